@@ -0,0 +1,198 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package admin provides an optional listener exposing the runtime state of the gateway over JSON
+package admin
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/starvn/turbo/config"
+	"github.com/starvn/turbo/discovery"
+	"github.com/starvn/turbo/log"
+	"github.com/starvn/turbo/proxy"
+	"github.com/starvn/turbo/route"
+	"github.com/starvn/turbo/toggle"
+	"github.com/starvn/turbo/transport/http/server"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+)
+
+const Namespace = "github.com/starvn/turbo/admin"
+
+const logPrefix = "[SERVICE: Admin]"
+
+var (
+	ErrNotConfigured = errors.New("admin: the listener is not configured")
+	errNoAuth        = errors.New("the admin listener requires a token or mTLS")
+	errNoKeys        = errors.New("the tls config requires a public_key and a private_key")
+	errCACertsNoMTLS = errors.New("ca_certs requires enable_mtls")
+)
+
+// Config is the service extra config of the namespace. The listener must be protected by a token,
+// sent as a bearer token in the Authorization header, by mTLS or by both
+type Config struct {
+	Address string     `json:"address"`
+	Port    int        `json:"port"`
+	Token   string     `json:"token"`
+	TLS     *TLSConfig `json:"tls"`
+}
+
+type TLSConfig struct {
+	PublicKey  string   `json:"public_key"`
+	PrivateKey string   `json:"private_key"`
+	MinVersion string   `json:"min_version"`
+	MaxVersion string   `json:"max_version"`
+	EnableMTLS bool     `json:"enable_mtls"`
+	CACerts    []string `json:"ca_certs"`
+}
+
+func (c Config) Validate() error {
+	if c.Port <= 0 || c.Port > 65535 {
+		return fmt.Errorf("invalid port %d", c.Port)
+	}
+	if c.Token == "" && (c.TLS == nil || !c.TLS.EnableMTLS) {
+		return errNoAuth
+	}
+	if c.TLS == nil {
+		return nil
+	}
+	if c.TLS.PublicKey == "" || c.TLS.PrivateKey == "" {
+		return errNoKeys
+	}
+	if len(c.TLS.CACerts) > 0 && !c.TLS.EnableMTLS {
+		return errCACertsNoMTLS
+	}
+	return nil
+}
+
+func init() {
+	config.RegisterExtraConfigType(Namespace, config.ServiceScope, Config{})
+}
+
+// GetConfig decodes the config of the listener from the service extra config
+func GetConfig(extra config.ExtraConfig) (Config, error) {
+	v, ok := extra[Namespace]
+	if !ok {
+		return Config{}, ErrNotConfigured
+	}
+	cfg := Config{}
+	if err := config.DecodeExtraConfig(v, &cfg); err != nil {
+		return Config{}, err
+	}
+	return cfg, cfg.Validate()
+}
+
+// Options completes the state exposed by the listener with the parts not held by the config
+type Options struct {
+	// SubscriberFactory returns the subscribers queried for the hosts of the backends. It defaults to
+	// discovery.GetSubscriber
+	SubscriberFactory discovery.SubscriberFactory
+	// Renders lists the renders registered in the router
+	Renders []string
+	// Toggles is the store of the disabled endpoints. It defaults to toggle.Default()
+	Toggles *toggle.Store
+	// Stacks describes the proxies built for the endpoints, usually the proxy factory of the router.
+	// Without it, the endpoints are listed without their stacks
+	Stacks proxy.StackDescriber
+	// Updates delivers the reloaded configs, usually the same updates consumed by the router. The state
+	// exposed by the API is rebuilt on every change, while the listener keeps the settings it started with
+	Updates <-chan config.Update
+	// Logger reports the failed reloads. It defaults to log.NoOp
+	Logger log.Logger
+}
+
+// Run starts the listener and blocks until the context is done
+func Run(ctx context.Context, cfg config.ServiceConfig, opts Options) error {
+	adminCfg, err := GetConfig(cfg.ExtraConfig)
+	if err != nil {
+		return err
+	}
+
+	handler := route.NewSwappableHandler(NewHandler(cfg, adminCfg.Token, opts))
+	if opts.Updates != nil {
+		logger := opts.Logger
+		if logger == nil {
+			logger = log.NoOp
+		}
+		go route.Reload(ctx, logger, logPrefix, cfg, opts.Updates, handler, func(cfg config.ServiceConfig) (http.Handler, error) {
+			return NewHandler(cfg, adminCfg.Token, opts), nil
+		})
+	}
+
+	s := &http.Server{
+		Addr:              net.JoinHostPort(adminCfg.Address, fmt.Sprintf("%d", adminCfg.Port)),
+		Handler:           handler,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	if adminCfg.TLS != nil {
+		if s.TLSConfig, err = parseTLSConfig(adminCfg.TLS); err != nil {
+			return err
+		}
+	}
+
+	ln, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		if s.TLSConfig == nil {
+			done <- s.Serve(ln)
+			return
+		}
+		done <- s.ServeTLS(ln, adminCfg.TLS.PublicKey, adminCfg.TLS.PrivateKey)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return s.Shutdown(context.Background())
+	}
+}
+
+func parseTLSConfig(cfg *TLSConfig) (*tls.Config, error) {
+	tlsConfig := server.ParseTLSConfig(&config.TLS{
+		PublicKey:  cfg.PublicKey,
+		PrivateKey: cfg.PrivateKey,
+		MinVersion: cfg.MinVersion,
+		MaxVersion: cfg.MaxVersion,
+		EnableMTLS: cfg.EnableMTLS,
+	})
+	if len(cfg.CACerts) == 0 {
+		return tlsConfig, nil
+	}
+	if tlsConfig.ClientCAs == nil {
+		tlsConfig.ClientCAs = x509.NewCertPool()
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	for _, path := range cfg.CACerts {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if !tlsConfig.ClientCAs.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificates found in %s", path)
+		}
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,269 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package admin
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"github.com/starvn/turbo/config"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	for i, tc := range []struct {
+		cfg Config
+		err bool
+	}{
+		{Config{Port: 8090, Token: "t"}, false},
+		{Config{Port: 8090, TLS: &TLSConfig{PublicKey: "a", PrivateKey: "b", EnableMTLS: true}}, false},
+		{Config{Port: 8090, Token: "t", TLS: &TLSConfig{PublicKey: "a", PrivateKey: "b"}}, false},
+		{Config{Port: 0, Token: "t"}, true},
+		{Config{Port: 70000, Token: "t"}, true},
+		{Config{Port: 8090}, true},
+		{Config{Port: 8090, TLS: &TLSConfig{PublicKey: "a", PrivateKey: "b"}}, true},
+		{Config{Port: 8090, TLS: &TLSConfig{PublicKey: "a", EnableMTLS: true}}, true},
+		{Config{Port: 8090, Token: "t", TLS: &TLSConfig{PublicKey: "a", PrivateKey: "b", CACerts: []string{"c"}}}, true},
+	} {
+		if err := tc.cfg.Validate(); (err != nil) != tc.err {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+		}
+	}
+}
+
+func TestGetConfig(t *testing.T) {
+	if _, err := GetConfig(config.ExtraConfig{}); err != ErrNotConfigured {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := GetConfig(config.ExtraConfig{Namespace: map[string]interface{}{"port": 8090, "unknown": true}}); err == nil {
+		t.Error("expecting an error")
+	}
+	cfg, err := GetConfig(config.ExtraConfig{Namespace: map[string]interface{}{"port": 8090, "token": "t"}})
+	if err != nil || cfg.Port != 8090 || cfg.Token != "t" {
+		t.Errorf("unexpected config: %+v %v", cfg, err)
+	}
+}
+
+func freePort(t *testing.T) int {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func runTestListener(t *testing.T, adminCfg map[string]interface{}) (int, context.CancelFunc, chan error) {
+	return runTestListenerWithOptions(t, adminCfg, Options{})
+}
+
+func runTestListenerWithOptions(t *testing.T, adminCfg map[string]interface{}, opts Options) (int, context.CancelFunc, chan error) {
+	port := freePort(t)
+	adminCfg["address"] = "127.0.0.1"
+	adminCfg["port"] = port
+	cfg := config.ServiceConfig{ExtraConfig: config.ExtraConfig{Namespace: adminCfg}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- Run(ctx, cfg, opts) }()
+
+	for i := 0; i < 50; i++ {
+		if c, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port)); err == nil {
+			c.Close()
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return port, cancel, done
+}
+
+func TestRun_token(t *testing.T) {
+	port, cancel, done := runTestListener(t, map[string]interface{}{"token": "s3cr3t"})
+
+	url := fmt.Sprintf("http://127.0.0.1:%d/plugins", port)
+	for _, tc := range []struct {
+		token  string
+		status int
+	}{
+		{"", http.StatusUnauthorized},
+		{"s3cr3t", http.StatusOK},
+	} {
+		req, _ := http.NewRequest("GET", url, nil)
+		if tc.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.status {
+			t.Errorf("unexpected status code: %d", resp.StatusCode)
+		}
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRun_reload(t *testing.T) {
+	updates := make(chan config.Update)
+	port, cancel, done := runTestListenerWithOptions(t, map[string]interface{}{"token": "s3cr3t"}, Options{Updates: updates})
+
+	endpoints := func() []map[string]interface{} {
+		req, _ := http.NewRequest("GET", fmt.Sprintf("http://127.0.0.1:%d/endpoints", port), nil)
+		req.Header.Set("Authorization", "Bearer s3cr3t")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var res []map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+	if res := endpoints(); len(res) != 0 {
+		t.Errorf("unexpected endpoints: %v", res)
+	}
+
+	reloaded := config.ServiceConfig{
+		Endpoints: []*config.EndpointConfig{{Method: "GET", Endpoint: "/users"}},
+		ExtraConfig: config.ExtraConfig{Namespace: map[string]interface{}{
+			"address": "127.0.0.1",
+			"port":    port,
+			"token":   "other",
+		}},
+	}
+	updates <- config.Update{Config: reloaded}
+	// the unbuffered channel is consumed again only once the first update has been applied
+	updates <- config.Update{Config: reloaded}
+
+	if res := endpoints(); len(res) != 1 || res[0]["endpoint"] != "/users" {
+		t.Errorf("unexpected endpoints: %v", res)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRun_mTLS(t *testing.T) {
+	certFile, keyFile := generateTestCert(t)
+	port, cancel, done := runTestListener(t, map[string]interface{}{
+		"tls": map[string]interface{}{
+			"public_key":  certFile,
+			"private_key": keyFile,
+			"enable_mtls": true,
+		},
+	})
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}()
+
+	certPEM, _ := ioutil.ReadFile(certFile)
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(certPEM)
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := fmt.Sprintf("https://127.0.0.1:%d/encodings", port)
+
+	anonymous := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	if resp, err := anonymous.Get(url); err == nil {
+		resp.Body.Close()
+		t.Errorf("the request without a client certificate was accepted: %d", resp.StatusCode)
+	}
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		RootCAs:      pool,
+		Certificates: []tls.Certificate{cert},
+	}}}
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+}
+
+func TestRun_notConfigured(t *testing.T) {
+	if err := Run(context.Background(), config.ServiceConfig{}, Options{}); err != ErrNotConfigured {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func generateTestCert(t *testing.T) (string, string) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{Organization: []string{"Acme Co"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
@@ -0,0 +1,422 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"github.com/starvn/turbo/config"
+	"github.com/starvn/turbo/discovery"
+	"github.com/starvn/turbo/encoding"
+	"github.com/starvn/turbo/proxy"
+	proxyplugin "github.com/starvn/turbo/proxy/plugin"
+	"github.com/starvn/turbo/toggle"
+	clientplugin "github.com/starvn/turbo/transport/http/client/plugin"
+	serverplugin "github.com/starvn/turbo/transport/http/server/plugin"
+	"net/http"
+	"strings"
+)
+
+const redactedValue = "********"
+
+// sensitiveKeys are the fragments of the extra_config keys holding credentials. Their values are
+// hidden by the config endpoint, unless they are references to secrets
+var sensitiveKeys = []string{"password", "passwd", "secret", "token", "private_key", "privatekey", "api_key", "apikey", "credential"}
+
+// NewHandler returns the handler of the admin API. The requests must carry the token as a bearer
+// token, unless it is empty
+func NewHandler(cfg config.ServiceConfig, token string, opts Options) http.Handler {
+	sf := opts.SubscriberFactory
+	if sf == nil {
+		sf = discovery.GetSubscriber
+	}
+	h := &handler{cfg: cfg, token: token, renders: opts.Renders, stacks: opts.Stacks, subscribers: make([][]discovery.Subscriber, len(cfg.Endpoints))}
+	for i, e := range cfg.Endpoints {
+		h.subscribers[i] = make([]discovery.Subscriber, len(e.Backend))
+		for j, b := range e.Backend {
+			h.subscribers[i][j] = sf(b)
+		}
+	}
+	if h.renders == nil {
+		h.renders = []string{}
+	}
+	if h.toggles = opts.Toggles; h.toggles == nil {
+		h.toggles = toggle.Default()
+	}
+	h.hash, h.redacted, h.err = redactConfig(cfg)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", h.index)
+	mux.HandleFunc("/config", h.config)
+	mux.HandleFunc("/endpoints", h.endpoints)
+	mux.HandleFunc("/discovery", h.discovery)
+	mux.HandleFunc("/plugins", h.plugins)
+	mux.HandleFunc("/encodings", h.encodings)
+	mux.HandleFunc("/toggles", h.listToggles)
+	mux.HandleFunc("/toggles/disable", h.disable)
+	mux.HandleFunc("/toggles/enable", h.enable)
+	return h.authenticate(mux)
+}
+
+type handler struct {
+	cfg         config.ServiceConfig
+	token       string
+	renders     []string
+	stacks      proxy.StackDescriber
+	subscribers [][]discovery.Subscriber
+	toggles     *toggle.Store
+	hash        string
+	redacted    config.ServiceConfig
+	err         error
+}
+
+type endpointState struct {
+	Method         string       `json:"method"`
+	Endpoint       string       `json:"endpoint"`
+	OutputEncoding string       `json:"output_encoding"`
+	Stack          *proxy.Stack `json:"stack,omitempty"`
+}
+
+type discoveryState struct {
+	Method     string   `json:"method"`
+	Endpoint   string   `json:"endpoint"`
+	Backend    int      `json:"backend"`
+	URLPattern string   `json:"url_pattern"`
+	SD         string   `json:"sd"`
+	Hosts      []string `json:"hosts"`
+	Error      string   `json:"error,omitempty"`
+}
+
+func (h *handler) authenticate(next http.Handler) http.Handler {
+	if h.token == "" {
+		return next
+	}
+	expected := []byte("Bearer " + h.token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (h *handler) index(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	h.get(w, r, func() (interface{}, error) {
+		return []string{"/config", "/endpoints", "/discovery", "/plugins", "/encodings", "/toggles"}, nil
+	})
+}
+
+func (h *handler) config(w http.ResponseWriter, r *http.Request) {
+	h.get(w, r, func() (interface{}, error) {
+		if h.err != nil {
+			return nil, h.err
+		}
+		return map[string]interface{}{"hash": h.hash, "config": h.redacted}, nil
+	})
+}
+
+func (h *handler) endpoints(w http.ResponseWriter, r *http.Request) {
+	h.get(w, r, func() (interface{}, error) {
+		res := make([]endpointState, len(h.cfg.Endpoints))
+		for i, e := range h.cfg.Endpoints {
+			res[i] = endpointState{
+				Method:         strings.ToUpper(e.Method),
+				Endpoint:       e.Endpoint,
+				OutputEncoding: e.OutputEncoding,
+			}
+			if h.stacks == nil {
+				continue
+			}
+			if s, ok := h.stacks.Stack(e.Method, e.Endpoint); ok {
+				res[i].Stack = &s
+			}
+		}
+		return res, nil
+	})
+}
+
+func (h *handler) discovery(w http.ResponseWriter, r *http.Request) {
+	h.get(w, r, func() (interface{}, error) {
+		res := []discoveryState{}
+		for i, e := range h.cfg.Endpoints {
+			for j, b := range e.Backend {
+				state := discoveryState{
+					Method:     strings.ToUpper(e.Method),
+					Endpoint:   e.Endpoint,
+					Backend:    j,
+					URLPattern: b.URLPattern,
+					SD:         b.SD,
+					Hosts:      []string{},
+				}
+				if state.SD == "" {
+					state.SD = "static"
+				}
+				hosts, err := h.subscribers[i][j].Hosts()
+				if err != nil {
+					state.Error = err.Error()
+				} else if hosts != nil {
+					state.Hosts = hosts
+				}
+				res = append(res, state)
+			}
+		}
+		return res, nil
+	})
+}
+
+func (h *handler) plugins(w http.ResponseWriter, r *http.Request) {
+	h.get(w, r, func() (interface{}, error) {
+		return map[string][]string{
+			"request_modifiers":  proxyplugin.RequestModifierNames(),
+			"response_modifiers": proxyplugin.ResponseModifierNames(),
+			"clients":            clientplugin.ClientNames(),
+			"handlers":           serverplugin.HandlerNames(),
+		}, nil
+	})
+}
+
+func (h *handler) encodings(w http.ResponseWriter, r *http.Request) {
+	h.get(w, r, func() (interface{}, error) {
+		return map[string][]string{
+			"decoders":           encoding.GetRegister().Names(),
+			"renders":            h.renders,
+			"response_combiners": proxy.NewRegister().ResponseCombinerNames(),
+		}, nil
+	})
+}
+
+// toggleRequest is the body of the requests disabling or enabling an endpoint. The method defaults to
+// GET and the endpoint must be one of the config, or toggle.AllEndpoints
+type toggleRequest struct {
+	Method   string          `json:"method"`
+	Endpoint string          `json:"endpoint"`
+	Reason   string          `json:"reason"`
+	User     string          `json:"user"`
+	Response toggle.Response `json:"response"`
+}
+
+func (h *handler) listToggles(w http.ResponseWriter, r *http.Request) {
+	h.get(w, r, func() (interface{}, error) {
+		return h.toggles.List(), nil
+	})
+}
+
+func (h *handler) disable(w http.ResponseWriter, r *http.Request) {
+	req, ok := h.decodeToggleRequest(w, r)
+	if !ok {
+		return
+	}
+	t, err := h.toggles.Disable(toggle.Toggle{
+		Method:     req.Method,
+		Endpoint:   req.Endpoint,
+		Response:   req.Response,
+		Reason:     req.Reason,
+		DisabledBy: actor(r, req.User),
+	}, r.RemoteAddr)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, t)
+}
+
+func (h *handler) enable(w http.ResponseWriter, r *http.Request) {
+	req, ok := h.decodeToggleRequest(w, r)
+	if !ok {
+		return
+	}
+	enabled, err := h.toggles.Enable(req.Method, req.Endpoint, actor(r, req.User), r.RemoteAddr)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !enabled {
+		writeError(w, http.StatusNotFound, "the endpoint is not disabled")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"method": req.Method, "endpoint": req.Endpoint})
+}
+
+func (h *handler) decodeToggleRequest(w http.ResponseWriter, r *http.Request) (toggleRequest, bool) {
+	req := toggleRequest{}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return req, false
+	}
+	d := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	d.DisallowUnknownFields()
+	if err := d.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return req, false
+	}
+	if err := req.Response.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return req, false
+	}
+	if req.Method = strings.ToUpper(req.Method); req.Method == "" {
+		req.Method = http.MethodGet
+	}
+	if req.Endpoint == toggle.AllEndpoints {
+		req.Method = toggle.AllEndpoints
+		return req, true
+	}
+	for _, e := range h.cfg.Endpoints {
+		if strings.EqualFold(e.Method, req.Method) && toggle.NormalizePath(e.Endpoint) == toggle.NormalizePath(req.Endpoint) {
+			return req, true
+		}
+	}
+	writeError(w, http.StatusNotFound, "unknown endpoint "+req.Method+" "+req.Endpoint)
+	return req, false
+}
+
+// actor identifies the author of a toggle by the common name of its client certificate, falling back to
+// the user declared in the request
+func actor(r *http.Request, user string) string {
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		if cn := r.TLS.PeerCertificates[0].Subject.CommonName; cn != "" {
+			return cn
+		}
+	}
+	return user
+}
+
+func (h *handler) get(w http.ResponseWriter, r *http.Request, f func() (interface{}, error)) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	v, err := f()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, v)
+}
+
+// redactConfig returns the hash of the config and a copy safe to expose. They are computed once per
+// handler, as a reloaded config gets a new handler
+func redactConfig(cfg config.ServiceConfig) (string, config.ServiceConfig, error) {
+	hash, err := cfg.Hash()
+	if err != nil {
+		return "", config.ServiceConfig{}, err
+	}
+	redacted, err := cfg.Redacted()
+	if err != nil {
+		return "", config.ServiceConfig{}, err
+	}
+
+	redacted.ExtraConfig = redactExtraConfig(redacted.ExtraConfig)
+	endpoints := make([]*config.EndpointConfig, len(redacted.Endpoints))
+	for i, e := range redacted.Endpoints {
+		endpoints[i] = redactEndpoint(e)
+	}
+	redacted.Endpoints = endpoints
+	if redacted.EndpointDefaults != nil {
+		redacted.EndpointDefaults = redactEndpoint(redacted.EndpointDefaults)
+	}
+	if redacted.BackendTemplates != nil {
+		templates := make(map[string]*config.Backend, len(redacted.BackendTemplates))
+		for name, t := range redacted.BackendTemplates {
+			templates[name] = redactBackend(t)
+		}
+		redacted.BackendTemplates = templates
+	}
+	return hash, redacted, nil
+}
+
+func redactEndpoint(e *config.EndpointConfig) *config.EndpointConfig {
+	res := *e
+	res.ExtraConfig = redactExtraConfig(e.ExtraConfig)
+	if e.Backend != nil {
+		res.Backend = make([]*config.Backend, len(e.Backend))
+		for i, b := range e.Backend {
+			res.Backend[i] = redactBackend(b)
+		}
+	}
+	return &res
+}
+
+func redactBackend(b *config.Backend) *config.Backend {
+	res := *b
+	res.ExtraConfig = redactExtraConfig(b.ExtraConfig)
+	return &res
+}
+
+// redactExtraConfig returns a copy of the extra config hiding the values of the sensitive keys. The
+// copy does not share any map or slice with the config in use
+func redactExtraConfig(extra config.ExtraConfig) config.ExtraConfig {
+	if extra == nil {
+		return nil
+	}
+	res := make(config.ExtraConfig, len(extra))
+	for ns, v := range extra {
+		res[ns] = redactValue(v, false)
+	}
+	return res
+}
+
+func redactValue(v interface{}, sensitive bool) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(t))
+		for k, v := range t {
+			res[k] = redactValue(v, sensitive || isSensitiveKey(k))
+		}
+		return res
+	case []interface{}:
+		res := make([]interface{}, len(t))
+		for i, v := range t {
+			res[i] = redactValue(v, sensitive)
+		}
+		return res
+	case string:
+		if sensitive && t != "" && !config.IsSecretReference(t) {
+			return redactedValue
+		}
+	}
+	return v
+}
+
+func isSensitiveKey(k string) bool {
+	k = strings.ToLower(k)
+	for _, s := range sensitiveKeys {
+		if strings.Contains(k, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
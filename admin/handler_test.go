@@ -0,0 +1,338 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/starvn/turbo/config"
+	"github.com/starvn/turbo/discovery"
+	"github.com/starvn/turbo/log"
+	"github.com/starvn/turbo/proxy"
+	"github.com/starvn/turbo/toggle"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestServiceConfig(t *testing.T, token string) config.ServiceConfig {
+	data := `{
+	"version": 2,
+	"port": 8080,
+	"extra_config": {"github.com/starvn/turbo/admin": {"port": 8090, "token": "` + token + `"}},
+	"endpoints": [
+		{
+			"endpoint": "/users/{id}",
+			"backend": [
+				{"host": ["http://users"], "url_pattern": "/users/{id}"},
+				{"host": ["http://orders"], "url_pattern": "/orders", "sd": "broken"}
+			]
+		}
+	]
+}`
+	name := filepath.Join(t.TempDir(), "turbo.json")
+	if err := ioutil.WriteFile(name, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.NewParser().Parse(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func testSubscriberFactory(b *config.Backend) discovery.Subscriber {
+	if b.SD == "broken" {
+		return discovery.SubscriberFunc(func() ([]string, error) { return nil, errors.New("no hosts") })
+	}
+	return discovery.FixedSubscriberFactory(b)
+}
+
+func doAdminRequest(t *testing.T, h http.Handler, method, path, token string, v interface{}) int {
+	req, _ := http.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("%s %s: unexpected content type %s", method, path, ct)
+	}
+	if v != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Errorf("%s %s: %s", method, path, err.Error())
+		}
+	}
+	return w.Code
+}
+
+func TestNewHandler(t *testing.T) {
+	cfg := newTestServiceConfig(t, "s3cr3t")
+	pf := proxy.NewDefaultFactory(func(_ *config.Backend) proxy.Proxy { return proxy.NoopProxy }, log.NoOp)
+	if _, err := pf.New(cfg.Endpoints[0]); err != nil {
+		t.Fatal(err)
+	}
+	h := NewHandler(cfg, "s3cr3t", Options{
+		SubscriberFactory: testSubscriberFactory,
+		Renders:           []string{"json"},
+		Stacks:            pf.(proxy.StackDescriber),
+	})
+
+	var index []string
+	if code := doAdminRequest(t, h, "GET", "/", "s3cr3t", &index); code != http.StatusOK || len(index) != 6 {
+		t.Errorf("unexpected index: %d %v", code, index)
+	}
+
+	var cfgState struct {
+		Hash   string                 `json:"hash"`
+		Config map[string]interface{} `json:"config"`
+	}
+	if code := doAdminRequest(t, h, "GET", "/config", "s3cr3t", &cfgState); code != http.StatusOK {
+		t.Errorf("unexpected status code: %d", code)
+	}
+	if expected, _ := cfg.Hash(); cfgState.Hash != expected {
+		t.Errorf("unexpected hash: %s", cfgState.Hash)
+	}
+	extra := cfgState.Config["ExtraConfig"].(map[string]interface{})[Namespace].(map[string]interface{})
+	if extra["token"] != redactedValue {
+		t.Errorf("the token was not redacted: %v", extra)
+	}
+
+	var endpoints []endpointState
+	if code := doAdminRequest(t, h, "GET", "/endpoints", "s3cr3t", &endpoints); code != http.StatusOK || len(endpoints) != 1 {
+		t.Errorf("unexpected endpoints: %d %v", code, endpoints)
+		return
+	}
+	if e := endpoints[0]; e.Method != "GET" || e.Endpoint != "/users/:id" || e.Stack == nil || len(e.Stack.Backends) != 2 ||
+		strings.Join(e.Stack.Middlewares, ",") != "merge:default" {
+		t.Errorf("unexpected endpoint: %+v", e)
+	}
+
+	var states []discoveryState
+	if code := doAdminRequest(t, h, "GET", "/discovery", "s3cr3t", &states); code != http.StatusOK || len(states) != 2 {
+		t.Errorf("unexpected discovery: %d %v", code, states)
+		return
+	}
+	if s := states[0]; s.SD != "static" || len(s.Hosts) != 1 || s.Hosts[0] != "http://users" || s.Error != "" {
+		t.Errorf("unexpected discovery state: %+v", s)
+	}
+	if s := states[1]; s.SD != "broken" || len(s.Hosts) != 0 || s.Error != "no hosts" || s.Backend != 1 {
+		t.Errorf("unexpected discovery state: %+v", s)
+	}
+
+	var plugins map[string][]string
+	if code := doAdminRequest(t, h, "GET", "/plugins", "s3cr3t", &plugins); code != http.StatusOK || len(plugins) != 4 {
+		t.Errorf("unexpected plugins: %d %v", code, plugins)
+	}
+
+	var encodings map[string][]string
+	if code := doAdminRequest(t, h, "GET", "/encodings", "s3cr3t", &encodings); code != http.StatusOK {
+		t.Errorf("unexpected status code: %d", code)
+	}
+	if len(encodings["decoders"]) == 0 || len(encodings["renders"]) != 1 || len(encodings["response_combiners"]) == 0 {
+		t.Errorf("unexpected encodings: %v", encodings)
+	}
+}
+
+func TestNewHandler_errors(t *testing.T) {
+	h := NewHandler(newTestServiceConfig(t, "s3cr3t"), "s3cr3t", Options{SubscriberFactory: testSubscriberFactory})
+	for _, tc := range []struct {
+		method, path, token string
+		status              int
+	}{
+		{"GET", "/config", "", http.StatusUnauthorized},
+		{"GET", "/config", "wrong", http.StatusUnauthorized},
+		{"POST", "/config", "s3cr3t", http.StatusMethodNotAllowed},
+		{"GET", "/unknown", "s3cr3t", http.StatusNotFound},
+	} {
+		var res map[string]string
+		if code := doAdminRequest(t, h, tc.method, tc.path, tc.token, &res); code != tc.status || res["error"] == "" {
+			t.Errorf("%s %s: unexpected response %d %v", tc.method, tc.path, code, res)
+		}
+	}
+}
+
+func TestNewHandler_secretToken(t *testing.T) {
+	os.Setenv("TURBO_ADMIN_TEST_TOKEN", "s3cr3t")
+	defer os.Unsetenv("TURBO_ADMIN_TEST_TOKEN")
+
+	cfg := newTestServiceConfig(t, "env://TURBO_ADMIN_TEST_TOKEN")
+	adminCfg, err := GetConfig(cfg.ExtraConfig)
+	if err != nil || adminCfg.Token != "s3cr3t" {
+		t.Errorf("unexpected config: %+v %v", adminCfg, err)
+		return
+	}
+
+	h := NewHandler(cfg, adminCfg.Token, Options{SubscriberFactory: testSubscriberFactory})
+	var cfgState struct {
+		Config map[string]interface{} `json:"config"`
+	}
+	if code := doAdminRequest(t, h, "GET", "/config", "s3cr3t", &cfgState); code != http.StatusOK {
+		t.Errorf("unexpected status code: %d", code)
+	}
+	extra := cfgState.Config["ExtraConfig"].(map[string]interface{})[Namespace].(map[string]interface{})
+	if extra["token"] != "env://TURBO_ADMIN_TEST_TOKEN" {
+		t.Errorf("unexpected token: %v", extra["token"])
+	}
+}
+
+func TestNewHandler_redactedCredentials(t *testing.T) {
+	os.Setenv("TURBO_ADMIN_TEST_PASSWORD", "s3cr3t-password")
+	defer os.Unsetenv("TURBO_ADMIN_TEST_PASSWORD")
+
+	data := `{
+	"version": 2,
+	"extra_config": {
+		"github.com/starvn/turbo/admin": {"port": 8090, "token": "s3cr3t"},
+		"github.com/starvn/turbo/cache": {"purge": {"token": "purge-token"}}
+	},
+	"endpoints": [
+		{
+			"endpoint": "/users",
+			"extra_config": {"github.com/starvn/turbo/proxy": {"cache": {"store": {"driver": "redis", "address": "redis:6379", "password": "redis-password"}}}},
+			"backend": [
+				{
+					"host": ["http://users"],
+					"url_pattern": "/users",
+					"extra_config": {"github.com/unknown": {"auth": {"client_secret": "client-secret", "user": "admin", "passwords": ["a", "env://TURBO_ADMIN_TEST_PASSWORD"]}}}
+				}
+			]
+		}
+	]
+}`
+	name := filepath.Join(t.TempDir(), "turbo.json")
+	if err := ioutil.WriteFile(name, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.NewParser().Parse(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ := http.NewRequest("GET", "/config", nil)
+	req.Header.Set("Authorization", "Bearer s3cr3t")
+	w := httptest.NewRecorder()
+	NewHandler(cfg, "s3cr3t", Options{SubscriberFactory: testSubscriberFactory}).ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("unexpected status code: %d", w.Code)
+	}
+
+	body := w.Body.String()
+	for _, secret := range []string{"s3cr3t", "purge-token", "redis-password", "client-secret", `"a"`} {
+		if strings.Contains(body, secret) {
+			t.Errorf("the config exposes %s: %s", secret, body)
+		}
+	}
+	for _, visible := range []string{`"user": "admin"`, `"address": "redis:6379"`, "env://TURBO_ADMIN_TEST_PASSWORD"} {
+		if !strings.Contains(body, visible) {
+			t.Errorf("the config should show %s: %s", visible, body)
+		}
+	}
+
+	store := cfg.Endpoints[0].ExtraConfig["github.com/starvn/turbo/proxy"].(map[string]interface{})["cache"].(map[string]interface{})["store"].(map[string]interface{})
+	if store["password"] != "redis-password" {
+		t.Errorf("the config in use should not be modified: %v", store)
+	}
+}
+
+func doToggleRequest(t *testing.T, h http.Handler, path, body string, v interface{}) int {
+	req, _ := http.NewRequest("POST", path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer s3cr3t")
+	req.RemoteAddr = "10.0.0.1:1234"
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if v != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Errorf("%s: %s", path, err.Error())
+		}
+	}
+	return w.Code
+}
+
+func TestNewHandler_toggles(t *testing.T) {
+	audit := new(bytes.Buffer)
+	store, _ := toggle.NewStore(toggle.Config{}, audit)
+	h := NewHandler(newTestServiceConfig(t, "s3cr3t"), "s3cr3t", Options{SubscriberFactory: testSubscriberFactory, Toggles: store})
+
+	var disabled toggle.Toggle
+	body := `{"endpoint": "/users/{id}", "reason": "incident", "user": "alice", "response": {"status": 503, "retry_after": "5m"}}`
+	if code := doToggleRequest(t, h, "/toggles/disable", body, &disabled); code != http.StatusOK {
+		t.Errorf("unexpected status code: %d", code)
+	}
+	if disabled.Method != "GET" || disabled.DisabledBy != "alice" || disabled.Response.RetryAfter != "5m" {
+		t.Errorf("unexpected toggle: %+v", disabled)
+	}
+	if _, ok := store.Lookup("GET", "/users/:id"); !ok {
+		t.Error("the endpoint was not disabled")
+	}
+
+	var toggles []toggle.Toggle
+	if code := doAdminRequest(t, h, "GET", "/toggles", "s3cr3t", &toggles); code != http.StatusOK || len(toggles) != 1 {
+		t.Errorf("unexpected toggles: %d %v", code, toggles)
+	}
+
+	if code := doToggleRequest(t, h, "/toggles/enable", `{"method": "get", "endpoint": "/users/:id", "user": "bob"}`, nil); code != http.StatusOK {
+		t.Errorf("unexpected status code: %d", code)
+	}
+	if _, ok := store.Lookup("GET", "/users/:id"); ok {
+		t.Error("the endpoint was not enabled")
+	}
+
+	trail := strings.Split(strings.TrimSpace(audit.String()), "\n")
+	if len(trail) != 2 || !strings.Contains(trail[0], `"actor":"alice"`) || !strings.Contains(trail[0], `"remote_addr":"10.0.0.1:1234"`) ||
+		!strings.Contains(trail[1], `"action":"enable"`) || !strings.Contains(trail[1], `"actor":"bob"`) {
+		t.Errorf("unexpected audit trail: %s", audit.String())
+	}
+}
+
+func TestNewHandler_togglesErrors(t *testing.T) {
+	store, _ := toggle.NewStore(toggle.Config{}, new(bytes.Buffer))
+	h := NewHandler(newTestServiceConfig(t, "s3cr3t"), "s3cr3t", Options{SubscriberFactory: testSubscriberFactory, Toggles: store})
+
+	for _, tc := range []struct {
+		path, body string
+		status     int
+	}{
+		{"/toggles/disable", `{"endpoint": "/unknown"}`, http.StatusNotFound},
+		{"/toggles/disable", `{"method": "POST", "endpoint": "/users/:id"}`, http.StatusNotFound},
+		{"/toggles/disable", `{"endpoint": "/users/:id", "response": {"status": 1}}`, http.StatusBadRequest},
+		{"/toggles/disable", `{"endpoint": "/users/:id", "unknown": true}`, http.StatusBadRequest},
+		{"/toggles/disable", `{`, http.StatusBadRequest},
+		{"/toggles/enable", `{"endpoint": "/users/:id"}`, http.StatusNotFound},
+	} {
+		var res map[string]string
+		if code := doToggleRequest(t, h, tc.path, tc.body, &res); code != tc.status || res["error"] == "" {
+			t.Errorf("%s %s: unexpected response %d %v", tc.path, tc.body, code, res)
+		}
+	}
+
+	if code := doAdminRequest(t, h, "GET", "/toggles/disable", "s3cr3t", nil); code != http.StatusMethodNotAllowed {
+		t.Errorf("unexpected status code: %d", code)
+	}
+
+	if code := doToggleRequest(t, h, "/toggles/disable", `{"endpoint": "*", "response": {"body": "maintenance"}}`, nil); code != http.StatusOK {
+		t.Errorf("unexpected status code: %d", code)
+	}
+	if tg, ok := store.Lookup("DELETE", "/anything"); !ok || tg.Response.Body != "maintenance" {
+		t.Errorf("unexpected toggle: %+v", tg)
+	}
+}
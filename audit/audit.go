@@ -0,0 +1,255 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package audit evaluates the service config against a set of security rules
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/starvn/turbo/config"
+	"github.com/starvn/turbo/register"
+	"io"
+	"sort"
+	"strings"
+)
+
+const Namespace = "github.com/starvn/turbo/audit"
+
+type Severity int
+
+const (
+	SeverityLow Severity = iota
+	SeverityMedium
+	SeverityHigh
+	SeverityCritical
+)
+
+var severityNames = []string{"low", "medium", "high", "critical"}
+
+func (s Severity) String() string {
+	if s < SeverityLow || s > SeverityCritical {
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+	return severityNames[s]
+}
+
+func (s Severity) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// ParseSeverity returns the severity with the name, case insensitive
+func ParseSeverity(name string) (Severity, error) {
+	for i, n := range severityNames {
+		if strings.EqualFold(n, name) {
+			return Severity(i), nil
+		}
+	}
+	return SeverityLow, fmt.Errorf("unknown severity %q", name)
+}
+
+// Rule is a check of the config. Its functions return the violations found in the checked part of the
+// config, and the ones not defined are skipped
+type Rule struct {
+	ID          string
+	Description string
+	Severity    Severity
+	Service     func(s *config.ServiceConfig) []Violation
+	Endpoint    func(e *config.EndpointConfig) []Violation
+	Backend     func(e *config.EndpointConfig, b *config.Backend) []Violation
+}
+
+// Violation is a broken rule. Field is the path of the offending value, relative to the checked part
+// of the config
+type Violation struct {
+	Field   string
+	Message string
+}
+
+var rules = register.NewUntyped()
+
+// RegisterRule adds the rule to the ones evaluated by Audit, replacing the rule with the same ID
+func RegisterRule(r Rule) {
+	rules.Register(r.ID, r)
+}
+
+// Rules returns the registered rules, sorted by their ID
+func Rules() []Rule {
+	registered := rules.Clone()
+	res := make([]Rule, 0, len(registered))
+	for _, v := range registered {
+		if r, ok := v.(Rule); ok {
+			res = append(res, r)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res
+}
+
+// Options tunes the evaluation of the rules
+type Options struct {
+	// Ignore lists the IDs of the rules to skip for the whole config
+	Ignore []string
+	// MinSeverity drops the findings with a lower severity
+	MinSeverity Severity
+}
+
+// extraConfig is the extra config of the namespace, at the service and endpoint levels, listing the
+// rules to silence
+type extraConfig struct {
+	Ignore []string `json:"ignore"`
+}
+
+func init() {
+	config.RegisterExtraConfigType(Namespace, config.ServiceScope|config.EndpointScope, extraConfig{})
+}
+
+// Finding is a broken rule, located by the path of the config where it was found
+type Finding struct {
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	Path     string   `json:"path"`
+	Endpoint string   `json:"endpoint,omitempty"`
+	Message  string   `json:"message"`
+}
+
+type Findings []Finding
+
+// Max returns the highest severity of the findings and false if there are none
+func (f Findings) Max() (Severity, bool) {
+	if len(f) == 0 {
+		return SeverityLow, false
+	}
+	max := f[0].Severity
+	for _, finding := range f[1:] {
+		if finding.Severity > max {
+			max = finding.Severity
+		}
+	}
+	return max, true
+}
+
+// WriteText writes a finding per line
+func (f Findings) WriteText(w io.Writer) error {
+	for _, finding := range f {
+		location := finding.Path
+		if finding.Endpoint != "" {
+			location += " (" + finding.Endpoint + ")"
+		}
+		if _, err := fmt.Fprintf(w, "%s: %s: %s: %s\n", strings.ToUpper(finding.Severity.String()), finding.Rule, location, finding.Message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteJSON writes the findings as a JSON array
+func (f Findings) WriteJSON(w io.Writer) error {
+	if f == nil {
+		f = Findings{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(f)
+}
+
+// Audit evaluates the registered rules against the config. The rules can be silenced with the options,
+// for the whole config with the service extra config of the namespace and for a single endpoint with
+// its own. The findings are sorted by decreasing severity
+func Audit(cfg config.ServiceConfig, opts Options) Findings {
+	ignored := toSet(opts.Ignore)
+	for id := range ignoredRules(cfg.ExtraConfig) {
+		ignored[id] = true
+	}
+
+	var findings Findings
+	add := func(r Rule, path, endpoint string, violations []Violation) {
+		if r.Severity < opts.MinSeverity {
+			return
+		}
+		for _, v := range violations {
+			findings = append(findings, Finding{
+				Rule:     r.ID,
+				Severity: r.Severity,
+				Path:     joinPath(path, v.Field),
+				Endpoint: endpoint,
+				Message:  v.Message,
+			})
+		}
+	}
+
+	registered := Rules()
+	for _, r := range registered {
+		if ignored[r.ID] || r.Service == nil {
+			continue
+		}
+		add(r, "", "", r.Service(&cfg))
+	}
+	for i, e := range cfg.Endpoints {
+		path := fmt.Sprintf("endpoints[%d]", i)
+		name := strings.ToUpper(e.Method) + " " + e.Endpoint
+		ignoredByEndpoint := ignoredRules(e.ExtraConfig)
+		for _, r := range registered {
+			if ignored[r.ID] || ignoredByEndpoint[r.ID] {
+				continue
+			}
+			if r.Endpoint != nil {
+				add(r, path, name, r.Endpoint(e))
+			}
+			if r.Backend == nil {
+				continue
+			}
+			for j, b := range e.Backend {
+				add(r, fmt.Sprintf("%s.backend[%d]", path, j), name, r.Backend(e, b))
+			}
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Severity > findings[j].Severity })
+	return findings
+}
+
+func ignoredRules(extra config.ExtraConfig) map[string]bool {
+	v, ok := extra[Namespace]
+	if !ok {
+		return map[string]bool{}
+	}
+	cfg := extraConfig{}
+	if err := config.DecodeExtraConfig(v, &cfg); err != nil {
+		return map[string]bool{}
+	}
+	return toSet(cfg.Ignore)
+}
+
+func joinPath(base, field string) string {
+	switch {
+	case base == "":
+		return field
+	case field == "":
+		return base
+	case strings.HasPrefix(field, "["):
+		return base + field
+	}
+	return base + "." + field
+}
+
+func toSet(values []string) map[string]bool {
+	res := make(map[string]bool, len(values))
+	for _, v := range values {
+		res[v] = true
+	}
+	return res
+}
@@ -0,0 +1,167 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/starvn/turbo/config"
+	"strings"
+	"testing"
+)
+
+func newTestConfig() config.ServiceConfig {
+	return config.ServiceConfig{
+		Debug: true,
+		TLS:   &config.TLS{MinVersion: "TLS11"},
+		Endpoints: []*config.EndpointConfig{
+			{
+				Endpoint:      "/users/:id",
+				Method:        "GET",
+				HeadersToPass: []string{"X-Id", "*"},
+				QueryString:   []string{"*"},
+				Backend: []*config.Backend{
+					{Host: []string{"https://users", "http://users-fallback"}},
+					{Host: []string{"http://localhost:8080", "http://127.0.0.1"}, HostSanitizationDisabled: true},
+				},
+			},
+			{
+				Endpoint: "/__internal",
+				Method:   "GET",
+				Backend:  []*config.Backend{{Host: []string{"https://internal"}, HostSanitizationDisabled: true}},
+			},
+		},
+	}
+}
+
+func TestAudit(t *testing.T) {
+	findings := Audit(newTestConfig(), Options{})
+	expected := []string{
+		"debug-enabled:debug",
+		"tls-min-version:tls.min_version",
+		"headers-wildcard:endpoints[0].headers_to_pass[1]",
+		"host-sanitize-disabled:endpoints[0].backend[1].disable_host_sanitize",
+		"plain-http-backend:endpoints[0].backend[0].host[1]",
+		"querystring-wildcard:endpoints[0].querystring_params[0]",
+	}
+	if len(findings) != len(expected) {
+		t.Errorf("unexpected findings: %v", findings)
+		return
+	}
+	for i, f := range findings {
+		if got := f.Rule + ":" + f.Path; got != expected[i] {
+			t.Errorf("#%d: unexpected finding %s", i, got)
+		}
+	}
+	if findings[2].Endpoint != "GET /users/:id" {
+		t.Errorf("unexpected endpoint: %s", findings[2].Endpoint)
+	}
+	if max, ok := findings.Max(); !ok || max != SeverityHigh {
+		t.Errorf("unexpected max severity: %v", max)
+	}
+}
+
+func TestAudit_ignore(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.ExtraConfig = config.ExtraConfig{Namespace: map[string]interface{}{"ignore": []interface{}{"debug-enabled"}}}
+	cfg.Endpoints[0].ExtraConfig = config.ExtraConfig{
+		Namespace: map[string]interface{}{"ignore": []interface{}{"headers-wildcard", "plain-http-backend"}},
+	}
+
+	findings := Audit(cfg, Options{Ignore: []string{"tls-min-version"}, MinSeverity: SeverityMedium})
+	if len(findings) != 2 {
+		t.Errorf("unexpected findings: %v", findings)
+		return
+	}
+	for _, f := range findings {
+		if f.Rule != "host-sanitize-disabled" && f.Rule != "querystring-wildcard" {
+			t.Errorf("unexpected finding: %v", f)
+		}
+	}
+
+	if findings := Audit(cfg, Options{MinSeverity: SeverityCritical}); len(findings) != 0 {
+		t.Errorf("unexpected findings: %v", findings)
+	}
+}
+
+func TestRegisterRule(t *testing.T) {
+	RegisterRule(Rule{
+		ID:       "test-no-timeout",
+		Severity: SeverityLow,
+		Endpoint: func(e *config.EndpointConfig) []Violation {
+			if e.Timeout > 0 {
+				return nil
+			}
+			return []Violation{{Field: "timeout", Message: "no timeout"}}
+		},
+	})
+	defer rules.Register("test-no-timeout", nil)
+
+	cfg := config.ServiceConfig{Endpoints: []*config.EndpointConfig{{Endpoint: "/a", Method: "GET"}}}
+	findings := Audit(cfg, Options{})
+	if len(findings) != 1 || findings[0].Rule != "test-no-timeout" || findings[0].Path != "endpoints[0].timeout" {
+		t.Errorf("unexpected findings: %v", findings)
+	}
+}
+
+func TestFindings_write(t *testing.T) {
+	findings := Findings{
+		{Rule: "debug-enabled", Severity: SeverityHigh, Path: "debug", Message: "debug"},
+		{Rule: "querystring-wildcard", Severity: SeverityMedium, Path: "endpoints[0].querystring_params[0]", Endpoint: "GET /a", Message: "qs"},
+	}
+
+	buf := new(bytes.Buffer)
+	if err := findings.WriteText(buf); err != nil {
+		t.Error(err)
+	}
+	expected := "HIGH: debug-enabled: debug: debug\nMEDIUM: querystring-wildcard: endpoints[0].querystring_params[0] (GET /a): qs\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected text output: %s", buf.String())
+	}
+
+	buf.Reset()
+	if err := findings.WriteJSON(buf); err != nil {
+		t.Error(err)
+	}
+	var res []map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &res); err != nil {
+		t.Error(err)
+		return
+	}
+	if len(res) != 2 || res[0]["severity"] != "high" || res[1]["endpoint"] != "GET /a" {
+		t.Errorf("unexpected json output: %s", buf.String())
+	}
+	if _, ok := res[0]["endpoint"]; ok {
+		t.Errorf("unexpected json output: %s", buf.String())
+	}
+
+	buf.Reset()
+	if err := Findings(nil).WriteJSON(buf); err != nil || strings.TrimSpace(buf.String()) != "[]" {
+		t.Errorf("unexpected json output: %s", buf.String())
+	}
+}
+
+func TestParseSeverity(t *testing.T) {
+	for _, s := range []Severity{SeverityLow, SeverityMedium, SeverityHigh, SeverityCritical} {
+		if res, err := ParseSeverity(strings.ToUpper(s.String())); err != nil || res != s {
+			t.Errorf("unexpected result for %s: %v %v", s, res, err)
+		}
+	}
+	if _, err := ParseSeverity("urgent"); err == nil {
+		t.Error("expecting an error")
+	}
+}
@@ -0,0 +1,134 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package audit
+
+import (
+	"fmt"
+	"github.com/starvn/turbo/config"
+	"net"
+	"net/url"
+	"strings"
+)
+
+func init() {
+	for _, r := range []Rule{
+		{
+			ID:          "headers-wildcard",
+			Description: "the endpoint forwards all the headers of the request to its backends",
+			Severity:    SeverityHigh,
+			Endpoint: func(e *config.EndpointConfig) []Violation {
+				return wildcards("headers_to_pass", e.HeadersToPass, "all the headers, credentials and cookies included, are forwarded to the backends")
+			},
+		},
+		{
+			ID:          "querystring-wildcard",
+			Description: "the endpoint forwards all the query string params of the request to its backends",
+			Severity:    SeverityMedium,
+			Endpoint: func(e *config.EndpointConfig) []Violation {
+				return wildcards("querystring_params", e.QueryString, "all the query string params are forwarded to the backends")
+			},
+		},
+		{
+			ID:          "tls-min-version",
+			Description: "the server accepts deprecated TLS versions",
+			Severity:    SeverityHigh,
+			Service: func(s *config.ServiceConfig) []Violation {
+				if s.TLS == nil || s.TLS.IsDisabled {
+					return nil
+				}
+				switch s.TLS.MinVersion {
+				case "TLS10", "TLS11":
+					return []Violation{{
+						Field:   "tls.min_version",
+						Message: fmt.Sprintf("%s is deprecated, use TLS12 or TLS13", s.TLS.MinVersion),
+					}}
+				}
+				return nil
+			},
+		},
+		{
+			ID:          "host-sanitize-disabled",
+			Description: "a public endpoint uses backend hosts without sanitizing them",
+			Severity:    SeverityMedium,
+			Backend: func(e *config.EndpointConfig, b *config.Backend) []Violation {
+				if !b.HostSanitizationDisabled || strings.HasPrefix(e.Endpoint, "/__") {
+					return nil
+				}
+				return []Violation{{Field: "disable_host_sanitize", Message: "the hosts of the backend are not sanitized"}}
+			},
+		},
+		{
+			ID:          "debug-enabled",
+			Description: "the debug mode is enabled",
+			Severity:    SeverityHigh,
+			Service: func(s *config.ServiceConfig) []Violation {
+				if !s.Debug {
+					return nil
+				}
+				return []Violation{{Field: "debug", Message: "the debug mode exposes the /__debug/ endpoint and verbose logs"}}
+			},
+		},
+		{
+			ID:          "plain-http-backend",
+			Description: "the backend is reached over plain HTTP",
+			Severity:    SeverityMedium,
+			Backend: func(_ *config.EndpointConfig, b *config.Backend) []Violation {
+				if b.SD != "" && b.SD != "static" {
+					return nil
+				}
+				var res []Violation
+				for i, h := range b.Host {
+					if isPlainHTTP(h) {
+						res = append(res, Violation{
+							Field:   fmt.Sprintf("host[%d]", i),
+							Message: fmt.Sprintf("%s is not using https", h),
+						})
+					}
+				}
+				return res
+			},
+		},
+	} {
+		RegisterRule(r)
+	}
+}
+
+func wildcards(field string, values []string, msg string) []Violation {
+	var res []Violation
+	for i, v := range values {
+		if v == "*" {
+			res = append(res, Violation{Field: fmt.Sprintf("%s[%d]", field, i), Message: msg})
+		}
+	}
+	return res
+}
+
+func isPlainHTTP(host string) bool {
+	if !strings.HasPrefix(strings.ToLower(host), "http://") {
+		return false
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		return true
+	}
+	hostname := u.Hostname()
+	if hostname == "localhost" {
+		return false
+	}
+	ip := net.ParseIP(hostname)
+	return ip == nil || !ip.IsLoopback()
+}
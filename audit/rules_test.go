@@ -0,0 +1,70 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package audit
+
+import (
+	"github.com/starvn/turbo/config"
+	"testing"
+)
+
+func TestIsPlainHTTP(t *testing.T) {
+	for _, tc := range []struct {
+		host     string
+		expected bool
+	}{
+		{"http://users", true},
+		{"HTTP://users:8080", true},
+		{"http://10.0.0.1", true},
+		{"https://users", false},
+		{"http://localhost:8080", false},
+		{"http://127.0.0.2", false},
+		{"http://[::1]:8080", false},
+	} {
+		if res := isPlainHTTP(tc.host); res != tc.expected {
+			t.Errorf("%s: unexpected result %v", tc.host, res)
+		}
+	}
+}
+
+func TestAudit_tlsMinVersion(t *testing.T) {
+	for _, tc := range []struct {
+		tls      *config.TLS
+		findings int
+	}{
+		{nil, 0},
+		{&config.TLS{}, 0},
+		{&config.TLS{MinVersion: "TLS12"}, 0},
+		{&config.TLS{MinVersion: "TLS10"}, 1},
+		{&config.TLS{MinVersion: "TLS11"}, 1},
+		{&config.TLS{MinVersion: "TLS10", IsDisabled: true}, 0},
+	} {
+		findings := Audit(config.ServiceConfig{TLS: tc.tls}, Options{})
+		if len(findings) != tc.findings {
+			t.Errorf("%v: unexpected findings %v", tc.tls, findings)
+		}
+	}
+}
+
+func TestAudit_plainHTTPBackendWithSD(t *testing.T) {
+	cfg := config.ServiceConfig{Endpoints: []*config.EndpointConfig{{
+		Endpoint: "/a",
+		Backend:  []*config.Backend{{Host: []string{"http://users.service.consul"}, SD: "dns"}},
+	}}}
+	if findings := Audit(cfg, Options{}); len(findings) != 0 {
+		t.Errorf("unexpected findings: %v", findings)
+	}
+}
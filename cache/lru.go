@@ -0,0 +1,164 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultMaxItems     = 1024
+	DefaultMaxEntrySize = 1 << 20
+)
+
+func NewLRU(maxItems, maxEntrySize int) *LRU {
+	if maxItems <= 0 {
+		maxItems = DefaultMaxItems
+	}
+	if maxEntrySize <= 0 {
+		maxEntrySize = DefaultMaxEntrySize
+	}
+	return &LRU{
+		maxItems:     maxItems,
+		maxEntrySize: maxEntrySize,
+		ll:           list.New(),
+		items:        map[string]*list.Element{},
+		mu:           &sync.Mutex{},
+		now:          time.Now,
+	}
+}
+
+type LRU struct {
+	maxItems     int
+	maxEntrySize int
+	ll           *list.List
+	items        map[string]*list.Element
+	mu           *sync.Mutex
+	now          func() time.Time
+}
+
+type lruEntry struct {
+	key        string
+	value      []byte
+	tags       []string
+	expiration time.Time
+}
+
+func (c *LRU) Get(_ context.Context, key string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.items[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	entry := e.Value.(*lruEntry)
+	if !entry.expiration.IsZero() && !c.now().Before(entry.expiration) {
+		c.removeElement(e)
+		return nil, ErrNotFound
+	}
+	c.ll.MoveToFront(e)
+	return entry.value, nil
+}
+
+func (c *LRU) Set(_ context.Context, key string, value []byte, ttl time.Duration, tags ...string) error {
+	if len(value) > c.maxEntrySize {
+		return ErrEntryTooLarge
+	}
+
+	var expiration time.Time
+	if ttl > 0 {
+		expiration = c.now().Add(ttl)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[key]; ok {
+		entry := e.Value.(*lruEntry)
+		entry.value = value
+		entry.tags = tags
+		entry.expiration = expiration
+		c.ll.MoveToFront(e)
+		return nil
+	}
+
+	c.items[key] = c.ll.PushFront(&lruEntry{key: key, value: value, tags: tags, expiration: expiration})
+	for c.ll.Len() > c.maxItems {
+		c.removeElement(c.ll.Back())
+	}
+	return nil
+}
+
+func (c *LRU) Delete(_ context.Context, key string) error {
+	c.mu.Lock()
+	if e, ok := c.items[key]; ok {
+		c.removeElement(e)
+	}
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *LRU) Purge(_ context.Context, pattern string) (int, error) {
+	return c.removeWhere(func(entry *lruEntry) bool { return Match(pattern, entry.key) }), nil
+}
+
+func (c *LRU) PurgeTags(_ context.Context, tags ...string) (int, error) {
+	set := make(map[string]struct{}, len(tags))
+	for _, t := range tags {
+		set[t] = struct{}{}
+	}
+	return c.removeWhere(func(entry *lruEntry) bool {
+		for _, t := range entry.tags {
+			if _, ok := set[t]; ok {
+				return true
+			}
+		}
+		return false
+	}), nil
+}
+
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	l := c.ll.Len()
+	c.mu.Unlock()
+	return l
+}
+
+func (c *LRU) removeWhere(f func(*lruEntry) bool) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := 0
+	for e := c.ll.Front(); e != nil; {
+		next := e.Next()
+		if f(e.Value.(*lruEntry)) {
+			c.removeElement(e)
+			removed++
+		}
+		e = next
+	}
+	return removed
+}
+
+func (c *LRU) removeElement(e *list.Element) {
+	c.ll.Remove(e)
+	delete(c.items, e.Value.(*lruEntry).key)
+}
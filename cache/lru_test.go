@@ -0,0 +1,123 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLRU_eviction(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRU(2, 10)
+
+	if err := c.Set(ctx, "a", []byte("1"), 0); err != nil {
+		t.Error(err)
+	}
+	if err := c.Set(ctx, "b", []byte("2"), 0); err != nil {
+		t.Error(err)
+	}
+	if _, err := c.Get(ctx, "a"); err != nil {
+		t.Error("a should be stored")
+	}
+	if err := c.Set(ctx, "c", []byte("3"), 0); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := c.Get(ctx, "b"); err != ErrNotFound {
+		t.Error("b should have been evicted")
+	}
+	if v, err := c.Get(ctx, "a"); err != nil || string(v) != "1" {
+		t.Errorf("unexpected value for a: %s", string(v))
+	}
+	if v, err := c.Get(ctx, "c"); err != nil || string(v) != "3" {
+		t.Errorf("unexpected value for c: %s", string(v))
+	}
+	if c.Len() != 2 {
+		t.Errorf("unexpected size: %d", c.Len())
+	}
+
+	_ = c.Delete(ctx, "a")
+	if _, err := c.Get(ctx, "a"); err != ErrNotFound {
+		t.Error("a should have been deleted")
+	}
+}
+
+func TestLRU_entryTooLarge(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRU(2, 4)
+	if err := c.Set(ctx, "a", []byte("12345"), 0); err != ErrEntryTooLarge {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if c.Len() != 0 {
+		t.Errorf("unexpected size: %d", c.Len())
+	}
+}
+
+func TestLRU_purge(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRU(10, 10)
+	for _, e := range []struct {
+		key  string
+		tags []string
+	}{
+		{"/products/:id|GET|Id=1||", []string{"product:1"}},
+		{"/products/:id|GET|Id=2||", []string{"product:2"}},
+		{"/products|GET|||", []string{"product:1", "product:2"}},
+		{"/users/:id|GET|Id=1||", nil},
+	} {
+		if err := c.Set(ctx, e.key, []byte("1"), 0, e.tags...); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if n, err := c.PurgeTags(ctx, "product:2"); err != nil || n != 2 {
+		t.Errorf("unexpected purge result: %d %v", n, err)
+	}
+	if n, err := c.Purge(ctx, "/products*"); err != nil || n != 1 {
+		t.Errorf("unexpected purge result: %d %v", n, err)
+	}
+	if _, err := c.Get(ctx, "/users/:id|GET|Id=1||"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if c.Len() != 1 {
+		t.Errorf("unexpected size: %d", c.Len())
+	}
+}
+
+func TestLRU_expiration(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRU(2, 10)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	if err := c.Set(ctx, "a", []byte("1"), time.Second); err != nil {
+		t.Error(err)
+	}
+	if _, err := c.Get(ctx, "a"); err != nil {
+		t.Error("a should be stored")
+	}
+
+	now = now.Add(time.Second)
+	if _, err := c.Get(ctx, "a"); err != ErrNotFound {
+		t.Error("a should have expired")
+	}
+	if c.Len() != 0 {
+		t.Errorf("unexpected size: %d", c.Len())
+	}
+}
@@ -0,0 +1,143 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cache
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/starvn/turbo/config"
+	"net/http"
+)
+
+const (
+	DefaultPurgePath = "/__cache/purge"
+	KeySeparator     = "|"
+
+	purgeKey = "purge"
+)
+
+func init() {
+	config.RegisterExtraConfigValidator(Namespace, config.ServiceScope, validateExtraConfig)
+}
+
+type extraConfig struct {
+	Purge interface{} `json:"purge"`
+}
+
+type purgeExtraConfig struct {
+	Path  string `json:"path"`
+	Token string `json:"token"`
+}
+
+var errPurgeWithoutToken = errors.New("purge: the purge endpoint requires a token")
+
+func validateExtraConfig(_ config.ExtraConfigScope, v interface{}) error {
+	cfg := extraConfig{}
+	if err := config.DecodeExtraConfig(v, &cfg); err != nil {
+		return err
+	}
+	switch p := cfg.Purge.(type) {
+	case nil:
+		return nil
+	case bool:
+		if p {
+			return errPurgeWithoutToken
+		}
+		return nil
+	}
+	purge := purgeExtraConfig{}
+	if err := config.DecodeExtraConfig(cfg.Purge, &purge); err != nil {
+		return fmt.Errorf("%s: %s", purgeKey, err.Error())
+	}
+	if purge.Token == "" {
+		return errPurgeWithoutToken
+	}
+	return nil
+}
+
+func EndpointPattern(endpointPattern string) string {
+	return endpointPattern + KeySeparator + "*"
+}
+
+// PurgeHandlerFromConfig returns the purge endpoint defined in the service config. It is not mounted
+// without a token, so the cache can not be purged by anonymous clients
+func PurgeHandlerFromConfig(extra config.ExtraConfig) (string, http.Handler, bool) {
+	v, ok := extra[Namespace].(map[string]interface{})
+	if !ok {
+		return "", nil, false
+	}
+	cfg, ok := v[purgeKey].(map[string]interface{})
+	if !ok {
+		return "", nil, false
+	}
+	token, _ := cfg["token"].(string)
+	if token == "" {
+		return "", nil, false
+	}
+	path := DefaultPurgePath
+	if p, ok := cfg["path"].(string); ok && p != "" {
+		path = p
+	}
+	return path, NewPurgeHandler(token, Stores), true
+}
+
+func NewPurgeHandler(token string, stores func() []Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+			w.Header().Set("Allow", "POST, DELETE")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		if token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		q := r.URL.Query()
+		endpoints, tags := q["endpoint"], q["tag"]
+		if len(endpoints) == 0 && len(tags) == 0 {
+			http.Error(w, "at least one endpoint or tag is required", http.StatusBadRequest)
+			return
+		}
+
+		purged := 0
+		for _, s := range stores() {
+			for _, e := range endpoints {
+				n, err := s.Purge(r.Context(), EndpointPattern(e))
+				purged += n
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+			}
+			if len(tags) == 0 {
+				continue
+			}
+			n, err := s.PurgeTags(r.Context(), tags...)
+			purged += n
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]int{"purged": purged})
+	})
+}
@@ -0,0 +1,113 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cache
+
+import (
+	"context"
+	"github.com/starvn/turbo/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewPurgeHandler(t *testing.T) {
+	ctx := context.Background()
+	s1, s2 := NewLRU(10, 10), NewLRU(10, 10)
+	_ = s1.Set(ctx, "/products/:id|GET|Id=1||", []byte("1"), 0, "product:1")
+	_ = s1.Set(ctx, "/users/:id|GET|Id=1||", []byte("1"), 0)
+	_ = s2.Set(ctx, "/products|GET|||", []byte("1"), 0, "product:1")
+	_ = s2.Set(ctx, "/categories|GET|||", []byte("1"), 0)
+
+	h := NewPurgeHandler("secret", func() []Store { return []Store{s1, s2} })
+
+	for i, tc := range []struct {
+		method string
+		url    string
+		token  string
+		status int
+		body   string
+	}{
+		{http.MethodGet, "/__cache/purge?tag=product:1", "secret", http.StatusMethodNotAllowed, ""},
+		{http.MethodPost, "/__cache/purge?tag=product:1", "", http.StatusUnauthorized, ""},
+		{http.MethodPost, "/__cache/purge", "secret", http.StatusBadRequest, ""},
+		{http.MethodPost, "/__cache/purge?tag=product:1", "secret", http.StatusOK, "{\"purged\":2}\n"},
+		{http.MethodDelete, "/__cache/purge?endpoint=/users/*&endpoint=/categories", "secret", http.StatusOK, "{\"purged\":2}\n"},
+	} {
+		req, _ := http.NewRequest(tc.method, tc.url, nil)
+		if tc.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		if w.Code != tc.status {
+			t.Errorf("#%d: unexpected status code: %d", i, w.Code)
+		}
+		if tc.body != "" && w.Body.String() != tc.body {
+			t.Errorf("#%d: unexpected body: %s", i, w.Body.String())
+		}
+	}
+
+	if s1.Len() != 0 || s2.Len() != 0 {
+		t.Errorf("unexpected sizes: %d %d", s1.Len(), s2.Len())
+	}
+}
+
+func TestPurgeHandlerFromConfig(t *testing.T) {
+	for i, tc := range []struct {
+		extra config.ExtraConfig
+		path  string
+		ok    bool
+	}{
+		{config.ExtraConfig{}, "", false},
+		{config.ExtraConfig{Namespace: map[string]interface{}{"purge": false}}, "", false},
+		{config.ExtraConfig{Namespace: map[string]interface{}{"purge": true}}, "", false},
+		{config.ExtraConfig{Namespace: map[string]interface{}{"purge": map[string]interface{}{"path": "/purge"}}}, "", false},
+		{config.ExtraConfig{Namespace: map[string]interface{}{"purge": map[string]interface{}{"token": "s3cr3t"}}}, DefaultPurgePath, true},
+		{config.ExtraConfig{Namespace: map[string]interface{}{"purge": map[string]interface{}{"path": "/purge", "token": "s3cr3t"}}}, "/purge", true},
+	} {
+		path, h, ok := PurgeHandlerFromConfig(tc.extra)
+		if ok != tc.ok || path != tc.path || (ok && h == nil) {
+			t.Errorf("#%d: unexpected result: %s %v", i, path, ok)
+		}
+	}
+}
+
+func TestValidateExtraConfig(t *testing.T) {
+	for i, tc := range []struct {
+		cfg map[string]interface{}
+		err string
+	}{
+		{map[string]interface{}{}, ""},
+		{map[string]interface{}{"purge": false}, ""},
+		{map[string]interface{}{"purge": map[string]interface{}{"path": "/purge", "token": "s3cr3t"}}, ""},
+		{map[string]interface{}{"purge": true}, "purge: the purge endpoint requires a token"},
+		{map[string]interface{}{"purge": map[string]interface{}{"path": "/purge"}}, "purge: the purge endpoint requires a token"},
+		{map[string]interface{}{"purge": map[string]interface{}{"tokn": "s3cr3t"}}, `purge: unknown field "tokn"`},
+	} {
+		err := validateExtraConfig(config.ServiceScope, tc.cfg)
+		if tc.err == "" {
+			if err != nil {
+				t.Errorf("#%d: unexpected error: %s", i, err.Error())
+			}
+			continue
+		}
+		if err == nil || err.Error() != tc.err {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+		}
+	}
+}
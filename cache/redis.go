@@ -0,0 +1,394 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultRedisPoolSize = 10
+	defaultRedisTimeout  = time.Second
+	redisScanCount       = "100"
+	redisTagPrefix       = "tag:"
+	redisNoKey           = -2
+)
+
+var (
+	ErrNoRedisAddress   = errors.New("cache: redis driver without address")
+	errRedisNil         = errors.New("cache: redis nil reply")
+	errRedisBadResponse = errors.New("cache: malformed redis reply")
+)
+
+type RedisError string
+
+func (r RedisError) Error() string {
+	return "cache: redis: " + string(r)
+}
+
+func NewRedisStore(cfg map[string]interface{}) (Store, error) {
+	address, ok := cfg["address"].(string)
+	if !ok || address == "" {
+		return nil, ErrNoRedisAddress
+	}
+	r := &Redis{
+		address:      address,
+		timeout:      defaultRedisTimeout,
+		maxEntrySize: DefaultMaxEntrySize,
+	}
+	if v, ok := cfg["password"].(string); ok {
+		r.password = v
+	}
+	if v, ok := cfg["db"].(float64); ok {
+		r.db = int(v)
+	}
+	if v, ok := cfg["prefix"].(string); ok {
+		r.prefix = v
+	}
+	if v, ok := cfg["max_entry_size"].(float64); ok && v > 0 {
+		r.maxEntrySize = int(v)
+	}
+	if v, ok := cfg["timeout"].(string); ok {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			r.timeout = d
+		}
+	}
+	poolSize := defaultRedisPoolSize
+	if v, ok := cfg["pool_size"].(float64); ok && v > 0 {
+		poolSize = int(v)
+	}
+	r.pool = make(chan *redisConn, poolSize)
+	return r, nil
+}
+
+type Redis struct {
+	address      string
+	password     string
+	db           int
+	prefix       string
+	timeout      time.Duration
+	maxEntrySize int
+	pool         chan *redisConn
+}
+
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, error) {
+	v, err := r.do(ctx, "GET", r.prefix+key)
+	if err == errRedisNil {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	b, ok := v.([]byte)
+	if !ok {
+		return nil, errRedisBadResponse
+	}
+	return b, nil
+}
+
+func (r *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration, tags ...string) error {
+	if len(value) > r.maxEntrySize {
+		return ErrEntryTooLarge
+	}
+	args := []string{"SET", r.prefix + key, string(value)}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	if _, err := r.do(ctx, args...); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if err := r.tag(ctx, r.tagKey(tag), r.prefix+key, ttl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tag adds the key to the set of the tag. The set expires with its longest lived member, so the sets
+// do not outlive the entries they point to
+func (r *Redis) tag(ctx context.Context, tagKey, key string, ttl time.Duration) error {
+	v, err := r.do(ctx, "PTTL", tagKey)
+	if err != nil {
+		return err
+	}
+	current, ok := v.(int64)
+	if !ok {
+		return errRedisBadResponse
+	}
+	if _, err := r.do(ctx, "SADD", tagKey, key); err != nil {
+		return err
+	}
+	switch {
+	case ttl <= 0:
+		_, err = r.do(ctx, "PERSIST", tagKey)
+	case current == redisNoKey || (current >= 0 && current < ttl.Milliseconds()):
+		_, err = r.do(ctx, "PEXPIRE", tagKey, strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	return err
+}
+
+func (r *Redis) Delete(ctx context.Context, key string) error {
+	_, err := r.do(ctx, "DEL", r.prefix+key)
+	return err
+}
+
+func (r *Redis) Purge(ctx context.Context, pattern string) (int, error) {
+	purged := 0
+	cursor := "0"
+	for {
+		v, err := r.do(ctx, "SCAN", cursor, "MATCH", r.prefix+pattern, "COUNT", redisScanCount)
+		if err != nil {
+			return purged, err
+		}
+		reply, ok := v.([]interface{})
+		if !ok || len(reply) != 2 {
+			return purged, errRedisBadResponse
+		}
+		next, ok := reply[0].([]byte)
+		if !ok {
+			return purged, errRedisBadResponse
+		}
+		keys, err := redisStrings(reply[1])
+		if err != nil {
+			return purged, err
+		}
+		n, err := r.del(ctx, keys)
+		purged += n
+		if err != nil {
+			return purged, err
+		}
+		cursor = string(next)
+		if cursor == "0" {
+			return purged, nil
+		}
+	}
+}
+
+func (r *Redis) PurgeTags(ctx context.Context, tags ...string) (int, error) {
+	purged := 0
+	for _, tag := range tags {
+		v, err := r.do(ctx, "SMEMBERS", r.tagKey(tag))
+		if err != nil {
+			return purged, err
+		}
+		keys, err := redisStrings(v)
+		if err != nil {
+			return purged, err
+		}
+		n, err := r.del(ctx, keys)
+		purged += n
+		if err != nil {
+			return purged, err
+		}
+		if _, err := r.do(ctx, "DEL", r.tagKey(tag)); err != nil {
+			return purged, err
+		}
+	}
+	return purged, nil
+}
+
+func (r *Redis) tagKey(tag string) string {
+	return r.prefix + redisTagPrefix + tag
+}
+
+func (r *Redis) del(ctx context.Context, keys []string) (int, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	v, err := r.do(ctx, append([]string{"DEL"}, keys...)...)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := v.(int64)
+	if !ok {
+		return 0, errRedisBadResponse
+	}
+	return int(n), nil
+}
+
+func (r *Redis) do(ctx context.Context, args ...string) (interface{}, error) {
+	c, err := r.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	v, err := c.do(ctx, r.timeout, args...)
+	if err != nil && err != errRedisNil {
+		if _, ok := err.(RedisError); !ok {
+			_ = c.Close()
+			return nil, err
+		}
+	}
+	r.release(c)
+	return v, err
+}
+
+func (r *Redis) conn(ctx context.Context) (*redisConn, error) {
+	select {
+	case c := <-r.pool:
+		return c, nil
+	default:
+	}
+
+	d := net.Dialer{Timeout: r.timeout}
+	nc, err := d.DialContext(ctx, "tcp", r.address)
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{Conn: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+	if r.password != "" {
+		if _, err := c.do(ctx, r.timeout, "AUTH", r.password); err != nil {
+			_ = c.Close()
+			return nil, err
+		}
+	}
+	if r.db != 0 {
+		if _, err := c.do(ctx, r.timeout, "SELECT", strconv.Itoa(r.db)); err != nil {
+			_ = c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (r *Redis) release(c *redisConn) {
+	select {
+	case r.pool <- c:
+	default:
+		_ = c.Close()
+	}
+}
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+func (c *redisConn) do(ctx context.Context, timeout time.Duration, args ...string) (interface{}, error) {
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := c.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	if err := writeRedisCommand(c.w, args); err != nil {
+		return nil, err
+	}
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+	return readRedisReply(c.r)
+}
+
+func writeRedisCommand(w *bufio.Writer, args []string) error {
+	if _, err := fmt.Fprintf(w, "*%d\r\n", len(args)); err != nil {
+		return err
+	}
+	for _, arg := range args {
+		if _, err := fmt.Fprintf(w, "$%d\r\n%s\r\n", len(arg), arg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readRedisReply(r *bufio.Reader) (interface{}, error) {
+	line, err := readRedisLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errRedisBadResponse
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, RedisError(line[1:])
+	case ':':
+		return strconv.ParseInt(string(line[1:]), 10, 64)
+	case '$':
+		n, err := strconv.Atoi(string(line[1:]))
+		if err != nil {
+			return nil, errRedisBadResponse
+		}
+		if n < 0 {
+			return nil, errRedisNil
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	case '*':
+		n, err := strconv.Atoi(string(line[1:]))
+		if err != nil {
+			return nil, errRedisBadResponse
+		}
+		if n < 0 {
+			return nil, errRedisNil
+		}
+		res := make([]interface{}, n)
+		for i := range res {
+			v, err := readRedisReply(r)
+			if err != nil && err != errRedisNil {
+				return nil, err
+			}
+			res[i] = v
+		}
+		return res, nil
+	default:
+		return nil, errRedisBadResponse
+	}
+}
+
+func readRedisLine(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, errRedisBadResponse
+	}
+	return line[:len(line)-2], nil
+}
+
+func redisStrings(v interface{}) ([]string, error) {
+	items, ok := v.([]interface{})
+	if !ok {
+		return nil, errRedisBadResponse
+	}
+	res := make([]string, 0, len(items))
+	for _, item := range items {
+		b, ok := item.([]byte)
+		if !ok {
+			return nil, errRedisBadResponse
+		}
+		res = append(res, string(b))
+	}
+	return res, nil
+}
@@ -0,0 +1,342 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cache
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRedis(t *testing.T) {
+	srv := newFakeRedis(t, "secret")
+	defer srv.Close()
+
+	s, err := NewStore("redis-test", map[string]interface{}{
+		"driver":   RedisDriver,
+		"address":  srv.Addr(),
+		"password": "secret",
+		"db":       2.0,
+		"prefix":   "turbo:",
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ctx := context.Background()
+
+	if _, err := s.Get(ctx, "missing"); err != ErrNotFound {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if err := s.Set(ctx, "/products/:id|GET|Id=1||", []byte("one"), time.Minute, "product:1"); err != nil {
+		t.Error(err)
+	}
+	if err := s.Set(ctx, "/products/:id|GET|Id=2||", []byte("two"), 0, "product:2"); err != nil {
+		t.Error(err)
+	}
+	if err := s.Set(ctx, "/users/:id|GET|Id=1||", []byte("user"), 0); err != nil {
+		t.Error(err)
+	}
+	if err := s.Set(ctx, "big", make([]byte, DefaultMaxEntrySize+1), 0); err != ErrEntryTooLarge {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if v, err := s.Get(ctx, "/products/:id|GET|Id=1||"); err != nil || string(v) != "one" {
+		t.Errorf("unexpected result: %s %v", string(v), err)
+	}
+	if ttl := srv.ttl("turbo:/products/:id|GET|Id=1||"); ttl != time.Minute {
+		t.Errorf("unexpected ttl: %v", ttl)
+	}
+	if db := srv.lastDB(); db != "2" {
+		t.Errorf("unexpected db: %s", db)
+	}
+
+	if n, err := s.PurgeTags(ctx, "product:1"); err != nil || n != 1 {
+		t.Errorf("unexpected purge result: %d %v", n, err)
+	}
+	if _, err := s.Get(ctx, "/products/:id|GET|Id=1||"); err != ErrNotFound {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if n, err := s.Purge(ctx, EndpointPattern("/products/*")); err != nil || n != 1 {
+		t.Errorf("unexpected purge result: %d %v", n, err)
+	}
+	if err := s.Delete(ctx, "/users/:id|GET|Id=1||"); err != nil {
+		t.Error(err)
+	}
+	if keys := srv.keys(); len(keys) != 1 || keys[0] != "turbo:tag:product:2" {
+		t.Errorf("unexpected keys: %v", keys)
+	}
+}
+
+func TestRedis_tagExpiration(t *testing.T) {
+	srv := newFakeRedis(t, "")
+	defer srv.Close()
+
+	s, err := NewRedisStore(map[string]interface{}{"address": srv.Addr()})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ctx := context.Background()
+
+	for i, tc := range []struct {
+		ttl      time.Duration
+		expected time.Duration
+	}{
+		{time.Minute, time.Minute},
+		{2 * time.Minute, 2 * time.Minute},
+		{30 * time.Second, 2 * time.Minute},
+		{0, 0},
+		{time.Minute, 0},
+	} {
+		if err := s.Set(ctx, fmt.Sprintf("key-%d", i), []byte("v"), tc.ttl, "tag"); err != nil {
+			t.Errorf("#%d: unexpected error: %s", i, err.Error())
+		}
+		if ttl := srv.ttl("tag:tag"); ttl != tc.expected {
+			t.Errorf("#%d: unexpected ttl of the tag: %v", i, ttl)
+		}
+	}
+}
+
+func TestRedis_auth(t *testing.T) {
+	srv := newFakeRedis(t, "secret")
+	defer srv.Close()
+
+	s, err := NewRedisStore(map[string]interface{}{"address": srv.Addr(), "password": "wrong"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := s.Get(context.Background(), "a"); err == nil || !strings.Contains(err.Error(), "WRONGPASS") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestNewRedisStore_noAddress(t *testing.T) {
+	if _, err := NewRedisStore(map[string]interface{}{}); err != ErrNoRedisAddress {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+type fakeRedis struct {
+	net.Listener
+	t        *testing.T
+	password string
+	mu       *sync.Mutex
+	data     map[string]string
+	ttls     map[string]time.Duration
+	sets     map[string]map[string]struct{}
+	db       string
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{
+		Listener: l,
+		t:        t,
+		password: password,
+		mu:       &sync.Mutex{},
+		data:     map[string]string{},
+		ttls:     map[string]time.Duration{},
+		sets:     map[string]map[string]struct{}{},
+	}
+	go f.serve()
+	return f
+}
+
+func (f *fakeRedis) Addr() string { return f.Listener.Addr().String() }
+
+func (f *fakeRedis) ttl(key string) time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.ttls[key]
+}
+
+func (f *fakeRedis) lastDB() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.db
+}
+
+func (f *fakeRedis) keys() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var keys []string
+	for k := range f.data {
+		keys = append(keys, k)
+	}
+	for k := range f.sets {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (f *fakeRedis) serve() {
+	for {
+		c, err := f.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(c)
+	}
+}
+
+func (f *fakeRedis) handle(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	authenticated := f.password == ""
+	for {
+		args, err := readFakeRedisCommand(r)
+		if err != nil {
+			if err != io.EOF {
+				f.t.Log(err)
+			}
+			return
+		}
+		cmd := strings.ToUpper(args[0])
+		if cmd == "AUTH" {
+			if args[1] != f.password {
+				fmt.Fprint(c, "-WRONGPASS invalid password\r\n")
+				continue
+			}
+			authenticated = true
+			fmt.Fprint(c, "+OK\r\n")
+			continue
+		}
+		if !authenticated {
+			fmt.Fprint(c, "-NOAUTH Authentication required.\r\n")
+			continue
+		}
+		fmt.Fprint(c, f.exec(cmd, args[1:]))
+	}
+}
+
+func (f *fakeRedis) exec(cmd string, args []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch cmd {
+	case "SELECT":
+		f.db = args[0]
+		return "+OK\r\n"
+	case "GET":
+		v, ok := f.data[args[0]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+	case "SET":
+		f.data[args[0]] = args[1]
+		if len(args) == 4 && strings.ToUpper(args[2]) == "PX" {
+			ms, _ := strconv.Atoi(args[3])
+			f.ttls[args[0]] = time.Duration(ms) * time.Millisecond
+		}
+		return "+OK\r\n"
+	case "DEL":
+		n := 0
+		for _, k := range args {
+			if _, ok := f.data[k]; ok {
+				delete(f.data, k)
+				n++
+			}
+			if _, ok := f.sets[k]; ok {
+				delete(f.sets, k)
+				n++
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", n)
+	case "SADD":
+		set, ok := f.sets[args[0]]
+		if !ok {
+			set = map[string]struct{}{}
+			f.sets[args[0]] = set
+		}
+		for _, m := range args[1:] {
+			set[m] = struct{}{}
+		}
+		return fmt.Sprintf(":%d\r\n", len(args)-1)
+	case "SMEMBERS":
+		var members []string
+		for m := range f.sets[args[0]] {
+			members = append(members, m)
+		}
+		return encodeFakeRedisArray(members)
+	case "PTTL":
+		_, isData := f.data[args[0]]
+		_, isSet := f.sets[args[0]]
+		if !isData && !isSet {
+			return ":-2\r\n"
+		}
+		ttl, ok := f.ttls[args[0]]
+		if !ok {
+			return ":-1\r\n"
+		}
+		return fmt.Sprintf(":%d\r\n", ttl.Milliseconds())
+	case "PEXPIRE":
+		ms, _ := strconv.Atoi(args[1])
+		f.ttls[args[0]] = time.Duration(ms) * time.Millisecond
+		return ":1\r\n"
+	case "PERSIST":
+		delete(f.ttls, args[0])
+		return ":1\r\n"
+	case "SCAN":
+		var keys []string
+		for k := range f.data {
+			if Match(args[2], k) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		return "*2\r\n$1\r\n0\r\n" + encodeFakeRedisArray(keys)
+	default:
+		return "-ERR unknown command '" + cmd + "'\r\n"
+	}
+}
+
+func readFakeRedisCommand(r *bufio.Reader) ([]string, error) {
+	v, err := readRedisReply(r)
+	if err != nil {
+		return nil, err
+	}
+	items, ok := v.([]interface{})
+	if !ok || len(items) == 0 {
+		return nil, errRedisBadResponse
+	}
+	return redisStrings(items)
+}
+
+func encodeFakeRedisArray(items []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(items))
+	for _, item := range items {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(item), item)
+	}
+	return b.String()
+}
@@ -0,0 +1,200 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/starvn/turbo/register"
+	"time"
+)
+
+const (
+	Namespace = "github.com/starvn/turbo/cache"
+
+	MemoryDriver  = "memory"
+	RedisDriver   = "redis"
+	DefaultDriver = MemoryDriver
+
+	driversNamespace = Namespace + "/drivers"
+	storesNamespace  = Namespace + "/stores"
+)
+
+var (
+	ErrNotFound       = errors.New("cache: entry not found")
+	ErrEntryTooLarge  = errors.New("cache: entry too large")
+	ErrUnknownDriver  = errors.New("cache: unknown driver")
+	errInvalidFactory = errors.New("cache: invalid store factory")
+)
+
+type Store interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration, tags ...string) error
+	Delete(ctx context.Context, key string) error
+	Purge(ctx context.Context, pattern string) (int, error)
+	PurgeTags(ctx context.Context, tags ...string) (int, error)
+}
+
+type StoreFactory func(cfg map[string]interface{}) (Store, error)
+
+func RegisterStoreFactory(driver string, sf StoreFactory) {
+	stores.Register(driversNamespace, driver, sf)
+}
+
+func NewStore(name string, cfg map[string]interface{}) (Store, error) {
+	driver, ok := cfg["driver"].(string)
+	if !ok || driver == "" {
+		driver = DefaultDriver
+	}
+	r, ok := stores.Get(driversNamespace)
+	if !ok {
+		return nil, ErrUnknownDriver
+	}
+	v, ok := r.Get(driver)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownDriver, driver)
+	}
+	sf, ok := v.(StoreFactory)
+	if !ok {
+		return nil, errInvalidFactory
+	}
+	s, err := sf(cfg)
+	if err != nil {
+		return nil, err
+	}
+	stores.Register(storesNamespace, name, s)
+	return s, nil
+}
+
+func Stores() []Store {
+	r, ok := stores.Get(storesNamespace)
+	if !ok {
+		return []Store{}
+	}
+	all := r.Clone()
+	res := make([]Store, 0, len(all))
+	for _, v := range all {
+		if s, ok := v.(Store); ok {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+func NewMemoryStore(cfg map[string]interface{}) (Store, error) {
+	maxItems, maxEntrySize := 0, 0
+	if n, ok := cfg["max_items"].(float64); ok {
+		maxItems = int(n)
+	}
+	if n, ok := cfg["max_entry_size"].(float64); ok {
+		maxEntrySize = int(n)
+	}
+	return NewLRU(maxItems, maxEntrySize), nil
+}
+
+var stores = initStoreRegister()
+
+func initStoreRegister() *register.Namespaced {
+	r := register.New()
+	r.AddNamespace(storesNamespace)
+	r.Register(driversNamespace, MemoryDriver, StoreFactory(NewMemoryStore))
+	r.Register(driversNamespace, RedisDriver, StoreFactory(NewRedisStore))
+	return r
+}
+
+func Match(pattern, key string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(key); i++ {
+				if Match(pattern[1:], key[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(key) == 0 {
+				return false
+			}
+			key = key[1:]
+			pattern = pattern[1:]
+		case '[':
+			if len(key) == 0 {
+				return false
+			}
+			end := 1
+			for end < len(pattern) && pattern[end] != ']' {
+				if pattern[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(pattern) {
+				return pattern == key
+			}
+			if !matchClass(pattern[1:end], key[0]) {
+				return false
+			}
+			key = key[1:]
+			pattern = pattern[end+1:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(key) == 0 || key[0] != pattern[0] {
+				return false
+			}
+			key = key[1:]
+			pattern = pattern[1:]
+		}
+	}
+	return len(key) == 0
+}
+
+func matchClass(class string, c byte) bool {
+	negate := len(class) > 0 && class[0] == '^'
+	if negate {
+		class = class[1:]
+	}
+	match := false
+	for i := 0; i < len(class); i++ {
+		switch {
+		case class[i] == '\\' && i+1 < len(class):
+			i++
+			match = match || class[i] == c
+		case i+2 < len(class) && class[i+1] == '-':
+			lo, hi := class[i], class[i+2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			match = match || (c >= lo && c <= hi)
+			i += 2
+		default:
+			match = match || class[i] == c
+		}
+	}
+	return match != negate
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cache
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNewStore(t *testing.T) {
+	s, err := NewStore("store-test", map[string]interface{}{"max_items": 2.0})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	lru, ok := s.(*LRU)
+	if !ok {
+		t.Errorf("unexpected store: %T", s)
+		return
+	}
+	if lru.maxItems != 2 {
+		t.Errorf("unexpected max items: %d", lru.maxItems)
+	}
+
+	found := false
+	for _, registered := range Stores() {
+		if registered == s {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("the store has not been registered")
+	}
+}
+
+func TestNewStore_unknownDriver(t *testing.T) {
+	if _, err := NewStore("unknown-test", map[string]interface{}{"driver": "unknown"}); !errors.Is(err, ErrUnknownDriver) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRegisterStoreFactory(t *testing.T) {
+	expected := NewLRU(1, 1)
+	RegisterStoreFactory("custom", func(_ map[string]interface{}) (Store, error) { return expected, nil })
+
+	s, err := NewStore("custom-test", map[string]interface{}{"driver": "custom"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if s != expected {
+		t.Error("unexpected store")
+	}
+}
+
+func TestMatch(t *testing.T) {
+	for _, tc := range []struct {
+		pattern string
+		key     string
+		match   bool
+	}{
+		{"*", "", true},
+		{"*", "/a/b|GET", true},
+		{"/a/*|*", "/a/:id|GET|Id=1||", true},
+		{"/a/*|*", "/b/:id|GET|Id=1||", false},
+		{"/a/:id|*", "/a/:id|GET|", true},
+		{"/a/:id|*", "/a/:id/b|GET|", false},
+		{"/a/?", "/a/b", true},
+		{"/a/?", "/a/bc", false},
+		{"/a/[bc]", "/a/c", true},
+		{"/a/[^bc]", "/a/c", false},
+		{"/a/[a-c]", "/a/b", true},
+		{"/a/[a-c]", "/a/d", false},
+		{`/a/\*`, "/a/*", true},
+		{`/a/\*`, "/a/b", false},
+		{"/a/[b", "/a/[b", true},
+	} {
+		if res := Match(tc.pattern, tc.key); res != tc.match {
+			t.Errorf("unexpected result matching %s against %s: %v", tc.key, tc.pattern, res)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/starvn/turbo/audit"
+	"io"
+	"strings"
+)
+
+func runAudit(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("audit", flag.ContinueOnError)
+	configFile := flags.String("c", "turbo.json", "path to the config file")
+	routerName := flags.String("r", "gin", "router engine: "+strings.Join(routerEngineNames(), ", "))
+	format := flags.String("f", "text", "output format: text, json")
+	minSeverity := flags.String("min-severity", "low", "lowest severity to report: low, medium, high, critical")
+	ignore := flags.String("ignore", "", "comma separated list of rules to skip")
+	failOn := flags.String("fail", "high", "lowest severity making the command fail: low, medium, high, critical or none")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	engine, err := getRouterEngine(*routerName)
+	if err != nil {
+		return err
+	}
+	opts := audit.Options{}
+	if opts.MinSeverity, err = audit.ParseSeverity(*minSeverity); err != nil {
+		return err
+	}
+	failSeverity := audit.SeverityCritical + 1
+	if *failOn != "none" {
+		if failSeverity, err = audit.ParseSeverity(*failOn); err != nil {
+			return err
+		}
+	}
+	for _, id := range strings.Split(*ignore, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			opts.Ignore = append(opts.Ignore, id)
+		}
+	}
+
+	cfg, err := loadConfig(*configFile, engine)
+	if err != nil {
+		return err
+	}
+	findings := audit.Audit(cfg, opts)
+
+	switch *format {
+	case "text":
+		err = findings.WriteText(stdout)
+	case "json":
+		err = findings.WriteJSON(stdout)
+	default:
+		return fmt.Errorf("unknown output format %q", *format)
+	}
+	if err != nil {
+		return err
+	}
+
+	if max, ok := findings.Max(); ok && max >= failSeverity {
+		return fmt.Errorf("'%s': %d findings, up to %s severity", *configFile, len(findings), max)
+	}
+	return nil
+}
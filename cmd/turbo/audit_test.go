@@ -0,0 +1,104 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const auditTestConfig = `{
+	"version": 2,
+	"debug": true,
+	"endpoints": [
+		{
+			"endpoint": "/users/{id}",
+			"headers_to_pass": ["*"],
+			"backend": [{"host": ["https://users"], "url_pattern": "/users/{id}"}]
+		},
+		{
+			"endpoint": "/orders",
+			"querystring_params": ["*"],
+			"extra_config": {"github.com/starvn/turbo/audit": {"ignore": ["plain-http-backend"]}},
+			"backend": [{"host": ["http://orders"], "url_pattern": "/orders"}]
+		}
+	]
+}`
+
+func TestRun_audit(t *testing.T) {
+	configFile := writeTestConfig(t, auditTestConfig)
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	if code := run([]string{"audit", "-c", configFile}, stdout, stderr); code != 1 {
+		t.Errorf("unexpected exit code: %d", code)
+	}
+	out := stdout.String()
+	for _, expected := range []string{
+		"HIGH: debug-enabled: debug:",
+		"HIGH: headers-wildcard: endpoints[0].headers_to_pass[0] (GET /users/:id):",
+		"MEDIUM: querystring-wildcard: endpoints[1].querystring_params[0] (GET /orders):",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("%q not found in the output: %s", expected, out)
+		}
+	}
+	if strings.Contains(out, "plain-http-backend") {
+		t.Errorf("the ignored rule was reported: %s", out)
+	}
+	if !strings.Contains(stderr.String(), "3 findings, up to high severity") {
+		t.Errorf("unexpected error: %s", stderr.String())
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	args := []string{"audit", "-c", configFile, "-f", "json", "-ignore", "debug-enabled, headers-wildcard", "-fail", "high"}
+	if code := run(args, stdout, stderr); code != 0 {
+		t.Errorf("unexpected exit code: %d. %s", code, stderr.String())
+	}
+	var findings []map[string]interface{}
+	if err := json.Unmarshal(stdout.Bytes(), &findings); err != nil {
+		t.Error(err)
+		return
+	}
+	if len(findings) != 1 || findings[0]["rule"] != "querystring-wildcard" || findings[0]["severity"] != "medium" {
+		t.Errorf("unexpected findings: %s", stdout.String())
+	}
+
+	stdout.Reset()
+	if code := run([]string{"audit", "-c", configFile, "-min-severity", "critical", "-fail", "low"}, stdout, stderr); code != 0 {
+		t.Errorf("unexpected exit code: %d. %s", code, stderr.String())
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("unexpected output: %s", stdout.String())
+	}
+}
+
+func TestRun_auditErrors(t *testing.T) {
+	configFile := writeTestConfig(t, auditTestConfig)
+	for _, args := range [][]string{
+		{"-f", "xml"},
+		{"-min-severity", "urgent"},
+		{"-fail", "urgent"},
+		{"-r", "unknown"},
+	} {
+		stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+		if code := run(append([]string{"audit", "-c", configFile}, args...), stdout, stderr); code != 1 {
+			t.Errorf("%v: unexpected exit code: %d", args, code)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/starvn/turbo/config"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+func runCheck(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("check", flag.ContinueOnError)
+	configFile := flags.String("c", "turbo.json", "path to the config file")
+	routerName := flags.String("r", "gin", "router engine: "+strings.Join(routerEngineNames(), ", "))
+	strict := flags.Bool("strict", false, "report the unknown extra_config namespaces as errors")
+	printConfig := flags.Bool("print", false, "print the normalized config, with the secrets redacted")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	engine, err := getRouterEngine(*routerName)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(*configFile)
+	if err != nil {
+		return config.CheckErr(err, *configFile)
+	}
+
+	config.StrictExtraConfigNamespaces = *strict
+	issues, err := config.Validate(*configFile, data)
+	if err != nil {
+		return err
+	}
+	for _, issue := range issues {
+		fmt.Fprintln(stdout, issue.String())
+	}
+	if issues.HasErrors() {
+		return fmt.Errorf("'%s': the config is not valid", *configFile)
+	}
+
+	cfg, err := loadConfig(*configFile, engine)
+	if err != nil {
+		return err
+	}
+	if *printConfig {
+		redacted, err := cfg.Redacted()
+		if err != nil {
+			return err
+		}
+		b, err := json.MarshalIndent(redacted, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, string(b))
+	}
+	fmt.Fprintln(stdout, "Syntax OK!")
+	return nil
+}
@@ -0,0 +1,78 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRun_check(t *testing.T) {
+	os.Setenv("TURBO_CHECK_TEST_TOKEN", "s3cr3t")
+	defer os.Unsetenv("TURBO_CHECK_TEST_TOKEN")
+
+	configFile := writeTestConfig(t, `{
+	"version": 2,
+	"name": "env://TURBO_CHECK_TEST_TOKEN",
+	"endpoints": [
+		{"endpoint": "/users/{id}", "backend": [{"host": ["http://users"], "url_pattern": "/users/{id}"}]}
+	]
+}`)
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	if code := run([]string{"check", "-c", configFile, "-print"}, stdout, stderr); code != 0 {
+		t.Errorf("unexpected exit code: %d. %s", code, stderr.String())
+	}
+	out := stdout.String()
+	if !strings.HasSuffix(out, "Syntax OK!\n") || !strings.Contains(out, "env://TURBO_CHECK_TEST_TOKEN") {
+		t.Errorf("unexpected output: %s", out)
+	}
+	if strings.Contains(out, "s3cr3t") {
+		t.Errorf("the secret was not redacted: %s", out)
+	}
+}
+
+func TestRun_checkErrors(t *testing.T) {
+	configFile := writeTestConfig(t, `{
+	"version": 2,
+	"timeout": 3,
+	"endpoints": [
+		{"endpoint": "/users/{id}", "backend": [{"url_pattern": "/users/{name}"}]}
+	]
+}`)
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	if code := run([]string{"check", "-c", configFile}, stdout, stderr); code != 1 {
+		t.Errorf("unexpected exit code: %d", code)
+	}
+	if out := stdout.String(); !strings.Contains(out, "error: timeout: expected a duration string, got a number") ||
+		!strings.Contains(out, "error: endpoints[0].backend[0].url_pattern") {
+		t.Errorf("unexpected output: %s", out)
+	}
+	if !strings.Contains(stderr.String(), "the config is not valid") {
+		t.Errorf("unexpected error: %s", stderr.String())
+	}
+
+	configFile = writeTestConfig(t, `{"version": 2, "extra_config": {"github.com/unknown": {}}, "endpoints": []}`)
+	stdout.Reset()
+	if code := run([]string{"check", "-c", configFile}, stdout, stderr); code != 0 {
+		t.Errorf("unexpected exit code: %d. %s", code, stdout.String())
+	}
+	if code := run([]string{"check", "-c", configFile, "-strict"}, stdout, stderr); code != 1 {
+		t.Errorf("unexpected exit code: %d. %s", code, stdout.String())
+	}
+}
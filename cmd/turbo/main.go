@@ -0,0 +1,72 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Command turbo is the command line tool of the gateway
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+type command struct {
+	Name        string
+	Description string
+	Run         func(args []string, stdout io.Writer) error
+}
+
+var commands = []command{
+	{Name: "run", Description: "run the gateway", Run: runGateway},
+	{Name: "check", Description: "parse and validate the config", Run: runCheck},
+	{Name: "audit", Description: "check the config against the security rules", Run: runAudit},
+	{Name: "routes", Description: "list the endpoints and their backends", Run: runRoutes},
+	{Name: "openapi", Description: "export the gateway endpoints as an OpenAPI 3 document, or import them from one", Run: runOpenAPI},
+	{Name: "version", Description: "print the version", Run: runVersion},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		usage(stderr)
+		return 2
+	}
+	for _, c := range commands {
+		if c.Name != args[0] {
+			continue
+		}
+		if err := c.Run(args[1:], stdout); err != nil {
+			fmt.Fprintf(stderr, "turbo %s: %s\n", c.Name, err.Error())
+			return 1
+		}
+		return 0
+	}
+	fmt.Fprintf(stderr, "turbo: unknown command %q\n", args[0])
+	usage(stderr)
+	return 2
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: turbo <command> [flags]")
+	fmt.Fprintln(w, "\nCommands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", c.Name, c.Description)
+	}
+	fmt.Fprintln(w, "\nRun 'turbo <command> -h' for the flags of the command.")
+}
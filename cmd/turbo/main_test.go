@@ -0,0 +1,145 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testConfig = `{
+	"version": 2,
+	"name": "test",
+	"endpoints": [
+		{"endpoint": "/users/{id}", "backend": [{"host": ["http://users"], "url_pattern": "/users/{id}"}]}
+	]
+}`
+
+func writeTestConfig(t *testing.T, data string) string {
+	name := filepath.Join(t.TempDir(), "turbo.json")
+	if err := ioutil.WriteFile(name, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestRun_unknownCommand(t *testing.T) {
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	if code := run([]string{"unknown"}, stdout, stderr); code != 2 {
+		t.Errorf("unexpected exit code: %d", code)
+	}
+	if !strings.Contains(stderr.String(), `unknown command "unknown"`) || !strings.Contains(stderr.String(), "openapi") {
+		t.Errorf("unexpected output: %s", stderr.String())
+	}
+}
+
+func TestRun_openapi(t *testing.T) {
+	configFile := writeTestConfig(t, testConfig)
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	if code := run([]string{"openapi", "-c", configFile}, stdout, stderr); code != 0 {
+		t.Errorf("unexpected exit code: %d. %s", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), `"/users/{id}"`) {
+		t.Errorf("unexpected output: %s", stdout.String())
+	}
+
+	out := filepath.Join(filepath.Dir(configFile), "openapi.yaml")
+	if code := run([]string{"openapi", "-c", configFile, "-o", out}, stdout, stderr); code != 0 {
+		t.Errorf("unexpected exit code: %d. %s", code, stderr.String())
+	}
+	b, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !strings.Contains(string(b), "openapi: 3.0.3") {
+		t.Errorf("unexpected document: %s", string(b))
+	}
+
+	if code := run([]string{"openapi", "-c", filepath.Join(os.TempDir(), "unknown.json")}, stdout, stderr); code != 1 {
+		t.Errorf("unexpected exit code: %d", code)
+	}
+}
+
+func TestRun_openapiImport(t *testing.T) {
+	configFile := writeTestConfig(t, testConfig)
+	spec := filepath.Join(filepath.Dir(configFile), "openapi.yaml")
+	if err := ioutil.WriteFile(spec, []byte(`openapi: 3.0.0
+info: {title: users, version: "1"}
+servers: [{url: "http://users.example.com"}]
+paths:
+  /users/{id}:
+    get:
+      parameters: [{name: fields, in: query}]
+      responses: {"200": {description: ok}}
+  /users:
+    post:
+      responses: {"200": {description: ok}}
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(filepath.Dir(configFile), "merged.json")
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	if code := run([]string{"openapi", "import", "-c", configFile, "-o", out, spec}, stdout, stderr); code != 0 {
+		t.Errorf("unexpected exit code: %d. %s", code, stderr.String())
+	}
+	if s := stdout.String(); s != "1 endpoints added, 1 updated\n" {
+		t.Errorf("unexpected output: %s", s)
+	}
+	b, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !strings.Contains(string(b), `"querystring_params"`) || !strings.Contains(string(b), `"endpoint": "/users"`) {
+		t.Errorf("unexpected config: %s", string(b))
+	}
+
+	if code := run([]string{"openapi", "import", "-c", configFile}, stdout, stderr); code != 1 {
+		t.Errorf("unexpected exit code: %d", code)
+	}
+}
+
+func TestRun_version(t *testing.T) {
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	if code := run([]string{"version"}, stdout, stderr); code != 0 {
+		t.Errorf("unexpected exit code: %d", code)
+	}
+	if !strings.HasPrefix(stdout.String(), "Turbo undefined (go") {
+		t.Errorf("unexpected output: %s", stdout.String())
+	}
+}
+
+func TestRun_runErrors(t *testing.T) {
+	configFile := writeTestConfig(t, testConfig)
+	for i, args := range [][]string{
+		{"run", "-c", configFile, "-r", "unknown"},
+		{"run", "-c", configFile, "-l", "verbose"},
+		{"run", "-c", configFile + ".missing"},
+	} {
+		stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+		if code := run(args, stdout, stderr); code != 1 {
+			t.Errorf("#%d: unexpected exit code: %d", i, code)
+		}
+	}
+}
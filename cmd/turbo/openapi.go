@@ -0,0 +1,130 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/starvn/turbo/config"
+	"github.com/starvn/turbo/openapi"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func runOpenAPI(args []string, stdout io.Writer) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "export":
+			return runOpenAPIExport(args[1:], stdout)
+		case "import":
+			return runOpenAPIImport(args[1:], stdout)
+		}
+	}
+	return runOpenAPIExport(args, stdout)
+}
+
+func runOpenAPIExport(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("openapi export", flag.ContinueOnError)
+	configFile := flags.String("c", "turbo.json", "path to the config file")
+	out := flags.String("o", "", "path to the output file, the document is written to the stdout when empty")
+	format := flags.String("f", "", "format of the document, json or yaml. Taken from the output file extension when empty")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := config.NewParser().Parse(*configFile)
+	if err != nil {
+		return err
+	}
+	doc, err := openapi.Export(cfg)
+	if err != nil {
+		return err
+	}
+
+	if *format == "" && *out != "" {
+		*format = strings.TrimPrefix(filepath.Ext(*out), ".")
+	}
+	b, err := openapi.Encode(doc, *format)
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		_, err = stdout.Write(b)
+		return err
+	}
+	return ioutil.WriteFile(*out, b, 0644)
+}
+
+func runOpenAPIImport(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("openapi import", flag.ContinueOnError)
+	configFile := flags.String("c", "turbo.json", "path to the config file receiving the endpoints. It does not need to exist")
+	out := flags.String("o", "", "path to the output file, the merged config is written to the stdout when empty")
+	host := flags.String("host", "", "comma separated hosts of the backends. Taken from the servers of the document when empty")
+	prefix := flags.String("prefix", "", "prefix added to the path of the endpoints")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("expecting the path to the OpenAPI document")
+	}
+
+	specFile := flags.Arg(0)
+	data, err := ioutil.ReadFile(specFile)
+	if err != nil {
+		return err
+	}
+	spec, err := openapi.Decode(specFile, data)
+	if err != nil {
+		return err
+	}
+	opts := openapi.ImportOptions{Prefix: *prefix}
+	if *host != "" {
+		opts.Host = strings.Split(*host, ",")
+	}
+	endpoints, err := openapi.Import(spec, opts)
+	if err != nil {
+		return err
+	}
+
+	doc := map[string]interface{}{"version": config.TurboConfigVersion}
+	if data, err := ioutil.ReadFile(*configFile); err == nil {
+		if doc, err = config.DecodeDocument(*configFile, data); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	added, updated := openapi.Merge(doc, endpoints)
+
+	b, err := config.EncodeDocument(*configFile, doc)
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		_, err = stdout.Write(b)
+		return err
+	}
+	if err := ioutil.WriteFile(*out, b, 0644); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(stdout, "%d endpoints added, %d updated\n", added, updated)
+	return err
+}
@@ -0,0 +1,141 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	gochi "github.com/go-chi/chi/v5"
+	"github.com/starvn/turbo/config"
+	"github.com/starvn/turbo/log"
+	"github.com/starvn/turbo/proxy"
+	"github.com/starvn/turbo/route"
+	"github.com/starvn/turbo/route/chi"
+	turbogin "github.com/starvn/turbo/route/gin"
+	"github.com/starvn/turbo/route/gorilla"
+	"github.com/starvn/turbo/route/httptreemux"
+	"github.com/starvn/turbo/route/mux"
+	"github.com/starvn/turbo/route/negroni"
+	"github.com/starvn/turbo/transport/http/server"
+	serverplugin "github.com/starvn/turbo/transport/http/server/plugin"
+	"io"
+	"sort"
+	"strings"
+)
+
+// routerEngine builds the router factory of an engine. The routing pattern must be set before parsing
+// the config, as the endpoint paths are translated to the syntax of the engine
+type routerEngine struct {
+	RoutingPattern int
+	Renders        func() []string
+	Factory        func(cfg config.ServiceConfig, pf proxy.Factory, logger log.Logger, w io.Writer, run serverplugin.RunServer, updates <-chan config.Update) route.Factory
+}
+
+var routerEngines = map[string]routerEngine{
+	"gin": {
+		RoutingPattern: config.ColonRouterPatternBuilder,
+		Renders:        turbogin.RenderNames,
+		Factory: func(cfg config.ServiceConfig, pf proxy.Factory, logger log.Logger, w io.Writer, run serverplugin.RunServer, updates <-chan config.Update) route.Factory {
+			return turbogin.NewFactory(turbogin.Config{
+				Engine:         turbogin.NewEngine(cfg, logger, w),
+				HandlerFactory: turbogin.CustomErrorEndpointHandler(logger, server.DefaultToHTTPError),
+				ProxyFactory:   pf,
+				Logger:         logger,
+				RunServer:      turbogin.RunServerFunc(run),
+				EngineFactory:  func(c config.ServiceConfig) *gin.Engine { return turbogin.NewEngine(c, logger, w) },
+				Updates:        updates,
+			})
+		},
+	},
+	"mux": {
+		RoutingPattern: config.ColonRouterPatternBuilder,
+		Renders:        mux.RenderNames,
+		Factory: func(_ config.ServiceConfig, pf proxy.Factory, logger log.Logger, _ io.Writer, run serverplugin.RunServer, updates <-chan config.Update) route.Factory {
+			return mux.NewFactory(mux.Config{
+				Engine:         mux.DefaultEngine(),
+				HandlerFactory: mux.EndpointHandler,
+				ProxyFactory:   pf,
+				Logger:         logger,
+				RunServer:      mux.RunServerFunc(run),
+				EngineFactory:  func() mux.Engine { return mux.DefaultEngine() },
+				Updates:        updates,
+			})
+		},
+	},
+	"chi": {
+		RoutingPattern: config.BracketsRouterPatternBuilder,
+		Renders:        mux.RenderNames,
+		Factory: func(_ config.ServiceConfig, pf proxy.Factory, logger log.Logger, _ io.Writer, run serverplugin.RunServer, updates <-chan config.Update) route.Factory {
+			return chi.NewFactory(chi.Config{
+				Engine:         gochi.NewRouter(),
+				HandlerFactory: chi.NewEndpointHandler,
+				ProxyFactory:   pf,
+				Logger:         logger,
+				RunServer:      chi.RunServerFunc(run),
+				EngineFactory:  func() gochi.Router { return gochi.NewRouter() },
+				Updates:        updates,
+			})
+		},
+	},
+	"gorilla": {
+		RoutingPattern: config.BracketsRouterPatternBuilder,
+		Renders:        mux.RenderNames,
+		Factory: func(_ config.ServiceConfig, pf proxy.Factory, logger log.Logger, _ io.Writer, run serverplugin.RunServer, updates <-chan config.Update) route.Factory {
+			cfg := gorilla.DefaultConfig(pf, logger)
+			cfg.RunServer = mux.RunServerFunc(run)
+			cfg.Updates = updates
+			return mux.NewFactory(cfg)
+		},
+	},
+	"httptreemux": {
+		RoutingPattern: config.ColonRouterPatternBuilder,
+		Renders:        mux.RenderNames,
+		Factory: func(_ config.ServiceConfig, pf proxy.Factory, logger log.Logger, _ io.Writer, run serverplugin.RunServer, updates <-chan config.Update) route.Factory {
+			cfg := httptreemux.DefaultConfig(pf, logger)
+			cfg.RunServer = mux.RunServerFunc(run)
+			cfg.Updates = updates
+			return mux.NewFactory(cfg)
+		},
+	},
+	"negroni": {
+		RoutingPattern: config.BracketsRouterPatternBuilder,
+		Renders:        mux.RenderNames,
+		Factory: func(_ config.ServiceConfig, pf proxy.Factory, logger log.Logger, _ io.Writer, run serverplugin.RunServer, updates <-chan config.Update) route.Factory {
+			cfg := negroni.DefaultConfig(pf, logger, nil)
+			cfg.RunServer = mux.RunServerFunc(run)
+			cfg.Updates = updates
+			return mux.NewFactory(cfg)
+		},
+	},
+}
+
+func getRouterEngine(name string) (routerEngine, error) {
+	r, ok := routerEngines[strings.ToLower(name)]
+	if !ok {
+		return routerEngine{}, fmt.Errorf("unknown router %q, available: %s", name, strings.Join(routerEngineNames(), ", "))
+	}
+	return r, nil
+}
+
+func routerEngineNames() []string {
+	names := make([]string, 0, len(routerEngines))
+	for name := range routerEngines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+func runRoutes(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("routes", flag.ContinueOnError)
+	configFile := flags.String("c", "turbo.json", "path to the config file")
+	routerName := flags.String("r", "gin", "router engine: "+strings.Join(routerEngineNames(), ", "))
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	engine, err := getRouterEngine(*routerName)
+	if err != nil {
+		return err
+	}
+	cfg, err := loadConfig(*configFile, engine)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "METHOD\tPATH\tENCODING\tBACKENDS")
+	for _, e := range cfg.Endpoints {
+		for i, b := range e.Backend {
+			backend := strings.ToUpper(b.Method) + " " + strings.Join(b.Host, ",") + b.URLPattern
+			if b.Encoding != "" {
+				backend += " (" + b.Encoding + ")"
+			}
+			if i == 0 {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", strings.ToUpper(e.Method), e.Endpoint, e.OutputEncoding, backend)
+				continue
+			}
+			fmt.Fprintf(w, "\t\t\t%s\n", backend)
+		}
+	}
+	return w.Flush()
+}
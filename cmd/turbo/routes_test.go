@@ -0,0 +1,71 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"github.com/starvn/turbo/config"
+	"strings"
+	"testing"
+)
+
+func TestRun_routes(t *testing.T) {
+	defer func() { config.RoutingPattern = config.ColonRouterPatternBuilder }()
+
+	configFile := writeTestConfig(t, `{
+	"version": 2,
+	"endpoints": [
+		{
+			"endpoint": "/users/{id}",
+			"backend": [
+				{"host": ["http://users"], "url_pattern": "/users/{id}"},
+				{"host": ["http://orders"], "url_pattern": "/orders", "encoding": "xml", "method": "POST"}
+			]
+		},
+		{"endpoint": "/raw", "output_encoding": "no-op", "backend": [{"host": ["http://raw"], "url_pattern": "/"}]}
+	]
+}`)
+	for _, tc := range []struct {
+		router   string
+		expected string
+	}{
+		{
+			router: "gin",
+			expected: `METHOD  PATH        ENCODING  BACKENDS
+GET     /users/:id  json      GET http://users/users/{{.Id}}
+                              POST http://orders/orders (xml)
+GET     /raw        no-op     GET http://raw/
+`,
+		},
+		{
+			router: "chi",
+			expected: `METHOD  PATH         ENCODING  BACKENDS
+GET     /users/{id}  json      GET http://users/users/{{.Id}}
+                               POST http://orders/orders (xml)
+GET     /raw         no-op     GET http://raw/
+`,
+		},
+	} {
+		stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+		if code := run([]string{"routes", "-c", configFile, "-r", tc.router}, stdout, stderr); code != 0 {
+			t.Errorf("%s: unexpected exit code: %d. %s", tc.router, code, stderr.String())
+		}
+		if out := stdout.String(); out != tc.expected {
+			t.Errorf("%s: unexpected output:\n%s", tc.router, strings.Replace(out, " ", ".", -1))
+		}
+	}
+}
@@ -0,0 +1,208 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"flag"
+	"github.com/starvn/turbo/admin"
+	"github.com/starvn/turbo/config"
+	"github.com/starvn/turbo/log"
+	"github.com/starvn/turbo/proxy"
+	proxyplugin "github.com/starvn/turbo/proxy/plugin"
+	"github.com/starvn/turbo/toggle"
+	"github.com/starvn/turbo/transport/http/client"
+	clientplugin "github.com/starvn/turbo/transport/http/client/plugin"
+	"github.com/starvn/turbo/transport/http/server"
+	serverplugin "github.com/starvn/turbo/transport/http/server/plugin"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+const logPrefix = "[SERVICE: Turbo]"
+
+// newRunContext returns the context of the gateway, cancelled when the process is asked to stop
+var newRunContext = func() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+func runGateway(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	configFile := flags.String("c", "turbo.json", "path to the config file")
+	routerName := flags.String("r", "gin", "router engine: "+strings.Join(routerEngineNames(), ", "))
+	logLevel := flags.String("l", "ERROR", "log level: DEBUG, INFO, WARNING, ERROR or CRITICAL")
+	debug := flags.Bool("d", false, "enable the debug endpoints")
+	port := flags.Int("p", 0, "port of the service, overriding the one of the config")
+	watch := flags.Duration("w", 0, "interval to check the config file for changes and reload it, also reloaded on SIGHUP. Zero disables the hot reload")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	engine, err := getRouterEngine(*routerName)
+	if err != nil {
+		return err
+	}
+	logger, err := log.NewLogger(*logLevel, stdout, "[TURBO]")
+	if err != nil {
+		return err
+	}
+	// the flags override the config at startup and on every reload
+	override := func(cfg config.ServiceConfig) config.ServiceConfig {
+		if *debug {
+			cfg.Debug = true
+		}
+		if *port != 0 {
+			cfg.Port = *port
+		}
+		return cfg
+	}
+	cfg, err := loadConfig(*configFile, engine)
+	if err != nil {
+		return err
+	}
+	cfg = override(cfg)
+	if cfg.UpgradedFromV1() {
+		logger.Warning(logPrefix, config.ErrDeprecatedV1.Error())
+	}
+
+	loadPlugins(cfg, logger)
+	toggles, err := loadToggles(cfg)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newRunContext()
+	defer cancel()
+
+	// the router and the admin listener watch the config on their own, so a failing admin listener
+	// can not hold the reloads of the router
+	var watchConfig func() <-chan config.Update
+	if *watch > 0 {
+		parser := config.ParserFunc(func(configFile string) (config.ServiceConfig, error) {
+			cfg, err := config.NewParser().Parse(configFile)
+			return override(cfg), err
+		})
+		watchConfig = func() <-chan config.Update {
+			return config.Watch(ctx, parser, *configFile, *watch, syscall.SIGHUP)
+		}
+		logger.Info(logPrefix, "Watching the config file", *configFile, "every", watch.String())
+	}
+
+	pf := proxy.NewDefaultFactory(newBackendFactory(logger), logger)
+	stacks, _ := pf.(proxy.StackDescriber)
+	runAdmin(ctx, cfg, engine, toggles, stacks, watchConfig, logger)
+
+	var updates <-chan config.Update
+	if watchConfig != nil {
+		updates = watchConfig()
+	}
+
+	runServer := serverplugin.New(logger, server.RunServer)
+	logger.Info(logPrefix, "Listening on port", cfg.Port, "with the", *routerName, "router")
+	engine.Factory(cfg, pf, logger, stdout, runServer, updates).NewWithContext(ctx).Run(cfg)
+	return nil
+}
+
+// loadToggles restores the disabled endpoints from the state file and makes the store the one checked
+// by the routers
+func loadToggles(cfg config.ServiceConfig) (*toggle.Store, error) {
+	toggleCfg, err := toggle.GetConfig(cfg.ExtraConfig)
+	if err != nil {
+		return nil, err
+	}
+	store, err := toggle.NewStore(toggleCfg, nil)
+	if err != nil {
+		return nil, err
+	}
+	toggle.SetDefault(store)
+	return store, nil
+}
+
+// runAdmin starts the admin listener in the background, when the config enables it
+func runAdmin(ctx context.Context, cfg config.ServiceConfig, engine routerEngine, toggles *toggle.Store, stacks proxy.StackDescriber, watchConfig func() <-chan config.Update, logger log.Logger) {
+	adminCfg, err := admin.GetConfig(cfg.ExtraConfig)
+	if err == admin.ErrNotConfigured {
+		return
+	}
+	if err != nil {
+		logger.Error(logPrefix, "Admin listener:", err.Error())
+		return
+	}
+	var updates <-chan config.Update
+	if watchConfig != nil {
+		updates = watchConfig()
+	}
+	logger.Info(logPrefix, "Admin listener on port", adminCfg.Port)
+	go func() {
+		if err := admin.Run(ctx, cfg, admin.Options{Renders: engine.Renders(), Toggles: toggles, Stacks: stacks, Updates: updates, Logger: logger}); err != nil {
+			logger.Error(logPrefix, "Admin listener:", err.Error())
+		}
+	}()
+}
+
+// loadConfig parses the config file with the routing pattern of the router engine
+func loadConfig(configFile string, engine routerEngine) (config.ServiceConfig, error) {
+	config.RoutingPattern = engine.RoutingPattern
+	return config.NewParser().Parse(configFile)
+}
+
+// loadPlugins loads the plugins of the folder set in the config. The failures are logged, so the
+// gateway can run without the plugins
+func loadPlugins(cfg config.ServiceConfig, logger log.Logger) {
+	if cfg.Plugin == nil {
+		return
+	}
+	folder, pattern := cfg.Plugin.Folder, cfg.Plugin.Pattern
+
+	n, err := clientplugin.LoadWithLogger(folder, pattern, clientplugin.RegisterClient, logger)
+	if err != nil {
+		logger.Warning(logPrefix, "Loading the client plugins:", err.Error())
+	}
+	logger.Info(logPrefix, "Client plugins loaded:", n)
+
+	n, err = serverplugin.LoadWithLogger(folder, pattern, serverplugin.RegisterHandler, logger)
+	if err != nil {
+		logger.Warning(logPrefix, "Loading the server plugins:", err.Error())
+	}
+	logger.Info(logPrefix, "Server plugins loaded:", n)
+
+	n, err = proxyplugin.LoadModifiersWithLogger(folder, pattern, proxyplugin.RegisterModifier, logger)
+	if err != nil {
+		logger.Warning(logPrefix, "Loading the modifier plugins:", err.Error())
+	}
+	logger.Info(logPrefix, "Modifier plugins loaded:", n)
+}
+
+// newBackendFactory returns the default backend factory, delegating the requests to the client
+// plugins when the backends require them
+func newBackendFactory(logger log.Logger) proxy.BackendFactory {
+	requestExecutor := clientplugin.HTTPRequestExecutor(logger, func(remote *config.Backend) client.HTTPRequestExecutor {
+		re, err := client.CachedHTTPRequestExecutor(remote, client.DefaultHTTPRequestExecutor(client.NewHTTPClient))
+		if err != nil {
+			logger.Error(logPrefix, "Building the HTTP cache of the backend:", err.Error())
+			return func(_ context.Context, _ *http.Request) (*http.Response, error) { return nil, err }
+		}
+		return re
+	})
+	return func(remote *config.Backend) proxy.Proxy {
+		return proxy.NewHTTPProxyWithHTTPExecutor(remote, requestExecutor(remote), remote.Decoder)
+	}
+}
@@ -0,0 +1,281 @@
+//go:build !race
+// +build !race
+
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/starvn/turbo/config"
+	"github.com/starvn/turbo/toggle"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func freePort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestRun_run(t *testing.T) {
+	defer func(f func() (context.Context, context.CancelFunc)) { newRunContext = f }(newRunContext)
+	defer func() { config.RoutingPattern = config.ColonRouterPatternBuilder }()
+
+	configFile := writeTestConfig(t, testConfig)
+	for _, name := range routerEngineNames() {
+		ctx, cancel := context.WithCancel(context.Background())
+		newRunContext = func() (context.Context, context.CancelFunc) { return ctx, cancel }
+
+		port := freePort(t)
+		done := make(chan int)
+		stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+		go func() {
+			done <- run([]string{"run", "-c", configFile, "-r", name, "-p", fmt.Sprintf("%d", port)}, stdout, stderr)
+		}()
+
+		healthy := false
+		for i := 0; i < 50 && !healthy; i++ {
+			time.Sleep(20 * time.Millisecond)
+			resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/__health", port))
+			if err != nil {
+				continue
+			}
+			resp.Body.Close()
+			healthy = resp.StatusCode == http.StatusOK
+		}
+		if !healthy {
+			t.Errorf("%s: the gateway is not healthy", name)
+		}
+
+		cancel()
+		select {
+		case code := <-done:
+			if code != 0 {
+				t.Errorf("%s: unexpected exit code: %d. %s", name, code, stderr.String())
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("%s: the gateway did not stop", name)
+		}
+	}
+}
+
+func TestRun_runAdmin(t *testing.T) {
+	defer func(f func() (context.Context, context.CancelFunc)) { newRunContext = f }(newRunContext)
+	defer func() { config.RoutingPattern = config.ColonRouterPatternBuilder }()
+
+	adminPort := freePort(t)
+	configFile := writeTestConfig(t, fmt.Sprintf(`{
+	"version": 2,
+	"extra_config": {"github.com/starvn/turbo/admin": {"address": "127.0.0.1", "port": %d, "token": "s3cr3t"}},
+	"endpoints": [
+		{"endpoint": "/users/{id}", "backend": [{"host": ["http://users"], "url_pattern": "/users/{id}"}]}
+	]
+}`, adminPort))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	newRunContext = func() (context.Context, context.CancelFunc) { return ctx, cancel }
+	done := make(chan int)
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	go func() {
+		done <- run([]string{"run", "-c", configFile, "-r", "mux", "-p", fmt.Sprintf("%d", freePort(t))}, stdout, stderr)
+	}()
+
+	var encodings map[string][]string
+	for i := 0; i < 50 && encodings == nil; i++ {
+		time.Sleep(20 * time.Millisecond)
+		req, _ := http.NewRequest("GET", fmt.Sprintf("http://127.0.0.1:%d/encodings", adminPort), nil)
+		req.Header.Set("Authorization", "Bearer s3cr3t")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("unexpected status code: %d", resp.StatusCode)
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&encodings)
+		resp.Body.Close()
+	}
+	if len(encodings["renders"]) == 0 || len(encodings["decoders"]) == 0 {
+		t.Errorf("unexpected encodings: %v", encodings)
+	}
+
+	cancel()
+	select {
+	case code := <-done:
+		if code != 0 {
+			t.Errorf("unexpected exit code: %d. %s", code, stderr.String())
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("the gateway did not stop")
+	}
+}
+
+func TestRun_runToggles(t *testing.T) {
+	defer func(f func() (context.Context, context.CancelFunc)) { newRunContext = f }(newRunContext)
+	defer func() { config.RoutingPattern = config.ColonRouterPatternBuilder }()
+	defer toggle.SetDefault(toggle.Default())
+
+	dir := t.TempDir()
+	stateFile := filepath.Join(dir, "state.json")
+	state := `{"toggles": [{"method": "GET", "endpoint": "/users", "response": {"body": "{\"message\":\"maintenance\"}"}}]}`
+	if err := ioutil.WriteFile(stateFile, []byte(state), 0600); err != nil {
+		t.Fatal(err)
+	}
+	configFile := writeTestConfig(t, fmt.Sprintf(`{
+	"version": 2,
+	"extra_config": {"github.com/starvn/turbo/toggle": {"state_file": %q, "audit_file": %q, "retry_after": "1m"}},
+	"endpoints": [
+		{"endpoint": "/users", "backend": [{"host": ["http://users"], "url_pattern": "/users"}]}
+	]
+}`, stateFile, filepath.Join(dir, "audit.log")))
+
+	for _, name := range routerEngineNames() {
+		ctx, cancel := context.WithCancel(context.Background())
+		newRunContext = func() (context.Context, context.CancelFunc) { return ctx, cancel }
+
+		port := freePort(t)
+		done := make(chan int)
+		stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+		go func() {
+			done <- run([]string{"run", "-c", configFile, "-r", name, "-p", fmt.Sprintf("%d", port)}, stdout, stderr)
+		}()
+
+		var resp *http.Response
+		for i := 0; i < 50 && resp == nil; i++ {
+			time.Sleep(20 * time.Millisecond)
+			resp, _ = http.Get(fmt.Sprintf("http://127.0.0.1:%d/users", port))
+		}
+		if resp == nil {
+			t.Errorf("%s: the gateway is not listening", name)
+		} else {
+			body, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusServiceUnavailable || string(body) != `{"message":"maintenance"}` {
+				t.Errorf("%s: unexpected response: %d %s", name, resp.StatusCode, string(body))
+			}
+			if ra := resp.Header.Get("Retry-After"); ra != "60" {
+				t.Errorf("%s: unexpected Retry-After header: %s", name, ra)
+			}
+		}
+
+		cancel()
+		select {
+		case code := <-done:
+			if code != 0 {
+				t.Errorf("%s: unexpected exit code: %d. %s", name, code, stderr.String())
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("%s: the gateway did not stop", name)
+		}
+	}
+}
+
+func TestRun_watch(t *testing.T) {
+	defer func(f func() (context.Context, context.CancelFunc)) { newRunContext = f }(newRunContext)
+	defer func() { config.RoutingPattern = config.ColonRouterPatternBuilder }()
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"ok":true}`)
+	}))
+	defer backend.Close()
+
+	adminPort := freePort(t)
+	tmpl := `{
+	"version": 2,
+	"extra_config": {"github.com/starvn/turbo/admin": {"address": "127.0.0.1", "port": %d, "token": "s3cr3t"}},
+	"endpoints": [
+		%s
+	]
+}`
+	users := fmt.Sprintf(`{"endpoint": "/users", "backend": [{"host": [%q], "url_pattern": "/users"}]}`, backend.URL)
+	orders := fmt.Sprintf(`{"endpoint": "/orders", "backend": [{"host": [%q], "url_pattern": "/orders"}]}`, backend.URL)
+	configFile := writeTestConfig(t, fmt.Sprintf(tmpl, adminPort, users))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	newRunContext = func() (context.Context, context.CancelFunc) { return ctx, cancel }
+	port := freePort(t)
+	done := make(chan int)
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	go func() {
+		done <- run([]string{"run", "-c", configFile, "-r", "mux", "-p", fmt.Sprintf("%d", port), "-w", "20ms"}, stdout, stderr)
+	}()
+
+	status := func(path string) int {
+		resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d%s", port, path))
+		if err != nil {
+			return 0
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	adminEndpoints := func() int {
+		req, _ := http.NewRequest("GET", fmt.Sprintf("http://127.0.0.1:%d/endpoints", adminPort), nil)
+		req.Header.Set("Authorization", "Bearer s3cr3t")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return 0
+		}
+		defer resp.Body.Close()
+		var endpoints []interface{}
+		_ = json.NewDecoder(resp.Body).Decode(&endpoints)
+		return len(endpoints)
+	}
+
+	for i := 0; i < 50 && (status("/users") != http.StatusOK || adminEndpoints() != 1); i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if code := status("/orders"); code != http.StatusNotFound {
+		t.Errorf("unexpected status code before the reload: %d", code)
+	}
+
+	if err := ioutil.WriteFile(configFile, []byte(fmt.Sprintf(tmpl, adminPort, users+",\n\t\t"+orders)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100 && (status("/orders") != http.StatusOK || adminEndpoints() != 2); i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if code := status("/orders"); code != http.StatusOK {
+		t.Errorf("unexpected status code after the reload: %d", code)
+	}
+	if n := adminEndpoints(); n != 2 {
+		t.Errorf("unexpected number of endpoints in the admin API: %d", n)
+	}
+
+	cancel()
+	select {
+	case code := <-done:
+		if code != 0 {
+			t.Errorf("unexpected exit code: %d. %s", code, stderr.String())
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("the gateway did not stop")
+	}
+}
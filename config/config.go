@@ -36,40 +36,47 @@ const (
 	ColonRouterPatternBuilder
 	DefaultMaxIdleConnectionsPerHost = 250
 	DefaultTimeout                   = 2 * time.Second
-	TurboConfigVersion               = 1
+	TurboConfigVersion               = 2
+	// ConfigVersion1 is still accepted, the parser upgrades its documents in memory
+	ConfigVersion1 = 1
 )
 
 var RoutingPattern = ColonRouterPatternBuilder
 
 type ServiceConfig struct {
-	Name                      string            `mapstructure:"name"`
-	Endpoints                 []*EndpointConfig `mapstructure:"endpoints"`
-	Timeout                   time.Duration     `mapstructure:"timeout"`
-	CacheTTL                  time.Duration     `mapstructure:"cache_ttl"`
-	Host                      []string          `mapstructure:"host"`
-	Port                      int               `mapstructure:"port"`
-	Version                   int               `mapstructure:"version"`
-	OutputEncoding            string            `mapstructure:"output_encoding"`
-	ExtraConfig               ExtraConfig       `mapstructure:"extra_config"`
-	ReadTimeout               time.Duration     `mapstructure:"read_timeout"`
-	WriteTimeout              time.Duration     `mapstructure:"write_timeout"`
-	IdleTimeout               time.Duration     `mapstructure:"idle_timeout"`
-	ReadHeaderTimeout         time.Duration     `mapstructure:"read_header_timeout"`
-	DisableKeepAlives         bool              `mapstructure:"disable_keep_alives"`
-	DisableCompression        bool              `mapstructure:"disable_compression"`
-	MaxIdleConnections        int               `mapstructure:"max_idle_connections"`
-	MaxIdleConnectionsPerHost int               `mapstructure:"max_idle_connections_per_host"`
-	IdleConnectionTimeout     time.Duration     `mapstructure:"idle_connection_timeout"`
-	ResponseHeaderTimeout     time.Duration     `mapstructure:"response_header_timeout"`
-	ExpectContinueTimeout     time.Duration     `mapstructure:"expect_continue_timeout"`
-	DialerTimeout             time.Duration     `mapstructure:"dialer_timeout"`
-	DialerFallbackDelay       time.Duration     `mapstructure:"dialer_fallback_delay"`
-	DialerKeepAlive           time.Duration     `mapstructure:"dialer_keep_alive"`
-	DisableStrictREST         bool              `mapstructure:"disable_rest"`
-	Plugin                    *Plugin           `mapstructure:"plugin"`
-	TLS                       *TLS              `mapstructure:"tls"`
+	Name                      string              `mapstructure:"name"`
+	Endpoints                 []*EndpointConfig   `mapstructure:"endpoints"`
+	Timeout                   time.Duration       `mapstructure:"timeout"`
+	CacheTTL                  time.Duration       `mapstructure:"cache_ttl"`
+	Host                      []string            `mapstructure:"host"`
+	Port                      int                 `mapstructure:"port"`
+	Version                   int                 `mapstructure:"version"`
+	OutputEncoding            string              `mapstructure:"output_encoding"`
+	ExtraConfig               ExtraConfig         `mapstructure:"extra_config"`
+	ReadTimeout               time.Duration       `mapstructure:"read_timeout"`
+	WriteTimeout              time.Duration       `mapstructure:"write_timeout"`
+	IdleTimeout               time.Duration       `mapstructure:"idle_timeout"`
+	ReadHeaderTimeout         time.Duration       `mapstructure:"read_header_timeout"`
+	DisableKeepAlives         bool                `mapstructure:"disable_keep_alives"`
+	DisableCompression        bool                `mapstructure:"disable_compression"`
+	MaxIdleConnections        int                 `mapstructure:"max_idle_connections"`
+	MaxIdleConnectionsPerHost int                 `mapstructure:"max_idle_connections_per_host"`
+	IdleConnectionTimeout     time.Duration       `mapstructure:"idle_connection_timeout"`
+	ResponseHeaderTimeout     time.Duration       `mapstructure:"response_header_timeout"`
+	ExpectContinueTimeout     time.Duration       `mapstructure:"expect_continue_timeout"`
+	DialerTimeout             time.Duration       `mapstructure:"dialer_timeout"`
+	DialerFallbackDelay       time.Duration       `mapstructure:"dialer_fallback_delay"`
+	DialerKeepAlive           time.Duration       `mapstructure:"dialer_keep_alive"`
+	DisableStrictREST         bool                `mapstructure:"disable_rest"`
+	Plugin                    *Plugin             `mapstructure:"plugin"`
+	TLS                       *TLS                `mapstructure:"tls"`
+	BackendTemplates          map[string]*Backend `mapstructure:"backend_templates"`
+	EndpointDefaults          *EndpointConfig     `mapstructure:"endpoint_defaults"`
 	Debug                     bool
 	uriParser                 URIParser
+	secrets                   map[string]string
+	secretsDigest             []byte
+	upgradedV1                bool
 }
 
 type EndpointConfig struct {
@@ -98,11 +105,22 @@ type Backend struct {
 	IsCollection             bool              `mapstructure:"is_collection"`
 	Target                   string            `mapstructure:"target"`
 	SD                       string            `mapstructure:"sd"`
+	Template                 string            `mapstructure:"template"`
+	Required                 bool              `mapstructure:"required"`
 	URLKeys                  []string
 	ConcurrentCalls          int
-	Timeout                  time.Duration
+	Timeout                  time.Duration    `mapstructure:"timeout"`
 	Decoder                  encoding.Decoder `json:"-"`
 	ExtraConfig              ExtraConfig      `mapstructure:"extra_config"`
+	flags                    backendFlags
+}
+
+// backendFlags tells which boolean fields of a backend were set by the config, so an explicit false
+// is not replaced by the value of the template
+type backendFlags struct {
+	hostSanitizationDisabled bool
+	isCollection             bool
+	required                 bool
 }
 
 type Plugin struct {
@@ -155,23 +173,35 @@ var (
 	defaultPort             = 8080
 )
 
+// UpgradedFromV1 reports whether the config was parsed from a deprecated version 1 document, upgraded
+// in memory to the current version
+func (s ServiceConfig) UpgradedFromV1() bool {
+	return s.upgradedV1
+}
+
 func (s *ServiceConfig) Hash() (string, error) {
 	var name string
 	name, s.Name = s.Name, ""
 	defer func() { s.Name = name }()
 
-	b, err := json.Marshal(s)
+	redacted, err := s.Redacted()
 	if err != nil {
 		return "", err
 	}
-	sum := sha256.Sum256(b)
-	return base64.StdEncoding.EncodeToString(sum[:]), nil
+	b, err := json.Marshal(redacted)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	h.Write(b)
+	h.Write(s.secretsDigest)
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
 }
 
 func (s *ServiceConfig) Init() error {
 	s.uriParser = NewURIParser()
 
-	if s.Version != TurboConfigVersion {
+	if s.Version != TurboConfigVersion && s.Version != ConfigVersion1 {
 		return &UnsupportedVersionError{
 			Have: s.Version,
 			Want: TurboConfigVersion,
@@ -180,7 +210,16 @@ func (s *ServiceConfig) Init() error {
 
 	s.initGlobalParams()
 
-	return s.initEndpoints()
+	var err error
+	if s.ExtraConfig.validate(ServiceScope, "extra_config", firstErrorReporter(&err)); err != nil {
+		return err
+	}
+
+	if err := s.initEndpoints(); err != nil {
+		return err
+	}
+	s.trackInheritedSecrets()
+	return nil
 }
 
 func (s *ServiceConfig) initGlobalParams() {
@@ -200,11 +239,43 @@ func (s *ServiceConfig) initGlobalParams() {
 }
 
 func (s *ServiceConfig) initEndpoints() error {
+	var err error
+	report := firstErrorReporter(&err)
+	s.initEndpointsWithReporter(report)
+	if err != nil {
+		return err
+	}
+	s.validateService(report)
+	return err
+}
+
+// firstErrorReporter keeps the first error reported and stops the init
+func firstErrorReporter(err *error) func(path string, e error) bool {
+	return func(_ string, e error) bool {
+		if isIgnoredExtraConfigError(e) {
+			return true
+		}
+		*err = e
+		return false
+	}
+}
+
+// initEndpointsWithReporter passes every error found to the report function, along with the JSON path
+// of the offending value. It stops as soon as report returns false
+func (s *ServiceConfig) initEndpointsWithReporter(report func(path string, err error) bool) {
 	for i, e := range s.Endpoints {
+		path := fmt.Sprintf("endpoints[%d]", i)
 		e.Endpoint = s.uriParser.CleanPath(e.Endpoint)
 
 		if err := e.validate(); err != nil {
-			return err
+			field := ".endpoint"
+			if _, ok := err.(*NoBackendsError); ok {
+				field = ".backend"
+			}
+			if !report(path+field, err) {
+				return
+			}
+			continue
 		}
 
 		for i := range e.HeadersToPass {
@@ -222,22 +293,49 @@ func (s *ServiceConfig) initEndpoints() error {
 		s.initEndpointDefaults(i)
 
 		if e.OutputEncoding == encoding.NOOP && len(e.Backend) > 1 {
-			return errInvalidNoOpEncoding
+			if !report(path+".output_encoding", errInvalidNoOpEncoding) {
+				return
+			}
+			continue
 		}
 
 		e.ExtraConfig.sanitize()
+		if !e.ExtraConfig.validate(EndpointScope, path+".extra_config", report) {
+			return
+		}
 
 		for j, b := range e.Backend {
-			s.initBackendDefaults(i, j)
+			backendPath := fmt.Sprintf("%s.backend[%d]", path, j)
+			inherited, err := s.initBackendDefaults(i, j)
+			if err != nil {
+				if !report(backendPath+".template", err) {
+					return
+				}
+				continue
+			}
+			reportBackend := report
+			if len(inherited) > 0 {
+				reportBackend = func(p string, err error) bool {
+					if field := strings.TrimPrefix(p, backendPath+"."); inherited[field] {
+						err = &BackendTemplateError{Template: b.Template, Field: field, Err: err}
+					}
+					return report(p, err)
+				}
+			}
 
 			if err := s.initBackendURLMappings(i, j, inputSet); err != nil {
-				return err
+				if !reportBackend(backendPath+".url_pattern", err) {
+					return
+				}
+				continue
 			}
 
 			b.ExtraConfig.sanitize()
+			if !b.ExtraConfig.validate(BackendScope, backendPath+".extra_config", reportBackend) {
+				return
+			}
 		}
 	}
-	return nil
 }
 
 func (s *ServiceConfig) paramExtractionPattern() *regexp.Regexp {
@@ -258,6 +356,9 @@ func (s *ServiceConfig) extractPlaceHoldersFromURLTemplate(subject string, patte
 
 func (s *ServiceConfig) initEndpointDefaults(e int) {
 	endpoint := s.Endpoints[e]
+	if s.EndpointDefaults != nil {
+		endpoint.applyDefaults(s.EndpointDefaults)
+	}
 	if endpoint.Method == "" {
 		endpoint.Method = "GET"
 	}
@@ -279,9 +380,19 @@ func (s *ServiceConfig) initEndpointDefaults(e int) {
 	}
 }
 
-func (s *ServiceConfig) initBackendDefaults(e, b int) {
+// initBackendDefaults resolves the template of the backend, if any, before setting the defaults. It
+// returns the fields inherited from the template
+func (s *ServiceConfig) initBackendDefaults(e, b int) (map[string]bool, error) {
 	endpoint := s.Endpoints[e]
 	backend := endpoint.Backend[b]
+	var inherited map[string]bool
+	if backend.Template != "" {
+		t, ok := s.BackendTemplates[backend.Template]
+		if !ok || t == nil {
+			return nil, &UnknownBackendTemplateError{Template: backend.Template}
+		}
+		inherited = backend.applyTemplate(t)
+	}
 	if len(backend.Host) == 0 {
 		backend.Host = s.Host
 	} else if !backend.HostSanitizationDisabled {
@@ -290,9 +401,12 @@ func (s *ServiceConfig) initBackendDefaults(e, b int) {
 	if backend.Method == "" {
 		backend.Method = endpoint.Method
 	}
-	backend.Timeout = endpoint.Timeout
+	if backend.Timeout == 0 {
+		backend.Timeout = endpoint.Timeout
+	}
 	backend.ConcurrentCalls = endpoint.ConcurrentCalls
 	backend.Decoder = encoding.GetRegister().Get(strings.ToLower(backend.Encoding))(backend.IsCollection)
+	return inherited, nil
 }
 
 func (s *ServiceConfig) initBackendURLMappings(e, b int, inputParams map[string]interface{}) error {
@@ -26,7 +26,7 @@ import (
 func TestConfig_rejectInvalidVersion(t *testing.T) {
 	subject := ServiceConfig{}
 	err := subject.Init()
-	if err == nil || strings.Index(err.Error(), "unsupported version: 0 (want: 1)") != 0 {
+	if err == nil || strings.Index(err.Error(), "unsupported version: 0 (want: 2)") != 0 {
 		t.Error("Error expected. Got", err.Error())
 	}
 }
@@ -167,6 +167,7 @@ func TestConfig_init(t *testing.T) {
 		URLPattern: "/users/{user}",
 		Host:       []string{"https://jsonplaceholder.typicode.com"},
 		Encoding:   "rss",
+		Timeout:    300 * time.Millisecond,
 	}
 	postBackend := Backend{
 		URLPattern: "/posts/{user}",
@@ -213,6 +214,10 @@ func TestConfig_init(t *testing.T) {
 		t.Error("default timeout not applied to the userBackend")
 	}
 
+	if rssBackend.Timeout != 300*time.Millisecond {
+		t.Error("the rssBackend timeout has been overwritten")
+	}
+
 	if userEndpoint.CacheTTL != subject.CacheTTL {
 		t.Error("default CacheTTL not applied to the userEndpoint")
 	}
@@ -222,7 +227,7 @@ func TestConfig_init(t *testing.T) {
 		t.Error(err.Error())
 	}
 
-	if hash != "Nvw/S+RNSFKG9wOO5bFSSlyuT25j0wwYllEDqzNdBPA=" {
+	if hash != "bjpoNVab5vbAlpMryK5YzXS9d0XbvTijTANkZR68tfo=" {
 		t.Errorf("unexpected hash: %s", hash)
 	}
 }
@@ -0,0 +1,177 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"fmt"
+	"net/textproto"
+)
+
+// applyDefaults sets the values not defined by the endpoint from the endpoint defaults of the service.
+// The extra_config namespaces are merged, the ones of the endpoint taking precedence
+func (e *EndpointConfig) applyDefaults(d *EndpointConfig) {
+	if e.Method == "" {
+		e.Method = d.Method
+	}
+	if e.ConcurrentCalls == 0 {
+		e.ConcurrentCalls = d.ConcurrentCalls
+	}
+	if e.Timeout == 0 {
+		e.Timeout = d.Timeout
+	}
+	if e.CacheTTL == 0 {
+		e.CacheTTL = d.CacheTTL
+	}
+	if e.OutputEncoding == "" {
+		e.OutputEncoding = d.OutputEncoding
+	}
+	if len(e.QueryString) == 0 && len(d.QueryString) > 0 {
+		e.QueryString = append([]string{}, d.QueryString...)
+	}
+	if len(e.HeadersToPass) == 0 && len(d.HeadersToPass) > 0 {
+		e.HeadersToPass = make([]string, len(d.HeadersToPass))
+		for i, h := range d.HeadersToPass {
+			e.HeadersToPass[i] = textproto.CanonicalMIMEHeaderKey(h)
+		}
+	}
+	e.ExtraConfig, _ = mergeExtraConfig(d.ExtraConfig, e.ExtraConfig)
+}
+
+// applyTemplate sets the values not defined by the backend from the template. It returns the fields
+// inherited, named as the suffixes of the paths reported by the validation
+func (b *Backend) applyTemplate(t *Backend) map[string]bool {
+	inherited := map[string]bool{}
+	if b.URLPattern == "" && t.URLPattern != "" {
+		b.URLPattern = t.URLPattern
+		inherited["url_pattern"] = true
+	}
+	if len(b.Host) == 0 && len(t.Host) > 0 {
+		b.Host = append([]string{}, t.Host...)
+		inherited["host"] = true
+	}
+	if b.Group == "" {
+		b.Group = t.Group
+	}
+	if b.Method == "" {
+		b.Method = t.Method
+	}
+	if b.Encoding == "" {
+		b.Encoding = t.Encoding
+	}
+	if b.Target == "" {
+		b.Target = t.Target
+	}
+	if b.SD == "" {
+		b.SD = t.SD
+	}
+	if b.Timeout == 0 {
+		b.Timeout = t.Timeout
+	}
+	if len(b.AllowList) == 0 && len(t.AllowList) > 0 {
+		b.AllowList = append([]string{}, t.AllowList...)
+	}
+	if len(b.DenyList) == 0 && len(t.DenyList) > 0 {
+		b.DenyList = append([]string{}, t.DenyList...)
+	}
+	if len(t.Mapping) > 0 {
+		mapping := make(map[string]string, len(t.Mapping)+len(b.Mapping))
+		for k, v := range t.Mapping {
+			mapping[k] = v
+		}
+		for k, v := range b.Mapping {
+			mapping[k] = v
+		}
+		b.Mapping = mapping
+	}
+	if !b.flags.hostSanitizationDisabled && !b.HostSanitizationDisabled {
+		b.HostSanitizationDisabled = t.HostSanitizationDisabled
+	}
+	if !b.flags.isCollection && !b.IsCollection {
+		b.IsCollection = t.IsCollection
+	}
+	if !b.flags.required && !b.Required {
+		b.Required = t.Required
+	}
+
+	var namespaces []string
+	b.ExtraConfig, namespaces = mergeExtraConfig(t.ExtraConfig, b.ExtraConfig)
+	for _, ns := range namespaces {
+		inherited[fmt.Sprintf("extra_config[%q]", ns)] = true
+	}
+	return inherited
+}
+
+// mergeExtraConfig returns a new extra config with the namespaces of both, the ones of the override
+// taking precedence, along with the namespaces taken from the base. The namespaces taken from the base
+// are deep copies, so the configs inheriting them do not share any map or slice
+func mergeExtraConfig(base, override ExtraConfig) (ExtraConfig, []string) {
+	if len(base) == 0 {
+		return override, nil
+	}
+	merged := make(ExtraConfig, len(base)+len(override))
+	var inherited []string
+	for ns, v := range base {
+		if _, ok := override[ns]; ok {
+			continue
+		}
+		inherited = append(inherited, ns)
+		merged[ns] = copyExtraConfigValue(v)
+	}
+	for ns, v := range override {
+		merged[ns] = v
+	}
+	return merged, inherited
+}
+
+func copyExtraConfigValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(t))
+		for k, v := range t {
+			res[k] = copyExtraConfigValue(v)
+		}
+		return res
+	case []interface{}:
+		res := make([]interface{}, len(t))
+		for i, v := range t {
+			res[i] = copyExtraConfigValue(v)
+		}
+		return res
+	}
+	return v
+}
+
+type UnknownBackendTemplateError struct {
+	Template string
+}
+
+func (u *UnknownBackendTemplateError) Error() string {
+	return fmt.Sprintf("unknown backend template %q", u.Template)
+}
+
+// BackendTemplateError is an error found in a backend at a value inherited from its template
+type BackendTemplateError struct {
+	Template string
+	Field    string
+	Err      error
+}
+
+func (b *BackendTemplateError) Error() string {
+	return fmt.Sprintf("%s (inherited from backend_templates[%q].%s)", b.Err.Error(), b.Template, b.Field)
+}
+
+func (b *BackendTemplateError) Unwrap() error { return b.Err }
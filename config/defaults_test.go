@@ -0,0 +1,205 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const testConfigWithTemplates = `{
+	"version": 2,
+	"endpoint_defaults": {
+		"timeout": "2s",
+		"cache_ttl": "1m",
+		"headers_to_pass": ["x-tenant"],
+		"extra_config": {"github.com/starvn/turbo/config/test": {"sequential": true}}
+	},
+	"backend_templates": {
+		"users": {
+			"host": ["http://users.example.com"],
+			"url_pattern": "/users/{id}",
+			"encoding": "json",
+			"mapping": {"name": "username"},
+			"is_collection": true,
+			"required": true,
+			"extra_config": {"github.com/starvn/turbo/config/test": {"strategy": "ok"}}
+		}
+	},
+	"endpoints": [
+		{
+			"endpoint": "/users/{id}",
+			"backend": [{"template": "users"}]
+		},
+		{
+			"endpoint": "/accounts/{id}",
+			"timeout": "500ms",
+			"headers_to_pass": ["authorization"],
+			"backend": [
+				{"template": "users", "url_pattern": "/accounts/{id}", "mapping": {"email": "mail"}, "is_collection": false}
+			]
+		}
+	]
+}`
+
+func TestNewParser_backendTemplates(t *testing.T) {
+	cfg, err := parseTestConfig("turbo.json", []byte(testConfigWithTemplates))
+	if err != nil {
+		t.Errorf("unexpected error: %s", err.Error())
+		return
+	}
+
+	e := cfg.Endpoints[0]
+	if e.Timeout != 2*time.Second || e.CacheTTL != time.Minute {
+		t.Errorf("the endpoint defaults were not applied: %+v", e)
+	}
+	if len(e.HeadersToPass) != 1 || e.HeadersToPass[0] != "X-Tenant" {
+		t.Errorf("unexpected headers to pass: %v", e.HeadersToPass)
+	}
+	if _, ok := e.ExtraConfig[testExtraConfigNamespace]; !ok {
+		t.Errorf("the default extra config was not merged: %v", e.ExtraConfig)
+	}
+	b := e.Backend[0]
+	if b.URLPattern != "/users/{{.Id}}" || len(b.Host) != 1 || b.Host[0] != "http://users.example.com" {
+		t.Errorf("the template was not applied: %+v", b)
+	}
+	if b.Mapping["name"] != "username" || b.Timeout != 2*time.Second {
+		t.Errorf("unexpected backend: %+v", b)
+	}
+
+	e = cfg.Endpoints[1]
+	if e.Timeout != 500*time.Millisecond || len(e.HeadersToPass) != 1 || e.HeadersToPass[0] != "Authorization" {
+		t.Errorf("the endpoint should override the defaults: %+v", e)
+	}
+	b = e.Backend[0]
+	if b.URLPattern != "/accounts/{{.Id}}" {
+		t.Errorf("the backend should override the template: %s", b.URLPattern)
+	}
+	if len(b.Mapping) != 2 || b.Mapping["name"] != "username" || b.Mapping["email"] != "mail" {
+		t.Errorf("unexpected mapping: %v", b.Mapping)
+	}
+	if len(cfg.BackendTemplates["users"].Mapping) != 1 {
+		t.Errorf("the template was modified: %v", cfg.BackendTemplates["users"].Mapping)
+	}
+	if !cfg.Endpoints[0].Backend[0].IsCollection || !cfg.Endpoints[0].Backend[0].Required {
+		t.Errorf("the template flags were not applied: %+v", cfg.Endpoints[0].Backend[0])
+	}
+	if b.IsCollection || !b.Required {
+		t.Errorf("the backend should override the template flags: %+v", b)
+	}
+
+	cfg.Endpoints[0].Backend[0].ExtraConfig[testExtraConfigNamespace].(map[string]interface{})["strategy"] = "changed"
+	cfg.Endpoints[0].ExtraConfig[testExtraConfigNamespace].(map[string]interface{})["sequential"] = false
+	if v := b.ExtraConfig[testExtraConfigNamespace].(map[string]interface{})["strategy"]; v != "ok" {
+		t.Errorf("the backends should not share the extra config of the template: %v", v)
+	}
+	if v := cfg.BackendTemplates["users"].ExtraConfig[testExtraConfigNamespace].(map[string]interface{})["strategy"]; v != "ok" {
+		t.Errorf("the template was modified: %v", v)
+	}
+	if v := e.ExtraConfig[testExtraConfigNamespace].(map[string]interface{})["sequential"]; v != true {
+		t.Errorf("the endpoints should not share the extra config of the defaults: %v", v)
+	}
+}
+
+func TestServiceConfig_Init_backendTemplateErrors(t *testing.T) {
+	for i, tc := range []struct {
+		template *Backend
+		backend  *Backend
+		err      string
+	}{
+		{
+			template: &Backend{URLPattern: "/bar"},
+			backend:  &Backend{Template: "unknown"},
+			err:      `unknown backend template "unknown"`,
+		},
+		{
+			template: &Backend{URLPattern: "/bar/{unknown}"},
+			backend:  &Backend{Template: "tpl"},
+			err:      `(inherited from backend_templates["tpl"].url_pattern)`,
+		},
+		{
+			template: &Backend{
+				URLPattern:  "/bar",
+				ExtraConfig: ExtraConfig{testExtraConfigNamespace: map[string]interface{}{"strategy": "invalid"}},
+			},
+			backend: &Backend{Template: "tpl"},
+			err:     `(inherited from backend_templates["tpl"].extra_config["github.com/starvn/turbo/config/test"])`,
+		},
+		{
+			template: &Backend{
+				URLPattern:  "/bar",
+				ExtraConfig: ExtraConfig{testExtraConfigNamespace: map[string]interface{}{"strategy": "ok"}},
+			},
+			backend: &Backend{
+				Template:    "tpl",
+				ExtraConfig: ExtraConfig{testExtraConfigNamespace: map[string]interface{}{"strategy": "invalid"}},
+			},
+			err: "invalid strategy",
+		},
+	} {
+		cfg := ServiceConfig{
+			Version:          TurboConfigVersion,
+			BackendTemplates: map[string]*Backend{"tpl": tc.template},
+			Endpoints: []*EndpointConfig{
+				{Endpoint: "/foo", Method: "GET", Backend: []*Backend{tc.backend}},
+			},
+		}
+		err := cfg.Init()
+		if err == nil {
+			t.Errorf("#%d: expecting an error", i)
+			continue
+		}
+		if !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("#%d: unexpected error: %s", i, err.Error())
+		}
+		if tc.err == "invalid strategy" && strings.Contains(err.Error(), "inherited") {
+			t.Errorf("#%d: the error should not point to the template: %s", i, err.Error())
+		}
+	}
+}
+
+func TestValidate_backendTemplates(t *testing.T) {
+	issues, err := Validate("turbo.json", []byte(`{
+	"version": 2,
+	"backend_templates": {
+		"users": {"host": ["http://example.com"], "url_pattern": "/users/{name}"}
+	},
+	"endpoints": [
+		{"endpoint": "/users/{id}", "backend": [{"template": "users"}]},
+		{"endpoint": "/accounts/{id}", "backend": [{"template": "accounts"}]}
+	]
+}`))
+	if err != nil {
+		t.Errorf("unexpected error: %s", err.Error())
+		return
+	}
+	expected := []string{
+		`endpoints[0].backend[0].url_pattern: (inherited from backend_templates["users"].url_pattern)`,
+		`endpoints[1].backend[0].template: unknown backend template "accounts"`,
+	}
+	if len(issues) != len(expected) {
+		t.Errorf("unexpected issues: %v", issues)
+		return
+	}
+	for i, prefix := range expected {
+		parts := strings.SplitN(prefix, ": ", 2)
+		if issues[i].Path != parts[0] || !strings.Contains(issues[i].Message, parts[1]) {
+			t.Errorf("#%d: unexpected issue: %s", i, issues[i])
+		}
+	}
+}
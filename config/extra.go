@@ -0,0 +1,211 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/starvn/turbo/register"
+	"reflect"
+	"strings"
+)
+
+// ExtraConfigScope is the level of the config holding an extra_config section
+type ExtraConfigScope int
+
+const (
+	ServiceScope ExtraConfigScope = 1 << iota
+	EndpointScope
+	BackendScope
+
+	AnyScope = ServiceScope | EndpointScope | BackendScope
+)
+
+func (s ExtraConfigScope) String() string {
+	switch s {
+	case ServiceScope:
+		return "service"
+	case EndpointScope:
+		return "endpoint"
+	case BackendScope:
+		return "backend"
+	}
+	return "unknown"
+}
+
+// ExtraConfigValidator checks the value stored under a namespace of an extra_config section
+type ExtraConfigValidator func(scope ExtraConfigScope, v interface{}) error
+
+// StrictExtraConfigNamespaces makes Init reject the namespaces without a registered validator. When
+// disabled, they are ignored by Init and reported as warnings by Validate
+var StrictExtraConfigNamespaces = false
+
+var extraConfigValidators = register.NewUntyped()
+
+type extraConfigValidator struct {
+	scopes   ExtraConfigScope
+	validate ExtraConfigValidator
+}
+
+// RegisterExtraConfigValidator registers the validator of a namespace, allowed at the given scopes
+func RegisterExtraConfigValidator(namespace string, scopes ExtraConfigScope, v ExtraConfigValidator) {
+	extraConfigValidators.Register(namespace, extraConfigValidator{scopes: scopes, validate: v})
+}
+
+// RegisterExtraConfigType registers a validator decoding the namespace into a new value of the type of
+// the sample. Unknown fields are rejected and, if the type has a Validate() error method, it is called
+// over the decoded value
+func RegisterExtraConfigType(namespace string, scopes ExtraConfigScope, sample interface{}) {
+	t := reflect.TypeOf(sample)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	RegisterExtraConfigValidator(namespace, scopes, func(_ ExtraConfigScope, v interface{}) error {
+		target := reflect.New(t).Interface()
+		if err := DecodeExtraConfig(v, target); err != nil {
+			return err
+		}
+		if validator, ok := target.(interface{ Validate() error }); ok {
+			return validator.Validate()
+		}
+		return nil
+	})
+}
+
+// ServiceConfigValidator checks the constraints spanning several endpoints or backends of a service,
+// passing every problem found to the report function along with the JSON path of the offending value.
+// It returns false if the report function asked to stop
+type ServiceConfigValidator func(s *ServiceConfig, report func(path string, err error) bool) bool
+
+var serviceConfigValidators = register.NewUntyped()
+
+// RegisterServiceConfigValidator registers a validator called once the endpoints are initialized
+func RegisterServiceConfigValidator(name string, v ServiceConfigValidator) {
+	serviceConfigValidators.Register(name, v)
+}
+
+func (s *ServiceConfig) validateService(report func(path string, err error) bool) bool {
+	for _, name := range serviceConfigValidators.Keys() {
+		v, _ := serviceConfigValidators.Get(name)
+		if validate, ok := v.(ServiceConfigValidator); ok && !validate(s, report) {
+			return false
+		}
+	}
+	return true
+}
+
+// DecodeExtraConfig decodes the value of an extra_config namespace into the target, rejecting the
+// fields not defined by it
+func DecodeExtraConfig(v, target interface{}) error {
+	b, err := json.Marshal(normalizeDecodedValue(v))
+	if err != nil {
+		return err
+	}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.DisallowUnknownFields()
+	if err := d.Decode(target); err != nil {
+		if t, ok := err.(*json.UnmarshalTypeError); ok {
+			if t.Field == "" {
+				return fmt.Errorf("expected %s, got %s", kindName(t.Type), articled(t.Value))
+			}
+			return fmt.Errorf("%s: expected %s, got %s", t.Field, kindName(t.Type), articled(t.Value))
+		}
+		return fmt.Errorf("%s", strings.TrimPrefix(err.Error(), "json: "))
+	}
+	return nil
+}
+
+type ExtraConfigError struct {
+	Namespace string
+	Scope     ExtraConfigScope
+	Err       error
+}
+
+func (e *ExtraConfigError) Error() string {
+	return fmt.Sprintf("invalid extra_config %q at the %s level: %s", e.Namespace, e.Scope, e.Err.Error())
+}
+
+type UnknownNamespaceError struct {
+	Namespace string
+	Scope     ExtraConfigScope
+}
+
+func (u *UnknownNamespaceError) Error() string {
+	return fmt.Sprintf("unknown extra_config namespace %q at the %s level", u.Namespace, u.Scope)
+}
+
+// validate runs the registered validators over every namespace, passing the errors to the report
+// function. It returns false if the report function asked to stop
+func (e ExtraConfig) validate(scope ExtraConfigScope, path string, report func(path string, err error) bool) bool {
+	for _, namespace := range sortedKeys(e) {
+		var err error
+		v, ok := extraConfigValidators.Get(namespace)
+		validator, isValidator := v.(extraConfigValidator)
+		switch {
+		case !ok || !isValidator || validator.scopes&scope == 0:
+			err = &UnknownNamespaceError{Namespace: namespace, Scope: scope}
+		default:
+			if vErr := validator.validate(scope, e[namespace]); vErr != nil {
+				err = &ExtraConfigError{Namespace: namespace, Scope: scope, Err: vErr}
+			}
+		}
+		if err != nil && !report(fmt.Sprintf("%s[%q]", path, namespace), err) {
+			return false
+		}
+	}
+	return true
+}
+
+// isIgnoredExtraConfigError tells if the error should not stop the Init of the service
+func isIgnoredExtraConfigError(err error) bool {
+	var u *UnknownNamespaceError
+	return errors.As(err, &u) && !StrictExtraConfigNamespaces
+}
+
+func kindName(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map:
+		return "an object"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	}
+	return t.String()
+}
+
+func articled(jsonType string) string {
+	switch jsonType {
+	case "object", "array":
+		return "an " + jsonType
+	case "bool":
+		return "a boolean"
+	}
+	return "a " + jsonType
+}
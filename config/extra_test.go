@@ -0,0 +1,205 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+const testExtraConfigNamespace = "github.com/starvn/turbo/config/test"
+
+type testNamespaceConfig struct {
+	Sequential bool   `json:"sequential"`
+	Strategy   string `json:"strategy"`
+}
+
+func (t testNamespaceConfig) Validate() error {
+	if t.Strategy == "invalid" {
+		return errors.New("invalid strategy")
+	}
+	return nil
+}
+
+func init() {
+	RegisterExtraConfigType(testExtraConfigNamespace, EndpointScope|BackendScope, testNamespaceConfig{})
+	RegisterServiceConfigValidator(testExtraConfigNamespace, func(s *ServiceConfig, report func(string, error) bool) bool {
+		for i, e := range s.Endpoints {
+			for j, b := range e.Backend {
+				if m, ok := b.ExtraConfig[testExtraConfigNamespace].(map[string]interface{}); ok && m["strategy"] == "conflict" {
+					if !report(fmt.Sprintf("endpoints[%d].backend[%d]", i, j), errors.New("conflicting strategy")) {
+						return false
+					}
+				}
+			}
+		}
+		return true
+	})
+}
+
+func newExtraConfigTestService(endpointExtra, backendExtra ExtraConfig) ServiceConfig {
+	return ServiceConfig{
+		Version: TurboConfigVersion,
+		Endpoints: []*EndpointConfig{
+			{
+				Endpoint:    "/foo",
+				Method:      "GET",
+				ExtraConfig: endpointExtra,
+				Backend: []*Backend{
+					{URLPattern: "/bar", ExtraConfig: backendExtra},
+				},
+			},
+		},
+	}
+}
+
+func TestServiceConfig_Init_extraConfig(t *testing.T) {
+	for i, tc := range []struct {
+		endpoint ExtraConfig
+		backend  ExtraConfig
+		err      string
+	}{
+		{
+			endpoint: ExtraConfig{testExtraConfigNamespace: map[string]interface{}{"sequential": true}},
+			backend:  ExtraConfig{testExtraConfigNamespace: map[string]interface{}{"strategy": "ok"}},
+		},
+		{
+			endpoint: ExtraConfig{"github.com/unknown": true},
+		},
+		{
+			endpoint: ExtraConfig{testExtraConfigNamespace: map[string]interface{}{"sequentail": true}},
+			err:      `invalid extra_config "github.com/starvn/turbo/config/test" at the endpoint level: unknown field "sequentail"`,
+		},
+		{
+			backend: ExtraConfig{testExtraConfigNamespace: map[string]interface{}{"sequential": "yes"}},
+			err:     `invalid extra_config "github.com/starvn/turbo/config/test" at the backend level: sequential: expected a boolean, got a string`,
+		},
+		{
+			backend: ExtraConfig{testExtraConfigNamespace: map[interface{}]interface{}{"strategy": "invalid"}},
+			err:     `invalid extra_config "github.com/starvn/turbo/config/test" at the backend level: invalid strategy`,
+		},
+		{
+			backend: ExtraConfig{testExtraConfigNamespace: []interface{}{}},
+			err:     `invalid extra_config "github.com/starvn/turbo/config/test" at the backend level: expected an object, got an array`,
+		},
+	} {
+		cfg := newExtraConfigTestService(tc.endpoint, tc.backend)
+		err := cfg.Init()
+		if tc.err == "" {
+			if err != nil {
+				t.Errorf("#%d: unexpected error: %s", i, err.Error())
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("#%d: expecting an error", i)
+			continue
+		}
+		if _, ok := err.(*ExtraConfigError); !ok || err.Error() != tc.err {
+			t.Errorf("#%d: unexpected error: %s", i, err.Error())
+		}
+	}
+}
+
+func TestServiceConfig_Init_serviceConfigValidator(t *testing.T) {
+	cfg := newExtraConfigTestService(nil, ExtraConfig{testExtraConfigNamespace: map[string]interface{}{"strategy": "conflict"}})
+	if err := cfg.Init(); err == nil || err.Error() != "conflicting strategy" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	issues, err := Validate("turbo.json", []byte(`{
+	"version": 2,
+	"endpoints": [{
+		"endpoint": "/foo",
+		"backend": [
+			{"host": ["http://a"], "url_pattern": "/a", "extra_config": {"github.com/starvn/turbo/config/test": {"strategy": "conflict"}}},
+			{"host": ["http://b"], "url_pattern": "/b", "extra_config": {"github.com/starvn/turbo/config/test": {"strategy": "conflict"}}}
+		]
+	}]
+}`))
+	if err != nil {
+		t.Errorf("unexpected error: %s", err.Error())
+		return
+	}
+	if len(issues) != 2 || issues[0].Path != "endpoints[0].backend[0]" || issues[1].Path != "endpoints[0].backend[1]" {
+		t.Errorf("unexpected issues: %v", issues)
+	}
+}
+
+func TestServiceConfig_Init_strictExtraConfigNamespaces(t *testing.T) {
+	StrictExtraConfigNamespaces = true
+	defer func() { StrictExtraConfigNamespaces = false }()
+
+	cfg := newExtraConfigTestService(nil, nil)
+	cfg.ExtraConfig = ExtraConfig{testExtraConfigNamespace: map[string]interface{}{}}
+	err := cfg.Init()
+	if err == nil {
+		t.Error("expecting an error")
+		return
+	}
+	if e, ok := err.(*UnknownNamespaceError); !ok || e.Namespace != testExtraConfigNamespace || e.Scope != ServiceScope {
+		t.Errorf("unexpected error: %s", err.Error())
+	}
+
+	cfg = newExtraConfigTestService(nil, ExtraConfig{"github.com/unknown": true})
+	if err := cfg.Init(); err == nil || err.Error() != `unknown extra_config namespace "github.com/unknown" at the backend level` {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestValidate_extraConfig(t *testing.T) {
+	issues, err := Validate("turbo.json", []byte(`{
+	"version": 2,
+	"extra_config": {"github.com/unknown": {}},
+	"endpoints": [
+		{
+			"endpoint": "/foo",
+			"extra_config": {"github.com/starvn/turbo/config/test": {"sequentail": true}},
+			"backend": [
+				{
+					"url_pattern": "/bar",
+					"extra_config": {"github.com/starvn/turbo/config/test": {"strategy": "invalid"}}
+				}
+			]
+		}
+	]
+}`))
+	if err != nil {
+		t.Errorf("unexpected error: %s", err.Error())
+		return
+	}
+
+	expected := []Issue{
+		{`extra_config["github.com/unknown"]`, `unknown extra_config namespace "github.com/unknown" at the service level`, SeverityWarning},
+		{`endpoints[0].extra_config["github.com/starvn/turbo/config/test"]`, "", SeverityError},
+		{`endpoints[0].backend[0].extra_config["github.com/starvn/turbo/config/test"]`, "", SeverityError},
+	}
+	if len(issues) != len(expected) {
+		t.Errorf("unexpected number of issues: %d", len(issues))
+		for _, i := range issues {
+			t.Log(i.String())
+		}
+		return
+	}
+	for i, issue := range issues {
+		exp := expected[i]
+		if issue.Path != exp.Path || issue.Severity != exp.Severity || (exp.Message != "" && issue.Message != exp.Message) {
+			t.Errorf("#%d: unexpected issue: %s", i, issue.String())
+		}
+	}
+}
@@ -0,0 +1,447 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"github.com/starvn/turbo/register"
+	"gopkg.in/yaml.v3"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	JSONFormat = "json"
+	YAMLFormat = "yaml"
+	TOMLFormat = "toml"
+)
+
+// FormatDecoder decodes a config document into a generic map. The result is processed as if it were
+// the equivalent JSON document
+type FormatDecoder func(data []byte) (map[string]interface{}, error)
+
+// FormatError is the error returned by the format decoders able to locate the failure in the source
+type FormatError struct {
+	Err    error
+	Offset int
+}
+
+func (f *FormatError) Error() string {
+	return f.Err.Error()
+}
+
+// RegisterFormatDecoder sets the decoder to use for the config files with the given extension
+func RegisterFormatDecoder(ext string, d FormatDecoder) {
+	formatDecoders.Register(strings.ToLower(strings.TrimPrefix(ext, ".")), d)
+}
+
+var formatDecoders = initFormatDecoders()
+
+func initFormatDecoders() *register.Untyped {
+	r := register.NewUntyped()
+	r.Register(YAMLFormat, FormatDecoder(YAMLDecoder))
+	r.Register("yml", FormatDecoder(YAMLDecoder))
+	r.Register(TOMLFormat, FormatDecoder(TOMLDecoder))
+	return r
+}
+
+func getFormatDecoder(configFile string) (FormatDecoder, bool) {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(configFile), "."))
+	if ext == "" || ext == JSONFormat {
+		return nil, false
+	}
+	v, ok := formatDecoders.Get(ext)
+	if !ok {
+		return nil, false
+	}
+	d, ok := v.(FormatDecoder)
+	return d, ok
+}
+
+// decodeServiceConfig decodes the document with the parseable structs of its version. The returned
+// config is never nil, even when the document is not valid
+func decodeServiceConfig(configFile string, data []byte) (parseableConfig, error) {
+	decoder, ok := getFormatDecoder(configFile)
+	if !ok {
+		var doc interface{}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return &parseableServiceConfig{}, err
+		}
+		cfg := newParseableConfig(documentVersion(doc))
+		return cfg, json.Unmarshal(data, cfg)
+	}
+
+	m, err := decodeFormat(decoder, data)
+	if err != nil {
+		return &parseableServiceConfig{}, err
+	}
+	cfg := newParseableConfig(documentVersion(m))
+	b, err := json.Marshal(m)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(b, cfg); err != nil {
+		ferr := errors.New(strings.TrimPrefix(err.Error(), "json: "))
+		// the offsets of the JSON errors point to the converted document, so the value is located
+		// by its path in the source
+		if terr, ok := err.(*json.UnmarshalTypeError); ok {
+			if offset, ok := locateValue(configFile, data, jsonPath(b, terr.Offset)); ok {
+				return cfg, &FormatError{Err: ferr, Offset: offset}
+			}
+		}
+		return cfg, ferr
+	}
+	return cfg, nil
+}
+
+// jsonPath returns the path of the deepest value of the JSON document containing the offset
+func jsonPath(data []byte, offset int64) []interface{} {
+	path, _ := walkJSONPath(json.NewDecoder(bytes.NewReader(data)), nil, offset)
+	return path
+}
+
+func walkJSONPath(dec *json.Decoder, path []interface{}, offset int64) ([]interface{}, bool) {
+	start := dec.InputOffset()
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, false
+	}
+	switch tok {
+	case json.Delim('{'):
+		for dec.More() {
+			k, err := dec.Token()
+			if err != nil {
+				return nil, false
+			}
+			if p, ok := walkJSONPath(dec, append(path[:len(path):len(path)], k), offset); ok {
+				return p, true
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, false
+		}
+	case json.Delim('['):
+		for i := 0; dec.More(); i++ {
+			if p, ok := walkJSONPath(dec, append(path[:len(path):len(path)], i), offset); ok {
+				return p, true
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, false
+		}
+	}
+	return path, start < offset && offset <= dec.InputOffset()
+}
+
+// locateValue returns the offset in the source of the value at the given path
+func locateValue(configFile string, data []byte, path []interface{}) (int, bool) {
+	var line, col int
+	var ok bool
+	switch strings.ToLower(strings.TrimPrefix(filepath.Ext(configFile), ".")) {
+	case YAMLFormat, "yml":
+		line, col, ok = yamlPosition(data, path)
+	case TOMLFormat:
+		line, col, ok = tomlPosition(data, path)
+	}
+	if !ok {
+		return 0, false
+	}
+	return lineOffset(data, line) + col - 1, true
+}
+
+// DecodeDocument decodes the contents of the config file into a generic document, with the decoder of
+// its format
+func DecodeDocument(configFile string, data []byte) (map[string]interface{}, error) {
+	var doc map[string]interface{}
+	if decoder, ok := getFormatDecoder(configFile); ok {
+		m, err := decodeFormat(decoder, data)
+		if err != nil {
+			return nil, checkErr(err, configFile, data)
+		}
+		doc = m
+	} else if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, checkErr(err, configFile, data)
+	}
+	if doc == nil {
+		return map[string]interface{}{}, nil
+	}
+	return doc, nil
+}
+
+// decodeFormat decodes the data with the format decoder, converting the result into the values of
+// the equivalent JSON document, so the rest of the package never deals with the types of the decoders
+func decodeFormat(decoder FormatDecoder, data []byte) (map[string]interface{}, error) {
+	m, err := decoder(data)
+	if err != nil || m == nil {
+		return m, err
+	}
+	return normalizeDecodedValue(m).(map[string]interface{}), nil
+}
+
+// EncodeDocument encodes the generic document in the format of the config file
+func EncodeDocument(configFile string, doc map[string]interface{}) ([]byte, error) {
+	switch strings.ToLower(strings.TrimPrefix(filepath.Ext(configFile), ".")) {
+	case "", JSONFormat:
+		b, err := json.MarshalIndent(doc, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(b, '\n'), nil
+	case YAMLFormat, "yml":
+		return marshalYAML(doc)
+	case TOMLFormat:
+		buf := new(bytes.Buffer)
+		if err := toml.NewEncoder(buf).Encode(doc); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("'%s': the format can not be encoded", configFile)
+}
+
+// marshalYAML encodes the value with the indentation of the YAML config examples
+func marshalYAML(v interface{}) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	enc := yaml.NewEncoder(buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var yamlLineErrorPattern = regexp.MustCompile(`^yaml: line (\d+):`)
+
+func YAMLDecoder(data []byte) (map[string]interface{}, error) {
+	var m map[string]interface{}
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		if match := yamlLineErrorPattern.FindStringSubmatch(err.Error()); len(match) == 2 {
+			line, _ := strconv.Atoi(match[1])
+			// the parser does not expose the column, so the error points to the first character of the line
+			offset := lineOffset(data, line)
+			for offset < len(data) && (data[offset] == ' ' || data[offset] == '\t') {
+				offset++
+			}
+			return nil, &FormatError{Err: err, Offset: offset}
+		}
+		return nil, err
+	}
+	return m, nil
+}
+
+func TOMLDecoder(data []byte) (map[string]interface{}, error) {
+	var m map[string]interface{}
+	if err := toml.Unmarshal(data, &m); err != nil {
+		var perr toml.ParseError
+		if errors.As(err, &perr) {
+			return nil, &FormatError{Err: err, Offset: perr.Position.Start}
+		}
+		return nil, err
+	}
+	return m, nil
+}
+
+// yamlPosition returns the line and column of the node at the given path, or of its deepest parent
+// present in the document
+func yamlPosition(data []byte, path []interface{}) (int, int, bool) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil || len(doc.Content) == 0 {
+		return 0, 0, false
+	}
+	n := doc.Content[0]
+	for _, p := range path {
+		for n.Kind == yaml.AliasNode && n.Alias != nil {
+			n = n.Alias
+		}
+		next := yamlChild(n, p)
+		if next == nil {
+			break
+		}
+		n = next
+	}
+	return n.Line, n.Column, true
+}
+
+func yamlChild(n *yaml.Node, p interface{}) *yaml.Node {
+	switch k := p.(type) {
+	case string:
+		if n.Kind != yaml.MappingNode {
+			return nil
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == k {
+				return n.Content[i+1]
+			}
+		}
+	case int:
+		if n.Kind == yaml.SequenceNode && k < len(n.Content) {
+			return n.Content[k]
+		}
+	}
+	return nil
+}
+
+// tomlPosition returns the line and column of the key at the given path, or of its deepest parent
+// present in the document. The document is scanned line by line, so the values of the inline tables
+// and arrays are located by the key holding them
+func tomlPosition(data []byte, path []interface{}) (int, int, bool) {
+	var table []interface{}
+	tables := map[string]int{}
+	bestLine, bestCol, bestDepth := 0, 0, 0
+	match := func(p []interface{}, line, col int) {
+		d := 0
+		for d < len(p) && d < len(path) && fmt.Sprintf("%v", p[d]) == fmt.Sprintf("%v", path[d]) {
+			d++
+		}
+		if d == len(p) && d > bestDepth {
+			bestLine, bestCol, bestDepth = line, col, d
+		}
+	}
+
+	for i, raw := range strings.Split(string(data), "\n") {
+		line := strings.TrimRight(raw, "\r")
+		trimmed := strings.TrimLeft(line, " \t")
+		col := len(line) - len(trimmed) + 1
+		switch {
+		case trimmed == "" || trimmed[0] == '#':
+		case strings.HasPrefix(trimmed, "[["):
+			end := strings.Index(trimmed, "]]")
+			if end < 0 {
+				continue
+			}
+			keys := tomlKeys(trimmed[2:end])
+			name := strings.Join(keys, ".")
+			for k := range tables {
+				if strings.HasPrefix(k, name+".") {
+					delete(tables, k)
+				}
+			}
+			tables[name]++
+			table = tomlTablePath(keys, tables)
+			match(table, i+1, col)
+		case trimmed[0] == '[':
+			end := strings.Index(trimmed, "]")
+			if end < 0 {
+				continue
+			}
+			table = tomlTablePath(tomlKeys(trimmed[1:end]), tables)
+			match(table, i+1, col)
+		default:
+			eq := strings.Index(trimmed, "=")
+			if eq < 0 {
+				continue
+			}
+			p := append(table[:len(table):len(table)], tomlKeysPath(tomlKeys(trimmed[:eq]))...)
+			match(p, i+1, col)
+		}
+	}
+	return bestLine, bestCol, bestDepth > 0
+}
+
+// tomlTablePath adds the index of the current element of the arrays of tables to the table keys
+func tomlTablePath(keys []string, tables map[string]int) []interface{} {
+	var p []interface{}
+	for i, k := range keys {
+		p = append(p, k)
+		if n, ok := tables[strings.Join(keys[:i+1], ".")]; ok && n > 0 {
+			p = append(p, n-1)
+		}
+	}
+	return p
+}
+
+func tomlKeysPath(keys []string) []interface{} {
+	p := make([]interface{}, len(keys))
+	for i, k := range keys {
+		p[i] = k
+	}
+	return p
+}
+
+// tomlKeys splits a dotted key, removing the quotes of its parts
+func tomlKeys(s string) []string {
+	var keys []string
+	var current strings.Builder
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+			current.WriteByte(c)
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '.':
+			keys = append(keys, strings.TrimSpace(current.String()))
+			current.Reset()
+		case c != ' ' && c != '\t':
+			current.WriteByte(c)
+		}
+	}
+	return append(keys, strings.TrimSpace(current.String()))
+}
+
+func lineOffset(data []byte, line int) int {
+	offset := 0
+	for l := 1; l < line && offset < len(data); offset++ {
+		if data[offset] == '\n' {
+			l++
+		}
+	}
+	return offset
+}
+
+func normalizeDecodedValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, v := range t {
+			m[fmt.Sprintf("%v", k)] = normalizeDecodedValue(v)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, v := range t {
+			m[k] = normalizeDecodedValue(v)
+		}
+		return m
+	case []map[string]interface{}:
+		s := make([]interface{}, len(t))
+		for i, v := range t {
+			s[i] = normalizeDecodedValue(v)
+		}
+		return s
+	case []interface{}:
+		s := make([]interface{}, len(t))
+		for i, v := range t {
+			s[i] = normalizeDecodedValue(v)
+		}
+		return s
+	default:
+		return v
+	}
+}
@@ -0,0 +1,237 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewParserWithFileReader_formats(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		content string
+	}{
+		{
+			name: "/tmp/sonic.yaml",
+			content: `version: 1
+name: My lovely gateway
+port: 8080
+timeout: 3s
+cache_ttl: 3600s
+extra_config:
+  user: test
+  hits: 6
+  parents: [gomez, morticia]
+endpoints:
+  - endpoint: /github/{user}
+    method: GET
+    extra_config:
+      user: test
+      parents:
+        - gomez
+        - morticia
+    backend:
+      - host: [https://api.github.com]
+        url_pattern: /users/{user}
+        timeout: 500ms
+        required: true
+        extra_config:
+          user: test
+          parents: [gomez, morticia]
+          1: numeric key
+`,
+		},
+		{
+			name: "/tmp/sonic.yml",
+			content: `version: 1
+name: My lovely gateway
+port: 8080
+timeout: 3s
+cache_ttl: 3600s
+extra_config: {user: test, hits: 6, parents: [gomez, morticia]}
+endpoints:
+  - endpoint: /github/{user}
+    method: GET
+    extra_config: {user: test, parents: [gomez, morticia]}
+    backend:
+      - host: [https://api.github.com]
+        url_pattern: /users/{user}
+        timeout: 500ms
+        required: true
+        extra_config: {user: test, parents: [gomez, morticia]}
+`,
+		},
+		{
+			name: "/tmp/sonic.toml",
+			content: `version = 1
+name = "My lovely gateway"
+port = 8080
+timeout = "3s"
+cache_ttl = "3600s"
+
+[extra_config]
+user = "test"
+hits = 6
+parents = ["gomez", "morticia"]
+
+[[endpoints]]
+endpoint = "/github/{user}"
+method = "GET"
+
+  [endpoints.extra_config]
+  user = "test"
+  parents = ["gomez", "morticia"]
+
+  [[endpoints.backend]]
+  host = ["https://api.github.com"]
+  url_pattern = "/users/{user}"
+  timeout = "500ms"
+  required = true
+  extra_config = { user = "test", parents = ["gomez", "morticia"] }
+`,
+		},
+	} {
+		content := tc.content
+		cfg, err := NewParserWithFileReader(func(_ string) ([]byte, error) {
+			return []byte(content), nil
+		}).Parse(tc.name)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tc.name, err.Error())
+			continue
+		}
+
+		if cfg.Name != "My lovely gateway" || cfg.Port != 8080 || cfg.Timeout != 3*time.Second || cfg.CacheTTL != time.Hour {
+			t.Errorf("%s: unexpected service config: %+v", tc.name, cfg)
+		}
+		testExtraConfig(cfg.ExtraConfig, t)
+		if len(cfg.Endpoints) != 1 || len(cfg.Endpoints[0].Backend) != 1 {
+			t.Errorf("%s: unexpected endpoints: %+v", tc.name, cfg.Endpoints)
+			continue
+		}
+		testExtraConfig(cfg.Endpoints[0].ExtraConfig, t)
+
+		backend := cfg.Endpoints[0].Backend[0]
+		testExtraConfig(backend.ExtraConfig, t)
+		if backend.URLPattern != "/users/{{.User}}" || backend.Timeout != 500*time.Millisecond || !backend.Required {
+			t.Errorf("%s: unexpected backend: %+v", tc.name, backend)
+		}
+		if len(backend.Host) != 1 || backend.Host[0] != "https://api.github.com" {
+			t.Errorf("%s: unexpected hosts: %v", tc.name, backend.Host)
+		}
+	}
+}
+
+func TestNewParserWithFileReader_formatErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		content string
+		expErr  string
+	}{
+		{
+			name:    "/tmp/sonic.yaml",
+			content: "version: 1\nname: gateway\n  port: 8080\n",
+			expErr:  "'/tmp/sonic.yaml': yaml: line 3: mapping values are not allowed in this context, offset: 27, row: 2, col: 2",
+		},
+		{
+			name:    "/tmp/sonic.yml",
+			content: "version: 1\nendpoints: [\n",
+			expErr:  "'/tmp/sonic.yml': yaml: line 2: did not find expected node content, offset: 11, row: 1, col: 0",
+		},
+		{
+			name:    "/tmp/sonic.toml",
+			content: "version = 1\nname = \"gateway\nport = 8080\n",
+			expErr:  "'/tmp/sonic.toml': toml: line 2 (last key \"name\"): strings cannot contain newlines, offset: 27, row: 1, col: 15",
+		},
+		{
+			name:    "/tmp/sonic.yaml",
+			content: "version: 1\nendpoints: 42\n",
+			expErr:  "'/tmp/sonic.yaml': cannot unmarshal number into Go struct field parseableServiceConfig.endpoints of type []*config.parseableEndpointConfig, offset: 22, row: 1, col: 11",
+		},
+		{
+			name:    "/tmp/sonic.yaml",
+			content: "version: 1\nendpoints:\n  - endpoint: /a\n  - endpoint: /b\n    backend:\n      - host: [\"http://a\"]\n        url_pattern:\n          path: /b\n",
+			expErr:  "'/tmp/sonic.yaml': cannot unmarshal object into Go struct field parseableServiceConfig.endpoints.1.backend.0.url_pattern of type string, offset: 127, row: 7, col: 10",
+		},
+		{
+			name:    "/tmp/sonic.toml",
+			content: "version = 1\n\n[[endpoints]]\nendpoint = \"/a\"\n\n[[endpoints]]\nendpoint = \"/b\"\n\n[[endpoints.backend]]\nhost = [\"http://a\"]\n  url_pattern = 42\n",
+			expErr:  "'/tmp/sonic.toml': cannot unmarshal number into Go struct field parseableServiceConfig.endpoints.1.backend.0.url_pattern of type string, offset: 119, row: 10, col: 2",
+		},
+		{
+			name:    "/tmp/sonic.toml",
+			content: "version = 1\n\n[[endpoints]]\nendpoint = \"/a\"\nbackend = [{ host = [\"http://a\"], url_pattern = true }]\n",
+			expErr:  "'/tmp/sonic.toml': cannot unmarshal bool into Go struct field parseableServiceConfig.endpoints.0.backend.0.url_pattern of type string, offset: 43, row: 4, col: 0",
+		},
+	} {
+		content := tc.content
+		_, err := NewParserWithFileReader(func(_ string) ([]byte, error) {
+			return []byte(content), nil
+		}).Parse(tc.name)
+		if err == nil {
+			t.Errorf("%s: expecting an error", tc.name)
+			continue
+		}
+		if err.Error() != tc.expErr {
+			t.Errorf("%s: unexpected error. Got '%s' want '%s'", tc.name, err.Error(), tc.expErr)
+		}
+	}
+}
+
+func TestRegisterFormatDecoder(t *testing.T) {
+	RegisterFormatDecoder(".custom", func(_ []byte) (map[string]interface{}, error) {
+		return map[string]interface{}{"version": 1, "name": "custom"}, nil
+	})
+
+	cfg, err := NewParserWithFileReader(func(_ string) ([]byte, error) {
+		return []byte("whatever"), nil
+	}).Parse("/tmp/sonic.CUSTOM")
+	if err != nil {
+		t.Errorf("unexpected error: %s", err.Error())
+		return
+	}
+	if cfg.Name != "custom" {
+		t.Errorf("unexpected name: %s", cfg.Name)
+	}
+}
+
+func TestDecodeDocument_normalized(t *testing.T) {
+	RegisterFormatDecoder("generic", func(_ []byte) (map[string]interface{}, error) {
+		return map[string]interface{}{
+			"version": 2,
+			"extra_config": map[interface{}]interface{}{
+				"ns": []map[string]interface{}{{"key": map[interface{}]interface{}{1: "numeric key"}}},
+			},
+		}, nil
+	})
+
+	doc, err := DecodeDocument("turbo.generic", []byte("whatever"))
+	if err != nil {
+		t.Errorf("unexpected error: %s", err.Error())
+		return
+	}
+	expected := map[string]interface{}{
+		"version": 2,
+		"extra_config": map[string]interface{}{
+			"ns": []interface{}{map[string]interface{}{"key": map[string]interface{}{"1": "numeric key"}}},
+		},
+	}
+	if !reflect.DeepEqual(doc, expected) {
+		t.Errorf("unexpected document: %#v", doc)
+	}
+}
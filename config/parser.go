@@ -45,30 +45,48 @@ type parser struct {
 }
 
 func (p parser) Parse(configFile string) (ServiceConfig, error) {
-	var result ServiceConfig
-	var cfg parseableServiceConfig
 	data, err := p.fileReader(configFile)
 	if err != nil {
-		return result, CheckErr(err, configFile)
+		return ServiceConfig{}, CheckErr(err, configFile)
 	}
-	if err = json.Unmarshal(data, &cfg); err != nil {
-		return result, CheckErr(err, configFile)
+	return parseServiceConfig(configFile, configFile, data)
+}
+
+// parseServiceConfig decodes the data with the decoder matching the extension of the format file
+func parseServiceConfig(configFile, formatFile string, data []byte) (ServiceConfig, error) {
+	var result ServiceConfig
+	cfg, err := decodeServiceConfig(formatFile, data)
+	if err != nil {
+		return result, checkErr(err, configFile, data)
 	}
 	result = cfg.normalize()
 
-	if err = result.Init(); err != nil {
-		return result, CheckErr(err, configFile)
+	if err := result.resolveSecrets(); err != nil {
+		return result, checkErr(err, configFile, data)
+	}
+
+	if err := result.Init(); err != nil {
+		return result, checkErr(err, configFile, data)
 	}
 
 	return result, nil
 }
 
 func CheckErr(err error, configFile string) error {
+	return checkErr(err, configFile, nil)
+}
+
+func checkErr(err error, configFile string, data []byte) error {
+	if data == nil {
+		data, _ = ioutil.ReadFile(configFile)
+	}
 	switch e := err.(type) {
 	case *json.SyntaxError:
-		return NewParseError(err, configFile, int(e.Offset))
+		return newParseError(err, configFile, data, int(e.Offset))
 	case *json.UnmarshalTypeError:
-		return NewParseError(err, configFile, int(e.Offset))
+		return newParseError(err, configFile, data, int(e.Offset))
+	case *FormatError:
+		return newParseError(e.Err, configFile, data, e.Offset)
 	case *os.PathError:
 		return fmt.Errorf(
 			"'%s' (%s): %s",
@@ -83,7 +101,11 @@ func CheckErr(err error, configFile string) error {
 
 func NewParseError(err error, configFile string, offset int) *ParseError {
 	b, _ := ioutil.ReadFile(configFile)
-	row, col := getErrorRowCol(b, offset)
+	return newParseError(err, configFile, b, offset)
+}
+
+func newParseError(err error, configFile string, data []byte, offset int) *ParseError {
+	row, col := getErrorRowCol(data, offset)
 	return &ParseError{
 		ConfigFile: configFile,
 		Err:        err,
@@ -118,10 +140,11 @@ type ParseError struct {
 	Row        int
 	Col        int
 	Err        error
+	Rendered   bool
 }
 
 func (p *ParseError) Error() string {
-	return fmt.Sprintf(
+	msg := fmt.Sprintf(
 		"'%s': %v, offset: %v, row: %v, col: %v",
 		p.ConfigFile,
 		p.Err.Error(),
@@ -129,6 +152,10 @@ func (p *ParseError) Error() string {
 		p.Row,
 		p.Col,
 	)
+	if p.Rendered {
+		msg += " (position in the rendered template)"
+	}
+	return msg
 }
 
 type FileReaderFunc func(string) ([]byte, error)
@@ -136,30 +163,32 @@ type FileReaderFunc func(string) ([]byte, error)
 type parseableServiceConfig struct {
 	Name                      string                     `json:"name"`
 	Endpoints                 []*parseableEndpointConfig `json:"endpoints"`
-	Timeout                   string                     `json:"timeout"`
-	CacheTTL                  string                     `json:"cache_ttl"`
+	Timeout                   parseableDuration          `json:"timeout"`
+	CacheTTL                  parseableDuration          `json:"cache_ttl"`
 	Host                      []string                   `json:"host"`
 	Port                      int                        `json:"port"`
 	Version                   int                        `json:"version"`
 	ExtraConfig               *ExtraConfig               `json:"extra_config,omitempty"`
-	ReadTimeout               string                     `json:"read_timeout"`
-	WriteTimeout              string                     `json:"write_timeout"`
-	IdleTimeout               string                     `json:"idle_timeout"`
-	ReadHeaderTimeout         string                     `json:"read_header_timeout"`
+	ReadTimeout               parseableDuration          `json:"read_timeout"`
+	WriteTimeout              parseableDuration          `json:"write_timeout"`
+	IdleTimeout               parseableDuration          `json:"idle_timeout"`
+	ReadHeaderTimeout         parseableDuration          `json:"read_header_timeout"`
 	DisableKeepAlives         bool                       `json:"disable_keep_alives"`
 	DisableCompression        bool                       `json:"disable_compression"`
 	MaxIdleConnections        int                        `json:"max_idle_connections"`
 	MaxIdleConnectionsPerHost int                        `json:"max_idle_connections_per_host"`
-	IdleConnectionTimeout     string                     `json:"idle_connection_timeout"`
-	ResponseHeaderTimeout     string                     `json:"response_header_timeout"`
-	ExpectContinueTimeout     string                     `json:"expect_continue_timeout"`
+	IdleConnectionTimeout     parseableDuration          `json:"idle_connection_timeout"`
+	ResponseHeaderTimeout     parseableDuration          `json:"response_header_timeout"`
+	ExpectContinueTimeout     parseableDuration          `json:"expect_continue_timeout"`
 	OutputEncoding            string                     `json:"output_encoding"`
-	DialerTimeout             string                     `json:"dialer_timeout"`
-	DialerFallbackDelay       string                     `json:"dialer_fallback_delay"`
-	DialerKeepAlive           string                     `json:"dialer_keep_alive"`
+	DialerTimeout             parseableDuration          `json:"dialer_timeout"`
+	DialerFallbackDelay       parseableDuration          `json:"dialer_fallback_delay"`
+	DialerKeepAlive           parseableDuration          `json:"dialer_keep_alive"`
 	Debug                     bool
-	Plugin                    *Plugin       `json:"plugin,omitempty"`
-	TLS                       *parseableTLS `json:"tls,omitempty"`
+	Plugin                    *Plugin                      `json:"plugin,omitempty"`
+	TLS                       *parseableTLS                `json:"tls,omitempty"`
+	BackendTemplates          map[string]*parseableBackend `json:"backend_templates,omitempty"`
+	EndpointDefaults          *parseableEndpointDefaults   `json:"endpoint_defaults,omitempty"`
 }
 
 func (p *parseableServiceConfig) normalize() ServiceConfig {
@@ -204,14 +233,61 @@ func (p *parseableServiceConfig) normalize() ServiceConfig {
 	if p.ExtraConfig != nil {
 		cfg.ExtraConfig = *p.ExtraConfig
 	}
+	if cfg.Version == ConfigVersion1 {
+		cfg.Version = TurboConfigVersion
+		cfg.upgradedV1 = true
+	}
 	endpoints := make([]*EndpointConfig, 0, len(p.Endpoints))
 	for _, e := range p.Endpoints {
 		endpoints = append(endpoints, e.normalize())
 	}
 	cfg.Endpoints = endpoints
+	if p.EndpointDefaults != nil {
+		cfg.EndpointDefaults = p.EndpointDefaults.normalize()
+	}
+	cfg.BackendTemplates = normalizeBackendTemplates(p.BackendTemplates)
 	return cfg
 }
 
+func normalizeBackendTemplates(templates map[string]*parseableBackend) map[string]*Backend {
+	if len(templates) == 0 {
+		return nil
+	}
+	res := make(map[string]*Backend, len(templates))
+	for name, t := range templates {
+		if t != nil {
+			res[name] = t.normalize()
+		}
+	}
+	return res
+}
+
+// parseableEndpointDefaults holds the endpoint fields that can be defined once for all the endpoints
+type parseableEndpointDefaults struct {
+	Method          string            `json:"method"`
+	ConcurrentCalls int               `json:"concurrent_calls"`
+	Timeout         parseableDuration `json:"timeout"`
+	CacheTTL        int               `json:"cache_ttl"`
+	QueryString     []string          `json:"querystring_params"`
+	ExtraConfig     *ExtraConfig      `json:"extra_config,omitempty"`
+	HeadersToPass   []string          `json:"headers_to_pass"`
+	OutputEncoding  string            `json:"output_encoding"`
+}
+
+func (p *parseableEndpointDefaults) normalize() *EndpointConfig {
+	e := parseableEndpointConfig{
+		Method:          p.Method,
+		ConcurrentCalls: p.ConcurrentCalls,
+		Timeout:         p.Timeout,
+		CacheTTL:        p.CacheTTL,
+		QueryString:     p.QueryString,
+		ExtraConfig:     p.ExtraConfig,
+		HeadersToPass:   p.HeadersToPass,
+		OutputEncoding:  p.OutputEncoding,
+	}
+	return e.normalize()
+}
+
 type parseableTLS struct {
 	IsDisabled               bool     `json:"disabled"`
 	PublicKey                string   `json:"public_key"`
@@ -229,7 +305,7 @@ type parseableEndpointConfig struct {
 	Method          string              `json:"method"`
 	Backend         []*parseableBackend `json:"backend"`
 	ConcurrentCalls int                 `json:"concurrent_calls"`
-	Timeout         string              `json:"timeout"`
+	Timeout         parseableDuration   `json:"timeout"`
 	CacheTTL        int                 `json:"cache_ttl"`
 	QueryString     []string            `json:"querystring_params"`
 	ExtraConfig     *ExtraConfig        `json:"extra_config,omitempty"`
@@ -263,32 +339,47 @@ type parseableBackend struct {
 	Group                    string            `json:"group"`
 	Method                   string            `json:"method"`
 	Host                     []string          `json:"host"`
-	HostSanitizationDisabled bool              `json:"disable_host_sanitize"`
+	HostSanitizationDisabled *bool             `json:"disable_host_sanitize"`
 	URLPattern               string            `json:"url_pattern"`
 	AllowList                []string          `json:"allow"`
 	DenyList                 []string          `json:"deny"`
 	Mapping                  map[string]string `json:"mapping"`
 	Encoding                 string            `json:"encoding"`
-	IsCollection             bool              `json:"is_collection"`
+	IsCollection             *bool             `json:"is_collection"`
 	Target                   string            `json:"target"`
 	ExtraConfig              *ExtraConfig      `json:"extra_config,omitempty"`
 	SD                       string            `json:"discovery"`
+	Timeout                  parseableDuration `json:"timeout"`
+	Required                 *bool             `json:"required"`
+	Template                 string            `json:"template"`
 }
 
 func (p *parseableBackend) normalize() *Backend {
 	b := Backend{
-		Group:                    p.Group,
-		Method:                   p.Method,
-		Host:                     p.Host,
-		HostSanitizationDisabled: p.HostSanitizationDisabled,
-		URLPattern:               p.URLPattern,
-		Mapping:                  p.Mapping,
-		Encoding:                 p.Encoding,
-		IsCollection:             p.IsCollection,
-		Target:                   p.Target,
-		SD:                       p.SD,
-		AllowList:                p.AllowList,
-		DenyList:                 p.DenyList,
+		Group:      p.Group,
+		Method:     p.Method,
+		Host:       p.Host,
+		URLPattern: p.URLPattern,
+		Mapping:    p.Mapping,
+		Encoding:   p.Encoding,
+		Target:     p.Target,
+		SD:         p.SD,
+		AllowList:  p.AllowList,
+		DenyList:   p.DenyList,
+		Timeout:    parseDuration(p.Timeout),
+		Template:   p.Template,
+	}
+	if p.HostSanitizationDisabled != nil {
+		b.HostSanitizationDisabled = *p.HostSanitizationDisabled
+		b.flags.hostSanitizationDisabled = true
+	}
+	if p.IsCollection != nil {
+		b.IsCollection = *p.IsCollection
+		b.flags.isCollection = true
+	}
+	if p.Required != nil {
+		b.Required = *p.Required
+		b.flags.required = true
 	}
 	if p.ExtraConfig != nil {
 		b.ExtraConfig = *p.ExtraConfig
@@ -296,8 +387,12 @@ func (p *parseableBackend) normalize() *Backend {
 	return &b
 }
 
-func parseDuration(v string) time.Duration {
-	d, err := time.ParseDuration(v)
+// parseableDuration is a duration in the format accepted by time.ParseDuration. Invalid values are
+// ignored when parsing the config, so the validation reports them
+type parseableDuration string
+
+func parseDuration(v parseableDuration) time.Duration {
+	d, err := time.ParseDuration(string(v))
 	if err != nil {
 		return 0
 	}
@@ -20,6 +20,7 @@ import (
 	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 )
 
 func TestNewParser_ok(t *testing.T) {
@@ -85,6 +86,8 @@ func TestNewParser_ok(t *testing.T) {
                         "https://jsonplaceholder.typicode.com"
                     ],
                     "url_pattern": "/users/{id}",
+                    "timeout": "500ms",
+                    "required": true,
                     "mapping": {
                         "email": "personal_email"
                     }
@@ -138,6 +141,14 @@ func TestNewParser_ok(t *testing.T) {
 		t.Error("Extra config is not present in BackendConfig")
 	}
 
+	combination := serviceConfig.Endpoints[2]
+	if b := combination.Backend[0]; b.Timeout != 3*time.Second || b.Required {
+		t.Errorf("unexpected backend timeout and required flag: %v %v", b.Timeout, b.Required)
+	}
+	if b := combination.Backend[1]; b.Timeout != 500*time.Millisecond || !b.Required {
+		t.Errorf("unexpected backend timeout and required flag: %v %v", b.Timeout, b.Required)
+	}
+
 	if err := os.Remove(configPath); err != nil {
 		t.FailNow()
 	}
@@ -276,7 +287,7 @@ func TestNewParser_initError(t *testing.T) {
 	}
 
 	_, err := NewParser().Parse(wrongConfigPath)
-	if err == nil || err.Error() != "'/tmp/unmarshall.json': unsupported version: 0 (want: 1)" {
+	if err == nil || err.Error() != "'/tmp/unmarshall.json': unsupported version: 0 (want: 2)" {
 		t.Error("Error expected. Got", err)
 	}
 	if err = os.Remove(wrongConfigPath); err != nil {
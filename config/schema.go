@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+const JSONSchemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// DurationPattern matches the durations accepted by time.ParseDuration
+const DurationPattern = `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`
+
+var requiredFields = map[reflect.Type][]string{
+	reflect.TypeOf(parseableServiceConfig{}):    {"version"},
+	reflect.TypeOf(parseableEndpointConfig{}):   {"endpoint", "backend"},
+	reflect.TypeOf(parseableServiceConfigV2{}):  {"version"},
+	reflect.TypeOf(parseableEndpointConfigV2{}): {"endpoint", "backend"},
+}
+
+// JSONSchema returns the JSON Schema of the current version of the config files, generated from the
+// config structs
+func JSONSchema() map[string]interface{} {
+	schema := typeSchema(parseableServiceConfigType)
+	schema["$schema"] = JSONSchemaDraft
+	schema["title"] = "Turbo service config"
+	return schema
+}
+
+func typeSchema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == parseableDurationType:
+		return map[string]interface{}{"type": "string", "pattern": DurationPattern}
+	case t == extraConfigType:
+		return map[string]interface{}{"type": "object"}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		properties := map[string]interface{}{}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, ok := jsonFieldName(f)
+			if !ok {
+				continue
+			}
+			if name == f.Name {
+				name = strings.ToLower(name)
+			}
+			properties[name] = typeSchema(f.Type)
+		}
+		schema := map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"additionalProperties": false,
+		}
+		if required, ok := requiredFields[t]; ok {
+			schema["required"] = required
+		}
+		return schema
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	}
+	return map[string]interface{}{}
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestJSONSchema(t *testing.T) {
+	schema := JSONSchema()
+	if schema["$schema"] != JSONSchemaDraft {
+		t.Errorf("unexpected draft: %v", schema["$schema"])
+	}
+	if _, err := json.Marshal(schema); err != nil {
+		t.Errorf("the schema can not be serialized: %s", err.Error())
+	}
+
+	properties := schema["properties"].(map[string]interface{})
+	for _, k := range []string{"version", "timeout", "endpoints", "extra_config", "tls", "debug"} {
+		if _, ok := properties[k]; !ok {
+			t.Errorf("missing property: %s", k)
+		}
+	}
+	if timeout := properties["timeout"].(map[string]interface{}); timeout["pattern"] != DurationPattern {
+		t.Errorf("unexpected timeout schema: %v", timeout)
+	}
+
+	endpoints := properties["endpoints"].(map[string]interface{})
+	endpoint := endpoints["items"].(map[string]interface{})
+	if r := endpoint["required"].([]string); len(r) != 2 || r[0] != "endpoint" || r[1] != "backend" {
+		t.Errorf("unexpected required fields: %v", r)
+	}
+	backend := endpoint["properties"].(map[string]interface{})["backend"].(map[string]interface{})["items"].(map[string]interface{})
+	backendProperties := backend["properties"].(map[string]interface{})
+	if _, ok := backendProperties["sd"]; !ok {
+		t.Error("missing the sd property")
+	}
+	if _, ok := backendProperties["discovery"]; ok {
+		t.Error("the discovery property belongs to the version 1")
+	}
+	cacheTTL := endpoint["properties"].(map[string]interface{})["cache_ttl"].(map[string]interface{})
+	if cacheTTL["type"] != "string" || cacheTTL["pattern"] != DurationPattern {
+		t.Errorf("unexpected endpoint cache_ttl schema: %v", cacheTTL)
+	}
+	if mapping := backendProperties["mapping"].(map[string]interface{}); mapping["type"] != "object" {
+		t.Errorf("unexpected mapping schema: %v", mapping)
+	}
+	if backend["additionalProperties"] != false {
+		t.Error("the unknown keys should not be allowed")
+	}
+}
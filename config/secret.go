@@ -0,0 +1,277 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/starvn/turbo/register"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const (
+	EnvSecretScheme    = "env"
+	FileSecretScheme   = "file"
+	Base64SecretScheme = "base64"
+
+	secretSchemeSeparator = "://"
+)
+
+// SecretResolver returns the value referenced by the part of a secret reference following the scheme,
+// so a reference like env://TOKEN is resolved by the resolver of the env scheme with TOKEN
+type SecretResolver func(ref string) (string, error)
+
+var secretResolvers = initSecretResolvers()
+
+func initSecretResolvers() *register.Untyped {
+	r := register.NewUntyped()
+	r.Register(EnvSecretScheme, SecretResolver(EnvSecretResolver))
+	r.Register(FileSecretScheme, SecretResolver(FileSecretResolver))
+	r.Register(Base64SecretScheme, SecretResolver(Base64SecretResolver))
+	return r
+}
+
+// RegisterSecretResolver adds or replaces the resolver of the references using the scheme
+func RegisterSecretResolver(scheme string, r SecretResolver) {
+	secretResolvers.Register(strings.ToLower(scheme), r)
+}
+
+func EnvSecretResolver(name string) (string, error) {
+	v, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("the environment variable %s is not defined", name)
+	}
+	return v, nil
+}
+
+// FileSecretResolver returns the content of the file, without the trailing line breaks
+func FileSecretResolver(path string) (string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+func Base64SecretResolver(encoded string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+type SecretError struct {
+	Ref string
+	Err error
+}
+
+func (s *SecretError) Error() string {
+	return fmt.Sprintf("resolving the secret %s: %s", s.Ref, s.Err.Error())
+}
+
+// resolveSecrets replaces every string of the config holding a reference with a registered scheme
+// by the resolved value. The references are kept by the path of the value for Redacted, and a digest
+// of the resolved values is kept for Hash
+func (s *ServiceConfig) resolveSecrets() error {
+	secrets := map[string]string{}
+	resolved := map[string]string{}
+	err := replaceStrings(reflect.ValueOf(s).Elem(), "", func(path, v string) (string, bool, error) {
+		r, ok, err := resolveSecret(v)
+		if ok {
+			secrets[path] = v
+			resolved[path] = r
+		}
+		return r, ok, err
+	})
+	if err != nil {
+		return err
+	}
+	if len(secrets) == 0 {
+		return nil
+	}
+	paths := make([]string, 0, len(resolved))
+	for path := range resolved {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	h := sha256.New()
+	for _, path := range paths {
+		h.Write([]byte(path))
+		h.Write([]byte{0})
+		h.Write([]byte(resolved[path]))
+		h.Write([]byte{0})
+	}
+	s.secrets = secrets
+	s.secretsDigest = h.Sum(nil)
+	return nil
+}
+
+// trackInheritedSecrets adds the paths of the secrets copied from the endpoint defaults and the backend
+// templates into the endpoints and the backends
+func (s *ServiceConfig) trackInheritedSecrets() {
+	if len(s.secrets) == 0 {
+		return
+	}
+	values := map[string]string{}
+	_ = replaceStrings(reflect.ValueOf(s).Elem(), "", func(path, v string) (string, bool, error) {
+		values[path] = v
+		return v, false, nil
+	})
+	inherit := func(from, to string) {
+		for path, ref := range s.secrets {
+			if !strings.HasPrefix(path, from+".") {
+				continue
+			}
+			target := to + strings.TrimPrefix(path, from)
+			if v, ok := values[target]; ok && v == values[path] {
+				s.secrets[target] = ref
+			}
+		}
+	}
+	for i, e := range s.Endpoints {
+		endpoint := fmt.Sprintf(".Endpoints[%d]", i)
+		if s.EndpointDefaults != nil {
+			inherit(".EndpointDefaults", endpoint)
+		}
+		for j, b := range e.Backend {
+			if b.Template != "" {
+				inherit(fmt.Sprintf(".BackendTemplates[%q]", b.Template), fmt.Sprintf("%s.Backend[%d]", endpoint, j))
+			}
+		}
+	}
+}
+
+// IsSecretReference tells if the value is a reference using the scheme of a registered resolver
+func IsSecretReference(s string) bool {
+	idx := strings.Index(s, secretSchemeSeparator)
+	if idx <= 0 {
+		return false
+	}
+	v, ok := secretResolvers.Get(strings.ToLower(s[:idx]))
+	if !ok {
+		return false
+	}
+	resolver, ok := v.(SecretResolver)
+	return ok && resolver != nil
+}
+
+func resolveSecret(s string) (string, bool, error) {
+	idx := strings.Index(s, secretSchemeSeparator)
+	if idx <= 0 {
+		return s, false, nil
+	}
+	v, ok := secretResolvers.Get(strings.ToLower(s[:idx]))
+	if !ok {
+		return s, false, nil
+	}
+	resolver, ok := v.(SecretResolver)
+	if !ok || resolver == nil {
+		return s, false, nil
+	}
+	resolved, err := resolver(s[idx+len(secretSchemeSeparator):])
+	if err != nil {
+		return s, false, &SecretError{Ref: s, Err: err}
+	}
+	return resolved, true, nil
+}
+
+// Redacted returns a copy of the config with the resolved secrets replaced by their references, so it
+// can be logged or dumped safely
+func (s ServiceConfig) Redacted() (ServiceConfig, error) {
+	if len(s.secrets) == 0 {
+		return s, nil
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		return ServiceConfig{}, err
+	}
+	var redacted ServiceConfig
+	if err := json.Unmarshal(b, &redacted); err != nil {
+		return ServiceConfig{}, err
+	}
+	_ = replaceStrings(reflect.ValueOf(&redacted).Elem(), "", func(path, _ string) (string, bool, error) {
+		ref, ok := s.secrets[path]
+		return ref, ok, nil
+	})
+	redacted.uriParser = s.uriParser
+	return redacted, nil
+}
+
+// replaceStrings walks the value replacing the strings found in the exported fields, slices and map
+// values, but not in the map keys. The replace function gets the path of every string, built with the
+// names of the fields, the indexes of the slices and the quoted keys of the maps
+func replaceStrings(v reflect.Value, path string, replace func(path, v string) (string, bool, error)) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return replaceStrings(v.Elem(), path, replace)
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		elem := reflect.New(v.Elem().Type()).Elem()
+		elem.Set(v.Elem())
+		if err := replaceStrings(elem, path, replace); err != nil {
+			return err
+		}
+		v.Set(elem)
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			if t.Field(i).PkgPath != "" {
+				continue
+			}
+			if err := replaceStrings(v.Field(i), path+"."+t.Field(i).Name, replace); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := replaceStrings(v.Index(i), fmt.Sprintf("%s[%d]", path, i), replace); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(iter.Value())
+			if err := replaceStrings(elem, fmt.Sprintf("%s[%q]", path, fmt.Sprint(iter.Key().Interface())), replace); err != nil {
+				return err
+			}
+			v.SetMapIndex(iter.Key(), elem)
+		}
+	case reflect.String:
+		s, ok, err := replace(path, v.String())
+		if err != nil {
+			return err
+		}
+		if ok {
+			v.SetString(s)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,308 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotModified is returned by the sources when the document did not change since the last fetch
+var ErrNotModified = errors.New("config: the source has not been modified")
+
+// DefaultChecksumHeader is the response header with the hex encoded SHA-256 checksum of the document
+const DefaultChecksumHeader = "X-Checksum-Sha256"
+
+// Source provides the content of a config document. The extension of its name selects the format
+// decoder
+type Source interface {
+	Name() string
+	Fetch(ctx context.Context) ([]byte, error)
+}
+
+// ResettableSource is a source able to forget the last document fetched, so the next fetch returns
+// it again even if it did not change. The pollers reset their sources when a document can not be
+// parsed, as the failure may be transient, like a secret not available yet
+type ResettableSource interface {
+	Source
+	Reset()
+}
+
+// NewFileSource returns a source reading the file. The fetches return ErrNotModified while the
+// checksum of the content does not change
+func NewFileSource(path string) Source {
+	return NewFileSourceWithFileReader(path, ioutil.ReadFile)
+}
+
+func NewFileSourceWithFileReader(path string, f FileReaderFunc) Source {
+	return &fileSource{path: path, fileReader: f, mu: &sync.Mutex{}}
+}
+
+type fileSource struct {
+	path       string
+	fileReader FileReaderFunc
+	checksum   [sha256.Size]byte
+	fetched    bool
+	mu         *sync.Mutex
+}
+
+func (f *fileSource) Name() string { return f.path }
+
+func (f *fileSource) Reset() {
+	f.mu.Lock()
+	f.fetched = false
+	f.mu.Unlock()
+}
+
+func (f *fileSource) Fetch(_ context.Context) ([]byte, error) {
+	data, err := f.fileReader(f.path)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fetched && sum == f.checksum {
+		return nil, ErrNotModified
+	}
+	f.checksum, f.fetched = sum, true
+	return data, nil
+}
+
+// HTTPSource fetches the document from a config service. It sends the ETag of the last document
+// received, so the service can answer with a 304, and verifies the checksum header when present
+type HTTPSource struct {
+	URL            string
+	Client         *http.Client
+	Header         http.Header
+	ChecksumHeader string
+
+	etag     string
+	checksum string
+	mu       *sync.Mutex
+}
+
+func NewHTTPSource(u string) *HTTPSource {
+	return &HTTPSource{
+		URL:            u,
+		Client:         http.DefaultClient,
+		Header:         http.Header{},
+		ChecksumHeader: DefaultChecksumHeader,
+		mu:             &sync.Mutex{},
+	}
+}
+
+// Name returns the URL without the query string, so the extension of the path selects the format
+func (h *HTTPSource) Name() string {
+	u, err := url.Parse(h.URL)
+	if err != nil {
+		return h.URL
+	}
+	u.RawQuery, u.Fragment = "", ""
+	return u.String()
+}
+
+func (h *HTTPSource) Reset() {
+	h.mu.Lock()
+	h.etag, h.checksum = "", ""
+	h.mu.Unlock()
+}
+
+func (h *HTTPSource) Fetch(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range h.Header {
+		req.Header[k] = vs
+	}
+
+	h.mu.Lock()
+	etag, last := h.etag, h.checksum
+	h.mu.Unlock()
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := h.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, ErrNotModified
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(data)
+	checksum := hex.EncodeToString(sum[:])
+	if h.ChecksumHeader != "" {
+		if expected := resp.Header.Get(h.ChecksumHeader); expected != "" && !strings.EqualFold(expected, checksum) {
+			return nil, fmt.Errorf("checksum mismatch: expected %s, got %s", expected, checksum)
+		}
+	}
+
+	h.mu.Lock()
+	h.etag, h.checksum = resp.Header.Get("ETag"), checksum
+	h.mu.Unlock()
+
+	if checksum == last {
+		return nil, ErrNotModified
+	}
+	return data, nil
+}
+
+// MemorySource holds the document in memory. Every Set is returned once by Fetch
+type MemorySource struct {
+	name    string
+	data    []byte
+	changed bool
+	mu      *sync.Mutex
+}
+
+func NewMemorySource(name string, data []byte) *MemorySource {
+	return &MemorySource{name: name, data: data, changed: true, mu: &sync.Mutex{}}
+}
+
+func (m *MemorySource) Name() string { return m.name }
+
+func (m *MemorySource) Set(data []byte) {
+	m.mu.Lock()
+	m.changed = m.changed || !bytes.Equal(m.data, data)
+	m.data = data
+	m.mu.Unlock()
+}
+
+func (m *MemorySource) Reset() {
+	m.mu.Lock()
+	m.changed = true
+	m.mu.Unlock()
+}
+
+func (m *MemorySource) Fetch(_ context.Context) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.changed {
+		return nil, ErrNotModified
+	}
+	m.changed = false
+	return m.data, nil
+}
+
+// SourcePoller parses the documents fetched from a source, keeping the last good config
+type SourcePoller struct {
+	source   Source
+	interval time.Duration
+	last     ServiceConfig
+	loaded   bool
+	mu       *sync.RWMutex
+}
+
+func NewSourcePoller(source Source, interval time.Duration) *SourcePoller {
+	return &SourcePoller{source: source, interval: interval, mu: &sync.RWMutex{}}
+}
+
+// Config returns the last good config, if any
+func (p *SourcePoller) Config() (ServiceConfig, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.last, p.loaded
+}
+
+// Load fetches and parses the document. If the source was not modified or the document is not valid,
+// it returns the last good config along with the error. The resettable sources are reset when the
+// document is not valid, so it is parsed again by the next load
+func (p *SourcePoller) Load(ctx context.Context) (ServiceConfig, error) {
+	name := p.source.Name()
+	data, err := p.source.Fetch(ctx)
+	if err == nil {
+		var cfg ServiceConfig
+		if cfg, err = parseServiceConfig(name, name, data); err == nil {
+			p.mu.Lock()
+			p.last, p.loaded = cfg, true
+			p.mu.Unlock()
+			return cfg, nil
+		}
+		if r, ok := p.source.(ResettableSource); ok {
+			r.Reset()
+		}
+	} else if err != ErrNotModified {
+		err = fmt.Errorf("'%s': %s", name, err.Error())
+	}
+	last, _ := p.Config()
+	return last, err
+}
+
+// Poll loads the source at every interval, until the context is cancelled. The unmodified fetches
+// are skipped and the failed ones are sent with the last good config, once per distinct error. The
+// first load happens after the first interval, so the callers needing the initial config must call
+// Load before polling
+func (p *SourcePoller) Poll(ctx context.Context) <-chan Update {
+	out := make(chan Update)
+	go func() {
+		defer close(out)
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+
+		lastErr := ""
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			cfg, err := p.Load(ctx)
+			if err == ErrNotModified {
+				continue
+			}
+			if err != nil {
+				// the invalid documents are parsed again at every interval, but reported only once
+				if err.Error() == lastErr {
+					continue
+				}
+				lastErr = err.Error()
+			} else {
+				lastErr = ""
+			}
+			select {
+			case out <- Update{Config: cfg, Err: err}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,204 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHTTPSource(t *testing.T) {
+	mu := &sync.Mutex{}
+	doc, etag, checksum := `{"version": 1, "name": "v1", "endpoints": []}`, `"v1"`, ""
+	var ifNoneMatch []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		ifNoneMatch = append(ifNoneMatch, r.Header.Get("If-None-Match"))
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		sum := sha256.Sum256([]byte(doc))
+		if checksum == "" {
+			w.Header().Set(DefaultChecksumHeader, hex.EncodeToString(sum[:]))
+		} else {
+			w.Header().Set(DefaultChecksumHeader, checksum)
+		}
+		w.Header().Set("ETag", etag)
+		fmt.Fprint(w, doc)
+	}))
+	defer ts.Close()
+
+	source := NewHTTPSource(ts.URL + "/turbo.json?env=prod")
+	source.Header.Set("Authorization", "Bearer token")
+	if source.Name() != ts.URL+"/turbo.json" {
+		t.Errorf("unexpected name: %s", source.Name())
+	}
+	poller := NewSourcePoller(source, time.Second)
+
+	cfg, err := poller.Load(context.Background())
+	if err != nil || cfg.Name != "v1" {
+		t.Errorf("unexpected result: %v %v", cfg.Name, err)
+	}
+	cfg, err = poller.Load(context.Background())
+	if err != ErrNotModified || cfg.Name != "v1" {
+		t.Errorf("unexpected result: %v %v", cfg.Name, err)
+	}
+
+	mu.Lock()
+	doc, etag, checksum = `{"version": 1, "name": "v2", "endpoints": []}`, `"v2"`, "bad"
+	mu.Unlock()
+	cfg, err = poller.Load(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") || cfg.Name != "v1" {
+		t.Errorf("unexpected result: %v %v", cfg.Name, err)
+	}
+
+	mu.Lock()
+	checksum = ""
+	mu.Unlock()
+	cfg, err = poller.Load(context.Background())
+	if err != nil || cfg.Name != "v2" {
+		t.Errorf("unexpected result: %v %v", cfg.Name, err)
+	}
+
+	mu.Lock()
+	doc, etag = `{"version": 42}`, `"v3"`
+	mu.Unlock()
+	cfg, err = poller.Load(context.Background())
+	if err == nil || cfg.Name != "v2" {
+		t.Errorf("unexpected result: %v %v", cfg.Name, err)
+	}
+
+	source.Header.Del("Authorization")
+	if _, err = poller.Load(context.Background()); err == nil || !strings.Contains(err.Error(), "unexpected status code 401") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := []string{"", `"v1"`, `"v1"`, `"v1"`, `"v2"`}
+	if strings.Join(ifNoneMatch, ",") != strings.Join(expected, ",") {
+		t.Errorf("unexpected If-None-Match headers: %v", ifNoneMatch)
+	}
+}
+
+func TestFileSource(t *testing.T) {
+	content := []byte(`{"version": 1}`)
+	source := NewFileSourceWithFileReader("turbo.json", func(_ string) ([]byte, error) { return content, nil })
+
+	if b, err := source.Fetch(context.Background()); err != nil || string(b) != string(content) {
+		t.Errorf("unexpected result: %s %v", b, err)
+	}
+	if _, err := source.Fetch(context.Background()); err != ErrNotModified {
+		t.Errorf("unexpected error: %v", err)
+	}
+	content = []byte(`{"version": 2}`)
+	if b, err := source.Fetch(context.Background()); err != nil || string(b) != string(content) {
+		t.Errorf("unexpected result: %s %v", b, err)
+	}
+}
+
+func TestSourcePoller_Poll(t *testing.T) {
+	source := NewMemorySource("turbo.yaml", []byte("version: 1\nname: v1\nendpoints: []\n"))
+	poller := NewSourcePoller(source, 5*time.Millisecond)
+	if _, ok := poller.Config(); ok {
+		t.Error("the poller should not have a config before loading the source")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates := poller.Poll(ctx)
+
+	next := func() Update {
+		select {
+		case u := <-updates:
+			return u
+		case <-time.After(time.Second):
+			t.Error("timeout waiting for an update")
+			return Update{}
+		}
+	}
+
+	if u := next(); u.Err != nil || u.Config.Name != "v1" {
+		t.Errorf("unexpected update: %v %v", u.Config.Name, u.Err)
+	}
+
+	source.Set([]byte("version: 1\nname: [\n"))
+	if u := next(); u.Err == nil || u.Config.Name != "v1" {
+		t.Errorf("unexpected update: %v %v", u.Config.Name, u.Err)
+	}
+
+	source.Set([]byte("version: 1\nname: v2\nendpoints: []\n"))
+	if u := next(); u.Err != nil || u.Config.Name != "v2" {
+		t.Errorf("unexpected update: %v %v", u.Config.Name, u.Err)
+	}
+	if cfg, ok := poller.Config(); !ok || cfg.Name != "v2" {
+		t.Errorf("unexpected config: %v", cfg.Name)
+	}
+
+	select {
+	case u := <-updates:
+		t.Errorf("unexpected update: %v %v", u.Config.Name, u.Err)
+	case <-time.After(30 * time.Millisecond):
+	}
+
+	cancel()
+	if _, ok := <-updates; ok {
+		t.Error("the channel should be closed")
+	}
+}
+
+func TestSourcePoller_transientError(t *testing.T) {
+	content := []byte(`{"version": 2, "name": "env://TURBO_TEST_POLLER_NAME", "endpoints": []}`)
+	poller := NewSourcePoller(NewFileSourceWithFileReader("turbo.json", func(_ string) ([]byte, error) { return content, nil }), 5*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates := poller.Poll(ctx)
+
+	next := func() Update {
+		select {
+		case u := <-updates:
+			return u
+		case <-time.After(time.Second):
+			t.Error("timeout waiting for an update")
+			return Update{}
+		}
+	}
+
+	if u := next(); u.Err == nil {
+		t.Errorf("the secret should not be resolved: %v", u.Config.Name)
+	}
+
+	t.Setenv("TURBO_TEST_POLLER_NAME", "gateway")
+	if u := next(); u.Err != nil || u.Config.Name != "gateway" {
+		t.Errorf("the same document should be parsed again: %v %v", u.Config.Name, u.Err)
+	}
+}
@@ -0,0 +1,190 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// TemplateParserConfig contains the options of the template parser. All the fields are optional
+type TemplateParserConfig struct {
+	// Templates is a folder with templates to be called from the config with {{ template "name" . }}
+	Templates string
+	// Partials is a folder with files to be included verbatim with {{ include "name" }}
+	Partials string
+	// Settings is a folder with the settings of the environment. Every file is decoded and exposed as
+	// template data under its name without extension, so settings/service.json is available as {{ .service }}
+	Settings string
+	// Out is the path where the rendered config is written, for debugging purposes
+	Out string
+	// Funcs are added to the template function map
+	Funcs template.FuncMap
+}
+
+func NewTemplateParser(cfg TemplateParserConfig) TemplateParser {
+	return NewTemplateParserWithFileReader(cfg, ioutil.ReadFile)
+}
+
+func NewTemplateParserWithFileReader(cfg TemplateParserConfig, f FileReaderFunc) TemplateParser {
+	return TemplateParser{cfg: cfg, fileReader: f}
+}
+
+// TemplateParser renders the config file as a text/template before decoding it
+type TemplateParser struct {
+	cfg        TemplateParserConfig
+	fileReader FileReaderFunc
+}
+
+func (p TemplateParser) Parse(configFile string) (ServiceConfig, error) {
+	rendered, err := p.Render(configFile)
+	if err != nil {
+		return ServiceConfig{}, err
+	}
+
+	if p.cfg.Out != "" {
+		if err := ioutil.WriteFile(p.cfg.Out, rendered, 0644); err != nil {
+			return ServiceConfig{}, CheckErr(err, p.cfg.Out)
+		}
+	}
+
+	result, err := parseServiceConfig(configFile, templateFormatName(configFile), rendered)
+	if perr, ok := err.(*ParseError); ok {
+		perr.Rendered = true
+	}
+	return result, err
+}
+
+// Render executes the config template and returns the resulting document
+func (p TemplateParser) Render(configFile string) ([]byte, error) {
+	data, err := p.fileReader(configFile)
+	if err != nil {
+		return nil, CheckErr(err, configFile)
+	}
+
+	settings, err := p.settings()
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl := template.New(filepath.Base(configFile)).Option("missingkey=error").Funcs(p.funcs())
+	if p.cfg.Templates != "" {
+		files, err := p.files(p.cfg.Templates)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			b, err := p.fileReader(file)
+			if err != nil {
+				return nil, CheckErr(err, file)
+			}
+			if _, err := tmpl.New(filepath.Base(file)).Parse(string(b)); err != nil {
+				return nil, fmt.Errorf("'%s': %s", file, err.Error())
+			}
+		}
+	}
+	if _, err := tmpl.Parse(string(data)); err != nil {
+		return nil, fmt.Errorf("'%s': %s", configFile, err.Error())
+	}
+
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, settings); err != nil {
+		return nil, fmt.Errorf("'%s': %s", configFile, err.Error())
+	}
+	return buf.Bytes(), nil
+}
+
+func (p TemplateParser) funcs() template.FuncMap {
+	funcs := template.FuncMap{
+		"env": os.Getenv,
+		"marshal": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+		"include": func(name string) (string, error) {
+			if p.cfg.Partials == "" {
+				return "", fmt.Errorf("no partials folder defined for including %s", name)
+			}
+			b, err := p.fileReader(filepath.Join(p.cfg.Partials, name))
+			return string(b), err
+		},
+	}
+	for k, v := range p.cfg.Funcs {
+		funcs[k] = v
+	}
+	return funcs
+}
+
+func (p TemplateParser) settings() (map[string]interface{}, error) {
+	settings := map[string]interface{}{}
+	if p.cfg.Settings == "" {
+		return settings, nil
+	}
+	files, err := p.files(p.cfg.Settings)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		b, err := p.fileReader(file)
+		if err != nil {
+			return nil, CheckErr(err, file)
+		}
+		var v map[string]interface{}
+		if decoder, ok := getFormatDecoder(file); ok {
+			v, err = decodeFormat(decoder, b)
+		} else {
+			err = json.Unmarshal(b, &v)
+		}
+		if err != nil {
+			return nil, checkErr(err, file, b)
+		}
+		name := filepath.Base(file)
+		settings[strings.TrimSuffix(name, filepath.Ext(name))] = v
+	}
+	return settings, nil
+}
+
+func (TemplateParser) files(dir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, CheckErr(err, dir)
+	}
+	var files []string
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		files = append(files, filepath.Join(dir, e.Name()))
+	}
+	return files, nil
+}
+
+// templateFormatName removes the template extension, so config.yaml.tmpl is decoded as YAML
+func templateFormatName(configFile string) string {
+	for _, ext := range []string{".tmpl", ".tpl"} {
+		if strings.HasSuffix(strings.ToLower(configFile), ext) {
+			return configFile[:len(configFile)-len(ext)]
+		}
+	}
+	return configFile
+}
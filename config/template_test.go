@@ -0,0 +1,164 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTemplateTestFolder(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "turbo_template")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestTemplateParser(t *testing.T) {
+	dir := newTemplateTestFolder(t, map[string]string{
+		"config.json": `{
+	"version": 1,
+	"name": "{{ env "TURBO_TEMPLATE_TEST_NAME" }}",
+	"port": {{ .service.port }},
+	"endpoints": [
+		{{ range $i, $e := .endpoints.list }}{{ if $i }},{{ end }}{{ template "endpoint.tmpl" $e }}{{ end }}
+	],
+	"extra_config": {{ include "extra.json" }}
+}`,
+		"templates/endpoint.tmpl": `{
+	"endpoint": "{{ .path }}",
+	"backend": [{"host": {{ marshal .hosts }}, "url_pattern": "{{ .path }}"}]
+}`,
+		"partials/extra.json":   `{"user": "test", "parents": ["gomez", "morticia"]}`,
+		"settings/service.json": `{"port": 8080}`,
+		"settings/endpoints.yaml": `list:
+  - path: /a
+    hosts: [http://a.example.com]
+  - path: /b
+    hosts: [http://b.example.com]
+`,
+	})
+	defer os.RemoveAll(dir)
+	os.Setenv("TURBO_TEMPLATE_TEST_NAME", "templated")
+	defer os.Unsetenv("TURBO_TEMPLATE_TEST_NAME")
+
+	out := filepath.Join(dir, "out.json")
+	cfg, err := NewTemplateParser(TemplateParserConfig{
+		Templates: filepath.Join(dir, "templates"),
+		Partials:  filepath.Join(dir, "partials"),
+		Settings:  filepath.Join(dir, "settings"),
+		Out:       out,
+	}).Parse(filepath.Join(dir, "config.json"))
+	if err != nil {
+		t.Errorf("unexpected error: %s", err.Error())
+		return
+	}
+
+	if cfg.Name != "templated" || cfg.Port != 8080 {
+		t.Errorf("unexpected service config: %s %d", cfg.Name, cfg.Port)
+	}
+	testExtraConfig(cfg.ExtraConfig, t)
+	if len(cfg.Endpoints) != 2 {
+		t.Errorf("unexpected number of endpoints: %d", len(cfg.Endpoints))
+		return
+	}
+	for i, path := range []string{"/a", "/b"} {
+		e := cfg.Endpoints[i]
+		if e.Endpoint != path || e.Backend[0].URLPattern != path {
+			t.Errorf("#%d: unexpected endpoint: %+v", i, e)
+		}
+	}
+
+	b, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Errorf("reading the rendered config: %s", err.Error())
+		return
+	}
+	if !strings.Contains(string(b), `"host": ["http://b.example.com"]`) {
+		t.Errorf("unexpected rendered config: %s", string(b))
+	}
+}
+
+func TestTemplateParser_yaml(t *testing.T) {
+	dir := newTemplateTestFolder(t, map[string]string{
+		"config.yaml.tmpl": `version: 1
+name: {{ .service.name }}
+endpoints:
+{{- range .service.paths }}
+  - endpoint: {{ . }}
+    backend:
+      - host: [http://example.com]
+        url_pattern: {{ . }}
+{{- end }}
+`,
+		"settings/service.json": `{"name": "yaml", "paths": ["/a", "/b", "/c"]}`,
+	})
+	defer os.RemoveAll(dir)
+
+	cfg, err := NewTemplateParser(TemplateParserConfig{Settings: filepath.Join(dir, "settings")}).Parse(filepath.Join(dir, "config.yaml.tmpl"))
+	if err != nil {
+		t.Errorf("unexpected error: %s", err.Error())
+		return
+	}
+	if cfg.Name != "yaml" || len(cfg.Endpoints) != 3 {
+		t.Errorf("unexpected config: %s %d", cfg.Name, len(cfg.Endpoints))
+	}
+}
+
+func TestTemplateParser_errors(t *testing.T) {
+	dir := newTemplateTestFolder(t, map[string]string{
+		"broken.json":           "{{ if }}",
+		"missing.json":          `{"version": 1, "name": "{{ .service.missing }}"}`,
+		"rendered.json":         "{\n\t\"version\": {{ .service.version }}\n\t\"name\": \"x\"\n}",
+		"settings/service.json": `{"version": 1}`,
+	})
+	defer os.RemoveAll(dir)
+
+	parser := NewTemplateParser(TemplateParserConfig{Settings: filepath.Join(dir, "settings")})
+
+	for _, name := range []string{"broken.json", "missing.json"} {
+		if _, err := parser.Parse(filepath.Join(dir, name)); err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("%s: unexpected error: %v", name, err)
+		}
+	}
+
+	_, err := parser.Parse(filepath.Join(dir, "rendered.json"))
+	perr, ok := err.(*ParseError)
+	if !ok {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+	if !perr.Rendered || perr.Offset != 18 || perr.Row != 2 || perr.Col != 2 {
+		t.Errorf("unexpected parse error: %+v", perr)
+	}
+	if msg := perr.Error(); !strings.HasSuffix(msg, "(position in the rendered template)") {
+		t.Errorf("unexpected error message: %s", msg)
+	}
+}
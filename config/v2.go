@@ -0,0 +1,295 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// ErrDeprecatedV1 is the notice of the config documents still in the version 1 of the format
+var ErrDeprecatedV1 = errors.New("the version 1 of the config format is deprecated, the document is upgraded in memory but it should be migrated to the version 2")
+
+// parseableConfig is the document of a given version of the config format
+type parseableConfig interface {
+	normalize() ServiceConfig
+}
+
+func newParseableConfig(version int) parseableConfig {
+	if version == TurboConfigVersion {
+		return &parseableServiceConfigV2{}
+	}
+	return &parseableServiceConfig{}
+}
+
+func documentVersion(doc interface{}) int {
+	m, ok := doc.(map[string]interface{})
+	if !ok {
+		return 0
+	}
+	v, _ := toFloat(m["version"])
+	return int(v)
+}
+
+// parseableServiceConfigV2 is the version 2 of the config format. Compared with the version 1, the
+// endpoint cache_ttl is a duration, the service discovery of the backends is set with the sd key and the
+// disable_rest flag can be set
+type parseableServiceConfigV2 struct {
+	Name                      string                         `json:"name"`
+	Endpoints                 []*parseableEndpointConfigV2   `json:"endpoints"`
+	Timeout                   parseableDuration              `json:"timeout"`
+	CacheTTL                  parseableDuration              `json:"cache_ttl"`
+	Host                      []string                       `json:"host"`
+	Port                      int                            `json:"port"`
+	Version                   int                            `json:"version"`
+	ExtraConfig               *ExtraConfig                   `json:"extra_config,omitempty"`
+	ReadTimeout               parseableDuration              `json:"read_timeout"`
+	WriteTimeout              parseableDuration              `json:"write_timeout"`
+	IdleTimeout               parseableDuration              `json:"idle_timeout"`
+	ReadHeaderTimeout         parseableDuration              `json:"read_header_timeout"`
+	DisableKeepAlives         bool                           `json:"disable_keep_alives"`
+	DisableCompression        bool                           `json:"disable_compression"`
+	MaxIdleConnections        int                            `json:"max_idle_connections"`
+	MaxIdleConnectionsPerHost int                            `json:"max_idle_connections_per_host"`
+	IdleConnectionTimeout     parseableDuration              `json:"idle_connection_timeout"`
+	ResponseHeaderTimeout     parseableDuration              `json:"response_header_timeout"`
+	ExpectContinueTimeout     parseableDuration              `json:"expect_continue_timeout"`
+	OutputEncoding            string                         `json:"output_encoding"`
+	DialerTimeout             parseableDuration              `json:"dialer_timeout"`
+	DialerFallbackDelay       parseableDuration              `json:"dialer_fallback_delay"`
+	DialerKeepAlive           parseableDuration              `json:"dialer_keep_alive"`
+	DisableStrictREST         bool                           `json:"disable_rest"`
+	Debug                     bool                           `json:"debug"`
+	Plugin                    *Plugin                        `json:"plugin,omitempty"`
+	TLS                       *parseableTLS                  `json:"tls,omitempty"`
+	BackendTemplates          map[string]*parseableBackendV2 `json:"backend_templates,omitempty"`
+	EndpointDefaults          *parseableEndpointDefaultsV2   `json:"endpoint_defaults,omitempty"`
+}
+
+func (p *parseableServiceConfigV2) normalize() ServiceConfig {
+	v1 := parseableServiceConfig{
+		Name:                      p.Name,
+		Timeout:                   p.Timeout,
+		CacheTTL:                  p.CacheTTL,
+		Host:                      p.Host,
+		Port:                      p.Port,
+		Version:                   p.Version,
+		ExtraConfig:               p.ExtraConfig,
+		ReadTimeout:               p.ReadTimeout,
+		WriteTimeout:              p.WriteTimeout,
+		IdleTimeout:               p.IdleTimeout,
+		ReadHeaderTimeout:         p.ReadHeaderTimeout,
+		DisableKeepAlives:         p.DisableKeepAlives,
+		DisableCompression:        p.DisableCompression,
+		MaxIdleConnections:        p.MaxIdleConnections,
+		MaxIdleConnectionsPerHost: p.MaxIdleConnectionsPerHost,
+		IdleConnectionTimeout:     p.IdleConnectionTimeout,
+		ResponseHeaderTimeout:     p.ResponseHeaderTimeout,
+		ExpectContinueTimeout:     p.ExpectContinueTimeout,
+		OutputEncoding:            p.OutputEncoding,
+		DialerTimeout:             p.DialerTimeout,
+		DialerFallbackDelay:       p.DialerFallbackDelay,
+		DialerKeepAlive:           p.DialerKeepAlive,
+		Debug:                     p.Debug,
+		Plugin:                    p.Plugin,
+		TLS:                       p.TLS,
+	}
+	cfg := v1.normalize()
+	cfg.DisableStrictREST = p.DisableStrictREST
+	for _, e := range p.Endpoints {
+		cfg.Endpoints = append(cfg.Endpoints, e.normalize())
+	}
+	if p.EndpointDefaults != nil {
+		cfg.EndpointDefaults = p.EndpointDefaults.normalize()
+	}
+	if len(p.BackendTemplates) > 0 {
+		templates := make(map[string]*parseableBackend, len(p.BackendTemplates))
+		for name, t := range p.BackendTemplates {
+			if t != nil {
+				b := parseableBackend(*t)
+				templates[name] = &b
+			}
+		}
+		cfg.BackendTemplates = normalizeBackendTemplates(templates)
+	}
+	return cfg
+}
+
+type parseableEndpointDefaultsV2 struct {
+	Method          string            `json:"method"`
+	ConcurrentCalls int               `json:"concurrent_calls"`
+	Timeout         parseableDuration `json:"timeout"`
+	CacheTTL        parseableDuration `json:"cache_ttl"`
+	QueryString     []string          `json:"querystring_params"`
+	ExtraConfig     *ExtraConfig      `json:"extra_config,omitempty"`
+	HeadersToPass   []string          `json:"headers_to_pass"`
+	OutputEncoding  string            `json:"output_encoding"`
+}
+
+func (p *parseableEndpointDefaultsV2) normalize() *EndpointConfig {
+	v1 := parseableEndpointDefaults{
+		Method:          p.Method,
+		ConcurrentCalls: p.ConcurrentCalls,
+		Timeout:         p.Timeout,
+		QueryString:     p.QueryString,
+		ExtraConfig:     p.ExtraConfig,
+		HeadersToPass:   p.HeadersToPass,
+		OutputEncoding:  p.OutputEncoding,
+	}
+	e := v1.normalize()
+	e.CacheTTL = parseDuration(p.CacheTTL)
+	return e
+}
+
+type parseableEndpointConfigV2 struct {
+	Endpoint        string                `json:"endpoint"`
+	Method          string                `json:"method"`
+	Backend         []*parseableBackendV2 `json:"backend"`
+	ConcurrentCalls int                   `json:"concurrent_calls"`
+	Timeout         parseableDuration     `json:"timeout"`
+	CacheTTL        parseableDuration     `json:"cache_ttl"`
+	QueryString     []string              `json:"querystring_params"`
+	ExtraConfig     *ExtraConfig          `json:"extra_config,omitempty"`
+	HeadersToPass   []string              `json:"headers_to_pass"`
+	OutputEncoding  string                `json:"output_encoding"`
+}
+
+func (p *parseableEndpointConfigV2) normalize() *EndpointConfig {
+	v1 := parseableEndpointConfig{
+		Endpoint:        p.Endpoint,
+		Method:          p.Method,
+		ConcurrentCalls: p.ConcurrentCalls,
+		Timeout:         p.Timeout,
+		QueryString:     p.QueryString,
+		ExtraConfig:     p.ExtraConfig,
+		HeadersToPass:   p.HeadersToPass,
+		OutputEncoding:  p.OutputEncoding,
+	}
+	e := v1.normalize()
+	e.CacheTTL = parseDuration(p.CacheTTL)
+	for _, b := range p.Backend {
+		e.Backend = append(e.Backend, b.normalize())
+	}
+	return e
+}
+
+type parseableBackendV2 struct {
+	Group                    string            `json:"group"`
+	Method                   string            `json:"method"`
+	Host                     []string          `json:"host"`
+	HostSanitizationDisabled *bool             `json:"disable_host_sanitize"`
+	URLPattern               string            `json:"url_pattern"`
+	AllowList                []string          `json:"allow"`
+	DenyList                 []string          `json:"deny"`
+	Mapping                  map[string]string `json:"mapping"`
+	Encoding                 string            `json:"encoding"`
+	IsCollection             *bool             `json:"is_collection"`
+	Target                   string            `json:"target"`
+	ExtraConfig              *ExtraConfig      `json:"extra_config,omitempty"`
+	SD                       string            `json:"sd"`
+	Timeout                  parseableDuration `json:"timeout"`
+	Required                 *bool             `json:"required"`
+	Template                 string            `json:"template"`
+}
+
+func (p *parseableBackendV2) normalize() *Backend {
+	v1 := parseableBackend(*p)
+	return v1.normalize()
+}
+
+// MigrateV1 upgrades a version 1 document to the version 2 of the format. The document is modified
+// in place
+func MigrateV1(doc map[string]interface{}) (map[string]interface{}, error) {
+	if v := documentVersion(doc); v != ConfigVersion1 {
+		return nil, &UnsupportedVersionError{Have: v, Want: ConfigVersion1}
+	}
+	doc["version"] = TurboConfigVersion
+
+	endpoints, _ := doc["endpoints"].([]interface{})
+	for i, v := range endpoints {
+		e, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if ttl, ok := e["cache_ttl"]; ok {
+			seconds, ok := toFloat(ttl)
+			if !ok {
+				return nil, fmt.Errorf("endpoints[%d].cache_ttl: expected a number, got %s", i, jsonTypeName(ttl))
+			}
+			e["cache_ttl"] = (time.Duration(seconds) * time.Second).String()
+		}
+
+		backends, _ := e["backend"].([]interface{})
+		for _, v := range backends {
+			if b, ok := v.(map[string]interface{}); ok {
+				migrateBackendV1(b)
+			}
+		}
+	}
+
+	if d, ok := doc["endpoint_defaults"].(map[string]interface{}); ok {
+		if ttl, ok := d["cache_ttl"]; ok {
+			seconds, ok := toFloat(ttl)
+			if !ok {
+				return nil, fmt.Errorf("endpoint_defaults.cache_ttl: expected a number, got %s", jsonTypeName(ttl))
+			}
+			d["cache_ttl"] = (time.Duration(seconds) * time.Second).String()
+		}
+	}
+	templates, _ := doc["backend_templates"].(map[string]interface{})
+	for _, v := range templates {
+		if b, ok := v.(map[string]interface{}); ok {
+			migrateBackendV1(b)
+		}
+	}
+	return doc, nil
+}
+
+func migrateBackendV1(b map[string]interface{}) {
+	if sd, ok := b["discovery"]; ok {
+		b["sd"] = sd
+		delete(b, "discovery")
+	}
+}
+
+// Migrate upgrades the version 1 config document to the version 2, encoding it in the format of the
+// config file
+func Migrate(configFile string, data []byte) ([]byte, error) {
+	doc, err := DecodeDocument(configFile, data)
+	if err != nil {
+		return nil, err
+	}
+	if doc, err = MigrateV1(doc); err != nil {
+		return nil, fmt.Errorf("'%s': %s", configFile, err.Error())
+	}
+	return EncodeDocument(configFile, doc)
+}
+
+// MigrateFile upgrades the version 1 config file, writing the result to the out file
+func MigrateFile(configFile, out string) error {
+	data, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return CheckErr(err, configFile)
+	}
+	b, err := Migrate(configFile, data)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(out, b, 0644)
+}
@@ -0,0 +1,264 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testConfigV1 = `{
+	"version": 1,
+	"name": "v1",
+	"cache_ttl": "5m",
+	"endpoints": [
+		{
+			"endpoint": "/foo",
+			"cache_ttl": 90,
+			"backend": [
+				{"host": ["http://example.com"], "url_pattern": "/foo", "discovery": "static"}
+			]
+		},
+		{
+			"endpoint": "/bar",
+			"backend": [{"host": ["http://example.com"], "url_pattern": "/bar"}]
+		}
+	]
+}`
+
+func parseTestConfig(configFile string, data []byte) (ServiceConfig, error) {
+	return NewParserWithFileReader(func(_ string) ([]byte, error) { return data, nil }).Parse(configFile)
+}
+
+func TestNewParser_v2(t *testing.T) {
+	cfg, err := parseTestConfig("turbo.json", []byte(`{
+	"version": 2,
+	"debug": true,
+	"disable_rest": true,
+	"endpoints": [
+		{
+			"endpoint": "/foo",
+			"cache_ttl": "1m30s",
+			"backend": [
+				{"host": ["http://example.com"], "url_pattern": "/foo", "sd": "dns"}
+			]
+		}
+	]
+}`))
+	if err != nil {
+		t.Errorf("unexpected error: %s", err.Error())
+		return
+	}
+	if cfg.Version != TurboConfigVersion || !cfg.Debug || !cfg.DisableStrictREST || cfg.UpgradedFromV1() {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+	if cfg.Endpoints[0].CacheTTL != 90*time.Second {
+		t.Errorf("unexpected cache ttl: %v", cfg.Endpoints[0].CacheTTL)
+	}
+	if sd := cfg.Endpoints[0].Backend[0].SD; sd != "dns" {
+		t.Errorf("unexpected sd: %s", sd)
+	}
+
+	if _, err := parseTestConfig("turbo.json", []byte(`{"version": 2, "endpoints": [{"endpoint": "/foo", "cache_ttl": 90}]}`)); err == nil {
+		t.Error("expecting an error")
+	}
+}
+
+func TestValidate_v2(t *testing.T) {
+	issues, err := Validate("turbo.json", []byte(`{
+	"version": 2,
+	"endpoints": [
+		{
+			"endpoint": "/foo",
+			"cache_ttl": "1 minute",
+			"backend": [{"url_pattern": "/foo", "discovery": "dns"}]
+		}
+	]
+}`))
+	if err != nil {
+		t.Errorf("unexpected error: %s", err.Error())
+		return
+	}
+	expected := []Issue{
+		{"endpoints[0].backend[0].discovery", `unknown key "discovery"`, SeverityWarning},
+		{"endpoints[0].cache_ttl", `invalid duration "1 minute", it will be ignored`, SeverityWarning},
+	}
+	if len(issues) != len(expected) {
+		t.Errorf("unexpected issues: %v", issues)
+		return
+	}
+	for i, issue := range issues {
+		if issue != expected[i] {
+			t.Errorf("#%d: unexpected issue: %s", i, issue.String())
+		}
+	}
+}
+
+const testConfigV1YAML = `version: 1
+name: v1
+cache_ttl: 5m
+endpoints:
+  - endpoint: /foo
+    cache_ttl: 90
+    backend:
+      - host: ["http://example.com"]
+        url_pattern: /foo
+        discovery: static
+  - endpoint: /bar
+    backend:
+      - host: ["http://example.com"]
+        url_pattern: /bar
+`
+
+const testConfigV1TOML = `version = 1
+name = "v1"
+cache_ttl = "5m"
+
+[[endpoints]]
+endpoint = "/foo"
+cache_ttl = 90
+
+[[endpoints.backend]]
+host = ["http://example.com"]
+url_pattern = "/foo"
+discovery = "static"
+
+[[endpoints]]
+endpoint = "/bar"
+
+[[endpoints.backend]]
+host = ["http://example.com"]
+url_pattern = "/bar"
+`
+
+func TestValidate_deprecatedV1(t *testing.T) {
+	for configFile, data := range map[string]string{
+		"turbo.json": testConfigV1,
+		"turbo.yaml": testConfigV1YAML,
+		"turbo.toml": testConfigV1TOML,
+	} {
+		issues, err := Validate(configFile, []byte(data))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", configFile, err.Error())
+			continue
+		}
+		if len(issues) != 1 || issues[0] != (Issue{"version", ErrDeprecatedV1.Error(), SeverityWarning}) || issues.HasErrors() {
+			t.Errorf("%s: unexpected issues: %v", configFile, issues)
+		}
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	v1, err := parseTestConfig("turbo.json", []byte(testConfigV1))
+	if err != nil {
+		t.Errorf("unexpected error: %s", err.Error())
+		return
+	}
+	if v1.Version != TurboConfigVersion || !v1.UpgradedFromV1() {
+		t.Errorf("the v1 config should be upgraded in memory: %d", v1.Version)
+	}
+	expectedHash, _ := v1.Hash()
+
+	for configFile, data := range map[string]string{
+		"turbo.json": testConfigV1,
+		"turbo.yaml": testConfigV1YAML,
+		"turbo.toml": testConfigV1TOML,
+	} {
+		cfg, err := parseTestConfig(configFile, []byte(data))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", configFile, err.Error())
+			continue
+		}
+		if h, _ := cfg.Hash(); h != expectedHash {
+			t.Errorf("%s: the v1 documents should be equivalent", configFile)
+		}
+
+		migrated, err := Migrate(configFile, []byte(data))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", configFile, err.Error())
+			continue
+		}
+		cfg, err = parseTestConfig(configFile, migrated)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s\n%s", configFile, err.Error(), migrated)
+			continue
+		}
+		if h, _ := cfg.Hash(); h != expectedHash {
+			t.Errorf("%s: the migrated config does not match the original one:\n%s", configFile, migrated)
+		}
+
+		if _, err := Migrate(configFile, migrated); err == nil || !strings.Contains(err.Error(), "unsupported version: 2 (want: 1)") {
+			t.Errorf("%s: unexpected error: %v", configFile, err)
+		}
+	}
+}
+
+func TestMigrateV1(t *testing.T) {
+	doc, err := MigrateV1(map[string]interface{}{
+		"version": 1.0,
+		"endpoints": []interface{}{
+			map[string]interface{}{
+				"cache_ttl": 3600.0,
+				"backend":   []interface{}{map[string]interface{}{"discovery": "dns"}},
+			},
+		},
+	})
+	if err != nil {
+		t.Errorf("unexpected error: %s", err.Error())
+		return
+	}
+	e := doc["endpoints"].([]interface{})[0].(map[string]interface{})
+	b := e["backend"].([]interface{})[0].(map[string]interface{})
+	if doc["version"] != TurboConfigVersion || e["cache_ttl"] != "1h0m0s" || b["sd"] != "dns" || b["discovery"] != nil {
+		t.Errorf("unexpected document: %v", doc)
+	}
+
+	if _, err := MigrateV1(map[string]interface{}{
+		"version":   1.0,
+		"endpoints": []interface{}{map[string]interface{}{"cache_ttl": "1h"}},
+	}); err == nil || err.Error() != "endpoints[0].cache_ttl: expected a number, got a string" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestMigrateFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "turbo_migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	in, out := filepath.Join(dir, "turbo.json"), filepath.Join(dir, "turbo.v2.json")
+	if err := ioutil.WriteFile(in, []byte(testConfigV1), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := MigrateFile(in, out); err != nil {
+		t.Errorf("unexpected error: %s", err.Error())
+		return
+	}
+	cfg, err := NewParser().Parse(out)
+	if err != nil {
+		t.Errorf("unexpected error: %s", err.Error())
+		return
+	}
+	if cfg.Endpoints[0].CacheTTL != 90*time.Second || cfg.Endpoints[0].Backend[0].SD != "static" {
+		t.Errorf("unexpected config: %+v", cfg.Endpoints[0])
+	}
+}
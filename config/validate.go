@@ -0,0 +1,279 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	if s == SeverityWarning {
+		return "warning"
+	}
+	return "error"
+}
+
+// Issue is a problem found in the config, located by its JSON path
+type Issue struct {
+	Path     string
+	Message  string
+	Severity Severity
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("%s: %s: %s", i.Severity, i.Path, i.Message)
+}
+
+type Issues []Issue
+
+func (is Issues) HasErrors() bool {
+	for _, i := range is {
+		if i.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+func (is *Issues) add(severity Severity, path, format string, args ...interface{}) {
+	*is = append(*is, Issue{Path: path, Message: fmt.Sprintf(format, args...), Severity: severity})
+}
+
+// Validate checks the config document and reports all the problems found, instead of stopping at the
+// first one. The returned error is only set when the document can not be decoded at all
+func Validate(configFile string, data []byte) (Issues, error) {
+	var doc interface{}
+	if decoder, ok := getFormatDecoder(configFile); ok {
+		m, err := decodeFormat(decoder, data)
+		if err != nil {
+			return nil, checkErr(err, configFile, data)
+		}
+		doc = m
+	} else if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, checkErr(err, configFile, data)
+	}
+
+	issues := Issues{}
+	if documentVersion(doc) == ConfigVersion1 {
+		issues.add(SeverityWarning, "version", "%s", ErrDeprecatedV1.Error())
+	}
+	validateDocument("", doc, reflect.TypeOf(newParseableConfig(documentVersion(doc))), &issues)
+
+	// the type mismatches are already reported, so the partially decoded config is good enough
+	cfg, _ := decodeServiceConfig(configFile, data)
+	validateServiceConfig(cfg.normalize(), &issues)
+
+	return issues, nil
+}
+
+var (
+	parseableServiceConfigType = reflect.TypeOf(parseableServiceConfigV2{})
+	parseableDurationType      = reflect.TypeOf(parseableDuration(""))
+	extraConfigType            = reflect.TypeOf(ExtraConfig{})
+	endpointParamsPattern      = regexp.MustCompile(`(:[^/]+|{[^}]+})`)
+)
+
+func validateServiceConfig(s ServiceConfig, issues *Issues) {
+	s.uriParser = NewURIParser()
+	if s.Version != TurboConfigVersion && s.Version != ConfigVersion1 {
+		issues.add(SeverityError, "version", "%s", (&UnsupportedVersionError{Have: s.Version, Want: TurboConfigVersion}).Error())
+	}
+	s.initGlobalParams()
+	report := func(path string, err error) bool {
+		severity := SeverityError
+		if isIgnoredExtraConfigError(err) {
+			severity = SeverityWarning
+		}
+		issues.add(severity, path, "%s", err.Error())
+		return true
+	}
+	s.ExtraConfig.validate(ServiceScope, "extra_config", report)
+	s.initEndpointsWithReporter(report)
+	s.validateService(report)
+
+	routes := map[string]int{}
+	for i, e := range s.Endpoints {
+		route := strings.ToUpper(e.Method) + " " + endpointParamsPattern.ReplaceAllString(e.Endpoint, "{}")
+		if j, ok := routes[route]; ok {
+			issues.add(SeverityError, fmt.Sprintf("endpoints[%d]", i), "duplicate endpoint %s %s, already defined at endpoints[%d]", strings.ToUpper(e.Method), e.Endpoint, j)
+			continue
+		}
+		routes[route] = i
+	}
+}
+
+func validateDocument(path string, v interface{}, t reflect.Type, issues *Issues) {
+	if v == nil {
+		return
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == parseableDurationType:
+		s, ok := v.(string)
+		if !ok {
+			issues.add(SeverityError, path, "expected a duration string, got %s", jsonTypeName(v))
+			return
+		}
+		if _, err := time.ParseDuration(s); s != "" && err != nil {
+			issues.add(SeverityWarning, path, "invalid duration %q, it will be ignored", s)
+		}
+		return
+	case t == extraConfigType:
+		if _, ok := v.(map[string]interface{}); !ok {
+			issues.add(SeverityError, path, "expected an object, got %s", jsonTypeName(v))
+		}
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			issues.add(SeverityError, path, "expected an object, got %s", jsonTypeName(v))
+			return
+		}
+		for _, k := range sortedKeys(m) {
+			field, ok := jsonField(t, k)
+			if !ok {
+				issues.add(SeverityWarning, joinPath(path, k), "unknown key %q", k)
+				continue
+			}
+			validateDocument(joinPath(path, k), m[k], field.Type, issues)
+		}
+	case reflect.Map:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			issues.add(SeverityError, path, "expected an object, got %s", jsonTypeName(v))
+			return
+		}
+		for _, k := range sortedKeys(m) {
+			validateDocument(joinPath(path, k), m[k], t.Elem(), issues)
+		}
+	case reflect.Slice:
+		s, ok := v.([]interface{})
+		if !ok {
+			issues.add(SeverityError, path, "expected an array, got %s", jsonTypeName(v))
+			return
+		}
+		for i, item := range s {
+			validateDocument(fmt.Sprintf("%s[%d]", path, i), item, t.Elem(), issues)
+		}
+	case reflect.String:
+		if _, ok := v.(string); !ok {
+			issues.add(SeverityError, path, "expected a string, got %s", jsonTypeName(v))
+		}
+	case reflect.Bool:
+		if _, ok := v.(bool); !ok {
+			issues.add(SeverityError, path, "expected a boolean, got %s", jsonTypeName(v))
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if f, ok := toFloat(v); !ok || f != float64(int64(f)) {
+			issues.add(SeverityError, path, "expected an integer, got %s", jsonTypeName(v))
+		}
+	}
+}
+
+// jsonField finds the field the JSON decoder would use for the key, ignoring the case as it does
+func jsonField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if name, ok := jsonFieldName(f); ok && strings.EqualFold(name, key) {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func jsonFieldName(f reflect.StructField) (string, bool) {
+	if f.PkgPath != "" {
+		return "", false
+	}
+	tag := strings.Split(f.Tag.Get("json"), ",")[0]
+	switch tag {
+	case "-":
+		return "", false
+	case "":
+		return f.Name, true
+	}
+	return tag, true
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+func jsonTypeName(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return "a string"
+	case bool:
+		return "a boolean"
+	case []interface{}:
+		return "an array"
+	case map[string]interface{}:
+		return "an object"
+	}
+	if _, ok := toFloat(v); ok {
+		return "a number"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
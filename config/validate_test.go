@@ -0,0 +1,139 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	issues, err := Validate("turbo.json", []byte(`{
+	"version": 1,
+	"timeout": "3 seconds",
+	"cache_tll": "1h",
+	"port": "8080",
+	"endpoints": [
+		{
+			"endpoint": "/a/{id}",
+			"backend": [
+				{"url_pattern": "/a/{name}", "timeout": "100ms"},
+				{"url_pattern": "/b", "timeout": 5, "allow": "a"}
+			]
+		},
+		{
+			"endpoint": "/nobackends",
+			"method": "POST"
+		},
+		{
+			"endpoint": "/a/{other}",
+			"method": "get",
+			"backend": [{"url_pattern": "/a", "sd": "dns"}]
+		},
+		{
+			"endpoint": "/__debug/foo",
+			"backend": [{"url_pattern": "/foo"}]
+		}
+	]
+}`))
+	if err != nil {
+		t.Errorf("unexpected error: %s", err.Error())
+		return
+	}
+
+	expected := []Issue{
+		{"version", ErrDeprecatedV1.Error(), SeverityWarning},
+		{"cache_tll", `unknown key "cache_tll"`, SeverityWarning},
+		{"endpoints[0].backend[1].allow", "expected an array, got a string", SeverityError},
+		{"endpoints[0].backend[1].timeout", "expected a duration string, got a number", SeverityError},
+		{"endpoints[2].backend[0].sd", `unknown key "sd"`, SeverityWarning},
+		{"port", "expected an integer, got a string", SeverityError},
+		{"timeout", `invalid duration "3 seconds", it will be ignored`, SeverityWarning},
+		{"endpoints[0].backend[0].url_pattern", "", SeverityError},
+		{"endpoints[1].backend", "", SeverityError},
+		{"endpoints[3].endpoint", "", SeverityError},
+		{"endpoints[2]", "duplicate endpoint GET /a/:other, already defined at endpoints[0]", SeverityError},
+	}
+	if len(issues) != len(expected) {
+		t.Errorf("unexpected number of issues: %d", len(issues))
+		for _, i := range issues {
+			t.Log(i.String())
+		}
+		return
+	}
+	for i, issue := range issues {
+		exp := expected[i]
+		if issue.Path != exp.Path || issue.Severity != exp.Severity || (exp.Message != "" && issue.Message != exp.Message) {
+			t.Errorf("#%d: unexpected issue: %s", i, issue.String())
+		}
+	}
+	if !issues.HasErrors() {
+		t.Error("the issues should contain errors")
+	}
+}
+
+func TestValidate_ok(t *testing.T) {
+	issues, err := Validate("turbo.yaml", []byte(`version: 2
+timeout: 3s
+endpoints:
+  - endpoint: /a/{id}
+    backend:
+      - url_pattern: /a/{id}
+        host: [http://example.com]
+  - endpoint: /a/{id}
+    method: POST
+    backend:
+      - url_pattern: /a/{id}
+        host: [http://example.com]
+`))
+	if err != nil {
+		t.Errorf("unexpected error: %s", err.Error())
+		return
+	}
+	if len(issues) != 0 {
+		t.Errorf("unexpected issues: %v", issues)
+	}
+}
+
+func TestValidate_warningsOnly(t *testing.T) {
+	issues, err := Validate("turbo.json", []byte(`{"version": 2, "Timeout": "1s", "unknown": true}`))
+	if err != nil {
+		t.Errorf("unexpected error: %s", err.Error())
+		return
+	}
+	if len(issues) != 1 || issues[0].Severity != SeverityWarning || issues.HasErrors() {
+		t.Errorf("unexpected issues: %v", issues)
+	}
+}
+
+func TestValidate_version(t *testing.T) {
+	issues, err := Validate("turbo.json", []byte(`{"version": 42}`))
+	if err != nil {
+		t.Errorf("unexpected error: %s", err.Error())
+		return
+	}
+	if len(issues) != 1 || issues[0].Path != "version" || !strings.Contains(issues[0].Message, "unsupported version") {
+		t.Errorf("unexpected issues: %v", issues)
+	}
+}
+
+func TestValidate_syntaxError(t *testing.T) {
+	_, err := Validate("turbo.json", []byte(`{"version": 1`))
+	if _, ok := err.(*ParseError); !ok {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
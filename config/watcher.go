@@ -0,0 +1,99 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"time"
+)
+
+// Update is a new version of the service config, or the error found while parsing it
+type Update struct {
+	Config ServiceConfig
+	Err    error
+}
+
+// Watch parses the config file again every time its content changes or one of the signals is received.
+// The file is checked at the given interval; a zero interval disables the polling. The returned channel
+// is closed when the context is cancelled
+func Watch(ctx context.Context, parser Parser, configFile string, interval time.Duration, signals ...os.Signal) <-chan Update {
+	return watch(ctx, parser, ioutil.ReadFile, configFile, interval, signals...)
+}
+
+func watch(ctx context.Context, parser Parser, reader FileReaderFunc, configFile string, interval time.Duration, signals ...os.Signal) <-chan Update {
+	out := make(chan Update)
+
+	var sigs chan os.Signal
+	if len(signals) > 0 {
+		sigs = make(chan os.Signal, 1)
+		signal.Notify(sigs, signals...)
+	}
+	var tick <-chan time.Time
+	var ticker *time.Ticker
+	if interval > 0 {
+		ticker = time.NewTicker(interval)
+		tick = ticker.C
+	}
+	checksum := func() []byte {
+		b, err := reader(configFile)
+		if err != nil {
+			return nil
+		}
+		sum := sha256.Sum256(b)
+		return sum[:]
+	}
+	last := checksum()
+
+	go func() {
+		defer close(out)
+		if sigs != nil {
+			defer signal.Stop(sigs)
+		}
+		if ticker != nil {
+			defer ticker.Stop()
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-sigs:
+				last = checksum()
+			case <-tick:
+				current := checksum()
+				if current == nil || bytes.Equal(current, last) {
+					continue
+				}
+				last = current
+			}
+
+			cfg, err := parser.Parse(configFile)
+			select {
+			case out <- Update{Config: cfg, Err: err}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
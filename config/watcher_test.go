@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "turbo_watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	configFile := filepath.Join(dir, "turbo.json")
+	if err := ioutil.WriteFile(configFile, []byte(`{"version": 1, "name": "v1"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	updates := Watch(ctx, NewParser(), configFile, 10*time.Millisecond)
+
+	select {
+	case u := <-updates:
+		t.Errorf("unexpected update: %+v", u)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := writeFileAtomically(configFile, []byte(`{"version": 1, "name": "v2"}`)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case u := <-updates:
+		if u.Err != nil || u.Config.Name != "v2" {
+			t.Errorf("unexpected update: %+v", u)
+		}
+	case <-time.After(time.Second):
+		t.Error("the change was not detected")
+	}
+
+	if err := writeFileAtomically(configFile, []byte(`{"version": 42}`)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case u := <-updates:
+		if u.Err == nil {
+			t.Errorf("expecting an error: %+v", u)
+		}
+	case <-time.After(time.Second):
+		t.Error("the change was not detected")
+	}
+
+	cancel()
+	select {
+	case _, ok := <-updates:
+		if ok {
+			t.Error("the channel should be closed")
+		}
+	case <-time.After(time.Second):
+		t.Error("the channel was not closed")
+	}
+}
+
+// writeFileAtomically prevents the watcher from reading a truncated file
+func writeFileAtomically(name string, data []byte) error {
+	tmp := name + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
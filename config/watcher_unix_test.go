@@ -0,0 +1,69 @@
+//go:build !windows
+// +build !windows
+
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWatch_signal(t *testing.T) {
+	calls := 0
+	parser := ParserFunc(func(_ string) (ServiceConfig, error) {
+		calls++
+		if calls > 1 {
+			return ServiceConfig{}, errors.New("boom")
+		}
+		return ServiceConfig{Name: "reloaded"}, nil
+	})
+	reader := func(_ string) ([]byte, error) { return []byte("unchanged"), nil }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates := watch(ctx, parser, reader, "turbo.json", time.Millisecond, syscall.SIGUSR1)
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case u := <-updates:
+		if u.Err != nil || u.Config.Name != "reloaded" {
+			t.Errorf("unexpected update: %+v", u)
+		}
+	case <-time.After(time.Second):
+		t.Error("the signal was not processed")
+	}
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case u := <-updates:
+		if u.Err == nil {
+			t.Errorf("expecting an error: %+v", u)
+		}
+	case <-time.After(time.Second):
+		t.Error("the signal was not processed")
+	}
+}
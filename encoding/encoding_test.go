@@ -183,3 +183,17 @@ func (e erroredReader) Error() string {
 func (e erroredReader) Read(_ []byte) (n int, err error) {
 	return 0, e
 }
+
+func TestDecoderRegister_Names(t *testing.T) {
+	names := initDecoderRegister().Names()
+	expected := []string{JSON, NOOP, SAFE_JSON, STRING}
+	if len(names) != len(expected) {
+		t.Errorf("unexpected names: %v", names)
+		return
+	}
+	for i, name := range names {
+		if name != expected[i] {
+			t.Errorf("unexpected names: %v", names)
+		}
+	}
+}
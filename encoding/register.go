@@ -19,6 +19,7 @@ package encoding
 import (
 	"github.com/starvn/turbo/register"
 	"io"
+	"sort"
 )
 
 func GetRegister() *DecoderRegister {
@@ -51,6 +52,16 @@ func (r *DecoderRegister) Get(name string) func(bool) func(io.Reader, *map[strin
 	return NewJSONDecoder
 }
 
+// Names returns the names of the registered decoders, sorted
+func (r *DecoderRegister) Names() []string {
+	res := make([]string, 0)
+	for name := range r.data.Clone() {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
+
 var (
 	decoders        = initDecoderRegister()
 	defaultDecoders = map[string]func(bool) func(io.Reader, *map[string]interface{}) error{
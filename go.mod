@@ -3,6 +3,7 @@ module github.com/starvn/turbo
 go 1.17
 
 require (
+	github.com/BurntSushi/toml v1.2.1
 	github.com/dimfeld/httptreemux/v5 v5.4.0
 	github.com/gin-gonic/gin v1.7.4
 	github.com/go-chi/chi/v5 v5.0.5
@@ -10,6 +11,7 @@ require (
 	github.com/starvn/flatex v1.0.2
 	github.com/urfave/negroni/v2 v2.0.2
 	github.com/valyala/fastrand v1.1.0
+	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b
 )
 
 require (
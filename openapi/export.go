@@ -0,0 +1,389 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/starvn/turbo/config"
+	"github.com/starvn/turbo/encoding"
+	"github.com/starvn/turbo/ratelimit"
+	"github.com/starvn/turbo/transport/http/client"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const defaultAPIVersion = "1.0.0"
+
+// ServiceOptions is the service level extra config of the namespace
+type ServiceOptions struct {
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Version     string   `json:"version"`
+	Servers     []string `json:"servers"`
+}
+
+// EndpointOptions is the endpoint level extra config of the namespace. The schemas are JSON Schema
+// objects, and the responses add or describe the statuses of the endpoint
+type EndpointOptions struct {
+	Summary        string                 `json:"summary"`
+	Description    string                 `json:"description"`
+	Tags           []string               `json:"tags"`
+	OperationID    string                 `json:"operation_id"`
+	Deprecated     bool                   `json:"deprecated"`
+	Hidden         bool                   `json:"hidden"`
+	RequestSchema  map[string]interface{} `json:"request_schema"`
+	ResponseSchema map[string]interface{} `json:"response_schema"`
+	Responses      map[string]string      `json:"responses"`
+}
+
+func (o EndpointOptions) Validate() error {
+	for status := range o.Responses {
+		if !isValidStatus(status) {
+			return fmt.Errorf("responses: invalid status %q", status)
+		}
+	}
+	return nil
+}
+
+func init() {
+	config.RegisterExtraConfigValidator(Namespace, config.ServiceScope|config.EndpointScope, validateExtraConfig)
+}
+
+func validateExtraConfig(scope config.ExtraConfigScope, v interface{}) error {
+	if scope == config.ServiceScope {
+		return config.DecodeExtraConfig(v, &ServiceOptions{})
+	}
+	opts := EndpointOptions{}
+	if err := config.DecodeExtraConfig(v, &opts); err != nil {
+		return err
+	}
+	return opts.Validate()
+}
+
+var (
+	colonParamPattern   = regexp.MustCompile(`:([^/]+)`)
+	bracketParamPattern = regexp.MustCompile(`{([^}]+)}`)
+	nonWordPattern      = regexp.MustCompile(`[^A-Za-z0-9]+`)
+)
+
+// Export generates the OpenAPI document describing the endpoints of the parsed config. The internal
+// endpoints, with a path starting with /__, and the hidden ones are not included
+func Export(cfg config.ServiceConfig) (*Document, error) {
+	opts := ServiceOptions{}
+	if v, ok := cfg.ExtraConfig[Namespace]; ok {
+		if err := config.DecodeExtraConfig(v, &opts); err != nil {
+			return nil, fmt.Errorf("extra_config[%q]: %s", Namespace, err.Error())
+		}
+	}
+
+	doc := &Document{
+		OpenAPI: Version,
+		Info: Info{
+			Title:       opts.Title,
+			Description: opts.Description,
+			Version:     opts.Version,
+		},
+		Paths: map[string]*PathItem{},
+	}
+	if doc.Info.Title == "" {
+		doc.Info.Title = cfg.Name
+	}
+	if doc.Info.Version == "" {
+		doc.Info.Version = defaultAPIVersion
+	}
+	for _, u := range opts.Servers {
+		doc.Servers = append(doc.Servers, Server{URL: u})
+	}
+
+	operationIDs := map[string]int{}
+	for i, e := range cfg.Endpoints {
+		if strings.HasPrefix(e.Endpoint, "/__") {
+			continue
+		}
+		eOpts := EndpointOptions{}
+		if v, ok := e.ExtraConfig[Namespace]; ok {
+			if err := config.DecodeExtraConfig(v, &eOpts); err != nil {
+				return nil, fmt.Errorf("endpoints[%d].extra_config[%q]: %s", i, Namespace, err.Error())
+			}
+		}
+		if eOpts.Hidden {
+			continue
+		}
+
+		method := e.Method
+		if method == "" {
+			method = http.MethodGet
+		}
+		path := Path(e.Endpoint)
+		item, ok := doc.Paths[path]
+		if !ok {
+			item = &PathItem{}
+			doc.Paths[path] = item
+		}
+		op := newOperation(e, path, eOpts)
+		if op.OperationID == "" {
+			op.OperationID = operationID(method, path)
+		}
+		if n := operationIDs[op.OperationID]; n > 0 {
+			// the suffixed ID can be taken as well, by an explicit ID or by a previous suffix
+			id := op.OperationID
+			for operationIDs[op.OperationID] > 0 {
+				n++
+				op.OperationID = id + strconv.Itoa(n)
+			}
+			operationIDs[id] = n
+		}
+		operationIDs[op.OperationID] = 1
+		if err := item.SetOperation(method, op); err != nil {
+			return nil, fmt.Errorf("endpoints[%d]: %s", i, err.Error())
+		}
+	}
+	return doc, nil
+}
+
+// Path returns the endpoint path using the OpenAPI template syntax
+func Path(endpoint string) string {
+	return colonParamPattern.ReplaceAllString(endpoint, "{$1}")
+}
+
+func newOperation(e *config.EndpointConfig, path string, opts EndpointOptions) *Operation {
+	op := &Operation{
+		OperationID: opts.OperationID,
+		Summary:     opts.Summary,
+		Description: opts.Description,
+		Tags:        opts.Tags,
+		Deprecated:  opts.Deprecated,
+		Responses:   map[string]*Response{},
+	}
+
+	for _, m := range bracketParamPattern.FindAllStringSubmatch(path, -1) {
+		op.Parameters = append(op.Parameters, &Parameter{Name: m[1], In: "path", Required: true, Schema: &Schema{Type: "string"}})
+	}
+	for _, q := range e.QueryString {
+		if q == "*" {
+			continue
+		}
+		op.Parameters = append(op.Parameters, &Parameter{Name: q, In: "query", Schema: &Schema{Type: "string"}})
+	}
+	for _, h := range e.HeadersToPass {
+		switch http.CanonicalHeaderKey(h) {
+		case "*", "Accept", "Content-Type", "Authorization":
+			// the specification does not allow to describe these headers as parameters
+			continue
+		}
+		op.Parameters = append(op.Parameters, &Parameter{Name: h, In: "header", Schema: &Schema{Type: "string"}})
+	}
+
+	switch strings.ToUpper(e.Method) {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+		if opts.RequestSchema != nil {
+			op.RequestBody = &RequestBody{Content: map[string]*MediaType{"application/json": {Schema: toSchema(opts.RequestSchema)}}}
+		} else {
+			op.RequestBody = &RequestBody{Content: map[string]*MediaType{"*/*": {}}}
+		}
+	}
+
+	var schema *Schema
+	if opts.ResponseSchema != nil {
+		schema = toSchema(opts.ResponseSchema)
+	} else {
+		schema = responseSchema(e)
+	}
+	ok := &Response{Description: "Successful response"}
+	for _, contentType := range contentTypes(e) {
+		if ok.Content == nil {
+			ok.Content = map[string]*MediaType{}
+		}
+		if contentType == "text/plain" && outputEncoding(e) == encoding.STRING {
+			ok.Content[contentType] = &MediaType{Schema: &Schema{Type: "string"}}
+			continue
+		}
+		ok.Content[contentType] = &MediaType{Schema: schema}
+	}
+	op.Responses[strconv.Itoa(http.StatusOK)] = ok
+
+	if _, ok := e.ExtraConfig[ratelimit.Namespace]; ok {
+		op.Responses[strconv.Itoa(http.StatusTooManyRequests)] = &Response{
+			Description: "Rate limit exceeded",
+			Headers:     map[string]*Header{"Retry-After": {Description: "Seconds to wait before retrying", Schema: &Schema{Type: "integer"}}},
+		}
+	}
+	op.Responses[strconv.Itoa(http.StatusInternalServerError)] = &Response{Description: "The backends failed to respond"}
+	for _, b := range e.Backend {
+		if returnsBackendErrors(b) {
+			op.Responses["default"] = &Response{Description: "Error status returned by the backend"}
+			break
+		}
+	}
+
+	for status, description := range opts.Responses {
+		if r, ok := op.Responses[status]; ok {
+			r.Description = description
+			continue
+		}
+		op.Responses[status] = &Response{Description: description}
+	}
+	return op
+}
+
+func outputEncoding(e *config.EndpointConfig) string {
+	if e.OutputEncoding != "" {
+		return e.OutputEncoding
+	}
+	if len(e.Backend) == 1 {
+		switch enc := e.Backend[0].Encoding; enc {
+		case encoding.STRING, encoding.NOOP:
+			return enc
+		}
+	}
+	return encoding.JSON
+}
+
+func contentTypes(e *config.EndpointConfig) []string {
+	switch outputEncoding(e) {
+	case encoding.NOOP:
+		return nil
+	case encoding.STRING:
+		return []string{"text/plain"}
+	case "negotiate":
+		return []string{"application/json", "application/xml", "text/plain"}
+	}
+	return []string{"application/json"}
+}
+
+func returnsBackendErrors(b *config.Backend) bool {
+	m, ok := b.ExtraConfig[client.Namespace].(map[string]interface{})
+	if !ok {
+		return false
+	}
+	if v, ok := m["return_error_code"].(bool); ok && v {
+		return true
+	}
+	_, ok = m["return_error_details"]
+	return ok
+}
+
+// responseSchema infers the schema of the endpoint response from the allow lists of its backends
+func responseSchema(e *config.EndpointConfig) *Schema {
+	if outputEncoding(e) == "json-collection" {
+		return &Schema{Type: "array", Items: &Schema{}}
+	}
+	schema := &Schema{Type: "object"}
+	for _, b := range e.Backend {
+		s := backendSchema(b)
+		if s == nil {
+			schema.AdditionalProperties = true
+			continue
+		}
+		mergeSchema(schema, s)
+	}
+	if schema.AdditionalProperties == nil && len(schema.Properties) == 0 {
+		schema.AdditionalProperties = true
+	}
+	return schema
+}
+
+func backendSchema(b *config.Backend) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	switch {
+	case len(b.AllowList) > 0:
+		for _, field := range b.AllowList {
+			parts := strings.Split(field, ".")
+			if name, ok := b.Mapping[parts[0]]; ok {
+				parts[0] = name
+			}
+			s := schema
+			for i, part := range parts {
+				next, ok := s.Properties[part]
+				if !ok {
+					next = &Schema{}
+					if i < len(parts)-1 {
+						next = &Schema{Type: "object", Properties: map[string]*Schema{}}
+					}
+					s.Properties[part] = next
+				}
+				s = next
+			}
+		}
+	case b.IsCollection:
+		name := "collection"
+		if n, ok := b.Mapping[name]; ok {
+			name = n
+		}
+		schema.Properties[name] = &Schema{Type: "array", Items: &Schema{}}
+	default:
+		return nil
+	}
+
+	if b.Group != "" {
+		return &Schema{Type: "object", Properties: map[string]*Schema{b.Group: schema}}
+	}
+	return schema
+}
+
+func mergeSchema(dst, src *Schema) {
+	if dst.Properties == nil {
+		dst.Properties = map[string]*Schema{}
+	}
+	for name, s := range src.Properties {
+		current, ok := dst.Properties[name]
+		if !ok {
+			dst.Properties[name] = s
+			continue
+		}
+		if current.Type == "object" && s.Type == "object" {
+			mergeSchema(current, s)
+		}
+	}
+}
+
+func toSchema(v map[string]interface{}) *Schema {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return &Schema{}
+	}
+	s := &Schema{}
+	if err := json.Unmarshal(b, s); err != nil {
+		return &Schema{}
+	}
+	return s
+}
+
+func operationID(method, path string) string {
+	words := []string{strings.ToLower(method)}
+	for _, w := range nonWordPattern.Split(path, -1) {
+		if w == "" {
+			continue
+		}
+		words = append(words, strings.ToUpper(w[:1])+w[1:])
+	}
+	return strings.Join(words, "")
+}
+
+func isValidStatus(status string) bool {
+	if status == "default" {
+		return true
+	}
+	if len(status) == 3 && strings.HasSuffix(status, "XX") {
+		return status[0] >= '1' && status[0] <= '5'
+	}
+	code, err := strconv.Atoi(status)
+	return err == nil && code >= 100 && code <= 599
+}
@@ -0,0 +1,219 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package openapi
+
+import (
+	"encoding/json"
+	"github.com/starvn/turbo/config"
+	"strings"
+	"testing"
+)
+
+const testConfig = `{
+	"version": 2,
+	"name": "users api",
+	"extra_config": {
+		"github.com/starvn/turbo/openapi": {"version": "2.1.0", "servers": ["https://api.example.com"]}
+	},
+	"endpoints": [
+		{
+			"endpoint": "/users/{id}",
+			"querystring_params": ["fields", "*"],
+			"headers_to_pass": ["X-Tenant", "Authorization"],
+			"extra_config": {
+				"github.com/starvn/turbo/openapi": {"summary": "Get a user", "tags": ["users"], "responses": {"404": "Unknown user"}},
+				"github.com/starvn/turbo/ratelimit": {"max_rate": 10}
+			},
+			"backend": [
+				{
+					"host": ["http://users"],
+					"url_pattern": "/users/{id}",
+					"allow": ["name", "address.city", "address.zip"],
+					"mapping": {"name": "username"}
+				},
+				{
+					"host": ["http://orders"],
+					"url_pattern": "/orders?user={id}",
+					"is_collection": true,
+					"group": "orders",
+					"extra_config": {"github.com/starvn/turbo/transport/http/client": {"return_error_code": true}}
+				}
+			]
+		},
+		{
+			"endpoint": "/users",
+			"method": "POST",
+			"output_encoding": "string",
+			"extra_config": {
+				"github.com/starvn/turbo/openapi": {"request_schema": {"type": "object", "required": ["name"], "properties": {"name": {"type": "string"}}}}
+			},
+			"backend": [{"host": ["http://users"], "url_pattern": "/users"}]
+		},
+		{
+			"endpoint": "/hidden",
+			"extra_config": {"github.com/starvn/turbo/openapi": {"hidden": true}},
+			"backend": [{"host": ["http://users"], "url_pattern": "/hidden"}]
+		},
+		{
+			"endpoint": "/__health",
+			"backend": [{"host": ["http://users"], "url_pattern": "/health"}]
+		}
+	]
+}`
+
+func parseTestConfig(t *testing.T, data string) config.ServiceConfig {
+	cfg, err := config.NewParserWithFileReader(func(_ string) ([]byte, error) { return []byte(data), nil }).Parse("turbo.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	return cfg
+}
+
+func TestExport(t *testing.T) {
+	doc, err := Export(parseTestConfig(t, testConfig))
+	if err != nil {
+		t.Errorf("unexpected error: %s", err.Error())
+		return
+	}
+
+	if doc.OpenAPI != Version || doc.Info.Title != "users api" || doc.Info.Version != "2.1.0" {
+		t.Errorf("unexpected document: %+v", doc)
+	}
+	if len(doc.Servers) != 1 || doc.Servers[0].URL != "https://api.example.com" {
+		t.Errorf("unexpected servers: %v", doc.Servers)
+	}
+	if len(doc.Paths) != 2 {
+		t.Errorf("unexpected paths: %v", doc.Paths)
+		return
+	}
+
+	get := doc.Paths["/users/{id}"].Get
+	if get == nil {
+		t.Error("the get operation was not exported")
+		return
+	}
+	if get.OperationID != "getUsersId" || get.Summary != "Get a user" || len(get.Tags) != 1 {
+		t.Errorf("unexpected operation: %+v", get)
+	}
+	var params []string
+	for _, p := range get.Parameters {
+		params = append(params, p.In+":"+p.Name)
+	}
+	if strings.Join(params, ",") != "path:id,query:fields,header:X-Tenant" {
+		t.Errorf("unexpected parameters: %v", params)
+	}
+	for _, status := range []string{"200", "404", "429", "500", "default"} {
+		if _, ok := get.Responses[status]; !ok {
+			t.Errorf("the %s response is missing", status)
+		}
+	}
+	if d := get.Responses["404"].Description; d != "Unknown user" {
+		t.Errorf("unexpected description: %s", d)
+	}
+
+	schema := get.Responses["200"].Content["application/json"].Schema
+	b, _ := json.Marshal(schema)
+	expected := `{"type":"object","properties":{"address":{"type":"object","properties":{"city":{},"zip":{}}},"orders":{"type":"object","properties":{"collection":{"type":"array","items":{}}}},"username":{}}}`
+	if string(b) != expected {
+		t.Errorf("unexpected schema: %s", string(b))
+	}
+
+	post := doc.Paths["/users"].Post
+	if post == nil || post.RequestBody == nil {
+		t.Errorf("unexpected operation: %+v", post)
+		return
+	}
+	if s := post.RequestBody.Content["application/json"].Schema; s == nil || s.Type != "object" || len(s.Required) != 1 {
+		t.Errorf("unexpected request schema: %+v", s)
+	}
+	if s := post.Responses["200"].Content["text/plain"].Schema; s == nil || s.Type != "string" {
+		t.Errorf("unexpected response schema: %+v", s)
+	}
+}
+
+func TestExport_operationIDs(t *testing.T) {
+	cfg, err := config.NewParserWithFileReader(func(_ string) ([]byte, error) {
+		return []byte(`{"version": 2, "endpoints": [
+			{"endpoint": "/users", "backend": [{"host": ["http://a"], "url_pattern": "/"}]},
+			{"endpoint": "/a", "backend": [{"host": ["http://a"], "url_pattern": "/"}],
+				"extra_config": {"github.com/starvn/turbo/openapi": {"operation_id": "getUsers"}}},
+			{"endpoint": "/b", "backend": [{"host": ["http://a"], "url_pattern": "/"}],
+				"extra_config": {"github.com/starvn/turbo/openapi": {"operation_id": "getUsers2"}}},
+			{"endpoint": "/c", "backend": [{"host": ["http://a"], "url_pattern": "/"}],
+				"extra_config": {"github.com/starvn/turbo/openapi": {"operation_id": "getUsers"}}}
+		]}`), nil
+	}).Parse("turbo.json")
+	if err != nil {
+		t.Errorf("unexpected error: %s", err.Error())
+		return
+	}
+	doc, err := Export(cfg)
+	if err != nil {
+		t.Errorf("unexpected error: %s", err.Error())
+		return
+	}
+	for path, id := range map[string]string{
+		"/users": "getUsers",
+		"/a":     "getUsers2",
+		"/b":     "getUsers22",
+		"/c":     "getUsers3",
+	} {
+		if op := doc.Paths[path].Get; op == nil || op.OperationID != id {
+			t.Errorf("%s: unexpected operation: %+v", path, op)
+		}
+	}
+}
+
+func TestExport_invalidOptions(t *testing.T) {
+	_, err := config.NewParserWithFileReader(func(_ string) ([]byte, error) {
+		return []byte(`{"version": 2, "endpoints": [{"endpoint": "/foo", "backend": [{"host": ["http://a"], "url_pattern": "/"}],
+			"extra_config": {"github.com/starvn/turbo/openapi": {"responses": {"999": "what"}}}}]}`), nil
+	}).Parse("turbo.json")
+	if err == nil || !strings.Contains(err.Error(), `invalid status "999"`) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestPath(t *testing.T) {
+	for in, expected := range map[string]string{
+		"/users/:id":            "/users/{id}",
+		"/users/{id}/posts/:p":  "/users/{id}/posts/{p}",
+		"/users":                "/users",
+		"/users/:id/:name/test": "/users/{id}/{name}/test",
+	} {
+		if p := Path(in); p != expected {
+			t.Errorf("%s: unexpected path %s", in, p)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	doc := &Document{OpenAPI: Version, Info: Info{Title: "test", Version: "1"}, Paths: map[string]*PathItem{
+		"/foo": {Get: &Operation{Responses: map[string]*Response{"200": {Description: "ok"}}}},
+	}}
+	b, err := Encode(doc, "yaml")
+	if err != nil {
+		t.Errorf("unexpected error: %s", err.Error())
+		return
+	}
+	if !strings.Contains(string(b), "openapi: 3.0.3") || !strings.Contains(string(b), "description: ok") {
+		t.Errorf("unexpected yaml: %s", string(b))
+	}
+	if _, err := Encode(doc, "toml"); err == nil {
+		t.Error("expecting an error")
+	}
+}
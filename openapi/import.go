@@ -0,0 +1,428 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/starvn/turbo/config"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ImportOptions customizes the endpoints generated from an OpenAPI document
+type ImportOptions struct {
+	// Host of the backends. When empty, the host of the first server of the document is used
+	Host []string
+	// Prefix is added to the path of the generated endpoints
+	Prefix string
+}
+
+// ImportError is an operation of the document that can not be translated into an endpoint
+type ImportError struct {
+	Method string
+	Path   string
+	Err    error
+}
+
+func (i *ImportError) Error() string {
+	return fmt.Sprintf("%s %s: %s", i.Method, i.Path, i.Err.Error())
+}
+
+func (i *ImportError) Unwrap() error { return i.Err }
+
+var (
+	pathParamPattern    = regexp.MustCompile(`{([^}]*)}`)
+	invalidParamPattern = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+	importedMethods     = []string{
+		http.MethodGet,
+		http.MethodPost,
+		http.MethodPut,
+		http.MethodPatch,
+		http.MethodDelete,
+		http.MethodHead,
+		http.MethodOptions,
+		http.MethodTrace,
+	}
+)
+
+// Decode parses the OpenAPI 3 document, in the format given by the extension of the file name
+func Decode(specFile string, data []byte) (*Document, error) {
+	m, err := config.DecodeDocument(specFile, data)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	doc := &Document{}
+	if err := json.Unmarshal(b, doc); err != nil {
+		return nil, fmt.Errorf("'%s': %s", specFile, strings.TrimPrefix(err.Error(), "json: "))
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		return nil, fmt.Errorf("'%s': unsupported OpenAPI version %q", specFile, doc.OpenAPI)
+	}
+	return doc, nil
+}
+
+// Import generates a gateway endpoint, with a single backend, for every operation of the document. The
+// path parameters of the document become endpoint parameters, while the query, header and cookie
+// parameters, along with the ones required by the security schemes, are allowed to reach the backend
+func Import(doc *Document, opts ImportOptions) ([]*config.EndpointConfig, error) {
+	host, basePath := opts.Host, ""
+	if len(doc.Servers) > 0 {
+		h, p, err := splitServerURL(doc.Servers[0])
+		if err != nil {
+			return nil, err
+		}
+		if len(host) == 0 && h != "" {
+			host = []string{h}
+		}
+		basePath = p
+	}
+	prefix := strings.TrimSuffix(opts.Prefix, "/")
+	if prefix != "" && !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+
+	paths := make([]string, 0, len(doc.Paths))
+	for p := range doc.Paths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var endpoints []*config.EndpointConfig
+	for _, path := range paths {
+		item := doc.Paths[path]
+		if item == nil {
+			continue
+		}
+		operations := item.Operations()
+		for _, method := range importedMethods {
+			op, ok := operations[method]
+			if !ok {
+				continue
+			}
+			e, err := newEndpoint(doc, path, item, method, op)
+			if err != nil {
+				return nil, &ImportError{Method: method, Path: path, Err: err}
+			}
+			e.Backend[0].URLPattern = basePath + e.Endpoint
+			e.Backend[0].Host = host
+			e.Endpoint = prefix + e.Endpoint
+			endpoints = append(endpoints, e)
+		}
+	}
+	return endpoints, nil
+}
+
+func newEndpoint(doc *Document, path string, item *PathItem, method string, op *Operation) (*config.EndpointConfig, error) {
+	p, err := translatePath(path)
+	if err != nil {
+		return nil, err
+	}
+	e := &config.EndpointConfig{
+		Endpoint: p,
+		Method:   method,
+		Backend:  []*config.Backend{{Method: method}},
+	}
+
+	params, err := operationParameters(doc, item, op)
+	if err != nil {
+		return nil, err
+	}
+	query := newStringSet()
+	headers := newStringSet()
+	for _, param := range params {
+		switch param.In {
+		case "query":
+			query.Add(param.Name)
+		case "header":
+			headers.Add(textproto.CanonicalMIMEHeaderKey(param.Name))
+		case "cookie":
+			headers.Add("Cookie")
+		}
+	}
+
+	requirements := doc.Security
+	if op.Security != nil {
+		requirements = *op.Security
+	}
+	for _, requirement := range requirements {
+		for name := range requirement {
+			if doc.Components == nil {
+				continue
+			}
+			scheme, ok := doc.Components.SecuritySchemes[name]
+			if !ok || scheme == nil {
+				continue
+			}
+			switch scheme.Type {
+			case "apiKey":
+				switch scheme.In {
+				case "query":
+					query.Add(scheme.Name)
+				case "header":
+					headers.Add(textproto.CanonicalMIMEHeaderKey(scheme.Name))
+				case "cookie":
+					headers.Add("Cookie")
+				}
+			case "http", "oauth2", "openIdConnect":
+				headers.Add("Authorization")
+			}
+		}
+	}
+	if op.RequestBody != nil && len(headers.values) > 0 {
+		// the headers_to_pass replace the default ones, so the backends would not get the content type
+		headers.Add("Content-Type")
+	}
+	e.QueryString = query.values
+	e.HeadersToPass = headers.values
+
+	extra := map[string]interface{}{}
+	if op.OperationID != "" {
+		extra["operation_id"] = op.OperationID
+	}
+	if op.Summary != "" {
+		extra["summary"] = op.Summary
+	}
+	if len(op.Tags) > 0 {
+		extra["tags"] = op.Tags
+	}
+	if op.Deprecated {
+		extra["deprecated"] = true
+	}
+	if len(extra) > 0 {
+		e.ExtraConfig = config.ExtraConfig{Namespace: extra}
+	}
+	return e, nil
+}
+
+// translatePath converts the path template into the endpoint syntax, where the parameters must take a
+// whole segment. Their names can only have letters, digits and underscores, as they become fields of the
+// backend URL templates
+func translatePath(path string) (string, error) {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		matches := pathParamPattern.FindAllStringSubmatchIndex(segment, -1)
+		if len(matches) == 0 {
+			continue
+		}
+		if len(matches) > 1 || matches[0][0] != 0 || matches[0][1] != len(segment) {
+			return "", fmt.Errorf("the path parameters must take a whole segment: %q", segment)
+		}
+		name := segment[1 : len(segment)-1]
+		if name == "" {
+			return "", fmt.Errorf("empty path parameter")
+		}
+		segments[i] = "{" + paramName(name) + "}"
+	}
+	return strings.Join(segments, "/"), nil
+}
+
+func paramName(name string) string {
+	return invalidParamPattern.ReplaceAllString(name, "_")
+}
+
+// operationParameters returns the parameters of the path and the operation, the ones of the operation
+// replacing the ones of the path with the same name and location
+func operationParameters(doc *Document, item *PathItem, op *Operation) ([]*Parameter, error) {
+	var keys []string
+	params := map[string]*Parameter{}
+	for _, p := range append(append([]*Parameter{}, item.Parameters...), op.Parameters...) {
+		if p == nil {
+			continue
+		}
+		if p.Ref != "" {
+			name := strings.TrimPrefix(p.Ref, "#/components/parameters/")
+			var ok bool
+			if doc.Components != nil {
+				p, ok = doc.Components.Parameters[name]
+			}
+			if !ok || p == nil {
+				return nil, fmt.Errorf("unresolved parameter reference %q", name)
+			}
+		}
+		key := p.In + ":" + p.Name
+		if _, ok := params[key]; !ok {
+			keys = append(keys, key)
+		}
+		params[key] = p
+	}
+	res := make([]*Parameter, len(keys))
+	for i, k := range keys {
+		res[i] = params[k]
+	}
+	return res, nil
+}
+
+func splitServerURL(s Server) (string, string, error) {
+	u := s.URL
+	for name, v := range s.Variables {
+		if v != nil {
+			u = strings.Replace(u, "{"+name+"}", v.Default, -1)
+		}
+	}
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid server url %q: %s", s.URL, err.Error())
+	}
+	basePath := strings.TrimSuffix(parsed.Path, "/")
+	if parsed.Host == "" {
+		return "", basePath, nil
+	}
+	return parsed.Scheme + "://" + parsed.Host, basePath, nil
+}
+
+type stringSet struct {
+	values []string
+	seen   map[string]bool
+}
+
+func newStringSet() *stringSet {
+	return &stringSet{seen: map[string]bool{}}
+}
+
+func (s *stringSet) Add(v string) {
+	if v == "" || s.seen[v] {
+		return
+	}
+	s.seen[v] = true
+	s.values = append(s.values, v)
+}
+
+// Merge adds the endpoints to the config document. The endpoints already in the document, with the same
+// method and path, only get the fields they are missing, so the hand edited values are kept. It returns
+// the number of endpoints added and updated
+func Merge(doc map[string]interface{}, endpoints []*config.EndpointConfig) (added, updated int) {
+	current, _ := doc["endpoints"].([]interface{})
+	index := map[string]map[string]interface{}{}
+	for _, v := range current {
+		if e, ok := v.(map[string]interface{}); ok {
+			method, _ := e["method"].(string)
+			path, _ := e["endpoint"].(string)
+			index[endpointKey(method, path)] = e
+		}
+	}
+
+	for _, e := range endpoints {
+		generated := endpointDocument(e)
+		key := endpointKey(e.Method, e.Endpoint)
+		if existing, ok := index[key]; ok {
+			if fillMissing(existing, generated) {
+				updated++
+			}
+			continue
+		}
+		current = append(current, generated)
+		index[key] = generated
+		added++
+	}
+	doc["endpoints"] = current
+	return added, updated
+}
+
+func endpointKey(method, path string) string {
+	if method == "" {
+		method = http.MethodGet
+	}
+	path = pathParamPattern.ReplaceAllString(Path(path), "{}")
+	if len(path) > 1 {
+		path = strings.TrimSuffix(path, "/")
+	}
+	return strings.ToUpper(method) + " " + path
+}
+
+func endpointDocument(e *config.EndpointConfig) map[string]interface{} {
+	doc := map[string]interface{}{
+		"endpoint": e.Endpoint,
+		"method":   e.Method,
+	}
+	if len(e.QueryString) > 0 {
+		doc["querystring_params"] = toList(e.QueryString)
+	}
+	if len(e.HeadersToPass) > 0 {
+		doc["headers_to_pass"] = toList(e.HeadersToPass)
+	}
+	if len(e.ExtraConfig) > 0 {
+		doc["extra_config"] = toDocumentValue(e.ExtraConfig)
+	}
+	backends := make([]interface{}, 0, len(e.Backend))
+	for _, b := range e.Backend {
+		backend := map[string]interface{}{
+			"url_pattern": b.URLPattern,
+			"method":      b.Method,
+		}
+		if len(b.Host) > 0 {
+			backend["host"] = toList(b.Host)
+		}
+		backends = append(backends, backend)
+	}
+	doc["backend"] = backends
+	return doc
+}
+
+// fillMissing copies the keys of the src not defined in the dst, looking into the nested objects. It
+// returns true if the dst was modified
+func fillMissing(dst, src map[string]interface{}) bool {
+	changed := false
+	for k, v := range src {
+		current, ok := dst[k]
+		if !ok {
+			dst[k] = v
+			changed = true
+			continue
+		}
+		a, ok := current.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if b, ok := v.(map[string]interface{}); ok && fillMissing(a, b) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+func toList(values []string) []interface{} {
+	res := make([]interface{}, len(values))
+	for i, v := range values {
+		res[i] = v
+	}
+	return res
+}
+
+func toDocumentValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case config.ExtraConfig:
+		return toDocumentValue(map[string]interface{}(t))
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(t))
+		for k, v := range t {
+			res[k] = toDocumentValue(v)
+		}
+		return res
+	case []string:
+		return toList(t)
+	}
+	return v
+}
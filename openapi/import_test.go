@@ -0,0 +1,220 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package openapi
+
+import (
+	"encoding/json"
+	"github.com/starvn/turbo/config"
+	"strings"
+	"testing"
+)
+
+const testSpec = `openapi: 3.0.3
+info:
+  title: users
+  version: "1"
+servers:
+  - url: https://{env}.example.com/v1/
+    variables:
+      env:
+        default: api
+security:
+  - bearer: []
+components:
+  securitySchemes:
+    bearer:
+      type: http
+      scheme: bearer
+    key:
+      type: apiKey
+      in: query
+      name: api_key
+  parameters:
+    tenant:
+      name: x-tenant
+      in: header
+paths:
+  /users/{user-id}:
+    parameters:
+      - name: user-id
+        in: path
+        required: true
+      - $ref: '#/components/parameters/tenant'
+    get:
+      operationId: getUser
+      summary: Get a user
+      parameters:
+        - name: fields
+          in: query
+        - name: session
+          in: cookie
+      responses:
+        "200":
+          description: ok
+    put:
+      security:
+        - key: []
+      requestBody:
+        content:
+          application/json: {}
+      responses:
+        "200":
+          description: ok
+  /health:
+    get:
+      security: []
+      responses:
+        "200":
+          description: ok
+`
+
+func TestImport(t *testing.T) {
+	doc, err := Decode("openapi.yaml", []byte(testSpec))
+	if err != nil {
+		t.Errorf("unexpected error: %s", err.Error())
+		return
+	}
+	endpoints, err := Import(doc, ImportOptions{Prefix: "api/"})
+	if err != nil {
+		t.Errorf("unexpected error: %s", err.Error())
+		return
+	}
+	if len(endpoints) != 3 {
+		t.Errorf("unexpected endpoints: %d", len(endpoints))
+		return
+	}
+
+	for i, tc := range []struct {
+		endpoint, method, urlPattern, query, headers string
+	}{
+		{"/api/health", "GET", "/v1/health", "", ""},
+		{"/api/users/{user_id}", "GET", "/v1/users/{user_id}", "fields", "X-Tenant,Cookie,Authorization"},
+		{"/api/users/{user_id}", "PUT", "/v1/users/{user_id}", "api_key", "X-Tenant,Content-Type"},
+	} {
+		e := endpoints[i]
+		if e.Endpoint != tc.endpoint || e.Method != tc.method {
+			t.Errorf("#%d: unexpected endpoint %s %s", i, e.Method, e.Endpoint)
+		}
+		if q := strings.Join(e.QueryString, ","); q != tc.query {
+			t.Errorf("#%d: unexpected querystring params: %s", i, q)
+		}
+		if h := strings.Join(e.HeadersToPass, ","); h != tc.headers {
+			t.Errorf("#%d: unexpected headers to pass: %s", i, h)
+		}
+		b := e.Backend[0]
+		if b.URLPattern != tc.urlPattern || b.Method != tc.method || len(b.Host) != 1 || b.Host[0] != "https://api.example.com" {
+			t.Errorf("#%d: unexpected backend: %+v", i, b)
+		}
+	}
+	extra, _ := endpoints[1].ExtraConfig[Namespace].(map[string]interface{})
+	if extra["operation_id"] != "getUser" || extra["summary"] != "Get a user" {
+		t.Errorf("unexpected extra config: %v", endpoints[1].ExtraConfig)
+	}
+
+	endpoints, err = Import(doc, ImportOptions{Host: []string{"http://users:8080"}})
+	if err != nil {
+		t.Errorf("unexpected error: %s", err.Error())
+		return
+	}
+	if h := endpoints[0].Backend[0].Host; len(h) != 1 || h[0] != "http://users:8080" {
+		t.Errorf("unexpected host: %v", h)
+	}
+
+	cfg := config.ServiceConfig{Version: config.TurboConfigVersion, Endpoints: endpoints}
+	if err := cfg.Init(); err != nil {
+		t.Errorf("the imported endpoints should be valid: %s", err.Error())
+	}
+}
+
+func TestImport_errors(t *testing.T) {
+	for i, tc := range []struct {
+		spec string
+		err  string
+	}{
+		{
+			spec: `{"openapi": "3.0.0", "paths": {"/files/{name}.{ext}": {"get": {"responses": {}}}}}`,
+			err:  `GET /files/{name}.{ext}: the path parameters must take a whole segment: "{name}.{ext}"`,
+		},
+		{
+			spec: `{"openapi": "3.0.0", "paths": {"/foo": {"get": {"parameters": [{"$ref": "#/components/parameters/bar"}]}}}}`,
+			err:  `GET /foo: unresolved parameter reference "bar"`,
+		},
+	} {
+		doc, err := Decode("openapi.json", []byte(tc.spec))
+		if err != nil {
+			t.Errorf("#%d: unexpected error: %s", i, err.Error())
+			continue
+		}
+		if _, err := Import(doc, ImportOptions{}); err == nil || err.Error() != tc.err {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+		}
+	}
+
+	if _, err := Decode("swagger.json", []byte(`{"swagger": "2.0"}`)); err == nil || !strings.Contains(err.Error(), "unsupported OpenAPI version") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	doc := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(`{
+	"version": 2,
+	"endpoints": [
+		{
+			"endpoint": "/users/{id}",
+			"timeout": "1s",
+			"querystring_params": ["fields", "expand"],
+			"extra_config": {"github.com/starvn/turbo/proxy": {"sequential": true}},
+			"backend": [{"url_pattern": "/custom/{id}", "host": ["http://legacy"]}]
+		}
+	]
+}`), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	endpoints := []*config.EndpointConfig{
+		{
+			Endpoint:      "/users/{user_id}",
+			Method:        "GET",
+			QueryString:   []string{"fields"},
+			HeadersToPass: []string{"Authorization"},
+			ExtraConfig:   config.ExtraConfig{Namespace: map[string]interface{}{"summary": "Get a user"}},
+			Backend:       []*config.Backend{{URLPattern: "/users/{user_id}", Method: "GET", Host: []string{"http://users"}}},
+		},
+		{
+			Endpoint: "/users",
+			Method:   "POST",
+			Backend:  []*config.Backend{{URLPattern: "/users", Method: "POST"}},
+		},
+	}
+	added, updated := Merge(doc, endpoints)
+	if added != 1 || updated != 1 {
+		t.Errorf("unexpected result: %d added, %d updated", added, updated)
+	}
+	if added, updated := Merge(doc, endpoints); added != 0 || updated != 0 {
+		t.Errorf("merging twice should not change the document: %d added, %d updated", added, updated)
+	}
+
+	b, _ := json.Marshal(doc)
+	expected := `{"endpoints":[{"backend":[{"host":["http://legacy"],"url_pattern":"/custom/{id}"}],"endpoint":"/users/{id}",` +
+		`"extra_config":{"github.com/starvn/turbo/openapi":{"summary":"Get a user"},"github.com/starvn/turbo/proxy":{"sequential":true}},` +
+		`"headers_to_pass":["Authorization"],"method":"GET","querystring_params":["fields","expand"],"timeout":"1s"},` +
+		`{"backend":[{"method":"POST","url_pattern":"/users"}],"endpoint":"/users","method":"POST"}],"version":2}`
+	if string(b) != expected {
+		t.Errorf("unexpected document: %s", string(b))
+	}
+}
@@ -0,0 +1,306 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/starvn/turbo/cache"
+	"github.com/starvn/turbo/config"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	cacheKey = "cache"
+
+	CacheHitValue   = "HIT"
+	CacheMissValue  = "MISS"
+	CacheStaleValue = "STALE"
+)
+
+var CacheHeaderName = "X-Sonic-Cache"
+
+// NewCacheMiddleware returns the cache middleware of the endpoint, or the error creating its store
+func NewCacheMiddleware(endpointConfig *config.EndpointConfig) (Middleware, error) {
+	cfg, ok := getCacheMiddlewareCfg(endpointConfig)
+	if !ok {
+		return EmptyMiddleware, nil
+	}
+	store, err := cache.NewStore(cacheStoreName(endpointConfig), cfg.Store)
+	if err != nil {
+		return nil, fmt.Errorf("%s: creating the store of the endpoint %s: %s", cacheKey, endpointConfig.Endpoint, err.Error())
+	}
+	keyGenerator := newCacheKeyGenerator(endpointConfig, cfg.Vary)
+	storageTTL := cfg.TTL + cfg.StaleWhileRevalidate
+	if cfg.StaleIfError > cfg.StaleWhileRevalidate {
+		storageTTL = cfg.TTL + cfg.StaleIfError
+	}
+	refreshTimeout := endpointConfig.Timeout
+	if refreshTimeout <= 0 {
+		refreshTimeout = config.DefaultTimeout
+	}
+	refreshing := &sync.Map{}
+
+	return func(next ...Proxy) Proxy {
+		if len(next) > 1 {
+			panic(ErrTooManyProxies)
+		}
+
+		fetch := func(ctx context.Context, key string, request *Request) (*Response, error) {
+			resp, err := next[0](ctx, request)
+			if err == nil && resp != nil && isCacheableResponse(resp) {
+				if b, err := encodeCachedResponse(resp, time.Now()); err == nil {
+					_ = store.Set(ctx, key, b, storageTTL, cacheTags(cfg.Tags, request)...)
+				}
+			}
+			return resp, err
+		}
+
+		refresh := func(ctx context.Context, key string, request *Request) {
+			if _, loaded := refreshing.LoadOrStore(key, struct{}{}); loaded {
+				return
+			}
+			req := CloneRequest(request)
+			go func() {
+				localCtx, cancel := context.WithTimeout(newContextWrapper(ctx), refreshTimeout)
+				_, _ = fetch(localCtx, key, req)
+				cancel()
+				refreshing.Delete(key)
+			}()
+		}
+
+		return func(ctx context.Context, request *Request) (*Response, error) {
+			key := keyGenerator(request)
+
+			var stale *Response
+			if b, err := store.Get(ctx, key); err == nil {
+				if resp, storedAt, err := decodeCachedResponse(b); err == nil {
+					age := time.Since(storedAt)
+					switch {
+					case age < cfg.TTL:
+						setCacheHeader(resp, CacheHitValue)
+						return resp, nil
+					case age < cfg.TTL+cfg.StaleWhileRevalidate:
+						refresh(ctx, key, request)
+						setCacheHeader(resp, CacheStaleValue)
+						return resp, nil
+					case age < cfg.TTL+cfg.StaleIfError:
+						stale = resp
+					}
+				} else {
+					_ = store.Delete(ctx, key)
+				}
+			}
+
+			resp, err := fetch(ctx, key, request)
+			if stale != nil && isFailedResponse(resp, err) {
+				setCacheHeader(stale, CacheStaleValue)
+				return stale, nil
+			}
+			if resp == nil {
+				return resp, err
+			}
+			setCacheHeader(resp, CacheMissValue)
+			return resp, err
+		}
+	}, nil
+}
+
+type cacheConfig struct {
+	TTL                  time.Duration
+	StaleWhileRevalidate time.Duration
+	StaleIfError         time.Duration
+	Store                map[string]interface{}
+	Tags                 []string
+	Vary                 []string
+}
+
+func getCacheMiddlewareCfg(endpointConfig *config.EndpointConfig) (cacheConfig, bool) {
+	if endpointConfig.CacheTTL <= 0 || strings.ToUpper(endpointConfig.Method) != http.MethodGet {
+		return cacheConfig{}, false
+	}
+	v, ok := endpointConfig.ExtraConfig[Namespace]
+	if !ok {
+		return cacheConfig{}, ok
+	}
+	e, ok := v.(map[string]interface{})
+	if !ok {
+		return cacheConfig{}, ok
+	}
+	v, ok = e[cacheKey]
+	if !ok {
+		return cacheConfig{}, ok
+	}
+
+	cfg := cacheConfig{TTL: endpointConfig.CacheTTL, Store: map[string]interface{}{}}
+	switch tmp := v.(type) {
+	case bool:
+		return cfg, tmp
+	case map[string]interface{}:
+		if store, ok := tmp["store"].(map[string]interface{}); ok {
+			cfg.Store = store
+		} else {
+			for _, k := range []string{"max_items", "max_entry_size"} {
+				if n, ok := tmp[k]; ok {
+					cfg.Store[k] = n
+				}
+			}
+		}
+		if ts, ok := tmp["tags"].([]interface{}); ok {
+			for _, t := range ts {
+				if tag, ok := t.(string); ok {
+					cfg.Tags = append(cfg.Tags, tag)
+				}
+			}
+		}
+		if d, ok := tmp["stale_while_revalidate"].(string); ok {
+			cfg.StaleWhileRevalidate, _ = time.ParseDuration(d)
+		}
+		if d, ok := tmp["stale_if_error"].(string); ok {
+			cfg.StaleIfError, _ = time.ParseDuration(d)
+		}
+		if vs, ok := tmp["vary"].([]interface{}); ok {
+			for _, h := range vs {
+				if name, ok := h.(string); ok {
+					cfg.Vary = append(cfg.Vary, textproto.CanonicalMIMEHeaderKey(name))
+				}
+			}
+		}
+		return cfg, true
+	default:
+		return cacheConfig{}, false
+	}
+}
+
+func newCacheKeyGenerator(endpointConfig *config.EndpointConfig, vary []string) func(*Request) string {
+	allowAllQuery := false
+	allowedQuery := make(map[string]struct{}, len(endpointConfig.QueryString))
+	for _, q := range endpointConfig.QueryString {
+		if q == "*" {
+			allowAllQuery = true
+			break
+		}
+		allowedQuery[q] = struct{}{}
+	}
+	prefix := endpointConfig.Endpoint + cache.KeySeparator + strings.ToUpper(endpointConfig.Method)
+
+	return func(r *Request) string {
+		params := url.Values{}
+		for k, v := range r.Params {
+			params.Set(k, v)
+		}
+
+		query := url.Values{}
+		for k, vs := range r.Query {
+			if _, ok := allowedQuery[k]; ok || allowAllQuery {
+				query[k] = vs
+			}
+		}
+
+		headers := url.Values{}
+		for _, h := range vary {
+			if vs, ok := r.Headers[h]; ok {
+				headers[h] = vs
+			}
+		}
+
+		var b strings.Builder
+		b.WriteString(prefix)
+		b.WriteString(cache.KeySeparator)
+		b.WriteString(params.Encode())
+		b.WriteString(cache.KeySeparator)
+		b.WriteString(query.Encode())
+		b.WriteString(cache.KeySeparator)
+		b.WriteString(headers.Encode())
+		return b.String()
+	}
+}
+
+func cacheStoreName(endpointConfig *config.EndpointConfig) string {
+	return Namespace + cache.KeySeparator + strings.ToUpper(endpointConfig.Method) + " " + endpointConfig.Endpoint
+}
+
+func cacheTags(templates []string, r *Request) []string {
+	if len(templates) == 0 {
+		return nil
+	}
+	tags := make([]string, len(templates))
+	for i, tag := range templates {
+		for k, v := range r.Params {
+			tag = strings.Replace(tag, "{{."+k+"}}", v, -1)
+		}
+		tags[i] = tag
+	}
+	return tags
+}
+
+func isCacheableResponse(resp *Response) bool {
+	return resp.IsComplete && resp.Io == nil
+}
+
+func isFailedResponse(resp *Response, err error) bool {
+	if err != nil {
+		return resp == nil || !resp.IsComplete
+	}
+	return resp == nil || (!resp.IsComplete && len(resp.Data) == 0)
+}
+
+type cachedResponse struct {
+	Data       map[string]interface{} `json:"data"`
+	Headers    map[string][]string    `json:"headers,omitempty"`
+	StatusCode int                    `json:"status_code,omitempty"`
+	StoredAt   time.Time              `json:"stored_at"`
+}
+
+func encodeCachedResponse(resp *Response, storedAt time.Time) ([]byte, error) {
+	return json.Marshal(cachedResponse{
+		Data:       resp.Data,
+		Headers:    resp.Metadata.Headers,
+		StatusCode: resp.Metadata.StatusCode,
+		StoredAt:   storedAt,
+	})
+}
+
+func decodeCachedResponse(b []byte) (*Response, time.Time, error) {
+	var c cachedResponse
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, time.Time{}, err
+	}
+	return &Response{
+		Data:       c.Data,
+		IsComplete: true,
+		Metadata: Metadata{
+			Headers:    c.Headers,
+			StatusCode: c.StatusCode,
+		},
+	}, c.StoredAt, nil
+}
+
+func setCacheHeader(resp *Response, value string) {
+	headers := make(map[string][]string, len(resp.Metadata.Headers)+1)
+	for k, vs := range resp.Metadata.Headers {
+		headers[k] = vs
+	}
+	headers[CacheHeaderName] = []string{value}
+	resp.Metadata.Headers = headers
+}
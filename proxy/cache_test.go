@@ -0,0 +1,342 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"context"
+	"github.com/starvn/turbo/cache"
+	"github.com/starvn/turbo/config"
+	"github.com/starvn/turbo/log"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func newCacheTestEndpoint(extra interface{}) *config.EndpointConfig {
+	return &config.EndpointConfig{
+		Endpoint:    "/foo/:id",
+		Method:      "GET",
+		CacheTTL:    time.Minute,
+		QueryString: []string{"page"},
+		ExtraConfig: config.ExtraConfig{
+			Namespace: map[string]interface{}{
+				cacheKey: extra,
+			},
+		},
+	}
+}
+
+func newCacheTestMiddleware(t *testing.T, endpoint *config.EndpointConfig) Middleware {
+	mw, err := NewCacheMiddleware(endpoint)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	return mw
+}
+
+func TestNewCacheMiddleware_disabled(t *testing.T) {
+	for i, endpoint := range []*config.EndpointConfig{
+		{Method: "GET", CacheTTL: time.Minute},
+		{Method: "GET", ExtraConfig: config.ExtraConfig{Namespace: map[string]interface{}{cacheKey: true}}},
+		{Method: "POST", CacheTTL: time.Minute, ExtraConfig: config.ExtraConfig{Namespace: map[string]interface{}{cacheKey: true}}},
+		newCacheTestEndpoint(false),
+	} {
+		calls := 0
+		p := newCacheTestMiddleware(t, endpoint)(func(_ context.Context, _ *Request) (*Response, error) {
+			calls++
+			return &Response{Data: map[string]interface{}{"a": 1}, IsComplete: true}, nil
+		})
+		for j := 0; j < 2; j++ {
+			resp, err := p(context.Background(), &Request{})
+			if err != nil {
+				t.Errorf("#%d: unexpected error: %s", i, err.Error())
+				return
+			}
+			if _, ok := resp.Metadata.Headers[CacheHeaderName]; ok {
+				t.Errorf("#%d: unexpected cache header", i)
+			}
+		}
+		if calls != 2 {
+			t.Errorf("#%d: unexpected number of calls: %d", i, calls)
+		}
+	}
+}
+
+func TestNewCacheMiddleware_ok(t *testing.T) {
+	endpoint := newCacheTestEndpoint(map[string]interface{}{
+		"max_items": 10.0,
+		"vary":      []interface{}{"x-tenant"},
+	})
+
+	calls := 0
+	p := newCacheTestMiddleware(t, endpoint)(func(_ context.Context, _ *Request) (*Response, error) {
+		calls++
+		return &Response{
+			Data:       map[string]interface{}{"calls": calls},
+			IsComplete: true,
+			Metadata:   Metadata{Headers: map[string][]string{"X-Foo": {"bar"}}},
+		}, nil
+	})
+
+	newRequest := func(id, page, ignored, tenant string) *Request {
+		return &Request{
+			Params:  map[string]string{"Id": id},
+			Query:   url.Values{"page": {page}, "ignored": {ignored}},
+			Headers: map[string][]string{"X-Tenant": {tenant}},
+		}
+	}
+
+	for i, tc := range []struct {
+		req    *Request
+		status string
+		calls  float64
+	}{
+		{newRequest("1", "1", "a", "t1"), CacheMissValue, 1},
+		{newRequest("1", "1", "b", "t1"), CacheHitValue, 1},
+		{newRequest("2", "1", "a", "t1"), CacheMissValue, 2},
+		{newRequest("1", "2", "a", "t1"), CacheMissValue, 3},
+		{newRequest("1", "1", "a", "t2"), CacheMissValue, 4},
+		{newRequest("2", "1", "z", "t1"), CacheHitValue, 2},
+	} {
+		resp, err := p(context.Background(), tc.req)
+		if err != nil {
+			t.Errorf("#%d: unexpected error: %s", i, err.Error())
+			return
+		}
+		if h := resp.Metadata.Headers[CacheHeaderName]; len(h) != 1 || h[0] != tc.status {
+			t.Errorf("#%d: unexpected cache header: %v", i, h)
+		}
+		if h := resp.Metadata.Headers["X-Foo"]; len(h) != 1 || h[0] != "bar" {
+			t.Errorf("#%d: unexpected backend header: %v", i, h)
+		}
+		var c float64
+		switch v := resp.Data["calls"].(type) {
+		case int:
+			c = float64(v)
+		case float64:
+			c = v
+		}
+		if c != tc.calls {
+			t.Errorf("#%d: unexpected response: %v", i, resp.Data)
+		}
+	}
+}
+
+func TestNewCacheMiddleware_incomplete(t *testing.T) {
+	calls := 0
+	p := newCacheTestMiddleware(t, newCacheTestEndpoint(true))(func(_ context.Context, _ *Request) (*Response, error) {
+		calls++
+		return &Response{Data: map[string]interface{}{"a": 1}}, nil
+	})
+
+	for i := 0; i < 3; i++ {
+		resp, err := p(context.Background(), &Request{})
+		if err != nil {
+			t.Errorf("unexpected error: %s", err.Error())
+			return
+		}
+		if h := resp.Metadata.Headers[CacheHeaderName]; len(h) != 1 || h[0] != CacheMissValue {
+			t.Errorf("unexpected cache header: %v", h)
+		}
+	}
+	if calls != 3 {
+		t.Errorf("unexpected number of calls: %d", calls)
+	}
+}
+
+func TestNewCacheMiddleware_entryTooLarge(t *testing.T) {
+	calls := 0
+	p := newCacheTestMiddleware(t, newCacheTestEndpoint(map[string]interface{}{"max_entry_size": 10.0}))(
+		func(_ context.Context, _ *Request) (*Response, error) {
+			calls++
+			return &Response{Data: map[string]interface{}{"a": "some long content"}, IsComplete: true}, nil
+		},
+	)
+
+	for i := 0; i < 2; i++ {
+		if _, err := p(context.Background(), &Request{}); err != nil {
+			t.Errorf("unexpected error: %s", err.Error())
+			return
+		}
+	}
+	if calls != 2 {
+		t.Errorf("unexpected number of calls: %d", calls)
+	}
+}
+
+func TestNewCacheMiddleware_multipleNext(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("The code did not panic")
+		}
+	}()
+	newCacheTestMiddleware(t, newCacheTestEndpoint(true))(explosiveProxy(t), explosiveProxy(t))
+}
+
+func TestNewCacheMiddleware_staleWhileRevalidate(t *testing.T) {
+	endpoint := newCacheTestEndpoint(map[string]interface{}{"stale_while_revalidate": "1m"})
+	endpoint.CacheTTL = 50 * time.Millisecond
+
+	calls := 0
+	refreshed := make(chan struct{}, 10)
+	p := newCacheTestMiddleware(t, endpoint)(func(_ context.Context, _ *Request) (*Response, error) {
+		calls++
+		if calls > 1 {
+			refreshed <- struct{}{}
+		}
+		return &Response{Data: map[string]interface{}{"calls": calls}, IsComplete: true}, nil
+	})
+
+	assertResponse := func(status string, expected float64) {
+		resp, err := p(context.Background(), &Request{})
+		if err != nil {
+			t.Errorf("unexpected error: %s", err.Error())
+			return
+		}
+		if h := resp.Metadata.Headers[CacheHeaderName]; len(h) != 1 || h[0] != status {
+			t.Errorf("unexpected cache header. have: %v, want: %s", h, status)
+		}
+		var c float64
+		switch v := resp.Data["calls"].(type) {
+		case int:
+			c = float64(v)
+		case float64:
+			c = v
+		}
+		if c != expected {
+			t.Errorf("unexpected response: %v", resp.Data)
+		}
+	}
+
+	assertResponse(CacheMissValue, 1)
+	time.Sleep(60 * time.Millisecond)
+	assertResponse(CacheStaleValue, 1)
+
+	select {
+	case <-refreshed:
+	case <-time.After(time.Second):
+		t.Error("the stale entry was not refreshed")
+		return
+	}
+	time.Sleep(5 * time.Millisecond)
+	assertResponse(CacheHitValue, 2)
+}
+
+func TestNewCacheMiddleware_staleIfError(t *testing.T) {
+	endpoint := newCacheTestEndpoint(map[string]interface{}{"stale_if_error": "1m"})
+	endpoint.CacheTTL = 10 * time.Millisecond
+
+	calls := 0
+	p := newCacheTestMiddleware(t, endpoint)(func(_ context.Context, _ *Request) (*Response, error) {
+		calls++
+		switch calls {
+		case 1:
+			return &Response{Data: map[string]interface{}{"a": 1}, IsComplete: true}, nil
+		case 2:
+			return &Response{Data: map[string]interface{}{}}, mergeError{[]error{errNullResult, errNullResult}}
+		default:
+			return nil, errNullResult
+		}
+	})
+
+	if _, err := p(context.Background(), &Request{}); err != nil {
+		t.Errorf("unexpected error: %s", err.Error())
+		return
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	for i := 0; i < 2; i++ {
+		resp, err := p(context.Background(), &Request{})
+		if err != nil {
+			t.Errorf("#%d: unexpected error: %s", i, err.Error())
+			return
+		}
+		if h := resp.Metadata.Headers[CacheHeaderName]; len(h) != 1 || h[0] != CacheStaleValue {
+			t.Errorf("#%d: unexpected cache header: %v", i, h)
+		}
+		if !resp.IsComplete || len(resp.Data) != 1 {
+			t.Errorf("#%d: unexpected response: %v", i, resp)
+		}
+	}
+	if calls != 3 {
+		t.Errorf("unexpected number of calls: %d", calls)
+	}
+}
+
+func TestNewCacheMiddleware_store(t *testing.T) {
+	store := cache.NewLRU(10, 0)
+	cache.RegisterStoreFactory("proxy-cache-test", func(_ map[string]interface{}) (cache.Store, error) {
+		return store, nil
+	})
+	endpoint := newCacheTestEndpoint(map[string]interface{}{
+		"store": map[string]interface{}{"driver": "proxy-cache-test"},
+		"tags":  []interface{}{"product:{{.Id}}", "products"},
+	})
+
+	calls := 0
+	p := newCacheTestMiddleware(t, endpoint)(func(_ context.Context, _ *Request) (*Response, error) {
+		calls++
+		return &Response{Data: map[string]interface{}{"a": 1}, IsComplete: true}, nil
+	})
+
+	assertStatus := func(id, status string) {
+		resp, err := p(context.Background(), &Request{Params: map[string]string{"Id": id}})
+		if err != nil {
+			t.Errorf("unexpected error: %s", err.Error())
+			return
+		}
+		if h := resp.Metadata.Headers[CacheHeaderName]; len(h) != 1 || h[0] != status {
+			t.Errorf("unexpected cache header for %s. have: %v, want: %s", id, h, status)
+		}
+	}
+
+	assertStatus("1", CacheMissValue)
+	assertStatus("2", CacheMissValue)
+	assertStatus("1", CacheHitValue)
+	if store.Len() != 2 {
+		t.Errorf("unexpected store size: %d", store.Len())
+	}
+
+	if n, _ := store.PurgeTags(context.Background(), "product:1"); n != 1 {
+		t.Errorf("unexpected number of purged entries: %d", n)
+	}
+	assertStatus("1", CacheMissValue)
+	assertStatus("2", CacheHitValue)
+
+	if n, _ := store.Purge(context.Background(), cache.EndpointPattern("/foo/*")); n != 2 {
+		t.Errorf("unexpected number of purged entries: %d", n)
+	}
+	assertStatus("2", CacheMissValue)
+
+	if calls != 4 {
+		t.Errorf("unexpected number of calls: %d", calls)
+	}
+}
+
+func TestNewCacheMiddleware_invalidStore(t *testing.T) {
+	endpoint := newCacheTestEndpoint(map[string]interface{}{
+		"store": map[string]interface{}{"driver": "unknown"},
+	})
+	if _, err := NewCacheMiddleware(endpoint); err == nil {
+		t.Error("expecting an error")
+	}
+
+	endpoint.Backend = []*config.Backend{{}}
+	if _, err := NewDefaultFactory(func(_ *config.Backend) Proxy { return NoopProxy }, log.NoOp).New(endpoint); err == nil {
+		t.Error("the factory should fail when the cache store can not be created")
+	}
+}
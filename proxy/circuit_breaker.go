@@ -0,0 +1,316 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"context"
+	"errors"
+	"github.com/starvn/turbo/config"
+	"github.com/starvn/turbo/log"
+	"github.com/starvn/turbo/transport/http/client"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	circuitBreakerKey = "circuit_breaker"
+
+	defaultCircuitBreakerInterval    = 60 * time.Second
+	defaultCircuitBreakerWindow      = 60 * time.Second
+	defaultCircuitBreakerMaxHalfOpen = 1
+)
+
+type CircuitState int
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+type CircuitOpenError struct {
+	Backend string
+}
+
+func (c CircuitOpenError) Error() string {
+	return "circuit breaker open for backend " + c.Backend
+}
+
+func (CircuitOpenError) StatusCode() int {
+	return http.StatusServiceUnavailable
+}
+
+func NewCircuitBreakerMiddleware(remote *config.Backend) Middleware {
+	return NewCircuitBreakerMiddlewareWithLogger(log.NoOp, remote)
+}
+
+func NewCircuitBreakerMiddlewareWithLogger(logger log.Logger, remote *config.Backend) Middleware {
+	cfg, ok := getCircuitBreakerCfg(remote)
+	if !ok {
+		return EmptyMiddleware
+	}
+	cb := newCircuitBreaker(cfg)
+	cb.onStateChange = func(from, to CircuitState) {
+		logger.Warning("[BACKEND: "+remote.URLPattern+"][CB] Circuit breaker state changed from", from.String(), "to", to.String())
+	}
+	openErr := CircuitOpenError{Backend: remote.URLPattern}
+
+	return func(next ...Proxy) Proxy {
+		if len(next) > 1 {
+			panic(ErrTooManyProxies)
+		}
+		return func(ctx context.Context, request *Request) (*Response, error) {
+			generation, ok := cb.allow()
+			if !ok {
+				return nil, openErr
+			}
+			resp, err := next[0](ctx, request)
+			if errors.Is(err, context.Canceled) {
+				cb.release(generation)
+				return resp, err
+			}
+			cb.done(generation, !isBackendFailure(resp, err))
+			return resp, err
+		}
+	}
+}
+
+type circuitBreakerConfig struct {
+	ConsecutiveFailures int
+	ErrorRatio          float64
+	MinRequests         int
+	Window              time.Duration
+	Interval            time.Duration
+	MaxHalfOpenCalls    int
+}
+
+func getCircuitBreakerCfg(remote *config.Backend) (circuitBreakerConfig, bool) {
+	v, ok := remote.ExtraConfig[Namespace]
+	if !ok {
+		return circuitBreakerConfig{}, false
+	}
+	e, ok := v.(map[string]interface{})
+	if !ok {
+		return circuitBreakerConfig{}, false
+	}
+	tmp, ok := e[circuitBreakerKey].(map[string]interface{})
+	if !ok {
+		return circuitBreakerConfig{}, false
+	}
+
+	cfg := circuitBreakerConfig{
+		Window:           defaultCircuitBreakerWindow,
+		Interval:         defaultCircuitBreakerInterval,
+		MaxHalfOpenCalls: defaultCircuitBreakerMaxHalfOpen,
+	}
+	if n, ok := tmp["consecutive_failures"].(float64); ok {
+		cfg.ConsecutiveFailures = int(n)
+	}
+	if n, ok := tmp["error_ratio"].(float64); ok {
+		cfg.ErrorRatio = n
+	}
+	if n, ok := tmp["min_requests"].(float64); ok {
+		cfg.MinRequests = int(n)
+	}
+	if d, ok := tmp["window"].(string); ok {
+		if w, err := time.ParseDuration(d); err == nil && w > 0 {
+			cfg.Window = w
+		}
+	}
+	if d, ok := tmp["interval"].(string); ok {
+		if i, err := time.ParseDuration(d); err == nil && i > 0 {
+			cfg.Interval = i
+		}
+	}
+	if n, ok := tmp["max_half_open_calls"].(float64); ok && n > 0 {
+		cfg.MaxHalfOpenCalls = int(n)
+	}
+	return cfg, cfg.ConsecutiveFailures > 0 || cfg.ErrorRatio > 0
+}
+
+func isBackendFailure(resp *Response, err error) bool {
+	if err != nil {
+		if _, ok := err.(RateLimitedError); ok {
+			return false
+		}
+		if t, ok := err.(invalidStatusCodeError); ok {
+			return t.code >= http.StatusInternalServerError
+		}
+		if err == client.ErrInvalidStatusCode {
+			// the status code of the backend response is unknown, so it can not be told apart from a
+			// client error
+			return false
+		}
+		if t, ok := err.(interface{ StatusCode() int }); ok {
+			return t.StatusCode() >= http.StatusInternalServerError
+		}
+		return true
+	}
+	return resp != nil && resp.Metadata.StatusCode >= http.StatusInternalServerError
+}
+
+func newCircuitBreaker(cfg circuitBreakerConfig) *circuitBreaker {
+	cb := &circuitBreaker{
+		cfg:           cfg,
+		mu:            &sync.Mutex{},
+		now:           time.Now,
+		onStateChange: func(_, _ CircuitState) {},
+	}
+	cb.windowStart = cb.now()
+	return cb
+}
+
+type circuitBreaker struct {
+	cfg           circuitBreakerConfig
+	mu            *sync.Mutex
+	now           func() time.Time
+	onStateChange func(from, to CircuitState)
+
+	state       CircuitState
+	generation  uint64
+	openedAt    time.Time
+	windowStart time.Time
+	requests    int
+	failures    int
+	consecutive int
+	inFlight    int
+	successes   int
+}
+
+func (cb *circuitBreaker) State() CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.updateState(cb.now())
+	return cb.state
+}
+
+func (cb *circuitBreaker) allow() (uint64, bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.updateState(cb.now())
+	switch cb.state {
+	case CircuitOpen:
+		return cb.generation, false
+	case CircuitHalfOpen:
+		if cb.inFlight >= cb.cfg.MaxHalfOpenCalls {
+			return cb.generation, false
+		}
+		cb.inFlight++
+	}
+	return cb.generation, true
+}
+
+func (cb *circuitBreaker) release(generation uint64) {
+	cb.mu.Lock()
+	if generation == cb.generation && cb.state == CircuitHalfOpen {
+		cb.inFlight--
+	}
+	cb.mu.Unlock()
+}
+
+func (cb *circuitBreaker) done(generation uint64, success bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	now := cb.now()
+	cb.updateState(now)
+	if generation != cb.generation {
+		return
+	}
+
+	switch cb.state {
+	case CircuitHalfOpen:
+		cb.inFlight--
+		if !success {
+			cb.setState(CircuitOpen, now)
+			return
+		}
+		cb.successes++
+		if cb.successes >= cb.cfg.MaxHalfOpenCalls {
+			cb.setState(CircuitClosed, now)
+		}
+	case CircuitClosed:
+		cb.requests++
+		if success {
+			cb.consecutive = 0
+			return
+		}
+		cb.failures++
+		cb.consecutive++
+		if cb.shouldTrip() {
+			cb.setState(CircuitOpen, now)
+		}
+	}
+}
+
+func (cb *circuitBreaker) shouldTrip() bool {
+	if cb.cfg.ConsecutiveFailures > 0 && cb.consecutive >= cb.cfg.ConsecutiveFailures {
+		return true
+	}
+	return cb.cfg.ErrorRatio > 0 &&
+		cb.requests >= cb.cfg.MinRequests &&
+		float64(cb.failures)/float64(cb.requests) >= cb.cfg.ErrorRatio
+}
+
+func (cb *circuitBreaker) updateState(now time.Time) {
+	switch cb.state {
+	case CircuitClosed:
+		if now.Sub(cb.windowStart) >= cb.cfg.Window {
+			cb.windowStart = now
+			cb.requests = 0
+			cb.failures = 0
+		}
+	case CircuitOpen:
+		if now.Sub(cb.openedAt) >= cb.cfg.Interval {
+			cb.setState(CircuitHalfOpen, now)
+		}
+	}
+}
+
+func (cb *circuitBreaker) setState(state CircuitState, now time.Time) {
+	if cb.state == state {
+		return
+	}
+	prev := cb.state
+	cb.state = state
+	cb.generation++
+	cb.windowStart = now
+	cb.requests = 0
+	cb.failures = 0
+	cb.consecutive = 0
+	cb.inFlight = 0
+	cb.successes = 0
+	if state == CircuitOpen {
+		cb.openedAt = now
+	}
+	cb.onStateChange(prev, state)
+}
@@ -0,0 +1,302 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/starvn/turbo/config"
+	"github.com/starvn/turbo/encoding"
+	"github.com/starvn/turbo/transport/http/client"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newCircuitBreakerTestBackend(cfg map[string]interface{}) *config.Backend {
+	return &config.Backend{
+		URLPattern:  "/foo",
+		ExtraConfig: config.ExtraConfig{Namespace: map[string]interface{}{circuitBreakerKey: cfg}},
+	}
+}
+
+func TestNewCircuitBreakerMiddleware_disabled(t *testing.T) {
+	for i, backend := range []*config.Backend{
+		{},
+		newCircuitBreakerTestBackend(map[string]interface{}{}),
+		{ExtraConfig: config.ExtraConfig{Namespace: map[string]interface{}{circuitBreakerKey: true}}},
+	} {
+		calls := 0
+		p := NewCircuitBreakerMiddleware(backend)(func(_ context.Context, _ *Request) (*Response, error) {
+			calls++
+			return nil, errNullResult
+		})
+		for j := 0; j < 10; j++ {
+			if _, err := p(context.Background(), &Request{}); err != errNullResult {
+				t.Errorf("#%d: unexpected error: %v", i, err)
+			}
+		}
+		if calls != 10 {
+			t.Errorf("#%d: unexpected number of calls: %d", i, calls)
+		}
+	}
+}
+
+func TestNewCircuitBreakerMiddleware_consecutiveFailures(t *testing.T) {
+	backend := newCircuitBreakerTestBackend(map[string]interface{}{
+		"consecutive_failures": 3.0,
+		"interval":             "20ms",
+		"max_half_open_calls":  2.0,
+	})
+
+	calls := 0
+	var backendErr error = errNullResult
+	p := NewCircuitBreakerMiddleware(backend)(func(_ context.Context, _ *Request) (*Response, error) {
+		calls++
+		if backendErr != nil {
+			return nil, backendErr
+		}
+		return &Response{IsComplete: true}, nil
+	})
+
+	for i := 0; i < 3; i++ {
+		if _, err := p(context.Background(), &Request{}); err != errNullResult {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+		}
+	}
+	_, err := p(context.Background(), &Request{})
+	openErr, ok := err.(CircuitOpenError)
+	if !ok {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+	if openErr.StatusCode() != http.StatusServiceUnavailable || openErr.Backend != "/foo" {
+		t.Errorf("unexpected error: %v", openErr)
+	}
+	if calls != 3 {
+		t.Errorf("unexpected number of calls: %d", calls)
+	}
+
+	time.Sleep(25 * time.Millisecond)
+	if _, err := p(context.Background(), &Request{}); err != errNullResult {
+		t.Errorf("the half-open probe should reach the backend: %v", err)
+	}
+	if _, err := p(context.Background(), &Request{}); !errors.As(err, &openErr) {
+		t.Errorf("a failed probe should open the circuit again: %v", err)
+	}
+
+	time.Sleep(25 * time.Millisecond)
+	backendErr = nil
+	for i := 0; i < 3; i++ {
+		if _, err := p(context.Background(), &Request{}); err != nil {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+		}
+	}
+	if calls != 7 {
+		t.Errorf("unexpected number of calls: %d", calls)
+	}
+}
+
+func TestNewCircuitBreakerMiddleware_maxHalfOpenCalls(t *testing.T) {
+	cb := newCircuitBreaker(circuitBreakerConfig{
+		ConsecutiveFailures: 1,
+		Window:              time.Minute,
+		Interval:            time.Second,
+		MaxHalfOpenCalls:    2,
+	})
+	now := time.Now()
+	cb.now = func() time.Time { return now }
+
+	g, _ := cb.allow()
+	cb.done(g, false)
+	if s := cb.State(); s != CircuitOpen {
+		t.Errorf("unexpected state: %s", s)
+	}
+
+	now = now.Add(time.Second)
+	g1, ok1 := cb.allow()
+	g2, ok2 := cb.allow()
+	_, ok3 := cb.allow()
+	if !ok1 || !ok2 || ok3 {
+		t.Errorf("unexpected half-open admissions: %v %v %v", ok1, ok2, ok3)
+	}
+	cb.done(g1, true)
+	if s := cb.State(); s != CircuitHalfOpen {
+		t.Errorf("unexpected state: %s", s)
+	}
+	cb.done(g2, true)
+	if s := cb.State(); s != CircuitClosed {
+		t.Errorf("unexpected state: %s", s)
+	}
+}
+
+func TestNewCircuitBreakerMiddleware_errorRatio(t *testing.T) {
+	backend := newCircuitBreakerTestBackend(map[string]interface{}{
+		"error_ratio":  0.5,
+		"min_requests": 4.0,
+		"window":       "1m",
+	})
+
+	calls := 0
+	p := NewCircuitBreakerMiddleware(backend)(func(_ context.Context, _ *Request) (*Response, error) {
+		calls++
+		switch calls % 4 {
+		case 1:
+			return &Response{IsComplete: true}, nil
+		case 2:
+			return nil, client.HTTPResponseError{Code: http.StatusNotFound}
+		case 3:
+			return nil, client.HTTPResponseError{Code: http.StatusBadGateway}
+		default:
+			return &Response{Metadata: Metadata{StatusCode: http.StatusServiceUnavailable}}, nil
+		}
+	})
+
+	for i := 0; i < 4; i++ {
+		if _, err := p(context.Background(), &Request{}); err != nil {
+			if _, ok := err.(CircuitOpenError); ok {
+				t.Errorf("#%d: the circuit opened too early", i)
+			}
+		}
+	}
+	if _, err := p(context.Background(), &Request{}); err == nil {
+		t.Error("expecting an open circuit")
+	} else if _, ok := err.(CircuitOpenError); !ok {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if calls != 4 {
+		t.Errorf("unexpected number of calls: %d", calls)
+	}
+}
+
+func TestNewCircuitBreakerMiddleware_multipleNext(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("The code did not panic")
+		}
+	}()
+	NewCircuitBreakerMiddleware(newCircuitBreakerTestBackend(map[string]interface{}{"consecutive_failures": 1.0}))(explosiveProxy(t), explosiveProxy(t))
+}
+
+func TestNewMergeDataMiddleware_allCircuitsOpen(t *testing.T) {
+	endpoint := config.EndpointConfig{
+		Backend: []*config.Backend{{}, {}},
+		Timeout: time.Second,
+	}
+	open := func(_ context.Context, _ *Request) (*Response, error) {
+		return nil, CircuitOpenError{Backend: "/foo"}
+	}
+	failing := func(_ context.Context, _ *Request) (*Response, error) {
+		return nil, errNullResult
+	}
+
+	p := NewMergeDataMiddleware(&endpoint)(open, open)
+	if _, err := p(context.Background(), &Request{}); err != (CircuitOpenError{Backend: "/foo"}) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	wrapped := func(_ context.Context, _ *Request) (*Response, error) {
+		return nil, fmt.Errorf("backend: %w", CircuitOpenError{Backend: "/bar"})
+	}
+	p = NewMergeDataMiddleware(&endpoint)(wrapped, open)
+	if _, err := p(context.Background(), &Request{}); !errors.As(err, &CircuitOpenError{}) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	p = NewMergeDataMiddleware(&endpoint)(open, failing)
+	if _, err := p(context.Background(), &Request{}); err == nil {
+		t.Error("expecting an error")
+	} else if _, ok := err.(mergeError); !ok {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestNewCircuitBreakerMiddleware_canceled(t *testing.T) {
+	calls := 0
+	p := NewCircuitBreakerMiddleware(newCircuitBreakerTestBackend(map[string]interface{}{"consecutive_failures": 1.0}))(
+		func(_ context.Context, _ *Request) (*Response, error) {
+			calls++
+			return nil, fmt.Errorf("request aborted: %w", context.Canceled)
+		})
+	for i := 0; i < 3; i++ {
+		if _, err := p(context.Background(), &Request{}); !errors.Is(err, context.Canceled) {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+		}
+	}
+	if calls != 3 {
+		t.Errorf("the cancellations should not open the circuit: %d calls", calls)
+	}
+}
+
+func TestNewCircuitBreakerMiddleware_clientErrors(t *testing.T) {
+	for _, tc := range []struct {
+		status int
+		calls  int32
+	}{
+		{status: http.StatusNotFound, calls: 5},
+		{status: http.StatusBadRequest, calls: 5},
+		{status: http.StatusServiceUnavailable, calls: 2},
+	} {
+		var calls int32
+		backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			http.Error(w, http.StatusText(tc.status), tc.status)
+		}))
+
+		backend := newCircuitBreakerTestBackend(map[string]interface{}{"consecutive_failures": 2.0})
+		backend.Decoder = encoding.JSONDecoder
+		u, _ := url.Parse(backendServer.URL)
+
+		p := NewCircuitBreakerMiddleware(backend)(httpProxy(backend))
+		for i := 0; i < 5; i++ {
+			if _, err := p(context.Background(), &Request{Method: http.MethodGet, URL: u}); err == nil {
+				t.Errorf("%d #%d: expecting an error", tc.status, i)
+			}
+		}
+		backendServer.Close()
+
+		if c := atomic.LoadInt32(&calls); c != tc.calls {
+			t.Errorf("%d: unexpected number of calls: %d", tc.status, c)
+		}
+	}
+}
+
+func TestIsBackendFailure(t *testing.T) {
+	for i, tc := range []struct {
+		resp *Response
+		err  error
+		exp  bool
+	}{
+		{err: errNullResult, exp: true},
+		{err: invalidStatusCodeError{code: http.StatusBadGateway}, exp: true},
+		{err: invalidStatusCodeError{code: http.StatusNotFound}},
+		{err: client.ErrInvalidStatusCode},
+		{err: client.HTTPResponseError{Code: http.StatusInternalServerError}, exp: true},
+		{err: client.HTTPResponseError{Code: http.StatusUnauthorized}},
+		{resp: &Response{Metadata: Metadata{StatusCode: http.StatusServiceUnavailable}}, exp: true},
+		{resp: &Response{Metadata: Metadata{StatusCode: http.StatusNotFound}}},
+		{resp: &Response{IsComplete: true}},
+	} {
+		if res := isBackendFailure(tc.resp, tc.err); res != tc.exp {
+			t.Errorf("#%d: unexpected result: %v", i, res)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"github.com/starvn/turbo/config"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"sync"
+)
+
+const collapseKey = "collapse"
+
+// NewCollapseMiddleware returns a middleware collapsing the identical requests in flight into a single
+// call. The requests are identified the same way the cache middleware does it, and every caller gets its
+// own copy of the shared response
+func NewCollapseMiddleware(endpointConfig *config.EndpointConfig) Middleware {
+	vary, ok := getCollapseCfg(endpointConfig)
+	if !ok {
+		return EmptyMiddleware
+	}
+	keyGenerator := newCacheKeyGenerator(endpointConfig, vary)
+
+	return func(next ...Proxy) Proxy {
+		if len(next) > 1 {
+			panic(ErrTooManyProxies)
+		}
+		group := &collapseGroup{calls: map[string]*collapsedCall{}, mu: &sync.Mutex{}}
+
+		return func(ctx context.Context, request *Request) (*Response, error) {
+			return group.do(ctx, keyGenerator(request), request, next[0])
+		}
+	}
+}
+
+func getCollapseCfg(endpointConfig *config.EndpointConfig) ([]string, bool) {
+	if strings.ToUpper(endpointConfig.Method) != http.MethodGet {
+		return nil, false
+	}
+	e, ok := endpointConfig.ExtraConfig[Namespace].(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	var vary []string
+	switch tmp := e[collapseKey].(type) {
+	case bool:
+		if !tmp {
+			return nil, false
+		}
+	case map[string]interface{}:
+		if vs, ok := tmp["vary"].([]interface{}); ok {
+			for _, h := range vs {
+				if name, ok := h.(string); ok {
+					vary = append(vary, textproto.CanonicalMIMEHeaderKey(name))
+				}
+			}
+			return vary, true
+		}
+	default:
+		return nil, false
+	}
+
+	if cfg, ok := getCacheMiddlewareCfg(endpointConfig); ok {
+		vary = cfg.Vary
+	}
+	return vary, true
+}
+
+type collapseGroup struct {
+	calls map[string]*collapsedCall
+	mu    *sync.Mutex
+}
+
+type collapsedCall struct {
+	done    chan struct{}
+	resp    *Response
+	body    []byte
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+func (g *collapseGroup) do(ctx context.Context, key string, request *Request, next Proxy) (*Response, error) {
+	g.mu.Lock()
+	c, ok := g.calls[key]
+	if ok {
+		c.waiters++
+	} else {
+		c = &collapsedCall{done: make(chan struct{}), waiters: 1}
+		g.calls[key] = c
+
+		var localCtx context.Context = newContextWrapper(ctx)
+		if deadline, ok := ctx.Deadline(); ok {
+			localCtx, c.cancel = context.WithDeadline(localCtx, deadline)
+		} else {
+			localCtx, c.cancel = context.WithCancel(localCtx)
+		}
+		go g.run(localCtx, key, c, CloneRequest(request), next)
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return cloneResponse(c.resp, c.body), c.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		c.waiters--
+		if c.waiters == 0 {
+			c.cancel()
+			if g.calls[key] == c {
+				delete(g.calls, key)
+			}
+		}
+		g.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+func (g *collapseGroup) run(ctx context.Context, key string, c *collapsedCall, request *Request, next Proxy) {
+	c.resp, c.err = next(ctx, request)
+	if c.resp != nil && c.resp.Io != nil {
+		c.body, _ = ioutil.ReadAll(c.resp.Io)
+		if closer, ok := c.resp.Io.(io.Closer); ok {
+			_ = closer.Close()
+		}
+	}
+	c.cancel()
+
+	g.mu.Lock()
+	if g.calls[key] == c {
+		delete(g.calls, key)
+	}
+	g.mu.Unlock()
+	close(c.done)
+}
+
+func cloneResponse(r *Response, body []byte) *Response {
+	if r == nil {
+		return nil
+	}
+	clone := &Response{
+		IsComplete: r.IsComplete,
+		Metadata:   Metadata{StatusCode: r.Metadata.StatusCode},
+	}
+	if r.Metadata.Headers != nil {
+		clone.Metadata.Headers = CloneRequestHeaders(r.Metadata.Headers)
+	}
+	if r.Data != nil {
+		clone.Data = cloneData(r.Data).(map[string]interface{})
+	}
+	if r.Io != nil {
+		clone.Io = bytes.NewReader(body)
+	}
+	return clone
+}
+
+func cloneData(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, v := range t {
+			m[k] = cloneData(v)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(t))
+		for i, v := range t {
+			s[i] = cloneData(v)
+		}
+		return s
+	case []map[string]interface{}:
+		s := make([]map[string]interface{}, len(t))
+		for i, v := range t {
+			s[i] = cloneData(v).(map[string]interface{})
+		}
+		return s
+	default:
+		return v
+	}
+}
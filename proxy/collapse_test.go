@@ -0,0 +1,224 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"github.com/starvn/turbo/config"
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newCollapseTestEndpoint(collapse interface{}) *config.EndpointConfig {
+	return &config.EndpointConfig{
+		Endpoint:    "/collapse",
+		Method:      "GET",
+		QueryString: []string{"q"},
+		ExtraConfig: config.ExtraConfig{Namespace: map[string]interface{}{collapseKey: collapse}},
+	}
+}
+
+func TestNewCollapseMiddleware(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	p := NewCollapseMiddleware(newCollapseTestEndpoint(true))(func(_ context.Context, _ *Request) (*Response, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return &Response{
+			Data: map[string]interface{}{
+				"user":  map[string]interface{}{"name": "sonic"},
+				"items": []interface{}{map[string]interface{}{"id": 1.0}},
+			},
+			IsComplete: true,
+			Metadata:   Metadata{StatusCode: 200, Headers: map[string][]string{"X-Foo": {"bar"}}},
+		}, nil
+	})
+
+	total := 10
+	responses := make([]*Response, total)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < total; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := p(context.Background(), &Request{Method: "GET", Query: map[string][]string{"q": {"1"}}})
+			if err != nil {
+				t.Errorf("#%d: unexpected error: %v", i, err)
+			}
+			responses[i] = resp
+		}(i)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if c := atomic.LoadInt32(&calls); c != 1 {
+		t.Errorf("unexpected number of calls: %d", c)
+	}
+
+	responses[0].Data["user"].(map[string]interface{})["name"] = "changed"
+	responses[0].Data["items"].([]interface{})[0].(map[string]interface{})["id"] = 2.0
+	responses[0].Metadata.Headers["X-Foo"][0] = "changed"
+	for i, resp := range responses[1:] {
+		if resp == responses[0] {
+			t.Errorf("#%d: the responses should not be shared", i)
+			continue
+		}
+		if name := resp.Data["user"].(map[string]interface{})["name"]; name != "sonic" {
+			t.Errorf("#%d: unexpected name: %v", i, name)
+		}
+		if id := resp.Data["items"].([]interface{})[0].(map[string]interface{})["id"]; id != 1.0 {
+			t.Errorf("#%d: unexpected id: %v", i, id)
+		}
+		if h := resp.Metadata.Headers["X-Foo"][0]; h != "bar" {
+			t.Errorf("#%d: unexpected header: %s", i, h)
+		}
+		if !resp.IsComplete || resp.Metadata.StatusCode != 200 {
+			t.Errorf("#%d: unexpected response: %+v", i, resp)
+		}
+	}
+}
+
+func TestNewCollapseMiddleware_differentKeys(t *testing.T) {
+	var calls int32
+	p := NewCollapseMiddleware(newCollapseTestEndpoint(map[string]interface{}{"vary": []interface{}{"authorization"}}))(
+		func(_ context.Context, _ *Request) (*Response, error) {
+			atomic.AddInt32(&calls, 1)
+			time.Sleep(20 * time.Millisecond)
+			return &Response{IsComplete: true}, nil
+		},
+	)
+
+	wg := &sync.WaitGroup{}
+	for _, r := range []*Request{
+		{Query: map[string][]string{"q": {"1"}}},
+		{Query: map[string][]string{"q": {"2"}}},
+		{Query: map[string][]string{"q": {"1"}}, Headers: map[string][]string{"Authorization": {"a"}}},
+		{Query: map[string][]string{"q": {"1"}}, Headers: map[string][]string{"Authorization": {"b"}}},
+	} {
+		wg.Add(1)
+		go func(r *Request) {
+			defer wg.Done()
+			_, _ = p(context.Background(), r)
+		}(r)
+	}
+	wg.Wait()
+
+	if c := atomic.LoadInt32(&calls); c != 4 {
+		t.Errorf("unexpected number of calls: %d", c)
+	}
+}
+
+func TestNewCollapseMiddleware_canceledWaiter(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	p := NewCollapseMiddleware(newCollapseTestEndpoint(true))(func(ctx context.Context, _ *Request) (*Response, error) {
+		close(started)
+		select {
+		case <-release:
+			return &Response{Data: map[string]interface{}{"ok": true}, IsComplete: true}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	leader := make(chan error, 1)
+	go func() {
+		_, err := p(ctx, &Request{})
+		leader <- err
+	}()
+	<-started
+
+	waiter := make(chan *Response, 1)
+	go func() {
+		resp, _ := p(context.Background(), &Request{})
+		waiter <- resp
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	cancel()
+	if err := <-leader; err != context.Canceled {
+		t.Errorf("unexpected error: %v", err)
+	}
+	close(release)
+
+	select {
+	case resp := <-waiter:
+		if resp == nil || resp.Data["ok"] != true {
+			t.Errorf("unexpected response: %v", resp)
+		}
+	case <-time.After(time.Second):
+		t.Error("the waiter did not get the shared response")
+	}
+}
+
+func TestNewCollapseMiddleware_io(t *testing.T) {
+	release := make(chan struct{})
+	p := NewCollapseMiddleware(newCollapseTestEndpoint(true))(func(_ context.Context, _ *Request) (*Response, error) {
+		<-release
+		return &Response{Io: ioutil.NopCloser(bytes.NewBufferString("payload")), IsComplete: true}, nil
+	})
+
+	results := make(chan string, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			resp, err := p(context.Background(), &Request{})
+			if err != nil || resp == nil || resp.Io == nil {
+				results <- ""
+				return
+			}
+			b, _ := ioutil.ReadAll(resp.Io)
+			results <- string(b)
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	for i := 0; i < 2; i++ {
+		if body := <-results; body != "payload" {
+			t.Errorf("#%d: unexpected body: %s", i, body)
+		}
+	}
+}
+
+func TestNewCollapseMiddleware_disabled(t *testing.T) {
+	post := newCollapseTestEndpoint(true)
+	post.Method = "POST"
+	for i, endpoint := range []*config.EndpointConfig{
+		{Method: "GET"},
+		newCollapseTestEndpoint(false),
+		post,
+	} {
+		if _, ok := getCollapseCfg(endpoint); ok {
+			t.Errorf("#%d: collapsing should be disabled", i)
+		}
+	}
+}
+
+func TestNewCollapseMiddleware_multipleNext(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("The code did not panic")
+		}
+	}()
+	NewCollapseMiddleware(newCollapseTestEndpoint(true))(explosiveProxy(t), explosiveProxy(t))
+}
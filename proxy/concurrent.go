@@ -20,20 +20,24 @@ import (
 	"context"
 	"errors"
 	"github.com/starvn/turbo/config"
-	"time"
 )
 
 func NewConcurrentMiddleware(remote *config.Backend) Middleware {
 	if remote.ConcurrentCalls == 1 {
 		panic(ErrTooManyProxies)
 	}
-	serviceTimeout := time.Duration(75*remote.Timeout.Nanoseconds()/100) * time.Nanosecond
+	serviceTimeout := remote.Timeout
+	hedging, isHedged := getHedgingCfg(remote)
 
 	return func(next ...Proxy) Proxy {
 		if len(next) > 1 {
 			panic(ErrTooManyProxies)
 		}
 
+		if isHedged {
+			return newHedgedProxy(remote, hedging, serviceTimeout, next[0])
+		}
+
 		return func(ctx context.Context, request *Request) (*Response, error) {
 			localCtx, cancel := context.WithTimeout(ctx, serviceTimeout)
 
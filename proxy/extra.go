@@ -0,0 +1,232 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"github.com/starvn/turbo/config"
+	"github.com/starvn/turbo/proxy/plugin"
+	"time"
+)
+
+func init() {
+	config.RegisterExtraConfigValidator(Namespace, config.EndpointScope|config.BackendScope, validateExtraConfig)
+	config.RegisterExtraConfigType(plugin.Namespace, config.EndpointScope|config.BackendScope, pluginExtraConfig{})
+}
+
+type endpointExtraConfig struct {
+	Static        *staticExtraConfig `json:"static"`
+	Sequential    bool               `json:"sequential"`
+	Combiner      string             `json:"combiner"`
+	FlatmapFilter []flatmapOpConfig  `json:"flatmap_filter"`
+	Cache         interface{}        `json:"cache"`
+	Collapse      interface{}        `json:"collapse"`
+}
+
+type backendExtraConfig struct {
+	Shadow         bool                       `json:"shadow"`
+	FlatmapFilter  []flatmapOpConfig          `json:"flatmap_filter"`
+	Retry          *retryExtraConfig          `json:"retry"`
+	CircuitBreaker *circuitBreakerExtraConfig `json:"circuit_breaker"`
+	Hedging        interface{}                `json:"hedging"`
+}
+
+type staticExtraConfig struct {
+	Data     map[string]interface{} `json:"data"`
+	Strategy string                 `json:"strategy"`
+}
+
+type flatmapOpConfig struct {
+	Type string   `json:"type"`
+	Args []string `json:"args"`
+}
+
+type cacheExtraConfig struct {
+	Store                map[string]interface{} `json:"store"`
+	MaxItems             int                    `json:"max_items"`
+	MaxEntrySize         int                    `json:"max_entry_size"`
+	Tags                 []string               `json:"tags"`
+	StaleWhileRevalidate string                 `json:"stale_while_revalidate"`
+	StaleIfError         string                 `json:"stale_if_error"`
+	Vary                 []string               `json:"vary"`
+}
+
+type collapseExtraConfig struct {
+	Vary []string `json:"vary"`
+}
+
+type retryExtraConfig struct {
+	MaxAttempts        int     `json:"max_attempts"`
+	Backoff            string  `json:"backoff"`
+	MaxBackoff         string  `json:"max_backoff"`
+	Multiplier         float64 `json:"multiplier"`
+	Jitter             bool    `json:"jitter"`
+	RetryNonIdempotent bool    `json:"retry_non_idempotent"`
+	StatusCodes        []int   `json:"status_codes"`
+}
+
+type circuitBreakerExtraConfig struct {
+	ConsecutiveFailures int     `json:"consecutive_failures"`
+	ErrorRatio          float64 `json:"error_ratio"`
+	MinRequests         int     `json:"min_requests"`
+	Window              string  `json:"window"`
+	Interval            string  `json:"interval"`
+	MaxHalfOpenCalls    int     `json:"max_half_open_calls"`
+}
+
+type hedgingExtraConfig struct {
+	Delay      string  `json:"delay"`
+	Percentile float64 `json:"percentile"`
+	MinSamples int     `json:"min_samples"`
+}
+
+type pluginExtraConfig map[string]interface{}
+
+func (p pluginExtraConfig) Validate() error {
+	names, ok := p["name"]
+	if !ok {
+		return nil
+	}
+	if err := config.DecodeExtraConfig(names, &[]string{}); err != nil {
+		return fmt.Errorf("name: %s", err.Error())
+	}
+	return nil
+}
+
+func validateExtraConfig(scope config.ExtraConfigScope, v interface{}) error {
+	if scope == config.EndpointScope {
+		cfg := endpointExtraConfig{}
+		if err := config.DecodeExtraConfig(v, &cfg); err != nil {
+			return err
+		}
+		return cfg.validate()
+	}
+	cfg := backendExtraConfig{}
+	if err := config.DecodeExtraConfig(v, &cfg); err != nil {
+		return err
+	}
+	return cfg.validate()
+}
+
+func (e endpointExtraConfig) validate() error {
+	if e.Static != nil {
+		if e.Static.Data == nil {
+			return errors.New("static: missing data")
+		}
+		switch e.Static.Strategy {
+		case "", staticAlwaysStrategy, staticIfSuccessStrategy, staticIfErroredStrategy, staticIfCompleteStrategy,
+			staticIfIncompleteStrategy:
+		default:
+			return fmt.Errorf("static.strategy: unknown strategy %q", e.Static.Strategy)
+		}
+	}
+	if err := validateFlatmapOps(e.FlatmapFilter); err != nil {
+		return err
+	}
+
+	cache := cacheExtraConfig{}
+	if err := decodeToggle(cacheKey, e.Cache, &cache); err != nil {
+		return err
+	}
+	if err := validateDurations(
+		[2]string{"cache.stale_while_revalidate", cache.StaleWhileRevalidate},
+		[2]string{"cache.stale_if_error", cache.StaleIfError},
+	); err != nil {
+		return err
+	}
+
+	return decodeToggle(collapseKey, e.Collapse, &collapseExtraConfig{})
+}
+
+func (b backendExtraConfig) validate() error {
+	if err := validateFlatmapOps(b.FlatmapFilter); err != nil {
+		return err
+	}
+
+	if r := b.Retry; r != nil {
+		if r.MaxAttempts < 0 {
+			return errors.New("retry.max_attempts: should not be negative")
+		}
+		if r.Multiplier != 0 && r.Multiplier < 1 {
+			return errors.New("retry.multiplier: should be greater or equal than 1")
+		}
+		if err := validateDurations(
+			[2]string{"retry.backoff", r.Backoff},
+			[2]string{"retry.max_backoff", r.MaxBackoff},
+		); err != nil {
+			return err
+		}
+	}
+
+	if cb := b.CircuitBreaker; cb != nil {
+		if cb.ErrorRatio < 0 || cb.ErrorRatio > 1 {
+			return errors.New("circuit_breaker.error_ratio: should be between 0 and 1")
+		}
+		if err := validateDurations(
+			[2]string{"circuit_breaker.window", cb.Window},
+			[2]string{"circuit_breaker.interval", cb.Interval},
+		); err != nil {
+			return err
+		}
+	}
+
+	hedging := hedgingExtraConfig{}
+	if err := decodeToggle(hedgingKey, b.Hedging, &hedging); err != nil {
+		return err
+	}
+	if hedging.Percentile < 0 || hedging.Percentile > 100 {
+		return errors.New("hedging.percentile: should be between 0 and 100")
+	}
+	return validateDurations([2]string{"hedging.delay", hedging.Delay})
+}
+
+func validateFlatmapOps(ops []flatmapOpConfig) error {
+	for i, op := range ops {
+		switch op.Type {
+		case "move", "append", "del":
+		default:
+			return fmt.Errorf("%s[%d].type: unknown operation %q", flatmapKey, i, op.Type)
+		}
+	}
+	return nil
+}
+
+// decodeToggle decodes the options of the features enabled either with a boolean or with an object
+func decodeToggle(name string, v, target interface{}) error {
+	switch v.(type) {
+	case nil, bool:
+		return nil
+	}
+	if err := config.DecodeExtraConfig(v, target); err != nil {
+		return fmt.Errorf("%s: %s", name, err.Error())
+	}
+	return nil
+}
+
+// validateDurations checks the pairs of field name and duration
+func validateDurations(durations ...[2]string) error {
+	for _, d := range durations {
+		if d[1] == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(d[1]); err != nil {
+			return fmt.Errorf("%s: invalid duration %q", d[0], d[1])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"github.com/starvn/turbo/config"
+	"testing"
+)
+
+func TestValidateExtraConfig(t *testing.T) {
+	for i, tc := range []struct {
+		scope config.ExtraConfigScope
+		cfg   map[string]interface{}
+		err   string
+	}{
+		{
+			scope: config.EndpointScope,
+			cfg: map[string]interface{}{
+				"sequential":     true,
+				"combiner":       "custom",
+				"static":         map[string]interface{}{"data": map[string]interface{}{}, "strategy": "errored"},
+				"flatmap_filter": []interface{}{map[string]interface{}{"type": "del", "args": []interface{}{"a.b"}}},
+				"cache":          map[string]interface{}{"max_items": 10.0, "stale_if_error": "1m", "vary": []interface{}{"X-Foo"}},
+				"collapse":       true,
+			},
+		},
+		{
+			scope: config.BackendScope,
+			cfg: map[string]interface{}{
+				"shadow":          true,
+				"retry":           map[string]interface{}{"max_attempts": 3.0, "backoff": "10ms", "status_codes": []interface{}{503.0}},
+				"circuit_breaker": map[string]interface{}{"error_ratio": 0.5, "window": "10s"},
+				"hedging":         map[string]interface{}{"delay": "50ms", "percentile": 95.0},
+			},
+		},
+		{config.EndpointScope, map[string]interface{}{"sequentail": true}, `unknown field "sequentail"`},
+		{config.BackendScope, map[string]interface{}{"sequential": true}, `unknown field "sequential"`},
+		{config.EndpointScope, map[string]interface{}{"sequential": "true"}, "sequential: expected a boolean, got a string"},
+		{config.EndpointScope, map[string]interface{}{"static": map[string]interface{}{}}, "static: missing data"},
+		{
+			config.EndpointScope,
+			map[string]interface{}{"static": map[string]interface{}{"data": map[string]interface{}{}, "strategy": "never"}},
+			`static.strategy: unknown strategy "never"`,
+		},
+		{
+			config.EndpointScope,
+			map[string]interface{}{"flatmap_filter": []interface{}{map[string]interface{}{"type": "copy"}}},
+			`flatmap_filter[0].type: unknown operation "copy"`,
+		},
+		{config.EndpointScope, map[string]interface{}{"cache": map[string]interface{}{"ttl": "1m"}}, `cache: unknown field "ttl"`},
+		{
+			config.EndpointScope,
+			map[string]interface{}{"cache": map[string]interface{}{"stale_if_error": "1 minute"}},
+			`cache.stale_if_error: invalid duration "1 minute"`,
+		},
+		{config.BackendScope, map[string]interface{}{"retry": map[string]interface{}{"backoff": "soon"}}, `retry.backoff: invalid duration "soon"`},
+		{
+			config.BackendScope,
+			map[string]interface{}{"circuit_breaker": map[string]interface{}{"error_ratio": 2.0}},
+			"circuit_breaker.error_ratio: should be between 0 and 1",
+		},
+		{
+			config.BackendScope,
+			map[string]interface{}{"hedging": map[string]interface{}{"percentile": 120.0}},
+			"hedging.percentile: should be between 0 and 100",
+		},
+	} {
+		err := validateExtraConfig(tc.scope, tc.cfg)
+		if tc.err == "" {
+			if err != nil {
+				t.Errorf("#%d: unexpected error: %s", i, err.Error())
+			}
+			continue
+		}
+		if err == nil || err.Error() != tc.err {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+		}
+	}
+}
+
+func TestServiceConfig_Init_proxyExtraConfig(t *testing.T) {
+	cfg := config.ServiceConfig{
+		Version: config.TurboConfigVersion,
+		Endpoints: []*config.EndpointConfig{
+			{
+				Endpoint:    "/foo",
+				Method:      "GET",
+				ExtraConfig: config.ExtraConfig{Namespace: map[string]interface{}{"sequentail": true}},
+				Backend:     []*config.Backend{{URLPattern: "/bar"}},
+			},
+		},
+	}
+	err := cfg.Init()
+	if err == nil {
+		t.Error("expecting an error")
+		return
+	}
+	if e, ok := err.(*config.ExtraConfigError); !ok || e.Namespace != Namespace || e.Scope != config.EndpointScope {
+		t.Errorf("unexpected error: %s", err.Error())
+	}
+}
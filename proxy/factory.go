@@ -20,6 +20,8 @@ import (
 	"github.com/starvn/turbo/config"
 	"github.com/starvn/turbo/discovery"
 	"github.com/starvn/turbo/log"
+	"github.com/starvn/turbo/ratelimit"
+	"github.com/starvn/turbo/transport/http/client"
 )
 
 type Factory interface {
@@ -43,55 +45,76 @@ func NewDefaultFactory(backendFactory BackendFactory, logger log.Logger) Factory
 }
 
 func NewDefaultFactoryWithSubscriber(backendFactory BackendFactory, logger log.Logger, sF discovery.SubscriberFactory) Factory {
-	return defaultFactory{backendFactory, logger, sF}
+	return defaultFactory{backendFactory, logger, sF, ratelimit.NewRegistry(), newStackRecorder()}
 }
 
 type defaultFactory struct {
 	backendFactory    BackendFactory
 	logger            log.Logger
 	subscriberFactory discovery.SubscriberFactory
+	buckets           *ratelimit.Registry
+	stacks            *stackRecorder
 }
 
-func (pf defaultFactory) New(cfg *config.EndpointConfig) (p Proxy, err error) {
-	switch len(cfg.Backend) {
-	case 0:
-		err = ErrNoBackends
-	case 1:
-		p, err = pf.newSingle(cfg)
-	default:
-		p, err = pf.newMulti(cfg)
+// Stack returns the middlewares of the last proxy built for the endpoint
+func (pf defaultFactory) Stack(method, endpoint string) (Stack, bool) {
+	return pf.stacks.Stack(method, endpoint)
+}
+
+func (pf defaultFactory) New(cfg *config.EndpointConfig) (Proxy, error) {
+	if len(cfg.Backend) == 0 {
+		return nil, ErrNoBackends
 	}
+	cacheMiddleware, err := NewCacheMiddleware(cfg)
 	if err != nil {
-		return
+		return nil, err
 	}
 
-	p = NewPluginMiddleware(cfg)(p)
-	p = NewStaticMiddleware(cfg)(p)
-	return
-}
-
-func (pf defaultFactory) newMulti(cfg *config.EndpointConfig) (p Proxy, err error) {
+	stack := Stack{Backends: make([]BackendStack, len(cfg.Backend))}
 	backendProxy := make([]Proxy, len(cfg.Backend))
 	for i, backend := range cfg.Backend {
-		backendProxy[i] = pf.newStack(backend)
+		b := pf.newStack(backend)
+		backendProxy[i] = b.proxy
+		stack.Backends[i] = newBackendStack(backend, b.middlewares())
 	}
-	p = NewMergeDataMiddleware(cfg)(backendProxy...)
-	p = NewFlatmapMiddleware(cfg)(p)
-	return
-}
 
-func (pf defaultFactory) newSingle(cfg *config.EndpointConfig) (Proxy, error) {
-	return pf.newStack(cfg.Backend[0]), nil
+	var b *stackBuilder
+	if len(cfg.Backend) == 1 {
+		b = newStackBuilder(backendProxy[0])
+	} else {
+		b = newStackBuilder(NewMergeDataMiddleware(cfg)(backendProxy...), "merge:"+getResponseCombinerName(cfg.ExtraConfig))
+		b.wrap("flatmap", NewFlatmapMiddleware(cfg))
+	}
+	b.wrap("plugin", NewPluginMiddleware(cfg))
+	b.wrap("static", NewStaticMiddleware(cfg))
+	b.wrap("collapse", NewCollapseMiddleware(cfg))
+	b.wrap("cache", cacheMiddleware)
+
+	stack.Middlewares = b.middlewares()
+	pf.stacks.record(cfg.Method, cfg.Endpoint, stack)
+	return b.proxy, nil
 }
 
-func (pf defaultFactory) newStack(backend *config.Backend) (p Proxy) {
-	p = pf.backendFactory(backend)
-	p = NewBackendPluginMiddleware(backend)(p)
-	p = NewGraphQLMiddleware(backend)(p)
-	p = NewLoadBalancedMiddlewareWithSubscriber(pf.subscriberFactory(backend))(p)
+func (pf defaultFactory) newStack(backend *config.Backend) *stackBuilder {
+	b := newStackBuilder(pf.backendFactory(backend), "backend")
+	if client.HasHTTPCache(backend) {
+		// the HTTP cache wraps the request executor of the backend
+		b.layers = append(b.layers, "http-cache")
+	}
+	b.wrap("plugin", NewBackendPluginMiddleware(backend))
+	b.wrap("graphql", NewGraphQLMiddleware(backend))
+	b.wrap("load-balancer", NewLoadBalancedMiddlewareWithSubscriber(pf.subscriberFactory(backend)))
+	b.wrap("rate-limit", NewBackendRateLimitMiddlewareWithRegistry(pf.buckets, backend))
+	b.wrap("retry", NewRetryMiddleware(backend))
+	b.wrap("circuit-breaker", NewCircuitBreakerMiddlewareWithLogger(pf.logger, backend))
 	if backend.ConcurrentCalls > 1 {
-		p = NewConcurrentMiddleware(backend)(p)
+		if _, ok := getHedgingCfg(backend); ok {
+			b.wrap("hedging", NewConcurrentMiddleware(backend))
+		} else {
+			b.wrap("concurrent", NewConcurrentMiddleware(backend))
+		}
 	}
-	p = NewRequestBuilderMiddleware(backend)(p)
-	return
+	b.wrap("request-builder", NewRequestBuilderMiddleware(backend))
+	b.wrap("timeout", NewBackendTimeoutMiddleware(backend))
+	return b
 }
@@ -292,15 +292,14 @@ func newFlatmapFormatter(cfg config.ExtraConfig, target, group string) EntityFor
 
 func NewFlatmapMiddleware(cfg *config.EndpointConfig) Middleware {
 	formatter := newFlatmapFormatter(cfg.ExtraConfig, "", "")
+	if formatter == nil {
+		return EmptyMiddleware
+	}
 	return func(next ...Proxy) Proxy {
 		if len(next) != 1 {
 			panic(ErrTooManyProxies)
 		}
 
-		if formatter == nil {
-			return next[0]
-		}
-
 		return func(ctx context.Context, request *Request) (*Response, error) {
 			resp, err := next[0](ctx, request)
 			if err != nil {
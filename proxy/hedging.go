@@ -0,0 +1,220 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"context"
+	"github.com/starvn/turbo/config"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	hedgingKey = "hedging"
+
+	defaultHedgingDelay      = 100 * time.Millisecond
+	defaultHedgingMinSamples = 20
+	hedgingLatencyWindow     = 128
+)
+
+type hedgingConfig struct {
+	Delay      time.Duration
+	Percentile float64
+	MinSamples int
+}
+
+func getHedgingCfg(remote *config.Backend) (hedgingConfig, bool) {
+	v, ok := remote.ExtraConfig[Namespace]
+	if !ok {
+		return hedgingConfig{}, false
+	}
+	e, ok := v.(map[string]interface{})
+	if !ok {
+		return hedgingConfig{}, false
+	}
+
+	cfg := hedgingConfig{Delay: defaultHedgingDelay, MinSamples: defaultHedgingMinSamples}
+	switch tmp := e[hedgingKey].(type) {
+	case bool:
+		return cfg, tmp
+	case map[string]interface{}:
+		if d, ok := tmp["delay"].(string); ok {
+			if delay, err := time.ParseDuration(d); err == nil && delay >= 0 {
+				cfg.Delay = delay
+			}
+		}
+		if p, ok := tmp["percentile"].(float64); ok && p > 0 && p <= 100 {
+			cfg.Percentile = p
+		}
+		if n, ok := tmp["min_samples"].(float64); ok && n > 0 {
+			cfg.MinSamples = int(n)
+		}
+		return cfg, true
+	default:
+		return hedgingConfig{}, false
+	}
+}
+
+func newHedgedProxy(remote *config.Backend, cfg hedgingConfig, timeout time.Duration, next Proxy) Proxy {
+	latencies := newLatencyTracker(hedgingLatencyWindow)
+	hedgingDelay := func() time.Duration {
+		if cfg.Percentile == 0 {
+			return cfg.Delay
+		}
+		if d, ok := latencies.Percentile(cfg.Percentile, cfg.MinSamples); ok {
+			return d
+		}
+		return cfg.Delay
+	}
+
+	return func(ctx context.Context, request *Request) (*Response, error) {
+		localCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		requests := make([]*Request, remote.ConcurrentCalls)
+		for i := range requests {
+			requests[i] = CloneRequest(request)
+		}
+
+		type hedgedResult struct {
+			response *Response
+			err      error
+			latency  time.Duration
+		}
+		results := make(chan hedgedResult, remote.ConcurrentCalls)
+		launched, pending := 0, 0
+		launch := func() {
+			r := requests[launched]
+			launched++
+			pending++
+			go func() {
+				begin := time.Now()
+				resp, err := next(localCtx, r)
+				if err == nil && resp == nil {
+					err = errNullResult
+				}
+				results <- hedgedResult{resp, err, time.Since(begin)}
+			}()
+		}
+
+		launch()
+		delay := hedgingDelay()
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+
+		var response *Response
+		var err error
+		for {
+			select {
+			case res := <-results:
+				pending--
+				if res.err == nil && res.response.IsComplete {
+					latencies.Add(res.latency)
+					return res.response, nil
+				}
+				if res.err != nil {
+					err = res.err
+				} else {
+					response = res.response
+				}
+				if pending > 0 {
+					continue
+				}
+				if launched == remote.ConcurrentCalls {
+					if response != nil {
+						return response, nil
+					}
+					return nil, err
+				}
+				launch()
+				resetTimer(timer, delay)
+			case <-timer.C:
+				if launched < remote.ConcurrentCalls {
+					launch()
+					timer.Reset(delay)
+				}
+			case <-localCtx.Done():
+				if response != nil {
+					return response, nil
+				}
+				if err == nil {
+					err = localCtx.Err()
+				}
+				return nil, err
+			}
+		}
+	}
+}
+
+func resetTimer(t *time.Timer, d time.Duration) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+	t.Reset(d)
+}
+
+func newLatencyTracker(size int) *latencyTracker {
+	return &latencyTracker{
+		samples: make([]time.Duration, 0, size),
+		size:    size,
+		mu:      &sync.Mutex{},
+	}
+}
+
+type latencyTracker struct {
+	samples []time.Duration
+	size    int
+	next    int
+	mu      *sync.Mutex
+}
+
+func (l *latencyTracker) Add(d time.Duration) {
+	l.mu.Lock()
+	if len(l.samples) < l.size {
+		l.samples = append(l.samples, d)
+	} else {
+		l.samples[l.next] = d
+	}
+	l.next = (l.next + 1) % l.size
+	l.mu.Unlock()
+}
+
+func (l *latencyTracker) Percentile(p float64, minSamples int) (time.Duration, bool) {
+	l.mu.Lock()
+	if len(l.samples) < minSamples || len(l.samples) == 0 {
+		l.mu.Unlock()
+		return 0, false
+	}
+	sorted := make([]time.Duration, len(l.samples))
+	copy(sorted, l.samples)
+	l.mu.Unlock()
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	idx := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx], true
+}
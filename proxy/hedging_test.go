@@ -0,0 +1,173 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"context"
+	"github.com/starvn/turbo/config"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newHedgingTestBackend(hedging interface{}) *config.Backend {
+	return &config.Backend{
+		ConcurrentCalls: 3,
+		Timeout:         time.Second,
+		ExtraConfig:     config.ExtraConfig{Namespace: map[string]interface{}{hedgingKey: hedging}},
+	}
+}
+
+func TestNewConcurrentMiddleware_hedgingFastResponse(t *testing.T) {
+	var calls int32
+	p := NewConcurrentMiddleware(newHedgingTestBackend(map[string]interface{}{"delay": "50ms"}))(
+		func(_ context.Context, _ *Request) (*Response, error) {
+			atomic.AddInt32(&calls, 1)
+			return &Response{Data: map[string]interface{}{"ok": true}, IsComplete: true}, nil
+		},
+	)
+
+	resp, err := p(context.Background(), &Request{})
+	if err != nil || resp == nil || !resp.IsComplete {
+		t.Errorf("unexpected result: %v %v", resp, err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if c := atomic.LoadInt32(&calls); c != 1 {
+		t.Errorf("unexpected number of calls: %d", c)
+	}
+}
+
+func TestNewConcurrentMiddleware_hedgingSlowResponse(t *testing.T) {
+	var calls int32
+	cancelled := make(chan struct{}, 3)
+	p := NewConcurrentMiddleware(newHedgingTestBackend(map[string]interface{}{"delay": "10ms"}))(
+		func(ctx context.Context, _ *Request) (*Response, error) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				<-ctx.Done()
+				cancelled <- struct{}{}
+				return nil, ctx.Err()
+			}
+			return &Response{Data: map[string]interface{}{"ok": true}, IsComplete: true}, nil
+		},
+	)
+
+	begin := time.Now()
+	resp, err := p(context.Background(), &Request{})
+	if err != nil || resp == nil || !resp.IsComplete {
+		t.Errorf("unexpected result: %v %v", resp, err)
+	}
+	if d := time.Since(begin); d < 10*time.Millisecond || d > 500*time.Millisecond {
+		t.Errorf("unexpected duration: %v", d)
+	}
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Error("the slow call was not cancelled")
+	}
+	if c := atomic.LoadInt32(&calls); c != 2 {
+		t.Errorf("unexpected number of calls: %d", c)
+	}
+}
+
+func TestNewConcurrentMiddleware_hedgingFailures(t *testing.T) {
+	var calls int32
+	p := NewConcurrentMiddleware(newHedgingTestBackend(map[string]interface{}{"delay": "1s"}))(
+		func(_ context.Context, _ *Request) (*Response, error) {
+			switch atomic.AddInt32(&calls, 1) {
+			case 1:
+				return nil, errNullResult
+			case 2:
+				return &Response{Data: map[string]interface{}{"partial": true}}, nil
+			default:
+				return nil, errNullResult
+			}
+		},
+	)
+
+	begin := time.Now()
+	resp, err := p(context.Background(), &Request{})
+	if err != nil || resp == nil || resp.Data["partial"] != true {
+		t.Errorf("unexpected result: %v %v", resp, err)
+	}
+	if d := time.Since(begin); d > 500*time.Millisecond {
+		t.Errorf("failed calls should trigger the next copy immediately: %v", d)
+	}
+	if c := atomic.LoadInt32(&calls); c != 3 {
+		t.Errorf("unexpected number of calls: %d", c)
+	}
+}
+
+func TestNewConcurrentMiddleware_hedgingPercentile(t *testing.T) {
+	backend := newHedgingTestBackend(map[string]interface{}{
+		"delay":       "1s",
+		"percentile":  50.0,
+		"min_samples": 3.0,
+	})
+	backend.ConcurrentCalls = 2
+
+	var calls int32
+	p := NewConcurrentMiddleware(backend)(func(ctx context.Context, _ *Request) (*Response, error) {
+		n := atomic.AddInt32(&calls, 1)
+		if n == 7 {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		time.Sleep(5 * time.Millisecond)
+		return &Response{IsComplete: true}, nil
+	})
+
+	for i := 0; i < 3; i++ {
+		if _, err := p(context.Background(), &Request{}); err != nil {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+		}
+	}
+
+	atomic.StoreInt32(&calls, 6)
+	begin := time.Now()
+	if _, err := p(context.Background(), &Request{}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if d := time.Since(begin); d > 500*time.Millisecond {
+		t.Errorf("the hedging delay should follow the observed latencies: %v", d)
+	}
+}
+
+func TestLatencyTracker(t *testing.T) {
+	l := newLatencyTracker(4)
+	if _, ok := l.Percentile(50, 1); ok {
+		t.Error("an empty tracker should not report percentiles")
+	}
+	for _, d := range []time.Duration{5, 1, 3, 2, 4} {
+		l.Add(d)
+	}
+	for _, tc := range []struct {
+		p        float64
+		expected time.Duration
+	}{
+		{50, 2},
+		{100, 4},
+		{1, 1},
+	} {
+		if d, ok := l.Percentile(tc.p, 4); !ok || d != tc.expected {
+			t.Errorf("unexpected p%v: %v", tc.p, d)
+		}
+	}
+	if _, ok := l.Percentile(50, 5); ok {
+		t.Error("the tracker should require the minimum number of samples")
+	}
+}
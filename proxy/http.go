@@ -40,7 +40,12 @@ func CustomHTTPProxyFactory(cf client.HTTPClientFactory) BackendFactory {
 }
 
 func NewHTTPProxy(remote *config.Backend, cf client.HTTPClientFactory, decode encoding.Decoder) Proxy {
-	return NewHTTPProxyWithHTTPExecutor(remote, client.DefaultHTTPRequestExecutor(cf), decode)
+	re, err := client.CachedHTTPRequestExecutor(remote, client.DefaultHTTPRequestExecutor(cf))
+	if err != nil {
+		// the backend is not called without the cache it is configured with
+		return func(_ context.Context, _ *Request) (*Response, error) { return nil, err }
+	}
+	return NewHTTPProxyWithHTTPExecutor(remote, re, decode)
 }
 
 func NewHTTPProxyWithHTTPExecutor(remote *config.Backend, re client.HTTPRequestExecutor, dec encoding.Decoder) Proxy {
@@ -50,7 +55,38 @@ func NewHTTPProxyWithHTTPExecutor(remote *config.Backend, re client.HTTPRequestE
 
 	ef := NewEntityFormatter(remote)
 	rp := DefaultHTTPResponseParserFactory(HTTPResponseParserConfig{dec, ef})
-	return NewHTTPProxyDetailed(remote, re, client.GetHTTPStatusHandler(remote), rp)
+	sh := client.GetHTTPStatusHandler(remote)
+	_, retry := getRetryCfg(remote)
+	_, circuitBreaker := getCircuitBreakerCfg(remote)
+	if retry || circuitBreaker {
+		sh = statusCodeKeeper(sh)
+	}
+	return NewHTTPProxyDetailed(remote, re, sh, rp)
+}
+
+// statusCodeKeeper keeps the backend status code of the responses rejected with
+// client.ErrInvalidStatusCode, so the resilience middlewares can inspect it
+func statusCodeKeeper(sh client.HTTPStatusHandler) client.HTTPStatusHandler {
+	return func(ctx context.Context, resp *http.Response) (*http.Response, error) {
+		code := resp.StatusCode
+		r, err := sh(ctx, resp)
+		if err == client.ErrInvalidStatusCode {
+			return r, invalidStatusCodeError{code: code}
+		}
+		return r, err
+	}
+}
+
+type invalidStatusCodeError struct {
+	code int
+}
+
+func (invalidStatusCodeError) Error() string {
+	return client.ErrInvalidStatusCode.Error()
+}
+
+func (invalidStatusCodeError) Unwrap() error {
+	return client.ErrInvalidStatusCode
 }
 
 func NewHTTPProxyDetailed(remote *config.Backend, re client.HTTPRequestExecutor, ch client.HTTPStatusHandler, rp HTTPResponseParser) Proxy {
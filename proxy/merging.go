@@ -18,6 +18,7 @@ package proxy
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/starvn/turbo/config"
 	"regexp"
@@ -34,7 +35,7 @@ func NewMergeDataMiddleware(endpointConfig *config.EndpointConfig) Middleware {
 	if totalBackends == 1 {
 		return EmptyMiddleware
 	}
-	serviceTimeout := time.Duration(85*endpointConfig.Timeout.Nanoseconds()/100) * time.Nanosecond
+	serviceTimeout := mergeTimeout(endpointConfig)
 	combiner := getResponseCombiner(endpointConfig.ExtraConfig)
 
 	return func(next ...Proxy) Proxy {
@@ -43,7 +44,11 @@ func NewMergeDataMiddleware(endpointConfig *config.EndpointConfig) Middleware {
 		}
 
 		if !shouldRunSequentialMerger(endpointConfig) {
-			return parallelMerge(serviceTimeout, combiner, next...)
+			required := make([]bool, len(endpointConfig.Backend))
+			for i, b := range endpointConfig.Backend {
+				required[i] = b.Required
+			}
+			return parallelMerge(serviceTimeout, combiner, required, next...)
 		}
 
 		patterns := make([]string, len(endpointConfig.Backend))
@@ -54,6 +59,23 @@ func NewMergeDataMiddleware(endpointConfig *config.EndpointConfig) Middleware {
 	}
 }
 
+func mergeTimeout(endpointConfig *config.EndpointConfig) time.Duration {
+	var timeout time.Duration
+	for _, b := range endpointConfig.Backend {
+		t := b.Timeout
+		if t <= 0 {
+			t = endpointConfig.Timeout
+		}
+		if t > timeout {
+			timeout = t
+		}
+	}
+	if endpointConfig.Timeout > 0 && timeout > endpointConfig.Timeout {
+		timeout = endpointConfig.Timeout
+	}
+	return timeout
+}
+
 func shouldRunSequentialMerger(endpointConfig *config.EndpointConfig) bool {
 	if v, ok := endpointConfig.ExtraConfig[Namespace]; ok {
 		if e, ok := v.(map[string]interface{}); ok {
@@ -66,24 +88,71 @@ func shouldRunSequentialMerger(endpointConfig *config.EndpointConfig) bool {
 	return false
 }
 
-func parallelMerge(timeout time.Duration, rc ResponseCombiner, next ...Proxy) Proxy {
+func parallelMerge(timeout time.Duration, rc ResponseCombiner, required []bool, next ...Proxy) Proxy {
+	totalRequired := 0
+	for _, r := range required {
+		if r {
+			totalRequired++
+		}
+	}
+	if totalRequired == 0 || totalRequired == len(next) {
+		return func(ctx context.Context, request *Request) (*Response, error) {
+			localCtx, cancel := context.WithTimeout(ctx, timeout)
+
+			parts := make(chan *Response, len(next))
+			failed := make(chan error, len(next))
+
+			for _, n := range next {
+				go requestPart(localCtx, n, request, false, parts, failed)
+			}
+
+			acc := newIncrementalMergeAccumulator(len(next), rc)
+			for i := 0; i < len(next); i++ {
+				select {
+				case err := <-failed:
+					acc.Merge(nil, err)
+				case response := <-parts:
+					acc.Merge(response, nil)
+				}
+			}
+
+			result, err := acc.Result()
+			cancel()
+			return result, err
+		}
+	}
+
 	return func(ctx context.Context, request *Request) (*Response, error) {
 		localCtx, cancel := context.WithTimeout(ctx, timeout)
 
-		parts := make(chan *Response, len(next))
-		failed := make(chan error, len(next))
+		type indexedPart struct {
+			idx      int
+			response *Response
+			err      error
+		}
+		results := make(chan indexedPart, len(next))
 
-		for _, n := range next {
-			go requestPart(localCtx, n, request, false, parts, failed)
+		for i, n := range next {
+			go func(i int, n Proxy) {
+				parts := make(chan *Response, 1)
+				failed := make(chan error, 1)
+				requestPart(localCtx, n, request, false, parts, failed)
+				select {
+				case err := <-failed:
+					results <- indexedPart{idx: i, err: err}
+				case response := <-parts:
+					results <- indexedPart{idx: i, response: response}
+				}
+			}(i, n)
 		}
 
 		acc := newIncrementalMergeAccumulator(len(next), rc)
-		for i := 0; i < len(next); i++ {
-			select {
-			case err := <-failed:
-				acc.Merge(nil, err)
-			case response := <-parts:
-				acc.Merge(response, nil)
+		pendingRequired := totalRequired
+		for i := 0; i < len(next) && pendingRequired > 0; i++ {
+			part := <-results
+			acc.Merge(part.response, part.err)
+			if required[part.idx] {
+				pendingRequired--
 			}
 		}
 
@@ -226,6 +295,9 @@ func (i *incrementalMergeAccumulator) Merge(res *Response, err error) {
 
 func (i *incrementalMergeAccumulator) Result() (*Response, error) {
 	if i.data == nil {
+		if err := allCircuitsOpenError(i.errs); err != nil {
+			return &Response{Data: make(map[string]interface{}, 0), IsComplete: false}, err
+		}
 		return &Response{Data: make(map[string]interface{}, 0), IsComplete: false}, newMergeError(i.errs)
 	}
 
@@ -267,6 +339,18 @@ func requestPart(ctx context.Context, next Proxy, request *Request, sequential b
 	cancel()
 }
 
+func allCircuitsOpenError(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	for _, err := range errs {
+		if !errors.As(err, &CircuitOpenError{}) {
+			return nil
+		}
+	}
+	return errs[0]
+}
+
 func newMergeError(errs []error) error {
 	if len(errs) == 0 {
 		return nil
@@ -309,17 +393,23 @@ func initResponseCombiners() *combinerRegister {
 }
 
 func getResponseCombiner(extra config.ExtraConfig) ResponseCombiner {
-	combiner, _ := responseCombiners.GetResponseCombiner(defaultCombinerName)
+	combiner, _ := responseCombiners.GetResponseCombiner(getResponseCombinerName(extra))
+	return combiner
+}
+
+func getResponseCombinerName(extra config.ExtraConfig) string {
 	if v, ok := extra[Namespace]; ok {
 		if e, ok := v.(map[string]interface{}); ok {
 			if v, ok := e[mergeKey]; ok {
-				if c, ok := responseCombiners.GetResponseCombiner(v.(string)); ok {
-					combiner = c
+				if name, ok := v.(string); ok {
+					if _, ok := responseCombiners.GetResponseCombiner(name); ok {
+						return name
+					}
 				}
 			}
 		}
 	}
-	return combiner
+	return defaultCombinerName
 }
 
 func combineData(total int, parts []*Response) *Response {
@@ -694,3 +694,61 @@ func Test_incrementalMergeAccumulator_incompleteResponse(t *testing.T) {
 		t.Error("response should not be completed")
 	}
 }
+
+func TestNewMergeDataMiddleware_backendTimeouts(t *testing.T) {
+	fast := config.Backend{Timeout: 50 * time.Millisecond}
+	slow := config.Backend{Timeout: 150 * time.Millisecond}
+	endpoint := config.EndpointConfig{
+		Backend: []*config.Backend{&fast, &slow},
+		Timeout: time.Second,
+	}
+	if d := mergeTimeout(&endpoint); d != slow.Timeout {
+		t.Errorf("unexpected merge timeout: %v", d)
+	}
+
+	endpoint.Timeout = 100 * time.Millisecond
+	if d := mergeTimeout(&endpoint); d != endpoint.Timeout {
+		t.Errorf("the merge timeout should not exceed the endpoint one: %v", d)
+	}
+
+	fast.Timeout = 0
+	slow.Timeout = 0
+	if d := mergeTimeout(&endpoint); d != endpoint.Timeout {
+		t.Errorf("unexpected merge timeout: %v", d)
+	}
+}
+
+func TestNewMergeDataMiddleware_required(t *testing.T) {
+	timeout := 500
+	required := config.Backend{Timeout: time.Duration(timeout) * time.Millisecond, Required: true}
+	optional := config.Backend{Timeout: time.Duration(timeout) * time.Millisecond}
+	endpoint := config.EndpointConfig{
+		Backend: []*config.Backend{&required, &optional, &required},
+		Timeout: time.Duration(timeout) * time.Millisecond,
+	}
+	mw := NewMergeDataMiddleware(&endpoint)
+	p := mw(
+		dummyProxy(&Response{Data: map[string]interface{}{"sonic": 42}, IsComplete: true}),
+		delayedProxy(t, time.Duration(5*timeout)*time.Millisecond, &Response{Data: map[string]interface{}{"slow": true}, IsComplete: true}),
+		delayedProxy(t, 10*time.Millisecond, &Response{Data: map[string]interface{}{"turbo": true}, IsComplete: true}),
+	)
+
+	begin := time.Now()
+	out, err := p(context.Background(), &Request{})
+	if err != nil {
+		t.Errorf("The middleware propagated an unexpected error: %s\n", err.Error())
+	}
+	if d := time.Since(begin); d > time.Duration(timeout/2)*time.Millisecond {
+		t.Errorf("The middleware should have returned once the required backends answered. took: %v", d)
+	}
+	if out == nil {
+		t.Errorf("The proxy returned a null result\n")
+		return
+	}
+	if len(out.Data) != 2 || out.Data["sonic"] != 42 || out.Data["turbo"] != true {
+		t.Errorf("We were expecting a partial response but we got %v!\n", out)
+	}
+	if out.IsComplete {
+		t.Errorf("We were expecting an incompleted response but we got a completed one!\n")
+	}
+}
@@ -60,6 +60,24 @@ func getModifier(namespace, name string) (ModifierFactory, bool) {
 	return ModifierFactory(res), ok
 }
 
+// RequestModifierNames returns the names of the registered request modifiers, sorted
+func RequestModifierNames() []string {
+	return modifierNames(requestNamespace)
+}
+
+// ResponseModifierNames returns the names of the registered response modifiers, sorted
+func ResponseModifierNames() []string {
+	return modifierNames(responseNamespace)
+}
+
+func modifierNames(namespace string) []string {
+	r, ok := modifierRegister.Get(namespace)
+	if !ok {
+		return []string{}
+	}
+	return r.Keys()
+}
+
 func RegisterModifier(
 	name string,
 	modifierFactory func(map[string]interface{}) func(interface{}) (interface{}, error),
@@ -89,3 +89,25 @@ func (r requestWrapper) Path() string                 { return r.path }
 func (r requestWrapper) Body() io.ReadCloser          { return r.body }
 func (r requestWrapper) Params() map[string]string    { return r.params }
 func (r requestWrapper) Headers() map[string][]string { return r.headers }
+
+func TestModifierNames(t *testing.T) {
+	factory := func(map[string]interface{}) func(interface{}) (interface{}, error) { return nil }
+	RegisterModifier("test-names-request", factory, true, false)
+	RegisterModifier("test-names-both", factory, true, true)
+
+	contains := func(names []string, name string) bool {
+		for _, n := range names {
+			if n == name {
+				return true
+			}
+		}
+		return false
+	}
+	request, response := RequestModifierNames(), ResponseModifierNames()
+	if !contains(request, "test-names-request") || !contains(request, "test-names-both") {
+		t.Errorf("unexpected request modifiers: %v", request)
+	}
+	if contains(response, "test-names-request") || !contains(response, "test-names-both") {
+		t.Errorf("unexpected response modifiers: %v", response)
+	}
+}
@@ -0,0 +1,70 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"context"
+	"github.com/starvn/turbo/config"
+	"github.com/starvn/turbo/ratelimit"
+	"net/http"
+)
+
+type RateLimitedError struct {
+	Backend string
+}
+
+func (r RateLimitedError) Error() string {
+	return "rate limit exceeded for backend " + r.Backend
+}
+
+func (RateLimitedError) StatusCode() int {
+	return http.StatusServiceUnavailable
+}
+
+// NewBackendRateLimitMiddleware caps the calls per second towards the backend. The token bucket is
+// shared by all the endpoints pointing to the same hosts, unless a name is set in the config
+func NewBackendRateLimitMiddleware(remote *config.Backend) Middleware {
+	return NewBackendRateLimitMiddlewareWithRegistry(nil, remote)
+}
+
+// NewBackendRateLimitMiddlewareWithRegistry takes the token buckets from the given registry, or from
+// the default one if it is nil
+func NewBackendRateLimitMiddlewareWithRegistry(buckets *ratelimit.Registry, remote *config.Backend) Middleware {
+	cfg, ok := ratelimit.BackendConfigGetter(remote)
+	if !ok {
+		return EmptyMiddleware
+	}
+	var bucket *ratelimit.TokenBucket
+	if buckets == nil {
+		bucket = ratelimit.Shared(cfg.Name, cfg.MaxRate, cfg.Capacity)
+	} else {
+		bucket = buckets.Get(cfg.Name, cfg.MaxRate, cfg.Capacity)
+	}
+	limitedErr := RateLimitedError{Backend: cfg.Name}
+
+	return func(next ...Proxy) Proxy {
+		if len(next) > 1 {
+			panic(ErrTooManyProxies)
+		}
+		return func(ctx context.Context, request *Request) (*Response, error) {
+			if ok, _ := bucket.Allow(); !ok {
+				return nil, limitedErr
+			}
+			return next[0](ctx, request)
+		}
+	}
+}
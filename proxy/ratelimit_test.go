@@ -0,0 +1,93 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"context"
+	"github.com/starvn/turbo/config"
+	"github.com/starvn/turbo/ratelimit"
+	"testing"
+)
+
+func TestNewBackendRateLimitMiddleware(t *testing.T) {
+	newBackend := func(pattern string) *config.Backend {
+		return &config.Backend{
+			Host:        []string{"http://TestNewBackendRateLimitMiddleware"},
+			URLPattern:  pattern,
+			ExtraConfig: config.ExtraConfig{ratelimit.Namespace: map[string]interface{}{"max_rate": 0.001, "capacity": 2.0}},
+		}
+	}
+	calls := 0
+	next := func(_ context.Context, _ *Request) (*Response, error) {
+		calls++
+		return &Response{IsComplete: true}, nil
+	}
+	buckets := ratelimit.NewRegistry()
+	p1 := NewBackendRateLimitMiddlewareWithRegistry(buckets, newBackend("/a"))(next)
+	p2 := NewBackendRateLimitMiddlewareWithRegistry(buckets, newBackend("/b"))(next)
+
+	for i, p := range []Proxy{p1, p2} {
+		if _, err := p(context.Background(), &Request{}); err != nil {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+		}
+	}
+	for i, p := range []Proxy{p1, p2} {
+		_, err := p(context.Background(), &Request{})
+		e, ok := err.(RateLimitedError)
+		if !ok {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+			continue
+		}
+		if e.StatusCode() != 503 {
+			t.Errorf("#%d: unexpected status code: %d", i, e.StatusCode())
+		}
+	}
+	if calls != 2 {
+		t.Errorf("the endpoints sharing the backend should share the limit: %d", calls)
+	}
+}
+
+func TestNewBackendRateLimitMiddleware_disabled(t *testing.T) {
+	for i, backend := range []*config.Backend{
+		{},
+		{ExtraConfig: config.ExtraConfig{ratelimit.Namespace: map[string]interface{}{"capacity": 2.0}}},
+	} {
+		calls := 0
+		p := NewBackendRateLimitMiddleware(backend)(func(_ context.Context, _ *Request) (*Response, error) {
+			calls++
+			return &Response{IsComplete: true}, nil
+		})
+		for j := 0; j < 10; j++ {
+			if _, err := p(context.Background(), &Request{}); err != nil {
+				t.Errorf("#%d: unexpected error: %v", i, err)
+			}
+		}
+		if calls != 10 {
+			t.Errorf("#%d: unexpected number of calls: %d", i, calls)
+		}
+	}
+}
+
+func TestNewBackendRateLimitMiddleware_multipleNext(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("The code did not panic")
+		}
+	}()
+	backend := &config.Backend{ExtraConfig: config.ExtraConfig{ratelimit.Namespace: map[string]interface{}{"max_rate": 1.0}}}
+	NewBackendRateLimitMiddleware(backend)(explosiveProxy(t), explosiveProxy(t))
+}
@@ -54,6 +54,11 @@ func (r *combinerRegister) GetResponseCombiner(name string) (ResponseCombiner, b
 	return r.fallback, ok
 }
 
+// ResponseCombinerNames returns the names of the registered response combiners, sorted
+func (r *combinerRegister) ResponseCombinerNames() []string {
+	return r.data.Keys()
+}
+
 func (r *combinerRegister) SetResponseCombiner(name string, rc ResponseCombiner) {
 	r.data.Register(name, rc)
 }
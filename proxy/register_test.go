@@ -92,3 +92,10 @@ func TestNewRegister_responseCombiner_fallbackIfUnknown(t *testing.T) {
 		return
 	}
 }
+
+func TestNewRegister_responseCombinerNames(t *testing.T) {
+	r := newCombinerRegister(map[string]ResponseCombiner{"b": combineData, "a": combineData}, combineData)
+	if names := r.ResponseCombinerNames(); len(names) != 2 || names[0] != "a" || names[1] != "b" {
+		t.Errorf("unexpected names: %v", names)
+	}
+}
@@ -0,0 +1,198 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"context"
+	"github.com/starvn/turbo/config"
+	"github.com/starvn/turbo/transport/http/client"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	retryKey = "retry"
+
+	defaultRetryMaxAttempts = 3
+	defaultRetryBackoff     = 100 * time.Millisecond
+	defaultRetryMaxBackoff  = 5 * time.Second
+	defaultRetryMultiplier  = 2.0
+)
+
+var defaultRetryStatusCodes = []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+
+func NewRetryMiddleware(remote *config.Backend) Middleware {
+	cfg, ok := getRetryCfg(remote)
+	if !ok {
+		return EmptyMiddleware
+	}
+
+	return func(next ...Proxy) Proxy {
+		if len(next) > 1 {
+			panic(ErrTooManyProxies)
+		}
+		return func(ctx context.Context, request *Request) (*Response, error) {
+			if !cfg.RetryNonIdempotent && !isIdempotentMethod(request.Method) {
+				return next[0](ctx, request)
+			}
+
+			var resp *Response
+			var err error
+			for attempt := 1; ; attempt++ {
+				resp, err = next[0](ctx, CloneRequest(request))
+				if attempt >= cfg.MaxAttempts || ctx.Err() != nil || !cfg.shouldRetry(resp, err) {
+					return resp, err
+				}
+				discardResponse(resp)
+
+				timer := time.NewTimer(cfg.backoff(attempt))
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return nil, ctx.Err()
+				case <-timer.C:
+				}
+			}
+		}
+	}
+}
+
+type retryConfig struct {
+	MaxAttempts        int
+	Backoff            time.Duration
+	MaxBackoff         time.Duration
+	Multiplier         float64
+	Jitter             bool
+	StatusCodes        map[int]struct{}
+	RetryNonIdempotent bool
+}
+
+func getRetryCfg(remote *config.Backend) (retryConfig, bool) {
+	v, ok := remote.ExtraConfig[Namespace]
+	if !ok {
+		return retryConfig{}, false
+	}
+	e, ok := v.(map[string]interface{})
+	if !ok {
+		return retryConfig{}, false
+	}
+	tmp, ok := e[retryKey].(map[string]interface{})
+	if !ok {
+		return retryConfig{}, false
+	}
+
+	cfg := retryConfig{
+		MaxAttempts: defaultRetryMaxAttempts,
+		Backoff:     defaultRetryBackoff,
+		MaxBackoff:  defaultRetryMaxBackoff,
+		Multiplier:  defaultRetryMultiplier,
+		Jitter:      true,
+		StatusCodes: map[int]struct{}{},
+	}
+	if n, ok := tmp["max_attempts"].(float64); ok {
+		cfg.MaxAttempts = int(n)
+	}
+	if d, ok := tmp["backoff"].(string); ok {
+		if b, err := time.ParseDuration(d); err == nil && b >= 0 {
+			cfg.Backoff = b
+		}
+	}
+	if d, ok := tmp["max_backoff"].(string); ok {
+		if b, err := time.ParseDuration(d); err == nil && b >= 0 {
+			cfg.MaxBackoff = b
+		}
+	}
+	if n, ok := tmp["multiplier"].(float64); ok && n >= 1 {
+		cfg.Multiplier = n
+	}
+	if b, ok := tmp["jitter"].(bool); ok {
+		cfg.Jitter = b
+	}
+	if b, ok := tmp["retry_non_idempotent"].(bool); ok {
+		cfg.RetryNonIdempotent = b
+	}
+	if codes, ok := tmp["status_codes"].([]interface{}); ok {
+		for _, c := range codes {
+			if code, ok := c.(float64); ok {
+				cfg.StatusCodes[int(code)] = struct{}{}
+			}
+		}
+	} else {
+		for _, code := range defaultRetryStatusCodes {
+			cfg.StatusCodes[code] = struct{}{}
+		}
+	}
+	return cfg, cfg.MaxAttempts > 1
+}
+
+func (r retryConfig) shouldRetry(resp *Response, err error) bool {
+	if err == nil {
+		if resp == nil {
+			return false
+		}
+		_, ok := r.StatusCodes[resp.Metadata.StatusCode]
+		return ok
+	}
+
+	switch t := err.(type) {
+	case CircuitOpenError, RateLimitedError:
+		return false
+	case invalidStatusCodeError:
+		_, ok := r.StatusCodes[t.code]
+		return ok
+	case interface{ StatusCode() int }:
+		_, ok := r.StatusCodes[t.StatusCode()]
+		return ok
+	}
+	return err != client.ErrInvalidStatusCode && err != context.Canceled && err != context.DeadlineExceeded
+}
+
+func (r retryConfig) backoff(attempt int) time.Duration {
+	d := float64(r.Backoff)
+	for i := 1; i < attempt && d < float64(r.MaxBackoff); i++ {
+		d *= r.Multiplier
+	}
+	if d > float64(r.MaxBackoff) {
+		d = float64(r.MaxBackoff)
+	}
+	delay := time.Duration(d)
+	if !r.Jitter || delay <= 1 {
+		return delay
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
+
+func isIdempotentMethod(method string) bool {
+	switch strings.ToUpper(method) {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func discardResponse(resp *Response) {
+	if resp == nil || resp.Io == nil {
+		return
+	}
+	if c, ok := resp.Io.(io.Closer); ok {
+		_ = c.Close()
+	}
+}
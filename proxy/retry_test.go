@@ -0,0 +1,240 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/starvn/turbo/config"
+	"github.com/starvn/turbo/discovery"
+	"github.com/starvn/turbo/encoding"
+	"github.com/starvn/turbo/transport/http/client"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newRetryTestBackend(cfg map[string]interface{}) *config.Backend {
+	return &config.Backend{ExtraConfig: config.ExtraConfig{Namespace: map[string]interface{}{retryKey: cfg}}}
+}
+
+func TestNewRetryMiddleware_disabled(t *testing.T) {
+	for i, backend := range []*config.Backend{
+		{},
+		newRetryTestBackend(map[string]interface{}{"max_attempts": 1.0}),
+		{ExtraConfig: config.ExtraConfig{Namespace: map[string]interface{}{retryKey: true}}},
+	} {
+		calls := 0
+		p := NewRetryMiddleware(backend)(func(_ context.Context, _ *Request) (*Response, error) {
+			calls++
+			return nil, errors.New("connection reset by peer")
+		})
+		if _, err := p(context.Background(), &Request{}); err == nil {
+			t.Errorf("#%d: expecting an error", i)
+		}
+		if calls != 1 {
+			t.Errorf("#%d: unexpected number of calls: %d", i, calls)
+		}
+	}
+}
+
+func TestNewRetryMiddleware(t *testing.T) {
+	backend := newRetryTestBackend(map[string]interface{}{
+		"max_attempts": 3.0,
+		"backoff":      "1ms",
+	})
+	transportErr := errors.New("connection reset by peer")
+
+	for i, tc := range []struct {
+		method string
+		resp   *Response
+		err    error
+		calls  int
+	}{
+		{http.MethodGet, nil, transportErr, 3},
+		{http.MethodGet, nil, client.HTTPResponseError{Code: http.StatusBadGateway}, 3},
+		{http.MethodGet, nil, client.HTTPResponseError{Code: http.StatusNotFound}, 1},
+		{http.MethodGet, &Response{Metadata: Metadata{StatusCode: http.StatusServiceUnavailable}}, nil, 3},
+		{http.MethodGet, &Response{Metadata: Metadata{StatusCode: http.StatusOK}}, nil, 1},
+		{http.MethodGet, nil, client.ErrInvalidStatusCode, 1},
+		{http.MethodGet, nil, invalidStatusCodeError{code: http.StatusServiceUnavailable}, 3},
+		{http.MethodGet, nil, invalidStatusCodeError{code: http.StatusNotFound}, 1},
+		{http.MethodGet, nil, CircuitOpenError{}, 1},
+		{http.MethodPut, nil, transportErr, 3},
+		{http.MethodPost, nil, transportErr, 1},
+		{http.MethodPatch, nil, transportErr, 1},
+	} {
+		calls := 0
+		p := NewRetryMiddleware(backend)(func(_ context.Context, _ *Request) (*Response, error) {
+			calls++
+			return tc.resp, tc.err
+		})
+		resp, err := p(context.Background(), &Request{Method: tc.method})
+		if err != tc.err || resp != tc.resp {
+			t.Errorf("#%d: unexpected result: %v %v", i, resp, err)
+		}
+		if calls != tc.calls {
+			t.Errorf("#%d: unexpected number of calls: %d", i, calls)
+		}
+	}
+}
+
+func TestNewRetryMiddleware_defaultStatusHandler(t *testing.T) {
+	var calls int32
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer backendServer.Close()
+
+	backend := newRetryTestBackend(map[string]interface{}{"max_attempts": 3.0, "backoff": "1ms"})
+	backend.Decoder = encoding.JSONDecoder
+	u, _ := url.Parse(backendServer.URL)
+
+	p := NewRetryMiddleware(backend)(httpProxy(backend))
+	resp, err := p(context.Background(), &Request{Method: http.MethodGet, URL: u})
+	if err != nil || resp == nil || resp.Data["ok"] != true {
+		t.Errorf("unexpected result: %v %v", resp, err)
+	}
+	if c := atomic.LoadInt32(&calls); c != 3 {
+		t.Errorf("unexpected number of calls: %d", c)
+	}
+}
+
+func TestNewRetryMiddleware_nonIdempotent(t *testing.T) {
+	backend := newRetryTestBackend(map[string]interface{}{
+		"max_attempts":         3.0,
+		"backoff":              "1ms",
+		"retry_non_idempotent": true,
+	})
+
+	calls := 0
+	var bodies []string
+	p := NewRetryMiddleware(backend)(func(_ context.Context, r *Request) (*Response, error) {
+		calls++
+		b, _ := ioutil.ReadAll(r.Body)
+		_ = r.Body.Close()
+		bodies = append(bodies, string(b))
+		if calls < 3 {
+			return nil, errors.New("connection reset by peer")
+		}
+		return &Response{IsComplete: true}, nil
+	})
+
+	resp, err := p(context.Background(), &Request{
+		Method: http.MethodPost,
+		Body:   ioutil.NopCloser(bytes.NewBufferString("payload")),
+	})
+	if err != nil || resp == nil || !resp.IsComplete {
+		t.Errorf("unexpected result: %v %v", resp, err)
+	}
+	if len(bodies) != 3 {
+		t.Errorf("unexpected number of calls: %d", len(bodies))
+		return
+	}
+	for i, b := range bodies {
+		if b != "payload" {
+			t.Errorf("#%d: unexpected body: %s", i, b)
+		}
+	}
+}
+
+func TestNewRetryMiddleware_differentHosts(t *testing.T) {
+	backend := newRetryTestBackend(map[string]interface{}{"max_attempts": 2.0, "backoff": "1ms"})
+
+	var hosts []string
+	p := func(_ context.Context, r *Request) (*Response, error) {
+		hosts = append(hosts, r.URL.Host)
+		if len(hosts) == 1 {
+			return nil, errors.New("connection refused")
+		}
+		return &Response{IsComplete: true}, nil
+	}
+	p = NewRoundRobinLoadBalancedMiddlewareWithSubscriber(discovery.FixedSubscriber{"http://a", "http://b"})(p)
+	p = NewRetryMiddleware(backend)(p)
+
+	if _, err := p(context.Background(), &Request{Path: "/foo"}); err != nil {
+		t.Errorf("unexpected error: %s", err.Error())
+	}
+	if len(hosts) != 2 || hosts[0] == hosts[1] {
+		t.Errorf("unexpected hosts: %v", hosts)
+	}
+}
+
+func TestNewRetryMiddleware_canceled(t *testing.T) {
+	backend := newRetryTestBackend(map[string]interface{}{"max_attempts": 5.0, "backoff": "1s"})
+
+	calls := 0
+	p := NewRetryMiddleware(backend)(func(_ context.Context, _ *Request) (*Response, error) {
+		calls++
+		return nil, errors.New("connection reset by peer")
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := p(ctx, &Request{}); err != context.DeadlineExceeded {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("unexpected number of calls: %d", calls)
+	}
+}
+
+func TestRetryConfig_backoff(t *testing.T) {
+	cfg := retryConfig{
+		Backoff:    100 * time.Millisecond,
+		MaxBackoff: time.Second,
+		Multiplier: 2,
+	}
+	for i, expected := range []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second,
+		time.Second,
+	} {
+		if d := cfg.backoff(i + 1); d != expected {
+			t.Errorf("#%d: unexpected backoff: %v", i, d)
+		}
+	}
+
+	cfg.Jitter = true
+	for i := 0; i < 100; i++ {
+		if d := cfg.backoff(3); d < 200*time.Millisecond || d > 400*time.Millisecond {
+			t.Errorf("unexpected backoff: %v", d)
+		}
+	}
+}
+
+func TestNewRetryMiddleware_multipleNext(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("The code did not panic")
+		}
+	}()
+	NewRetryMiddleware(newRetryTestBackend(map[string]interface{}{}))(explosiveProxy(t), explosiveProxy(t))
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"github.com/starvn/turbo/config"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Stack describes the middlewares a factory wrapped an endpoint and its backends with, from the
+// outermost to the innermost
+type Stack struct {
+	Middlewares []string       `json:"middlewares"`
+	Backends    []BackendStack `json:"backends"`
+}
+
+type BackendStack struct {
+	Method      string   `json:"method"`
+	Host        []string `json:"host"`
+	URLPattern  string   `json:"url_pattern"`
+	Middlewares []string `json:"middlewares"`
+}
+
+// StackDescriber is implemented by the factories recording the stacks they build
+type StackDescriber interface {
+	// Stack returns the stack of the last proxy built for the endpoint
+	Stack(method, endpoint string) (Stack, bool)
+}
+
+type stackRecorder struct {
+	stacks map[string]Stack
+	mu     *sync.RWMutex
+}
+
+func newStackRecorder() *stackRecorder {
+	return &stackRecorder{stacks: map[string]Stack{}, mu: &sync.RWMutex{}}
+}
+
+func (r *stackRecorder) Stack(method, endpoint string) (Stack, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	s, ok := r.stacks[strings.ToUpper(method)+" "+endpoint]
+	return s, ok
+}
+
+func (r *stackRecorder) record(method, endpoint string, s Stack) {
+	r.mu.Lock()
+	r.stacks[strings.ToUpper(method)+" "+endpoint] = s
+	r.mu.Unlock()
+}
+
+// stackBuilder wraps a proxy with middlewares, keeping the names of the ones the config enables
+type stackBuilder struct {
+	proxy  Proxy
+	layers []string
+}
+
+func newStackBuilder(p Proxy, layers ...string) *stackBuilder {
+	return &stackBuilder{proxy: p, layers: layers}
+}
+
+func (b *stackBuilder) wrap(name string, mw Middleware) {
+	if isEmptyMiddleware(mw) {
+		return
+	}
+	b.proxy = mw(b.proxy)
+	b.layers = append(b.layers, name)
+}
+
+// middlewares returns the names of the layers, from the outermost to the innermost
+func (b *stackBuilder) middlewares() []string {
+	res := make([]string, len(b.layers))
+	for i, name := range b.layers {
+		res[len(res)-1-i] = name
+	}
+	return res
+}
+
+// isEmptyMiddleware tells if the constructor of the middleware left it disabled
+func isEmptyMiddleware(mw Middleware) bool {
+	return reflect.ValueOf(mw).Pointer() == reflect.ValueOf(EmptyMiddleware).Pointer()
+}
+
+func newBackendStack(b *config.Backend, middlewares []string) BackendStack {
+	return BackendStack{
+		Method:      strings.ToUpper(b.Method),
+		Host:        b.Host,
+		URLPattern:  b.URLPattern,
+		Middlewares: middlewares,
+	}
+}
@@ -0,0 +1,108 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"github.com/starvn/turbo/config"
+	"github.com/starvn/turbo/log"
+	"github.com/starvn/turbo/ratelimit"
+	"github.com/starvn/turbo/transport/http/client"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDefaultFactory_stack(t *testing.T) {
+	cfg := &config.EndpointConfig{
+		Endpoint: "/users/:id",
+		Method:   "GET",
+		CacheTTL: time.Minute,
+		ExtraConfig: config.ExtraConfig{Namespace: map[string]interface{}{
+			cacheKey:    true,
+			collapseKey: true,
+			staticKey:   map[string]interface{}{"data": map[string]interface{}{"a": 1}},
+			mergeKey:    "unknown",
+		}},
+		Backend: []*config.Backend{
+			{
+				Method:     "get",
+				Host:       []string{"http://users"},
+				URLPattern: "/users/{{.Id}}",
+				Timeout:    time.Second,
+				ExtraConfig: config.ExtraConfig{
+					client.Namespace: map[string]interface{}{"http_cache": true},
+				},
+			},
+			{
+				Method:          "GET",
+				Host:            []string{"http://orders"},
+				URLPattern:      "/orders",
+				ConcurrentCalls: 2,
+				ExtraConfig: config.ExtraConfig{
+					Namespace: map[string]interface{}{
+						hedgingKey:        true,
+						retryKey:          map[string]interface{}{},
+						circuitBreakerKey: map[string]interface{}{"consecutive_failures": 3.0},
+					},
+					ratelimit.Namespace: map[string]interface{}{"max_rate": 10.0},
+				},
+			},
+		},
+	}
+
+	expected := Stack{
+		Middlewares: []string{"cache", "collapse", "static", "merge:default"},
+		Backends: []BackendStack{
+			{
+				Method:      "GET",
+				Host:        []string{"http://users"},
+				URLPattern:  "/users/{{.Id}}",
+				Middlewares: []string{"timeout", "request-builder", "load-balancer", "http-cache", "backend"},
+			},
+			{
+				Method:     "GET",
+				Host:       []string{"http://orders"},
+				URLPattern: "/orders",
+				Middlewares: []string{
+					"request-builder", "hedging", "circuit-breaker", "retry", "rate-limit", "load-balancer", "backend",
+				},
+			},
+		},
+	}
+	pf := NewDefaultFactory(func(_ *config.Backend) Proxy { return NoopProxy }, log.NoOp)
+	if _, err := pf.New(cfg); err != nil {
+		t.Error(err)
+		return
+	}
+	if s, ok := pf.(StackDescriber).Stack("get", "/users/:id"); !ok || !reflect.DeepEqual(s, expected) {
+		t.Errorf("unexpected stack: %+v", s)
+	}
+
+	cfg.Method = "POST"
+	cfg.Backend = cfg.Backend[:1]
+	if _, err := pf.New(cfg); err != nil {
+		t.Error(err)
+		return
+	}
+	s, ok := pf.(StackDescriber).Stack("POST", "/users/:id")
+	if !ok || !reflect.DeepEqual(s.Middlewares, []string{"static"}) || len(s.Backends) != 1 {
+		t.Errorf("unexpected stack: %+v", s)
+	}
+	if _, ok := pf.(StackDescriber).Stack("DELETE", "/users/:id"); ok {
+		t.Error("the endpoint was not built")
+	}
+}
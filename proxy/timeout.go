@@ -0,0 +1,41 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"context"
+	"github.com/starvn/turbo/config"
+)
+
+func NewBackendTimeoutMiddleware(remote *config.Backend) Middleware {
+	if remote.Timeout <= 0 {
+		return EmptyMiddleware
+	}
+	timeout := remote.Timeout
+
+	return func(next ...Proxy) Proxy {
+		if len(next) > 1 {
+			panic(ErrTooManyProxies)
+		}
+		return func(ctx context.Context, request *Request) (*Response, error) {
+			localCtx, cancel := context.WithTimeout(ctx, timeout)
+			resp, err := next[0](localCtx, request)
+			cancel()
+			return resp, err
+		}
+	}
+}
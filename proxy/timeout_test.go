@@ -0,0 +1,63 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"context"
+	"github.com/starvn/turbo/config"
+	"testing"
+	"time"
+)
+
+func TestNewBackendTimeoutMiddleware(t *testing.T) {
+	timeout := 50 * time.Millisecond
+	p := NewBackendTimeoutMiddleware(&config.Backend{Timeout: timeout})(func(ctx context.Context, _ *Request) (*Response, error) {
+		deadline, ok := ctx.Deadline()
+		if !ok {
+			t.Error("the context has no deadline")
+		} else if d := time.Until(deadline); d > timeout {
+			t.Errorf("unexpected deadline: %v", d)
+		}
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	if _, err := p(context.Background(), &Request{}); err != context.DeadlineExceeded {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestNewBackendTimeoutMiddleware_noTimeout(t *testing.T) {
+	p := NewBackendTimeoutMiddleware(&config.Backend{})(func(ctx context.Context, _ *Request) (*Response, error) {
+		if _, ok := ctx.Deadline(); ok {
+			t.Error("unexpected deadline")
+		}
+		return &Response{}, nil
+	})
+	if _, err := p(context.Background(), &Request{}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestNewBackendTimeoutMiddleware_multipleNext(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("The code did not panic")
+		}
+	}()
+	NewBackendTimeoutMiddleware(&config.Backend{Timeout: time.Second})(explosiveProxy(t), explosiveProxy(t))
+}
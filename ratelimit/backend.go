@@ -0,0 +1,99 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ratelimit
+
+import (
+	"fmt"
+	"github.com/starvn/turbo/config"
+	"strings"
+)
+
+type BackendConfig struct {
+	Name     string
+	MaxRate  float64
+	Capacity int
+}
+
+// BackendConfigGetter parses the rate limit options of a backend. The bucket is named after the hosts
+// of the backend, unless a name is set in the config
+func BackendConfigGetter(remote *config.Backend) (BackendConfig, bool) {
+	v, ok := remote.ExtraConfig[Namespace]
+	if !ok {
+		return BackendConfig{}, false
+	}
+	tmp, ok := v.(map[string]interface{})
+	if !ok {
+		return BackendConfig{}, false
+	}
+
+	cfg := BackendConfig{Name: strings.Join(remote.Host, ",")}
+	if n, ok := tmp["max_rate"].(float64); ok {
+		cfg.MaxRate = n
+	}
+	if n, ok := tmp["capacity"].(float64); ok && n > 0 {
+		cfg.Capacity = int(n)
+	}
+	if s, ok := tmp["name"].(string); ok && s != "" {
+		cfg.Name = s
+	}
+	return cfg, cfg.MaxRate > 0
+}
+
+type SharedLimitConflictError struct {
+	Name string
+	Path string
+}
+
+func (s *SharedLimitConflictError) Error() string {
+	return fmt.Sprintf("the rate limit %q is already defined with different limits at %s", s.Name, s.Path)
+}
+
+// validateSharedLimits rejects the backends sharing a token bucket with different limits
+func validateSharedLimits(s *config.ServiceConfig, report func(path string, err error) bool) bool {
+	type limit struct {
+		path     string
+		rate     float64
+		capacity float64
+	}
+	seen := map[string]limit{}
+	for i, e := range s.Endpoints {
+		for j, b := range e.Backend {
+			cfg, ok := BackendConfigGetter(b)
+			if !ok {
+				continue
+			}
+			bucket := NewTokenBucket(cfg.MaxRate, cfg.Capacity)
+			current := limit{
+				path:     fmt.Sprintf("endpoints[%d].backend[%d].extra_config[%q]", i, j, Namespace),
+				rate:     bucket.rate,
+				capacity: bucket.capacity,
+			}
+			first, ok := seen[cfg.Name]
+			if !ok {
+				seen[cfg.Name] = current
+				continue
+			}
+			if first.rate == current.rate && first.capacity == current.capacity {
+				continue
+			}
+			if !report(current.path, &SharedLimitConflictError{Name: cfg.Name, Path: first.path}) {
+				return false
+			}
+		}
+	}
+	return true
+}
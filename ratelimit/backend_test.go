@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ratelimit
+
+import (
+	"github.com/starvn/turbo/config"
+	"testing"
+)
+
+func TestBackendConfigGetter(t *testing.T) {
+	for i, tc := range []struct {
+		in       config.ExtraConfig
+		expected BackendConfig
+		ok       bool
+	}{
+		{config.ExtraConfig{}, BackendConfig{}, false},
+		{config.ExtraConfig{Namespace: map[string]interface{}{"capacity": 2.0}}, BackendConfig{Name: "http://a,http://b", Capacity: 2}, false},
+		{config.ExtraConfig{Namespace: map[string]interface{}{"max_rate": 10.0}}, BackendConfig{Name: "http://a,http://b", MaxRate: 10}, true},
+		{config.ExtraConfig{Namespace: map[string]interface{}{"max_rate": 10.0, "name": "shared"}}, BackendConfig{Name: "shared", MaxRate: 10}, true},
+	} {
+		cfg, ok := BackendConfigGetter(&config.Backend{Host: []string{"http://a", "http://b"}, ExtraConfig: tc.in})
+		if ok != tc.ok {
+			t.Errorf("#%d: unexpected ok: %v", i, ok)
+		}
+		if cfg != tc.expected {
+			t.Errorf("#%d: unexpected config: %+v", i, cfg)
+		}
+	}
+}
+
+func TestValidateSharedLimits(t *testing.T) {
+	newService := func(limits ...map[string]interface{}) config.ServiceConfig {
+		cfg := config.ServiceConfig{Version: config.TurboConfigVersion, Host: []string{"http://backend"}}
+		for _, l := range limits {
+			cfg.Endpoints = append(cfg.Endpoints, &config.EndpointConfig{
+				Endpoint: "/" + string(rune('a'+len(cfg.Endpoints))),
+				Method:   "GET",
+				Backend: []*config.Backend{
+					{URLPattern: "/", ExtraConfig: config.ExtraConfig{Namespace: l}},
+				},
+			})
+		}
+		return cfg
+	}
+
+	for i, tc := range []struct {
+		limits []map[string]interface{}
+		err    string
+	}{
+		{
+			limits: []map[string]interface{}{{"max_rate": 10.0}, {"max_rate": 10.0, "capacity": 10.0}},
+		},
+		{
+			limits: []map[string]interface{}{{"max_rate": 10.0, "name": "a"}, {"max_rate": 5.0, "name": "b"}},
+		},
+		{
+			limits: []map[string]interface{}{{"max_rate": 10.0}, {"max_rate": 5.0}},
+			err:    `the rate limit "http://backend" is already defined with different limits at endpoints[0].backend[0].extra_config["github.com/starvn/turbo/ratelimit"]`,
+		},
+		{
+			limits: []map[string]interface{}{{"max_rate": 10.0, "name": "a"}, {"max_rate": 10.0, "capacity": 2.0, "name": "a"}},
+			err:    `the rate limit "a" is already defined with different limits at endpoints[0].backend[0].extra_config["github.com/starvn/turbo/ratelimit"]`,
+		},
+	} {
+		cfg := newService(tc.limits...)
+		err := cfg.Init()
+		if tc.err == "" {
+			if err != nil {
+				t.Errorf("#%d: unexpected error: %s", i, err.Error())
+			}
+			continue
+		}
+		if _, ok := err.(*SharedLimitConflictError); !ok || err.Error() != tc.err {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+		}
+	}
+}
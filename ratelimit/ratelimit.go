@@ -0,0 +1,181 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package ratelimit provides token bucket rate limiters for the router and the proxy layers
+package ratelimit
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const Namespace = "github.com/starvn/turbo/ratelimit"
+
+type TokenBucket struct {
+	rate     float64
+	capacity float64
+	tokens   float64
+	last     time.Time
+	mu       *sync.Mutex
+	now      func() time.Time
+}
+
+func NewTokenBucket(rate float64, capacity int) *TokenBucket {
+	return newTokenBucket(rate, capacity, time.Now)
+}
+
+func newTokenBucket(rate float64, capacity int, now func() time.Time) *TokenBucket {
+	if capacity < 1 {
+		capacity = int(math.Max(1, math.Ceil(rate)))
+	}
+	return &TokenBucket{
+		rate:     rate,
+		capacity: float64(capacity),
+		tokens:   float64(capacity),
+		last:     now(),
+		mu:       &sync.Mutex{},
+		now:      now,
+	}
+}
+
+// Allow consumes a token if there is one available. When the bucket is empty, it returns
+// the time to wait until the next token is added
+func (t *TokenBucket) Allow() (bool, time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.refill()
+	if t.tokens >= 1 {
+		t.tokens--
+		return true, 0
+	}
+	if t.rate <= 0 {
+		return false, time.Second
+	}
+	return false, time.Duration((1 - t.tokens) / t.rate * float64(time.Second))
+}
+
+func (t *TokenBucket) refill() {
+	now := t.now()
+	if elapsed := now.Sub(t.last); elapsed > 0 {
+		t.tokens = math.Min(t.capacity, t.tokens+elapsed.Seconds()*t.rate)
+		t.last = now
+	}
+}
+
+func (t *TokenBucket) full() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.refill()
+	return t.tokens >= t.capacity
+}
+
+// KeyedLimiter keeps a token bucket per key. Buckets that are full again are dropped
+// periodically, so the number of tracked keys is bounded by the active clients
+type KeyedLimiter struct {
+	rate      float64
+	capacity  int
+	buckets   map[string]*TokenBucket
+	mu        *sync.Mutex
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewKeyedLimiter(rate float64, capacity int) *KeyedLimiter {
+	return newKeyedLimiter(rate, capacity, time.Now)
+}
+
+func newKeyedLimiter(rate float64, capacity int, now func() time.Time) *KeyedLimiter {
+	return &KeyedLimiter{
+		rate:      rate,
+		capacity:  capacity,
+		buckets:   map[string]*TokenBucket{},
+		mu:        &sync.Mutex{},
+		lastSweep: now(),
+		now:       now,
+	}
+}
+
+func (k *KeyedLimiter) Allow(key string) (bool, time.Duration) {
+	k.mu.Lock()
+	if now := k.now(); now.Sub(k.lastSweep) > sweepInterval {
+		for name, b := range k.buckets {
+			if b.full() {
+				delete(k.buckets, name)
+			}
+		}
+		k.lastSweep = now
+	}
+	b, ok := k.buckets[key]
+	if !ok {
+		b = newTokenBucket(k.rate, k.capacity, k.now)
+		k.buckets[key] = b
+	}
+	k.mu.Unlock()
+
+	return b.Allow()
+}
+
+func (k *KeyedLimiter) Len() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return len(k.buckets)
+}
+
+const sweepInterval = time.Minute
+
+// Registry keeps the token buckets shared by name
+type Registry struct {
+	buckets map[string]*TokenBucket
+	mu      *sync.Mutex
+}
+
+func NewRegistry() *Registry {
+	return &Registry{buckets: map[string]*TokenBucket{}, mu: &sync.Mutex{}}
+}
+
+// Get returns the token bucket registered under the given name, creating it if required. A bucket
+// registered with other limits is replaced, so a reloaded config applies its new limits. The configs
+// sharing a name with different limits are rejected when the service config is initialized
+func (r *Registry) Get(name string, rate float64, capacity int) *TokenBucket {
+	b := NewTokenBucket(rate, capacity)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if current, ok := r.buckets[name]; ok && current.rate == b.rate && current.capacity == b.capacity {
+		return current
+	}
+	r.buckets[name] = b
+	return b
+}
+
+var sharedBuckets = NewRegistry()
+
+// Shared returns the token bucket registered under the given name in the default registry
+func Shared(name string, rate float64, capacity int) *TokenBucket {
+	return sharedBuckets.Get(name, rate, capacity)
+}
+
+// RetryAfter returns the value of the Retry-After header for the given wait time
+func RetryAfter(d time.Duration) string {
+	seconds := int64(math.Ceil(d.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return strconv.FormatInt(seconds, 10)
+}
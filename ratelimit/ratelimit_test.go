@@ -0,0 +1,148 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (f *fakeClock) Now() time.Time { return f.t }
+
+func (f *fakeClock) Add(d time.Duration) { f.t = f.t.Add(d) }
+
+func TestTokenBucket(t *testing.T) {
+	clock := &fakeClock{t: time.Now()}
+	b := newTokenBucket(2, 3, clock.Now)
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := b.Allow(); !ok {
+			t.Errorf("#%d: the bucket should start full", i)
+		}
+	}
+	ok, wait := b.Allow()
+	if ok {
+		t.Error("the bucket should be empty")
+	}
+	if wait != 500*time.Millisecond {
+		t.Errorf("unexpected wait time: %v", wait)
+	}
+
+	clock.Add(250 * time.Millisecond)
+	if ok, wait := b.Allow(); ok || wait != 250*time.Millisecond {
+		t.Errorf("unexpected result: %v %v", ok, wait)
+	}
+
+	clock.Add(250 * time.Millisecond)
+	if ok, _ := b.Allow(); !ok {
+		t.Error("the bucket should have been refilled")
+	}
+
+	clock.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		if ok, _ := b.Allow(); !ok {
+			t.Errorf("#%d: the bucket should be full again", i)
+		}
+	}
+	if ok, _ := b.Allow(); ok {
+		t.Error("the bucket should not exceed its capacity")
+	}
+}
+
+func TestNewTokenBucket_defaultCapacity(t *testing.T) {
+	for _, tc := range []struct {
+		rate     float64
+		expected float64
+	}{
+		{0.5, 1},
+		{1, 1},
+		{2.5, 3},
+		{10, 10},
+	} {
+		if b := NewTokenBucket(tc.rate, 0); b.capacity != tc.expected {
+			t.Errorf("unexpected capacity for rate %v: %v", tc.rate, b.capacity)
+		}
+	}
+}
+
+func TestKeyedLimiter(t *testing.T) {
+	clock := &fakeClock{t: time.Now()}
+	l := newKeyedLimiter(1, 1, clock.Now)
+
+	if ok, _ := l.Allow("a"); !ok {
+		t.Error("unexpected rejection for a")
+	}
+	if ok, _ := l.Allow("a"); ok {
+		t.Error("a should be limited")
+	}
+	if ok, _ := l.Allow("b"); !ok {
+		t.Error("unexpected rejection for b")
+	}
+	if l.Len() != 2 {
+		t.Errorf("unexpected number of buckets: %d", l.Len())
+	}
+
+	clock.Add(2 * sweepInterval)
+	if ok, _ := l.Allow("c"); !ok {
+		t.Error("unexpected rejection for c")
+	}
+	if l.Len() != 1 {
+		t.Errorf("the full buckets should have been dropped: %d", l.Len())
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	a := r.Get("shared", 1, 1)
+	if b := r.Get("shared", 1, 1); a != b {
+		t.Error("the same name and limits should return the same bucket")
+	}
+	if b := r.Get("other", 1, 1); a == b {
+		t.Error("different names should return different buckets")
+	}
+	b := r.Get("shared", 2, 1)
+	if a == b {
+		t.Error("new limits should replace the bucket")
+	}
+	if c := r.Get("shared", 2, 1); b != c {
+		t.Error("the replaced bucket should be shared")
+	}
+	if NewRegistry().Get("shared", 1, 1) == a {
+		t.Error("the registries should not share buckets")
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	for _, tc := range []struct {
+		in       time.Duration
+		expected string
+	}{
+		{0, "1"},
+		{time.Millisecond, "1"},
+		{time.Second, "1"},
+		{1500 * time.Millisecond, "2"},
+		{time.Minute, "60"},
+	} {
+		if v := RetryAfter(tc.in); v != tc.expected {
+			t.Errorf("unexpected value for %v: %s", tc.in, v)
+		}
+	}
+}
@@ -0,0 +1,306 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"github.com/starvn/turbo/config"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	IPStrategy     = "ip"
+	HeaderStrategy = "header"
+	APIKeyStrategy = "api_key"
+
+	DefaultAPIKeyHeader = "X-Api-Key"
+	DefaultAPIKeyQuery  = "api_key"
+)
+
+type EndpointConfig struct {
+	MaxRate        float64
+	Capacity       int
+	ClientMaxRate  float64
+	ClientCapacity int
+	Strategy       string
+	Key            string
+	TrustedProxies []string
+}
+
+// EndpointConfigGetter parses the rate limit options of an endpoint
+func EndpointConfigGetter(extra config.ExtraConfig) (EndpointConfig, bool) {
+	v, ok := extra[Namespace]
+	if !ok {
+		return EndpointConfig{}, false
+	}
+	tmp, ok := v.(map[string]interface{})
+	if !ok {
+		return EndpointConfig{}, false
+	}
+
+	cfg := EndpointConfig{Strategy: IPStrategy}
+	if n, ok := tmp["max_rate"].(float64); ok && n > 0 {
+		cfg.MaxRate = n
+	}
+	if n, ok := tmp["capacity"].(float64); ok && n > 0 {
+		cfg.Capacity = int(n)
+	}
+	if n, ok := tmp["client_max_rate"].(float64); ok && n > 0 {
+		cfg.ClientMaxRate = n
+	}
+	if n, ok := tmp["client_capacity"].(float64); ok && n > 0 {
+		cfg.ClientCapacity = int(n)
+	}
+	if s, ok := tmp["strategy"].(string); ok && s != "" {
+		cfg.Strategy = strings.ToLower(s)
+	}
+	if s, ok := tmp["key"].(string); ok {
+		cfg.Key = s
+	}
+	if proxies, ok := tmp["trusted_proxies"].([]interface{}); ok {
+		for _, p := range proxies {
+			if s, ok := p.(string); ok {
+				cfg.TrustedProxies = append(cfg.TrustedProxies, s)
+			}
+		}
+	}
+	switch cfg.Strategy {
+	case IPStrategy:
+	case HeaderStrategy:
+		if cfg.Key == "" {
+			return EndpointConfig{}, false
+		}
+	case APIKeyStrategy:
+		if cfg.Key == "" {
+			cfg.Key = DefaultAPIKeyHeader
+		}
+	default:
+		return EndpointConfig{}, false
+	}
+	return cfg, cfg.MaxRate > 0 || cfg.ClientMaxRate > 0
+}
+
+// EndpointLimiter applies the endpoint wide limit and the per client limit of an endpoint
+type EndpointLimiter struct {
+	global  *TokenBucket
+	clients *KeyedLimiter
+	key     func(r *http.Request) string
+}
+
+func NewEndpointLimiter(cfg EndpointConfig) *EndpointLimiter {
+	l := &EndpointLimiter{key: clientKeyExtractor(cfg)}
+	if cfg.MaxRate > 0 {
+		l.global = NewTokenBucket(cfg.MaxRate, cfg.Capacity)
+	}
+	if cfg.ClientMaxRate > 0 {
+		l.clients = NewKeyedLimiter(cfg.ClientMaxRate, cfg.ClientCapacity)
+	}
+	return l
+}
+
+// NewEndpointLimiterFromConfig returns nil if the endpoint has no rate limit
+func NewEndpointLimiterFromConfig(cfg *config.EndpointConfig) *EndpointLimiter {
+	c, ok := EndpointConfigGetter(cfg.ExtraConfig)
+	if !ok {
+		return nil
+	}
+	return NewEndpointLimiter(c)
+}
+
+// Allow checks the client limit first, so a single noisy client does not drain the tokens of the endpoint
+func (l *EndpointLimiter) Allow(r *http.Request) (bool, time.Duration) {
+	if l.clients != nil {
+		if ok, wait := l.clients.Allow(l.key(r)); !ok {
+			return false, wait
+		}
+	}
+	if l.global != nil {
+		return l.global.Allow()
+	}
+	return true, 0
+}
+
+// clientKeyExtractor falls back to the client IP when the request has no header or API key, so the
+// anonymous clients do not share a single bucket
+func clientKeyExtractor(cfg EndpointConfig) func(*http.Request) string {
+	clientIP := clientIPExtractor(parseTrustedProxies(cfg.TrustedProxies))
+	switch cfg.Strategy {
+	case HeaderStrategy:
+		return func(r *http.Request) string {
+			if k := r.Header.Get(cfg.Key); k != "" {
+				return "key:" + k
+			}
+			return "ip:" + clientIP(r)
+		}
+	case APIKeyStrategy:
+		return func(r *http.Request) string {
+			if k := r.Header.Get(cfg.Key); k != "" {
+				return "key:" + k
+			}
+			if k := r.URL.Query().Get(DefaultAPIKeyQuery); k != "" {
+				return "key:" + k
+			}
+			return "ip:" + clientIP(r)
+		}
+	default:
+		return func(r *http.Request) string {
+			return "ip:" + clientIP(r)
+		}
+	}
+}
+
+// clientIPExtractor returns the address of the peer. The forwarding headers are only considered when
+// the peer is a trusted proxy, and the X-Forwarded-For chain is walked from the closest hop, skipping
+// the trusted proxies
+func clientIPExtractor(trusted []*net.IPNet) func(*http.Request) string {
+	isTrusted := func(addr string) bool {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return false
+		}
+		for _, n := range trusted {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+	return func(r *http.Request) string {
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ip = r.RemoteAddr
+		}
+		if !isTrusted(ip) {
+			return ip
+		}
+		forwarded := r.Header.Values("X-Forwarded-For")
+		if len(forwarded) == 0 {
+			if addr := strings.TrimSpace(r.Header.Get("X-Real-Ip")); addr != "" {
+				return addr
+			}
+			return ip
+		}
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			addr := strings.TrimSpace(hops[i])
+			if addr == "" {
+				continue
+			}
+			ip = addr
+			if !isTrusted(addr) {
+				break
+			}
+		}
+		return ip
+	}
+}
+
+func parseTrustedProxies(proxies []string) []*net.IPNet {
+	res := make([]*net.IPNet, 0, len(proxies))
+	for _, p := range proxies {
+		if n, err := parseTrustedProxy(p); err == nil {
+			res = append(res, n)
+		}
+	}
+	return res
+}
+
+func parseTrustedProxy(p string) (*net.IPNet, error) {
+	if strings.Contains(p, "/") {
+		_, n, err := net.ParseCIDR(p)
+		return n, err
+	}
+	ip := net.ParseIP(p)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid address %q", p)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+func init() {
+	config.RegisterExtraConfigValidator(Namespace, config.EndpointScope|config.BackendScope, validateExtraConfig)
+	config.RegisterServiceConfigValidator(Namespace, validateSharedLimits)
+}
+
+type endpointExtraConfig struct {
+	MaxRate        float64  `json:"max_rate"`
+	Capacity       int      `json:"capacity"`
+	ClientMaxRate  float64  `json:"client_max_rate"`
+	ClientCapacity int      `json:"client_capacity"`
+	Strategy       string   `json:"strategy"`
+	Key            string   `json:"key"`
+	TrustedProxies []string `json:"trusted_proxies"`
+}
+
+type backendExtraConfig struct {
+	MaxRate  float64 `json:"max_rate"`
+	Capacity int     `json:"capacity"`
+	Name     string  `json:"name"`
+}
+
+func validateExtraConfig(scope config.ExtraConfigScope, v interface{}) error {
+	if scope == config.BackendScope {
+		cfg := backendExtraConfig{}
+		if err := config.DecodeExtraConfig(v, &cfg); err != nil {
+			return err
+		}
+		return validateRates(cfg.MaxRate, cfg.Capacity)
+	}
+
+	cfg := endpointExtraConfig{}
+	if err := config.DecodeExtraConfig(v, &cfg); err != nil {
+		return err
+	}
+	if err := validateRates(cfg.MaxRate, cfg.Capacity); err != nil {
+		return err
+	}
+	if err := validateRates(cfg.ClientMaxRate, cfg.ClientCapacity); err != nil {
+		return fmt.Errorf("client_%s", err.Error())
+	}
+	switch strings.ToLower(cfg.Strategy) {
+	case "", IPStrategy, APIKeyStrategy:
+	case HeaderStrategy:
+		if cfg.Key == "" {
+			return errors.New("key: the header strategy requires a header name")
+		}
+	default:
+		return fmt.Errorf("strategy: unknown strategy %q", cfg.Strategy)
+	}
+	for _, p := range cfg.TrustedProxies {
+		if _, err := parseTrustedProxy(p); err != nil {
+			return fmt.Errorf("trusted_proxies: %s", err.Error())
+		}
+	}
+	return nil
+}
+
+func validateRates(maxRate float64, capacity int) error {
+	if maxRate < 0 {
+		return errors.New("max_rate: should not be negative")
+	}
+	if capacity < 0 {
+		return errors.New("capacity: should not be negative")
+	}
+	return nil
+}
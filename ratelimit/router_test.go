@@ -0,0 +1,238 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ratelimit
+
+import (
+	"github.com/starvn/turbo/config"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestEndpointConfigGetter(t *testing.T) {
+	for i, tc := range []struct {
+		in       config.ExtraConfig
+		expected EndpointConfig
+		ok       bool
+	}{
+		{config.ExtraConfig{}, EndpointConfig{}, false},
+		{config.ExtraConfig{Namespace: true}, EndpointConfig{}, false},
+		{config.ExtraConfig{Namespace: map[string]interface{}{}}, EndpointConfig{Strategy: IPStrategy}, false},
+		{
+			config.ExtraConfig{Namespace: map[string]interface{}{"max_rate": 10.0, "capacity": 20.0}},
+			EndpointConfig{MaxRate: 10, Capacity: 20, Strategy: IPStrategy},
+			true,
+		},
+		{
+			config.ExtraConfig{Namespace: map[string]interface{}{"client_max_rate": 1.0, "strategy": "header", "key": "X-User"}},
+			EndpointConfig{ClientMaxRate: 1, Strategy: HeaderStrategy, Key: "X-User"},
+			true,
+		},
+		{
+			config.ExtraConfig{Namespace: map[string]interface{}{"client_max_rate": 1.0, "strategy": "header"}},
+			EndpointConfig{},
+			false,
+		},
+		{
+			config.ExtraConfig{Namespace: map[string]interface{}{"client_max_rate": 1.0, "strategy": "api_key"}},
+			EndpointConfig{ClientMaxRate: 1, Strategy: APIKeyStrategy, Key: DefaultAPIKeyHeader},
+			true,
+		},
+		{
+			config.ExtraConfig{Namespace: map[string]interface{}{"client_max_rate": 1.0, "strategy": "unknown"}},
+			EndpointConfig{},
+			false,
+		},
+		{
+			config.ExtraConfig{Namespace: map[string]interface{}{"client_max_rate": 1.0, "trusted_proxies": []interface{}{"10.0.0.0/8"}}},
+			EndpointConfig{ClientMaxRate: 1, Strategy: IPStrategy, TrustedProxies: []string{"10.0.0.0/8"}},
+			true,
+		},
+	} {
+		cfg, ok := EndpointConfigGetter(tc.in)
+		if ok != tc.ok {
+			t.Errorf("#%d: unexpected ok: %v", i, ok)
+		}
+		if !reflect.DeepEqual(cfg, tc.expected) {
+			t.Errorf("#%d: unexpected config: %+v", i, cfg)
+		}
+	}
+}
+
+func TestEndpointLimiter_clients(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		cfg    EndpointConfig
+		client func(r *http.Request, id string)
+	}{
+		{
+			name:   "ip",
+			cfg:    EndpointConfig{ClientMaxRate: 0.001, ClientCapacity: 1, Strategy: IPStrategy},
+			client: func(r *http.Request, id string) { r.RemoteAddr = id + ":1234" },
+		},
+		{
+			name: "header",
+			cfg:  EndpointConfig{ClientMaxRate: 0.001, ClientCapacity: 1, Strategy: HeaderStrategy, Key: "X-User"},
+			client: func(r *http.Request, id string) {
+				r.Header.Set("X-User", id)
+			},
+		},
+		{
+			name: "api_key_header",
+			cfg:  EndpointConfig{ClientMaxRate: 0.001, ClientCapacity: 1, Strategy: APIKeyStrategy, Key: DefaultAPIKeyHeader},
+			client: func(r *http.Request, id string) {
+				r.Header.Set(DefaultAPIKeyHeader, id)
+			},
+		},
+		{
+			name: "api_key_query",
+			cfg:  EndpointConfig{ClientMaxRate: 0.001, ClientCapacity: 1, Strategy: APIKeyStrategy, Key: DefaultAPIKeyHeader},
+			client: func(r *http.Request, id string) {
+				r.URL.RawQuery = DefaultAPIKeyQuery + "=" + id
+			},
+		},
+	} {
+		l := NewEndpointLimiter(tc.cfg)
+		allow := func(id string) bool {
+			r, _ := http.NewRequest("GET", "http://example.com/", nil)
+			r.RemoteAddr = "127.0.0.1:1234"
+			tc.client(r, id)
+			ok, _ := l.Allow(r)
+			return ok
+		}
+		if !allow("10.0.0.1") {
+			t.Errorf("%s: unexpected rejection for the first request", tc.name)
+		}
+		if allow("10.0.0.1") {
+			t.Errorf("%s: the second request should be limited", tc.name)
+		}
+		if !allow("10.0.0.2") {
+			t.Errorf("%s: other clients should not be limited", tc.name)
+		}
+	}
+}
+
+func TestEndpointLimiter_missingKey(t *testing.T) {
+	for _, strategy := range []string{HeaderStrategy, APIKeyStrategy} {
+		l := NewEndpointLimiter(EndpointConfig{ClientMaxRate: 0.001, ClientCapacity: 1, Strategy: strategy, Key: "X-User"})
+		allow := func(remoteAddr, user string) bool {
+			r, _ := http.NewRequest("GET", "http://example.com/", nil)
+			r.RemoteAddr = remoteAddr
+			if user != "" {
+				r.Header.Set("X-User", user)
+			}
+			ok, _ := l.Allow(r)
+			return ok
+		}
+		if !allow("10.0.0.1:1234", "") {
+			t.Errorf("%s: unexpected rejection for the first anonymous client", strategy)
+		}
+		if !allow("10.0.0.2:1234", "") {
+			t.Errorf("%s: the anonymous clients should not share a bucket", strategy)
+		}
+		if allow("10.0.0.1:1234", "") {
+			t.Errorf("%s: the anonymous client should be limited by its address", strategy)
+		}
+		if !allow("10.0.0.1:1234", "10.0.0.2:1234") {
+			t.Errorf("%s: the key should not collide with the addresses", strategy)
+		}
+	}
+}
+
+func TestClientIPExtractor(t *testing.T) {
+	clientIP := clientIPExtractor(parseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1"}))
+	for i, tc := range []struct {
+		remoteAddr string
+		forwarded  []string
+		realIP     string
+		expected   string
+	}{
+		{"1.1.1.1:1234", nil, "", "1.1.1.1"},
+		{"1.1.1.1:1234", []string{"2.2.2.2"}, "3.3.3.3", "1.1.1.1"},
+		{"1.1.1.1", nil, "", "1.1.1.1"},
+		{"10.0.0.1:1234", nil, "", "10.0.0.1"},
+		{"10.0.0.1:1234", nil, "3.3.3.3", "3.3.3.3"},
+		{"10.0.0.1:1234", []string{"2.2.2.2"}, "3.3.3.3", "2.2.2.2"},
+		{"10.0.0.1:1234", []string{"4.4.4.4, 2.2.2.2, 192.168.1.1"}, "", "2.2.2.2"},
+		{"10.0.0.1:1234", []string{"4.4.4.4", "2.2.2.2"}, "", "2.2.2.2"},
+		{"192.168.1.1:1234", []string{"10.0.0.2, 10.0.0.3"}, "", "10.0.0.2"},
+		{"192.168.1.2:1234", []string{"2.2.2.2"}, "", "192.168.1.2"},
+	} {
+		r, _ := http.NewRequest("GET", "http://example.com/", nil)
+		r.RemoteAddr = tc.remoteAddr
+		for _, f := range tc.forwarded {
+			r.Header.Add("X-Forwarded-For", f)
+		}
+		if tc.realIP != "" {
+			r.Header.Set("X-Real-Ip", tc.realIP)
+		}
+		if ip := clientIP(r); ip != tc.expected {
+			t.Errorf("#%d: unexpected client ip: %s", i, ip)
+		}
+	}
+}
+
+func TestEndpointLimiter_global(t *testing.T) {
+	l := NewEndpointLimiter(EndpointConfig{MaxRate: 0.001, Capacity: 2, Strategy: IPStrategy})
+
+	for i, ip := range []string{"10.0.0.1:1", "10.0.0.2:1"} {
+		r, _ := http.NewRequest("GET", "http://example.com/", nil)
+		r.RemoteAddr = ip
+		if ok, _ := l.Allow(r); !ok {
+			t.Errorf("#%d: unexpected rejection", i)
+		}
+	}
+	r, _ := http.NewRequest("GET", "http://example.com/", nil)
+	r.RemoteAddr = "10.0.0.3:1"
+	ok, wait := l.Allow(r)
+	if ok {
+		t.Error("the endpoint should be limited")
+	}
+	if wait <= 0 {
+		t.Errorf("unexpected wait time: %v", wait)
+	}
+}
+
+func TestValidateExtraConfig(t *testing.T) {
+	for i, tc := range []struct {
+		scope config.ExtraConfigScope
+		cfg   map[string]interface{}
+		err   string
+	}{
+		{config.EndpointScope, map[string]interface{}{"max_rate": 10.0, "client_max_rate": 1.0, "strategy": "api_key"}, ""},
+		{config.BackendScope, map[string]interface{}{"max_rate": 10.0, "capacity": 5.0, "name": "shared"}, ""},
+		{config.EndpointScope, map[string]interface{}{"max_rate": 10.0, "name": "shared"}, `unknown field "name"`},
+		{config.EndpointScope, map[string]interface{}{"client_max_rate": -1.0}, "client_max_rate: should not be negative"},
+		{config.EndpointScope, map[string]interface{}{"strategy": "header"}, "key: the header strategy requires a header name"},
+		{config.EndpointScope, map[string]interface{}{"strategy": "cookie"}, `strategy: unknown strategy "cookie"`},
+		{config.BackendScope, map[string]interface{}{"capacity": 1.5}, "capacity: expected an integer, got a number 1.5"},
+		{config.EndpointScope, map[string]interface{}{"trusted_proxies": []interface{}{"10.0.0.0/8", "::1"}}, ""},
+		{config.EndpointScope, map[string]interface{}{"trusted_proxies": []interface{}{"proxy"}}, `trusted_proxies: invalid address "proxy"`},
+		{config.EndpointScope, map[string]interface{}{"trusted_proxies": []interface{}{"10.0.0.0/33"}}, "trusted_proxies: invalid CIDR address: 10.0.0.0/33"},
+	} {
+		err := validateExtraConfig(tc.scope, tc.cfg)
+		if tc.err == "" {
+			if err != nil {
+				t.Errorf("#%d: unexpected error: %s", i, err.Error())
+			}
+			continue
+		}
+		if err == nil || err.Error() != tc.err {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+		}
+	}
+}
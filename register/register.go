@@ -17,7 +17,10 @@
 // Package register offers tools for creating and managing registers
 package register
 
-import "sync"
+import (
+	"sort"
+	"sync"
+)
 
 func New() *Namespaced {
 	return &Namespaced{data: NewUntyped()}
@@ -88,3 +91,15 @@ func (u *Untyped) Clone() map[string]interface{} {
 	u.mutex.RUnlock()
 	return res
 }
+
+// Keys returns the names of the registered values, sorted
+func (u *Untyped) Keys() []string {
+	u.mutex.RLock()
+	res := make([]string, 0, len(u.data))
+	for k := range u.data {
+		res = append(res, k)
+	}
+	u.mutex.RUnlock()
+	sort.Strings(res)
+	return res
+}
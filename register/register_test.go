@@ -61,3 +61,16 @@ func TestNamespaced(t *testing.T) {
 		t.Error("unexpected value:", v2)
 	}
 }
+
+func TestUntyped_Keys(t *testing.T) {
+	r := NewUntyped()
+	if keys := r.Keys(); len(keys) != 0 {
+		t.Errorf("unexpected keys: %v", keys)
+	}
+	r.Register("b", 1)
+	r.Register("c", 2)
+	r.Register("a", 3)
+	if keys := r.Keys(); len(keys) != 3 || keys[0] != "a" || keys[1] != "b" || keys[2] != "c" {
+		t.Errorf("unexpected keys: %v", keys)
+	}
+}
@@ -19,8 +19,10 @@ package chi
 
 import (
 	"context"
+	"errors"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/starvn/turbo/cache"
 	"github.com/starvn/turbo/config"
 	"github.com/starvn/turbo/log"
 	"github.com/starvn/turbo/proxy"
@@ -45,6 +47,10 @@ type Config struct {
 	Logger         log.Logger
 	DebugPattern   string
 	RunServer      RunServerFunc
+	// EngineFactory creates the engines used for the reloaded configs
+	EngineFactory func() chi.Router
+	// Updates is an optional source of new service configs to be loaded at runtime
+	Updates <-chan config.Update
 }
 
 func DefaultFactory(proxyFactory proxy.Factory, logger log.Logger) route.Factory {
@@ -57,6 +63,7 @@ func DefaultFactory(proxyFactory proxy.Factory, logger log.Logger) route.Factory
 			Logger:         logger,
 			DebugPattern:   ChiDefaultDebugPattern,
 			RunServer:      server.RunServer,
+			EngineFactory:  func() chi.Router { return chi.NewRouter() },
 		},
 	)
 }
@@ -87,6 +94,36 @@ type chiRouter struct {
 }
 
 func (r chiRouter) Run(cfg config.ServiceConfig) {
+	server.InitHTTPDefaultTransport(cfg)
+
+	r.registerEndpoints(cfg)
+	handler := route.NewSwappableHandler(r.cfg.Engine)
+
+	if r.cfg.Updates != nil {
+		go route.Reload(r.ctx, r.cfg.Logger, logPrefix, cfg, r.cfg.Updates, handler, r.reload)
+	}
+
+	if err := r.RunServer(r.ctx, cfg, handler); err != nil {
+		r.cfg.Logger.Error(logPrefix, err.Error())
+	}
+
+	r.cfg.Logger.Info(logPrefix, "Router execution ended")
+}
+
+// reload builds the handler for a new config on a fresh engine. The listener and the
+// default transport are not affected
+func (r chiRouter) reload(cfg config.ServiceConfig) (http.Handler, error) {
+	if r.cfg.EngineFactory == nil {
+		return nil, errNoEngineFactory
+	}
+	r.cfg.Engine = r.cfg.EngineFactory()
+	r.registerEndpoints(cfg)
+	return r.cfg.Engine, nil
+}
+
+var errNoEngineFactory = errors.New("the router has no engine factory for reloading the config")
+
+func (r chiRouter) registerEndpoints(cfg config.ServiceConfig) {
 	r.cfg.Engine.Use(r.cfg.Middlewares...)
 	if cfg.Debug {
 		r.registerDebugEndpoints()
@@ -94,7 +131,11 @@ func (r chiRouter) Run(cfg config.ServiceConfig) {
 
 	r.cfg.Engine.Get("/__health", mux.HealthHandler)
 
-	server.InitHTTPDefaultTransport(cfg)
+	if path, purgeHandler, ok := cache.PurgeHandlerFromConfig(cfg.ExtraConfig); ok {
+		r.cfg.Logger.Debug(logPrefix, "Registering the cache purge endpoint", path)
+		r.cfg.Engine.Post(path, purgeHandler.ServeHTTP)
+		r.cfg.Engine.Delete(path, purgeHandler.ServeHTTP)
+	}
 
 	r.registerSonicEndpoints(cfg.Endpoints)
 
@@ -102,12 +143,6 @@ func (r chiRouter) Run(cfg config.ServiceConfig) {
 		w.Header().Set(server.CompleteResponseHeaderName, server.HeaderIncompleteResponseValue)
 		http.NotFound(w, r)
 	})
-
-	if err := r.RunServer(r.ctx, cfg, r.cfg.Engine); err != nil {
-		r.cfg.Logger.Error(logPrefix, err.Error())
-	}
-
-	r.cfg.Logger.Info(logPrefix, "Router execution ended")
 }
 
 func (r chiRouter) registerDebugEndpoints() {
@@ -24,7 +24,10 @@ import (
 	"github.com/starvn/turbo/core"
 	"github.com/starvn/turbo/log"
 	"github.com/starvn/turbo/proxy"
+	"github.com/starvn/turbo/ratelimit"
+	"github.com/starvn/turbo/toggle"
 	"github.com/starvn/turbo/transport/http/server"
+	"net/http"
 	"net/textproto"
 	"strings"
 )
@@ -42,12 +45,30 @@ func CustomErrorEndpointHandler(logger log.Logger, errF server.ToHTTPError) Hand
 		requestGenerator := NewRequest(configuration.HeadersToPass)
 		render := getRender(configuration)
 		logPrefix := "[ENDPOINT: " + configuration.Endpoint + "]"
+		limiter := ratelimit.NewEndpointLimiterFromConfig(configuration)
+		endpointToggle := toggle.NewEndpointToggle(configuration)
 
 		return func(c *gin.Context) {
-			requestCtx, cancel := context.WithTimeout(c, configuration.Timeout)
-
 			c.Header(core.SonicHeaderName, core.SonicHeaderValue)
 
+			if resp, disabled := endpointToggle.Disabled(); disabled {
+				c.Header(server.CompleteResponseHeaderName, server.HeaderIncompleteResponseValue)
+				resp.Write(c.Writer)
+				c.Abort()
+				return
+			}
+
+			if limiter != nil {
+				if ok, wait := limiter.Allow(c.Request); !ok {
+					c.Header(server.CompleteResponseHeaderName, server.HeaderIncompleteResponseValue)
+					c.Header("Retry-After", ratelimit.RetryAfter(wait))
+					c.AbortWithStatus(http.StatusTooManyRequests)
+					return
+				}
+			}
+
+			requestCtx, cancel := context.WithTimeout(c, configuration.Timeout)
+
 			response, err := prxy(requestCtx, requestGenerator(c, configuration.QueryString))
 
 			select {
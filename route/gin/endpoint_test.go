@@ -33,6 +33,8 @@ import (
 	"github.com/starvn/turbo/config"
 	"github.com/starvn/turbo/log"
 	"github.com/starvn/turbo/proxy"
+	"github.com/starvn/turbo/ratelimit"
+	"github.com/starvn/turbo/toggle"
 	"github.com/starvn/turbo/transport/http/server"
 )
 
@@ -373,3 +375,88 @@ func ctxMiddleware(c *gin.Context) {
 		c.Set(k, v)
 	}
 }
+
+func TestEndpointHandler_rateLimited(t *testing.T) {
+	endpoint := &config.EndpointConfig{
+		Method:  "GET",
+		Timeout: time.Second,
+		ExtraConfig: config.ExtraConfig{
+			ratelimit.Namespace: map[string]interface{}{"client_max_rate": 0.001, "client_capacity": 1.0, "strategy": "header", "key": "X-User"},
+		},
+	}
+	calls := 0
+	p := func(_ context.Context, _ *proxy.Request) (*proxy.Response, error) {
+		calls++
+		return &proxy.Response{IsComplete: true, Data: map[string]interface{}{"sonic": "turbo"}}, nil
+	}
+	s := startGinServer(EndpointHandler(endpoint, p))
+
+	for i, tc := range []struct {
+		user       string
+		statusCode int
+	}{
+		{"a", http.StatusOK},
+		{"a", http.StatusTooManyRequests},
+		{"b", http.StatusOK},
+	} {
+		req, _ := http.NewRequest("GET", "http://127.0.0.1:8080/_gin_endpoint/a", nil)
+		req.Header.Set("X-User", tc.user)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+
+		if w.Code != tc.statusCode {
+			t.Errorf("#%d: unexpected status code: %d", i, w.Code)
+		}
+		if tc.statusCode == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+			t.Errorf("#%d: missing Retry-After header", i)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("unexpected number of calls: %d", calls)
+	}
+}
+
+func TestEndpointHandler_disabled(t *testing.T) {
+	defer toggle.SetDefault(toggle.Default())
+	store, _ := toggle.NewStore(toggle.Config{}, new(bytes.Buffer))
+	toggle.SetDefault(store)
+
+	endpoint := &config.EndpointConfig{
+		Method:      "GET",
+		Endpoint:    "/_gin_endpoint/:param",
+		Timeout:     time.Second,
+		ExtraConfig: config.ExtraConfig{toggle.Namespace: map[string]interface{}{"retry_after": "2m"}},
+	}
+	calls := 0
+	p := func(_ context.Context, _ *proxy.Request) (*proxy.Response, error) {
+		calls++
+		return &proxy.Response{IsComplete: true, Data: map[string]interface{}{"sonic": "turbo"}}, nil
+	}
+	s := startGinServer(EndpointHandler(endpoint, p))
+
+	if _, err := store.Disable(toggle.Toggle{Method: "GET", Endpoint: endpoint.Endpoint, Response: toggle.Response{Body: `{"message":"maintenance"}`}}, ""); err != nil {
+		t.Error(err)
+		return
+	}
+	req, _ := http.NewRequest("GET", "http://127.0.0.1:8080/_gin_endpoint/a", nil)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable || w.Body.String() != `{"message":"maintenance"}` {
+		t.Errorf("unexpected response: %d %s", w.Code, w.Body.String())
+	}
+	if ra := w.Header().Get("Retry-After"); ra != "120" {
+		t.Errorf("unexpected Retry-After header: %s", ra)
+	}
+	if calls != 0 {
+		t.Errorf("the proxy of a disabled endpoint was called")
+	}
+
+	if _, err := store.Enable("GET", endpoint.Endpoint, "", ""); err != nil {
+		t.Error(err)
+	}
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || calls != 1 {
+		t.Errorf("unexpected response: %d %s", w.Code, w.Body.String())
+	}
+}
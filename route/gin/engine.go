@@ -27,6 +27,10 @@ import (
 
 const Namespace = "github.com/starvn/turbo/route/gin"
 
+func init() {
+	config.RegisterExtraConfigType(Namespace, config.ServiceScope, engineConfiguration{})
+}
+
 func NewEngine(cfg config.ServiceConfig, logger log.Logger, w io.Writer) *gin.Engine {
 	gin.SetMode(gin.ReleaseMode)
 	if cfg.Debug {
@@ -23,6 +23,7 @@ import (
 	"github.com/starvn/turbo/proxy"
 	"io"
 	"net/http"
+	"sort"
 	"sync"
 )
 
@@ -47,6 +48,18 @@ func RegisterRender(name string, r Render) {
 	mutex.Unlock()
 }
 
+// RenderNames returns the names of the registered renders, sorted
+func RenderNames() []string {
+	mutex.RLock()
+	res := make([]string, 0, len(renderRegister))
+	for name := range renderRegister {
+		res = append(res, name)
+	}
+	mutex.RUnlock()
+	sort.Strings(res)
+	return res
+}
+
 func getRender(cfg *config.EndpointConfig) Render {
 	fallback := jsonRender
 	if len(cfg.Backend) == 1 {
@@ -416,6 +416,14 @@ func TestRegisterRender(t *testing.T) {
 	if total != 1 {
 		t.Error("the render was called an unexpected amount of times:", total)
 	}
+
+	var found bool
+	for _, n := range RenderNames() {
+		found = found || n == name
+	}
+	if !found {
+		t.Errorf("the render was not listed: %v", RenderNames())
+	}
 }
 
 func TestRender_noop(t *testing.T) {
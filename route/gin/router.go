@@ -19,7 +19,9 @@ package gin
 
 import (
 	"context"
+	"errors"
 	"github.com/gin-gonic/gin"
+	"github.com/starvn/turbo/cache"
 	"github.com/starvn/turbo/config"
 	"github.com/starvn/turbo/core"
 	"github.com/starvn/turbo/log"
@@ -43,6 +45,10 @@ type Config struct {
 	ProxyFactory   proxy.Factory
 	Logger         log.Logger
 	RunServer      RunServerFunc
+	// EngineFactory creates the engines used for the reloaded configs
+	EngineFactory func(config.ServiceConfig) *gin.Engine
+	// Updates is an optional source of new service configs to be loaded at runtime
+	Updates <-chan config.Update
 }
 
 func DefaultFactory(proxyFactory proxy.Factory, logger log.Logger) route.Factory {
@@ -54,6 +60,7 @@ func DefaultFactory(proxyFactory proxy.Factory, logger log.Logger) route.Factory
 			ProxyFactory:   proxyFactory,
 			Logger:         logger,
 			RunServer:      server.RunServer,
+			EngineFactory:  func(cfg config.ServiceConfig) *gin.Engine { return NewEngine(cfg, logger, gin.DefaultWriter) },
 		},
 	)
 }
@@ -100,13 +107,33 @@ func (r ginRouter) Run(cfg config.ServiceConfig) {
 	// https://github.com/gin-gonic/gin/issues/2862 are completely fixed
 	go r.cfg.Engine.Run("XXXX")
 
-	if err := r.runServerF(r.ctx, cfg, r.cfg.Engine); err != nil && err != http.ErrServerClosed {
+	handler := route.NewSwappableHandler(r.cfg.Engine)
+	if r.cfg.Updates != nil {
+		go route.Reload(r.ctx, r.cfg.Logger, logPrefix, cfg, r.cfg.Updates, handler, r.reload)
+	}
+
+	if err := r.runServerF(r.ctx, cfg, handler); err != nil && err != http.ErrServerClosed {
 		r.cfg.Logger.Error(logPrefix, err.Error())
 	}
 
 	r.cfg.Logger.Info(logPrefix, "Router execution ended")
 }
 
+// reload builds a fresh engine for the new config. The listener and the default transport
+// are not affected
+func (r ginRouter) reload(cfg config.ServiceConfig) (http.Handler, error) {
+	if r.cfg.EngineFactory == nil {
+		return nil, errNoEngineFactory
+	}
+	r.cfg.Engine = r.cfg.EngineFactory(cfg)
+	r.urlCatalog = map[string][]string{}
+	r.registerEndpointsAndMiddlewares(cfg)
+	go r.cfg.Engine.Run("XXXX")
+	return r.cfg.Engine, nil
+}
+
+var errNoEngineFactory = errors.New("the router has no engine factory for reloading the config")
+
 func (r ginRouter) registerEndpointsAndMiddlewares(cfg config.ServiceConfig) {
 	if cfg.Debug {
 		r.cfg.Engine.Any("/__debug/*param", DebugHandler(r.cfg.Logger))
@@ -116,6 +143,12 @@ func (r ginRouter) registerEndpointsAndMiddlewares(cfg config.ServiceConfig) {
 		c.JSON(200, gin.H{"status": "ok"})
 	})
 
+	if path, purgeHandler, ok := cache.PurgeHandlerFromConfig(cfg.ExtraConfig); ok {
+		r.cfg.Logger.Debug(logPrefix, "Registering the cache purge endpoint", path)
+		r.cfg.Engine.POST(path, gin.WrapH(purgeHandler))
+		r.cfg.Engine.DELETE(path, gin.WrapH(purgeHandler))
+	}
+
 	endpointGroup := r.cfg.Engine.Group("/")
 	endpointGroup.Use(r.cfg.Middlewares...)
 
@@ -27,12 +27,14 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"regexp"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/starvn/turbo/cache"
 	"github.com/starvn/turbo/config"
 	"github.com/starvn/turbo/log"
 	"github.com/starvn/turbo/proxy"
@@ -346,3 +348,130 @@ type erroredProxyFactory struct {
 func (e erroredProxyFactory) New(_ *config.EndpointConfig) (proxy.Proxy, error) {
 	return proxy.NoopProxy, e.Error
 }
+
+func TestNewFactory_reload(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pf := proxy.FactoryFunc(func(e *config.EndpointConfig) (proxy.Proxy, error) {
+		return func(_ context.Context, _ *proxy.Request) (*proxy.Response, error) {
+			return &proxy.Response{IsComplete: true, Data: map[string]interface{}{"endpoint": e.Endpoint}}, nil
+		}, nil
+	})
+
+	handlers := make(chan http.Handler, 1)
+	updates := make(chan config.Update)
+	r := NewFactory(Config{
+		Engine:         gin.New(),
+		HandlerFactory: EndpointHandler,
+		ProxyFactory:   pf,
+		Logger:         log.NoOp,
+		RunServer: func(ctx context.Context, _ config.ServiceConfig, h http.Handler) error {
+			handlers <- h
+			<-ctx.Done()
+			return nil
+		},
+		EngineFactory: func(_ config.ServiceConfig) *gin.Engine { return gin.New() },
+		Updates:       updates,
+	}).NewWithContext(ctx)
+
+	newServiceConfig := func(path string) config.ServiceConfig {
+		return config.ServiceConfig{
+			Endpoints: []*config.EndpointConfig{{
+				Endpoint: path,
+				Method:   "GET",
+				Timeout:  time.Second,
+				Backend:  []*config.Backend{{}},
+			}},
+		}
+	}
+	go r.Run(newServiceConfig("/a"))
+	h := <-handlers
+
+	status := func(path string) int {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w.Code
+	}
+
+	if code := status("/a"); code != http.StatusOK {
+		t.Errorf("unexpected status code: %d", code)
+	}
+
+	updates <- config.Update{Config: newServiceConfig("/b")}
+	for i := 0; status("/b") != http.StatusOK; i++ {
+		if i > 100 {
+			t.Fatal("the new config was not loaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if code := status("/a"); code != http.StatusNotFound {
+		t.Errorf("unexpected status code for the removed endpoint: %d", code)
+	}
+}
+
+func TestDefaultFactory_engineFactory(t *testing.T) {
+	f, ok := DefaultFactory(noopProxyFactory(map[string]interface{}{}), log.NoOp).(factory)
+	if !ok {
+		t.Error("unexpected factory type")
+		return
+	}
+	engine := f.cfg.EngineFactory(config.ServiceConfig{
+		ExtraConfig: config.ExtraConfig{
+			Namespace: map[string]interface{}{
+				"disable_redirect_trailing_slash": true,
+				"remove_extra_slash":              true,
+			},
+		},
+	})
+	if engine.RedirectTrailingSlash || !engine.RemoveExtraSlash {
+		t.Error("the engine of the reloaded config should use its extra config")
+	}
+}
+
+func TestNewFactory_purgeEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	handlers := make(chan http.Handler, 1)
+	r := NewFactory(Config{
+		Engine:         gin.New(),
+		HandlerFactory: EndpointHandler,
+		ProxyFactory:   noopProxyFactory(map[string]interface{}{}),
+		Logger:         log.NoOp,
+		RunServer: func(ctx context.Context, _ config.ServiceConfig, h http.Handler) error {
+			handlers <- h
+			<-ctx.Done()
+			return nil
+		},
+	}).NewWithContext(ctx)
+
+	go r.Run(config.ServiceConfig{
+		ExtraConfig: config.ExtraConfig{
+			cache.Namespace: map[string]interface{}{"purge": map[string]interface{}{"token": "secret"}},
+		},
+	})
+	h := <-handlers
+
+	for _, tc := range []struct {
+		method string
+		auth   string
+		status int
+	}{
+		{method: http.MethodPost, status: http.StatusUnauthorized},
+		{method: http.MethodPost, auth: "Bearer secret", status: http.StatusOK},
+		{method: http.MethodDelete, auth: "Bearer secret", status: http.StatusOK},
+	} {
+		req := httptest.NewRequest(tc.method, cache.DefaultPurgePath+"?tag=products", nil)
+		if tc.auth != "" {
+			req.Header.Set("Authorization", tc.auth)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != tc.status {
+			t.Errorf("%s %q: unexpected status code: %d", tc.method, tc.auth, w.Code)
+		}
+	}
+}
@@ -41,6 +41,7 @@ func DefaultConfig(pf proxy.Factory, logger log.Logger) mux.Config {
 		Logger:         logger,
 		DebugPattern:   "/__debug/{params}",
 		RunServer:      server.RunServer,
+		EngineFactory:  func() mux.Engine { return gorillaEngine{gorilla.NewRouter()} },
 	}
 }
 
@@ -22,6 +22,8 @@ import (
 	"github.com/starvn/turbo/config"
 	"github.com/starvn/turbo/core"
 	"github.com/starvn/turbo/proxy"
+	"github.com/starvn/turbo/ratelimit"
+	"github.com/starvn/turbo/toggle"
 	"github.com/starvn/turbo/transport/http/server"
 	"net"
 	"net/http"
@@ -50,6 +52,8 @@ func CustomEndpointHandlerWithHTTPError(rb RequestBuilder, errF server.ToHTTPErr
 			headersToSend = server.HeadersToSend
 		}
 		method := strings.ToTitle(configuration.Method)
+		limiter := ratelimit.NewEndpointLimiterFromConfig(configuration)
+		endpointToggle := toggle.NewEndpointToggle(configuration)
 
 		return func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set(core.SonicHeaderName, core.SonicHeaderValue)
@@ -59,6 +63,21 @@ func CustomEndpointHandlerWithHTTPError(rb RequestBuilder, errF server.ToHTTPErr
 				return
 			}
 
+			if resp, disabled := endpointToggle.Disabled(); disabled {
+				w.Header().Set(server.CompleteResponseHeaderName, server.HeaderIncompleteResponseValue)
+				resp.Write(w)
+				return
+			}
+
+			if limiter != nil {
+				if ok, wait := limiter.Allow(r); !ok {
+					w.Header().Set(server.CompleteResponseHeaderName, server.HeaderIncompleteResponseValue)
+					w.Header().Set("Retry-After", ratelimit.RetryAfter(wait))
+					http.Error(w, "", http.StatusTooManyRequests)
+					return
+				}
+			}
+
 			requestCtx, cancel := context.WithTimeout(r.Context(), configuration.Timeout)
 
 			response, err := prxy(requestCtx, rb(r, configuration.QueryString, headersToSend))
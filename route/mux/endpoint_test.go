@@ -24,6 +24,8 @@ import (
 	"fmt"
 	"github.com/starvn/turbo/config"
 	"github.com/starvn/turbo/proxy"
+	"github.com/starvn/turbo/ratelimit"
+	"github.com/starvn/turbo/toggle"
 	"github.com/starvn/turbo/transport/http/server"
 	"io/ioutil"
 	"net/http"
@@ -314,3 +316,81 @@ func startMuxServer(handlerFunc http.HandlerFunc) *http.ServeMux {
 	router.Handle("/_mux_endpoint", handlerFunc)
 	return router
 }
+
+func TestEndpointHandler_rateLimited(t *testing.T) {
+	endpoint := &config.EndpointConfig{
+		Method:  "GET",
+		Timeout: time.Second,
+		ExtraConfig: config.ExtraConfig{
+			ratelimit.Namespace: map[string]interface{}{"client_max_rate": 0.001, "client_capacity": 1.0},
+		},
+	}
+	p := func(_ context.Context, _ *proxy.Request) (*proxy.Response, error) {
+		return &proxy.Response{IsComplete: true, Data: map[string]interface{}{"sonic": "turbo"}}, nil
+	}
+	s := startMuxServer(EndpointHandler(endpoint, p))
+
+	for i, tc := range []struct {
+		ip         string
+		forwarded  string
+		statusCode int
+	}{
+		{"1.1.1.1", "", http.StatusOK},
+		{"1.1.1.1", "3.3.3.3", http.StatusTooManyRequests},
+		{"2.2.2.2", "", http.StatusOK},
+	} {
+		req, _ := http.NewRequest("GET", "http://127.0.0.1:8081/_mux_endpoint", nil)
+		req.RemoteAddr = tc.ip + ":1234"
+		if tc.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", tc.forwarded)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+
+		if w.Code != tc.statusCode {
+			t.Errorf("#%d: unexpected status code: %d", i, w.Code)
+		}
+		retryAfter := w.Header().Get("Retry-After")
+		if tc.statusCode == http.StatusTooManyRequests && retryAfter == "" {
+			t.Errorf("#%d: missing Retry-After header", i)
+		}
+		if tc.statusCode == http.StatusOK && retryAfter != "" {
+			t.Errorf("#%d: unexpected Retry-After header: %s", i, retryAfter)
+		}
+	}
+}
+
+func TestEndpointHandler_disabled(t *testing.T) {
+	defer toggle.SetDefault(toggle.Default())
+	store, _ := toggle.NewStore(toggle.Config{Response: toggle.Response{Status: http.StatusGone}}, new(bytes.Buffer))
+	toggle.SetDefault(store)
+
+	endpoint := &config.EndpointConfig{
+		Method:   "GET",
+		Endpoint: "/_mux_endpoint",
+		Timeout:  time.Second,
+	}
+	calls := 0
+	p := func(_ context.Context, _ *proxy.Request) (*proxy.Response, error) {
+		calls++
+		return &proxy.Response{IsComplete: true, Data: map[string]interface{}{"sonic": "turbo"}}, nil
+	}
+	s := startMuxServer(EndpointHandler(endpoint, p))
+
+	if _, err := store.Disable(toggle.Toggle{Endpoint: toggle.AllEndpoints, Response: toggle.Response{RetryAfter: "30s"}}, ""); err != nil {
+		t.Error(err)
+		return
+	}
+	req, _ := http.NewRequest("GET", "http://127.0.0.1:8081/_mux_endpoint", nil)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != http.StatusGone || w.Body.Len() != 0 {
+		t.Errorf("unexpected response: %d %s", w.Code, w.Body.String())
+	}
+	if ra := w.Header().Get("Retry-After"); ra != "30" {
+		t.Errorf("unexpected Retry-After header: %s", ra)
+	}
+	if calls != 0 {
+		t.Errorf("the proxy of a disabled endpoint was called")
+	}
+}
@@ -19,6 +19,8 @@ package mux
 
 import (
 	"context"
+	"errors"
+	"github.com/starvn/turbo/cache"
 	"github.com/starvn/turbo/config"
 	"github.com/starvn/turbo/log"
 	"github.com/starvn/turbo/proxy"
@@ -41,6 +43,10 @@ type Config struct {
 	Logger         log.Logger
 	DebugPattern   string
 	RunServer      RunServerFunc
+	// EngineFactory creates the engines used for the reloaded configs
+	EngineFactory func() Engine
+	// Updates is an optional source of new service configs to be loaded at runtime
+	Updates <-chan config.Update
 }
 
 type HandlerMiddleware interface {
@@ -57,6 +63,7 @@ func DefaultFactory(pf proxy.Factory, logger log.Logger) route.Factory {
 			Logger:         logger,
 			DebugPattern:   DefaultDebugPattern,
 			RunServer:      server.RunServer,
+			EngineFactory:  func() Engine { return DefaultEngine() },
 		},
 	}
 }
@@ -92,6 +99,36 @@ func HealthHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (r httpRouter) Run(cfg config.ServiceConfig) {
+	server.InitHTTPDefaultTransport(cfg)
+
+	r.registerEndpoints(cfg)
+	handler := route.NewSwappableHandler(r.handler())
+
+	if r.cfg.Updates != nil {
+		go route.Reload(r.ctx, r.cfg.Logger, logPrefix, cfg, r.cfg.Updates, handler, r.reload)
+	}
+
+	if err := r.RunServer(r.ctx, cfg, handler); err != nil {
+		r.cfg.Logger.Error(logPrefix, err.Error())
+	}
+
+	r.cfg.Logger.Info(logPrefix, "Router execution ended")
+}
+
+// reload builds the handler for a new config on a fresh engine. The listener and the
+// default transport are not affected
+func (r httpRouter) reload(cfg config.ServiceConfig) (http.Handler, error) {
+	if r.cfg.EngineFactory == nil {
+		return nil, errNoEngineFactory
+	}
+	r.cfg.Engine = r.cfg.EngineFactory()
+	r.registerEndpoints(cfg)
+	return r.handler(), nil
+}
+
+var errNoEngineFactory = errors.New("the router has no engine factory for reloading the config")
+
+func (r httpRouter) registerEndpoints(cfg config.ServiceConfig) {
 	if cfg.Debug {
 		debugHandler := DebugHandler(r.cfg.Logger)
 		for _, method := range []string{
@@ -110,15 +147,13 @@ func (r httpRouter) Run(cfg config.ServiceConfig) {
 	}
 	r.cfg.Engine.Handle("/__health", "GET", http.HandlerFunc(HealthHandler))
 
-	server.InitHTTPDefaultTransport(cfg)
-
-	r.registerSonicEndpoints(cfg.Endpoints)
-
-	if err := r.RunServer(r.ctx, cfg, r.handler()); err != nil {
-		r.cfg.Logger.Error(logPrefix, err.Error())
+	if path, purgeHandler, ok := cache.PurgeHandlerFromConfig(cfg.ExtraConfig); ok {
+		r.cfg.Logger.Debug(logPrefix, "Registering the cache purge endpoint", path)
+		r.cfg.Engine.Handle(path, http.MethodPost, purgeHandler)
+		r.cfg.Engine.Handle(path, http.MethodDelete, purgeHandler)
 	}
 
-	r.cfg.Logger.Info(logPrefix, "Router execution ended")
+	r.registerSonicEndpoints(cfg.Endpoints)
 }
 
 func (r httpRouter) registerSonicEndpoints(endpoints []*config.EndpointConfig) {
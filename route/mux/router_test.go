@@ -24,6 +24,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/starvn/turbo/cache"
 	"github.com/starvn/turbo/config"
 	"github.com/starvn/turbo/log"
 	"github.com/starvn/turbo/proxy"
@@ -31,6 +32,7 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"regexp"
 	"strings"
 	"testing"
@@ -352,3 +354,128 @@ type identityMiddleware struct{}
 func (i identityMiddleware) Handler(h http.Handler) http.Handler {
 	return h
 }
+
+func TestNewFactory_reload(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	pf := proxy.FactoryFunc(func(e *config.EndpointConfig) (proxy.Proxy, error) {
+		return func(_ context.Context, _ *proxy.Request) (*proxy.Response, error) {
+			if e.Endpoint == "/slow" {
+				close(started)
+				<-release
+			}
+			return &proxy.Response{IsComplete: true, Data: map[string]interface{}{"endpoint": e.Endpoint}}, nil
+		}, nil
+	})
+
+	handlers := make(chan http.Handler, 1)
+	updates := make(chan config.Update)
+	r := NewFactory(Config{
+		Engine:         DefaultEngine(),
+		HandlerFactory: EndpointHandler,
+		ProxyFactory:   pf,
+		Logger:         log.NoOp,
+		RunServer: func(ctx context.Context, _ config.ServiceConfig, h http.Handler) error {
+			handlers <- h
+			<-ctx.Done()
+			return nil
+		},
+		EngineFactory: func() Engine { return DefaultEngine() },
+		Updates:       updates,
+	}).NewWithContext(ctx)
+
+	newServiceConfig := func(paths ...string) config.ServiceConfig {
+		cfg := config.ServiceConfig{}
+		for _, p := range paths {
+			cfg.Endpoints = append(cfg.Endpoints, &config.EndpointConfig{
+				Endpoint: p,
+				Method:   "GET",
+				Timeout:  time.Second,
+				Backend:  []*config.Backend{{}},
+			})
+		}
+		return cfg
+	}
+	go r.Run(newServiceConfig("/a", "/slow"))
+	h := <-handlers
+
+	status := func(path string) int {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w.Code
+	}
+
+	inFlight := make(chan int)
+	go func() { inFlight <- status("/slow") }()
+	<-started
+
+	updates <- config.Update{Config: newServiceConfig("/b")}
+	for i := 0; status("/b") != http.StatusOK; i++ {
+		if i > 100 {
+			t.Fatal("the new config was not loaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if code := status("/a"); code != http.StatusNotFound {
+		t.Errorf("unexpected status code for the removed endpoint: %d", code)
+	}
+
+	close(release)
+	if code := <-inFlight; code != http.StatusOK {
+		t.Errorf("unexpected status code for the request in flight: %d", code)
+	}
+
+	updates <- config.Update{Err: errors.New("parsing error")}
+	updates <- config.Update{Config: newServiceConfig("/b")}
+	if code := status("/b"); code != http.StatusOK {
+		t.Errorf("the failed update should not replace the live config: %d", code)
+	}
+}
+
+func TestNewFactory_purgeEndpoint(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	handlers := make(chan http.Handler, 1)
+	r := NewFactory(Config{
+		Engine:         DefaultEngine(),
+		HandlerFactory: EndpointHandler,
+		ProxyFactory:   noopProxyFactory(map[string]interface{}{}),
+		Logger:         log.NoOp,
+		RunServer: func(ctx context.Context, _ config.ServiceConfig, h http.Handler) error {
+			handlers <- h
+			<-ctx.Done()
+			return nil
+		},
+	}).NewWithContext(ctx)
+
+	go r.Run(config.ServiceConfig{
+		ExtraConfig: config.ExtraConfig{
+			cache.Namespace: map[string]interface{}{"purge": map[string]interface{}{"token": "secret"}},
+		},
+	})
+	h := <-handlers
+
+	for _, tc := range []struct {
+		method string
+		auth   string
+		status int
+	}{
+		{method: http.MethodPost, status: http.StatusUnauthorized},
+		{method: http.MethodPost, auth: "Bearer secret", status: http.StatusOK},
+		{method: http.MethodDelete, auth: "Bearer secret", status: http.StatusOK},
+	} {
+		req := httptest.NewRequest(tc.method, cache.DefaultPurgePath+"?tag=products", nil)
+		if tc.auth != "" {
+			req.Header.Set("Authorization", tc.auth)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != tc.status {
+			t.Errorf("%s %q: unexpected status code: %d", tc.method, tc.auth, w.Code)
+		}
+	}
+}
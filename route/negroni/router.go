@@ -39,6 +39,7 @@ func DefaultConfig(pf proxy.Factory, logger log.Logger, middlewares []negroni.Ha
 func DefaultConfigWithRouter(pf proxy.Factory, logger log.Logger, muxEngine *gorilla.Router, middlewares []negroni.Handler) mux.Config {
 	cfg := turbogorilla.DefaultConfig(pf, logger)
 	cfg.Engine = newNegroniEngine(muxEngine, middlewares...)
+	cfg.EngineFactory = func() mux.Engine { return newNegroniEngine(NewGorillaRouter(), middlewares...) }
 	return cfg
 }
 
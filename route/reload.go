@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"context"
+	"github.com/starvn/turbo/config"
+	"github.com/starvn/turbo/log"
+	"net/http"
+	"sync/atomic"
+)
+
+// SwappableHandler is an http.Handler that can be replaced at runtime. The requests already
+// dispatched keep running on the handler they got
+type SwappableHandler struct {
+	v atomic.Value
+}
+
+type handlerHolder struct {
+	h http.Handler
+}
+
+func NewSwappableHandler(h http.Handler) *SwappableHandler {
+	s := &SwappableHandler{}
+	s.Swap(h)
+	return s
+}
+
+func (s *SwappableHandler) Swap(h http.Handler) {
+	s.v.Store(handlerHolder{h})
+}
+
+func (s *SwappableHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.v.Load().(handlerHolder).h.ServeHTTP(w, r)
+}
+
+// HandlerBuilder builds a new handler for the given service config
+type HandlerBuilder func(config.ServiceConfig) (http.Handler, error)
+
+// Reload consumes the updates until the context is cancelled or the channel is closed. Every time
+// the hash of the received config differs from the live one, a new handler is built and swapped in.
+// Failed updates are logged and the live config stays in place
+func Reload(ctx context.Context, logger log.Logger, logPrefix string, current config.ServiceConfig, updates <-chan config.Update, handler *SwappableHandler, build HandlerBuilder) {
+	currentHash, _ := current.Hash()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case u, ok := <-updates:
+			if !ok {
+				return
+			}
+			if u.Err != nil {
+				logger.Error(logPrefix, "Ignoring the config update:", u.Err.Error())
+				continue
+			}
+			hash, err := u.Config.Hash()
+			if err != nil {
+				logger.Error(logPrefix, "Ignoring the config update:", err.Error())
+				continue
+			}
+			if hash == currentHash {
+				logger.Debug(logPrefix, "Config unchanged, skipping the reload")
+				continue
+			}
+			h, err := build(u.Config)
+			if err != nil {
+				logger.Error(logPrefix, "Ignoring the config update:", err.Error())
+				continue
+			}
+			handler.Swap(h)
+			currentHash = hash
+			logger.Info(logPrefix, "Config reloaded")
+		}
+	}
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"context"
+	"errors"
+	"github.com/starvn/turbo/config"
+	"github.com/starvn/turbo/log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func staticHandler(body string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(body))
+	})
+}
+
+func serve(h http.Handler) string {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	return w.Body.String()
+}
+
+func TestSwappableHandler(t *testing.T) {
+	h := NewSwappableHandler(staticHandler("a"))
+	if body := serve(h); body != "a" {
+		t.Errorf("unexpected body: %s", body)
+	}
+	h.Swap(staticHandler("b"))
+	if body := serve(h); body != "b" {
+		t.Errorf("unexpected body: %s", body)
+	}
+}
+
+func TestReload(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	updates := make(chan config.Update)
+	handler := NewSwappableHandler(staticHandler("v1"))
+	builds := 0
+	done := make(chan struct{})
+	go func() {
+		Reload(ctx, log.NoOp, "[TEST]", config.ServiceConfig{Name: "v1", Port: 1}, updates, handler, func(cfg config.ServiceConfig) (http.Handler, error) {
+			builds++
+			if cfg.Port == 666 {
+				return nil, errors.New("boom")
+			}
+			return staticHandler(cfg.Name), nil
+		})
+		close(done)
+	}()
+
+	sync := config.Update{Err: errors.New("sync")}
+	for i, tc := range []struct {
+		update   config.Update
+		expected string
+	}{
+		{config.Update{Err: errors.New("parsing error")}, "v1"},
+		{config.Update{Config: config.ServiceConfig{Name: "v1b", Port: 1}}, "v1"},
+		{config.Update{Config: config.ServiceConfig{Name: "v2", Port: 2}}, "v2"},
+		{config.Update{Config: config.ServiceConfig{Name: "v3", Port: 666}}, "v2"},
+		{config.Update{Config: config.ServiceConfig{Name: "v4", Port: 4}}, "v4"},
+	} {
+		updates <- tc.update
+		// the errored updates are ignored, but they can not be received before the previous one is processed
+		updates <- sync
+		if body := serve(handler); body != tc.expected {
+			t.Errorf("#%d: unexpected body: %s", i, body)
+		}
+	}
+	close(updates)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("the reload loop did not end")
+	}
+	if builds != 3 {
+		t.Errorf("unexpected number of builds: %d", builds)
+	}
+}
@@ -0,0 +1,291 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package toggle
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ActionDisable = "disable"
+	ActionEnable  = "enable"
+)
+
+var errNoEndpoint = errors.New("endpoint: the endpoint is required")
+
+// Toggle is a disabled endpoint. The response overrides the ones of the config
+type Toggle struct {
+	Method     string    `json:"method"`
+	Endpoint   string    `json:"endpoint"`
+	Response   Response  `json:"response"`
+	Reason     string    `json:"reason,omitempty"`
+	DisabledBy string    `json:"disabled_by,omitempty"`
+	DisabledAt time.Time `json:"disabled_at"`
+}
+
+// AuditEntry is a line of the audit trail
+type AuditEntry struct {
+	Time       time.Time `json:"time"`
+	Action     string    `json:"action"`
+	Method     string    `json:"method"`
+	Endpoint   string    `json:"endpoint"`
+	Actor      string    `json:"actor,omitempty"`
+	RemoteAddr string    `json:"remote_addr,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+	Response   *Response `json:"response,omitempty"`
+}
+
+// Store holds the disabled endpoints. Every change is persisted to the state file, if the store has
+// one, and then appended to the audit trail. The changes that can not be recorded are rolled back
+type Store struct {
+	stateFile string
+	auditFile string
+	audit     io.Writer
+	defaults  Response
+	toggles   map[string]Toggle
+	mu        *sync.RWMutex
+	now       func() time.Time
+}
+
+func newMemoryStore() *Store {
+	return &Store{audit: os.Stderr, toggles: map[string]Toggle{}, mu: &sync.RWMutex{}, now: time.Now}
+}
+
+// NewStore returns a store with the toggles found in the state file of the config. The audit trail
+// is written to the audit file of the config or, if it is not set, to the given writer
+func NewStore(cfg Config, audit io.Writer) (*Store, error) {
+	s := newMemoryStore()
+	s.stateFile = cfg.StateFile
+	s.auditFile = cfg.AuditFile
+	s.defaults = cfg.Response
+	if audit != nil {
+		s.audit = audit
+	}
+	if s.stateFile == "" {
+		return s, nil
+	}
+
+	b, err := ioutil.ReadFile(s.stateFile)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := stateFile{}
+	if err := json.Unmarshal(b, &state); err != nil {
+		return nil, fmt.Errorf("toggle: parsing the state file %s: %s", s.stateFile, err.Error())
+	}
+	for _, t := range state.Toggles {
+		if t.Endpoint == "" {
+			return nil, fmt.Errorf("toggle: parsing the state file %s: %s", s.stateFile, errNoEndpoint.Error())
+		}
+		if err := t.Response.Validate(); err != nil {
+			return nil, fmt.Errorf("toggle: parsing the state file %s: %s %s: %s", s.stateFile, t.Method, t.Endpoint, err.Error())
+		}
+		s.toggles[key(t.Method, t.Endpoint)] = t
+	}
+	return s, nil
+}
+
+type stateFile struct {
+	Toggles []Toggle `json:"toggles"`
+}
+
+// Lookup returns the toggle disabling the endpoint, either directly or through AllEndpoints
+func (s *Store) Lookup(method, endpoint string) (Toggle, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.toggles) == 0 {
+		return Toggle{}, false
+	}
+	if t, ok := s.toggles[key(method, endpoint)]; ok {
+		return t, true
+	}
+	t, ok := s.toggles[AllEndpoints]
+	return t, ok
+}
+
+// List returns the disabled endpoints, sorted by endpoint and method
+func (s *Store) List() []Toggle {
+	s.mu.RLock()
+	res := make([]Toggle, 0, len(s.toggles))
+	for _, t := range s.toggles {
+		res = append(res, t)
+	}
+	s.mu.RUnlock()
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Endpoint != res[j].Endpoint {
+			return res[i].Endpoint < res[j].Endpoint
+		}
+		return res[i].Method < res[j].Method
+	})
+	return res
+}
+
+// Disable disables the endpoint, replacing the previous toggle of the endpoint if any
+func (s *Store) Disable(t Toggle, remoteAddr string) (Toggle, error) {
+	if t.Endpoint == "" {
+		return Toggle{}, errNoEndpoint
+	}
+	if err := t.Response.Validate(); err != nil {
+		return Toggle{}, err
+	}
+	t.Method = strings.ToUpper(t.Method)
+	if t.Endpoint == AllEndpoints {
+		t.Method = AllEndpoints
+	}
+	t.DisabledAt = s.now().UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry := AuditEntry{
+		Time:       t.DisabledAt,
+		Action:     ActionDisable,
+		Method:     t.Method,
+		Endpoint:   t.Endpoint,
+		Actor:      t.DisabledBy,
+		RemoteAddr: remoteAddr,
+		Reason:     t.Reason,
+		Response:   &t.Response,
+	}
+	k := key(t.Method, t.Endpoint)
+	previous, existed := s.toggles[k]
+	s.toggles[k] = t
+	err := s.commit(entry, func() {
+		if existed {
+			s.toggles[k] = previous
+		} else {
+			delete(s.toggles, k)
+		}
+	})
+	if err != nil {
+		return Toggle{}, err
+	}
+	return t, nil
+}
+
+// Enable enables the endpoint, returning false if it was not disabled
+func (s *Store) Enable(method, endpoint, actor, remoteAddr string) (bool, error) {
+	if endpoint == "" {
+		return false, errNoEndpoint
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := key(method, endpoint)
+	previous, ok := s.toggles[k]
+	if !ok {
+		return false, nil
+	}
+	delete(s.toggles, k)
+	entry := AuditEntry{
+		Time:       s.now().UTC(),
+		Action:     ActionEnable,
+		Method:     previous.Method,
+		Endpoint:   previous.Endpoint,
+		Actor:      actor,
+		RemoteAddr: remoteAddr,
+	}
+	if err := s.commit(entry, func() { s.toggles[k] = previous }); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// commit persists the toggles and then writes the audit entry, so the audit trail never records a
+// change that did not happen. On failure, the change is undone with the rollback function. It must be
+// called with the lock held
+func (s *Store) commit(entry AuditEntry, rollback func()) error {
+	if err := s.persist(); err != nil {
+		rollback()
+		return fmt.Errorf("toggle: writing the state file: %s", err.Error())
+	}
+	if err := s.writeAudit(entry); err != nil {
+		rollback()
+		_ = s.persist()
+		return fmt.Errorf("toggle: writing the audit trail: %s", err.Error())
+	}
+	return nil
+}
+
+func (s *Store) writeAudit(entry AuditEntry) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	if s.auditFile == "" {
+		_, err = s.audit.Write(b)
+		return err
+	}
+	f, err := os.OpenFile(s.auditFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// persist replaces the state file atomically, so a crash never leaves it half written
+func (s *Store) persist() error {
+	if s.stateFile == "" {
+		return nil
+	}
+	state := stateFile{Toggles: make([]Toggle, 0, len(s.toggles))}
+	for _, t := range s.toggles {
+		state.Toggles = append(state.Toggles, t)
+	}
+	sort.Slice(state.Toggles, func(i, j int) bool {
+		return key(state.Toggles[i].Method, state.Toggles[i].Endpoint) < key(state.Toggles[j].Method, state.Toggles[j].Endpoint)
+	})
+	b, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.stateFile), filepath.Base(s.stateFile)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.stateFile); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package toggle
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	cfg := Config{StateFile: filepath.Join(dir, "state.json"), AuditFile: filepath.Join(dir, "audit.log")}
+	s, err := NewStore(cfg, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	s.now = func() time.Time { return time.Date(2021, 10, 17, 12, 0, 0, 0, time.UTC) }
+
+	if _, ok := s.Lookup("GET", "/users/:id"); ok {
+		t.Error("the endpoint should be enabled")
+	}
+	if _, err := s.Disable(Toggle{Method: "get", Endpoint: "/users/{id}", Reason: "incident", DisabledBy: "alice"}, "10.0.0.1:1234"); err != nil {
+		t.Error(err)
+	}
+	if _, err := s.Disable(Toggle{Method: "POST", Endpoint: "/orders"}, ""); err != nil {
+		t.Error(err)
+	}
+	if tg, ok := s.Lookup("GET", "/users/:id"); !ok || tg.Reason != "incident" || tg.Method != "GET" {
+		t.Errorf("unexpected toggle: %+v", tg)
+	}
+	if _, ok := s.Lookup("GET", "/orders"); ok {
+		t.Error("the toggles should match the method")
+	}
+
+	if ok, err := s.Enable("POST", "/orders", "bob", ""); !ok || err != nil {
+		t.Errorf("unexpected result: %v %v", ok, err)
+	}
+	if ok, err := s.Enable("POST", "/orders", "bob", ""); ok || err != nil {
+		t.Errorf("unexpected result: %v %v", ok, err)
+	}
+
+	reloaded, err := NewStore(cfg, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	list := reloaded.List()
+	if len(list) != 1 || list[0].Endpoint != "/users/{id}" || list[0].DisabledBy != "alice" || !list[0].DisabledAt.Equal(s.now()) {
+		t.Errorf("unexpected toggles: %+v", list)
+	}
+
+	b, _ := ioutil.ReadFile(cfg.AuditFile)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 3 {
+		t.Errorf("unexpected audit trail: %s", string(b))
+		return
+	}
+	var entry AuditEntry
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Error(err)
+	}
+	if entry.Action != ActionDisable || entry.Actor != "alice" || entry.RemoteAddr != "10.0.0.1:1234" || entry.Reason != "incident" {
+		t.Errorf("unexpected audit entry: %+v", entry)
+	}
+	if err := json.Unmarshal([]byte(lines[2]), &entry); err != nil {
+		t.Error(err)
+	}
+	if entry.Action != ActionEnable || entry.Actor != "bob" || entry.Method != "POST" || entry.Endpoint != "/orders" {
+		t.Errorf("unexpected audit entry: %+v", entry)
+	}
+}
+
+func TestStore_allEndpoints(t *testing.T) {
+	s, _ := NewStore(Config{}, new(bytes.Buffer))
+	if _, err := s.Disable(Toggle{Method: "GET", Endpoint: AllEndpoints, Response: Response{Body: "maintenance"}}, ""); err != nil {
+		t.Error(err)
+	}
+	if _, err := s.Disable(Toggle{Method: "GET", Endpoint: "/users", Response: Response{Body: "users"}}, ""); err != nil {
+		t.Error(err)
+	}
+	if tg, ok := s.Lookup("DELETE", "/orders"); !ok || tg.Response.Body != "maintenance" {
+		t.Errorf("unexpected toggle: %+v", tg)
+	}
+	if tg, ok := s.Lookup("GET", "/users"); !ok || tg.Response.Body != "users" {
+		t.Errorf("unexpected toggle: %+v", tg)
+	}
+	if ok, _ := s.Enable("", AllEndpoints, "", ""); !ok {
+		t.Error("the maintenance mode should be disabled")
+	}
+	if _, ok := s.Lookup("DELETE", "/orders"); ok {
+		t.Error("the endpoint should be enabled")
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(_ []byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestStore_auditFailure(t *testing.T) {
+	cfg := Config{StateFile: filepath.Join(t.TempDir(), "state.json")}
+	s, _ := NewStore(cfg, failingWriter{})
+	if _, err := s.Disable(Toggle{Method: "GET", Endpoint: "/users"}, ""); err == nil {
+		t.Error("expecting an error")
+	}
+	if _, ok := s.Lookup("GET", "/users"); ok {
+		t.Error("the toggle should not be applied without its audit entry")
+	}
+	reloaded, err := NewStore(cfg, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if list := reloaded.List(); len(list) != 0 {
+		t.Errorf("the toggle should not be persisted without its audit entry: %+v", list)
+	}
+}
+
+func TestStore_persistFailure(t *testing.T) {
+	audit := new(bytes.Buffer)
+	s, _ := NewStore(Config{StateFile: filepath.Join(t.TempDir(), "missing", "state.json")}, audit)
+	if _, err := s.Disable(Toggle{Method: "GET", Endpoint: "/users"}, ""); err == nil {
+		t.Error("expecting an error")
+	}
+	if _, ok := s.Lookup("GET", "/users"); ok {
+		t.Error("the toggle should not be applied when it can not be persisted")
+	}
+	if audit.Len() != 0 {
+		t.Errorf("the audit trail should not record a change that did not happen: %s", audit.String())
+	}
+}
+
+func TestStore_errors(t *testing.T) {
+	s, _ := NewStore(Config{}, new(bytes.Buffer))
+	if _, err := s.Disable(Toggle{Method: "GET"}, ""); err == nil {
+		t.Error("expecting an error")
+	}
+	if _, err := s.Disable(Toggle{Method: "GET", Endpoint: "/a", Response: Response{Status: 1}}, ""); err == nil {
+		t.Error("expecting an error")
+	}
+
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	if err := ioutil.WriteFile(stateFile, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewStore(Config{StateFile: stateFile}, nil); err == nil {
+		t.Error("expecting an error")
+	}
+
+	for _, state := range []string{
+		`{"toggles":[{"method":"GET","endpoint":"/a","response":{"status":1}}]}`,
+		`{"toggles":[{"method":"GET","response":{"status":503}}]}`,
+	} {
+		if err := ioutil.WriteFile(stateFile, []byte(state), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewStore(Config{StateFile: stateFile}, nil); err == nil {
+			t.Errorf("expecting an error loading %s", state)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package toggle switches off endpoints at runtime, answering with a maintenance response instead of
+// calling their proxy stack
+package toggle
+
+import (
+	"fmt"
+	"github.com/starvn/turbo/config"
+	"github.com/starvn/turbo/ratelimit"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	Namespace = "github.com/starvn/turbo/toggle"
+	// AllEndpoints disables every endpoint of the gateway, whatever their method
+	AllEndpoints = "*"
+
+	defaultContentType = "application/json"
+)
+
+// Response is the answer of a disabled endpoint. The zero fields are taken from the extra config of
+// the endpoint, then from the service one
+type Response struct {
+	Status      int    `json:"status,omitempty"`
+	Body        string `json:"body,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	RetryAfter  string `json:"retry_after,omitempty"`
+}
+
+func (r Response) Validate() error {
+	if r.Status != 0 && (r.Status < 100 || r.Status > 599) {
+		return fmt.Errorf("status: invalid status code %d", r.Status)
+	}
+	if r.RetryAfter == "" {
+		return nil
+	}
+	if d, err := time.ParseDuration(r.RetryAfter); err != nil || d < 0 {
+		return fmt.Errorf("retry_after: invalid duration %q", r.RetryAfter)
+	}
+	return nil
+}
+
+func (r Response) merge(fallback Response) Response {
+	if r.Status == 0 {
+		r.Status = fallback.Status
+	}
+	if r.Body == "" {
+		r.Body = fallback.Body
+	}
+	if r.ContentType == "" {
+		r.ContentType = fallback.ContentType
+	}
+	if r.RetryAfter == "" {
+		r.RetryAfter = fallback.RetryAfter
+	}
+	return r
+}
+
+// Write sends the response, adding the Retry-After header when it is configured
+func (r Response) Write(w http.ResponseWriter) {
+	if d, err := time.ParseDuration(r.RetryAfter); err == nil {
+		w.Header().Set("Retry-After", ratelimit.RetryAfter(d))
+	}
+	status := r.Status
+	if status == 0 {
+		status = http.StatusServiceUnavailable
+	}
+	if r.Body == "" {
+		w.WriteHeader(status)
+		return
+	}
+	contentType := r.ContentType
+	if contentType == "" {
+		contentType = defaultContentType
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(r.Body))
+}
+
+// Config is the service extra config of the namespace. The response is the default one of the
+// disabled endpoints, the toggles are persisted to the state file and the audit trail is appended to
+// the audit file
+type Config struct {
+	Response
+	StateFile string `json:"state_file"`
+	AuditFile string `json:"audit_file"`
+}
+
+func (c Config) Validate() error {
+	return c.Response.Validate()
+}
+
+// GetConfig decodes the service extra config of the namespace, returning the zero config if it is
+// not defined
+func GetConfig(extra config.ExtraConfig) (Config, error) {
+	cfg := Config{}
+	v, ok := extra[Namespace]
+	if !ok {
+		return cfg, nil
+	}
+	if err := config.DecodeExtraConfig(v, &cfg); err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.Validate()
+}
+
+func init() {
+	config.RegisterExtraConfigValidator(Namespace, config.ServiceScope|config.EndpointScope, validateExtraConfig)
+}
+
+func validateExtraConfig(scope config.ExtraConfigScope, v interface{}) error {
+	if scope == config.ServiceScope {
+		cfg := Config{}
+		if err := config.DecodeExtraConfig(v, &cfg); err != nil {
+			return err
+		}
+		return cfg.Validate()
+	}
+	r := Response{}
+	if err := config.DecodeExtraConfig(v, &r); err != nil {
+		return err
+	}
+	return r.Validate()
+}
+
+var pathParam = regexp.MustCompile(`{([^/{}]+)}`)
+
+// NormalizePath translates the params of the path to the colon syntax, so the endpoints are matched
+// whatever the routing pattern of the router
+func NormalizePath(path string) string {
+	return pathParam.ReplaceAllString(path, ":$1")
+}
+
+func key(method, endpoint string) string {
+	if endpoint == AllEndpoints {
+		return AllEndpoints
+	}
+	return strings.ToUpper(method) + " " + NormalizePath(endpoint)
+}
+
+var (
+	defaultStore   = newMemoryStore()
+	defaultStoreMu = &sync.RWMutex{}
+)
+
+// Default returns the store checked by the endpoint handlers of the routers
+func Default() *Store {
+	defaultStoreMu.RLock()
+	s := defaultStore
+	defaultStoreMu.RUnlock()
+	return s
+}
+
+// SetDefault replaces the store checked by the endpoint handlers of the routers
+func SetDefault(s *Store) {
+	defaultStoreMu.Lock()
+	defaultStore = s
+	defaultStoreMu.Unlock()
+}
+
+// EndpointToggle checks if an endpoint is disabled in the default store
+type EndpointToggle struct {
+	method   string
+	endpoint string
+	response Response
+}
+
+// NewEndpointToggle returns the toggle of the endpoint, with its response defined by the endpoint
+// extra config
+func NewEndpointToggle(cfg *config.EndpointConfig) *EndpointToggle {
+	t := &EndpointToggle{method: cfg.Method, endpoint: cfg.Endpoint}
+	if v, ok := cfg.ExtraConfig[Namespace]; ok {
+		_ = config.DecodeExtraConfig(v, &t.response)
+	}
+	return t
+}
+
+// Disabled returns the response to send if the endpoint is disabled
+func (t *EndpointToggle) Disabled() (Response, bool) {
+	s := Default()
+	toggle, ok := s.Lookup(t.method, t.endpoint)
+	if !ok {
+		return Response{}, false
+	}
+	return toggle.Response.merge(t.response).merge(s.defaults), true
+}
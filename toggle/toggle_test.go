@@ -0,0 +1,152 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package toggle
+
+import (
+	"bytes"
+	"github.com/starvn/turbo/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResponse_Validate(t *testing.T) {
+	for i, tc := range []struct {
+		r   Response
+		err bool
+	}{
+		{Response{}, false},
+		{Response{Status: 503, RetryAfter: "5m"}, false},
+		{Response{Status: 42}, true},
+		{Response{Status: 600}, true},
+		{Response{RetryAfter: "soon"}, true},
+		{Response{RetryAfter: "-1s"}, true},
+	} {
+		if err := tc.r.Validate(); (err != nil) != tc.err {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+		}
+	}
+}
+
+func TestResponse_Write(t *testing.T) {
+	for i, tc := range []struct {
+		r           Response
+		status      int
+		body        string
+		contentType string
+		retryAfter  string
+	}{
+		{Response{}, http.StatusServiceUnavailable, "", "", ""},
+		{Response{Status: 404, RetryAfter: "90s"}, http.StatusNotFound, "", "", "90"},
+		{Response{Body: `{"message":"maintenance"}`}, http.StatusServiceUnavailable, `{"message":"maintenance"}`, "application/json", ""},
+		{Response{Status: 410, Body: "gone", ContentType: "text/plain"}, http.StatusGone, "gone", "text/plain", ""},
+	} {
+		w := httptest.NewRecorder()
+		tc.r.Write(w)
+		if w.Code != tc.status || w.Body.String() != tc.body {
+			t.Errorf("#%d: unexpected response %d %s", i, w.Code, w.Body.String())
+		}
+		if ct := w.Header().Get("Content-Type"); ct != tc.contentType {
+			t.Errorf("#%d: unexpected content type %s", i, ct)
+		}
+		if ra := w.Header().Get("Retry-After"); ra != tc.retryAfter {
+			t.Errorf("#%d: unexpected Retry-After %s", i, ra)
+		}
+	}
+}
+
+func TestNormalizePath(t *testing.T) {
+	for _, tc := range []struct {
+		path, expected string
+	}{
+		{"/users", "/users"},
+		{"/users/:id", "/users/:id"},
+		{"/users/{id}/orders/{order_id}", "/users/:id/orders/:order_id"},
+	} {
+		if res := NormalizePath(tc.path); res != tc.expected {
+			t.Errorf("%s: unexpected result %s", tc.path, res)
+		}
+	}
+}
+
+func TestGetConfig(t *testing.T) {
+	cfg, err := GetConfig(config.ExtraConfig{})
+	if err != nil || cfg.StateFile != "" {
+		t.Errorf("unexpected config: %+v %v", cfg, err)
+	}
+	cfg, err = GetConfig(config.ExtraConfig{Namespace: map[string]interface{}{
+		"state_file":  "state.json",
+		"status":      503.0,
+		"retry_after": "1m",
+	}})
+	if err != nil || cfg.StateFile != "state.json" || cfg.Status != 503 || cfg.RetryAfter != "1m" {
+		t.Errorf("unexpected config: %+v %v", cfg, err)
+	}
+	if _, err := GetConfig(config.ExtraConfig{Namespace: map[string]interface{}{"status": 1.0}}); err == nil {
+		t.Error("expecting an error")
+	}
+}
+
+func TestValidateExtraConfig(t *testing.T) {
+	for i, tc := range []struct {
+		scope config.ExtraConfigScope
+		v     map[string]interface{}
+		err   bool
+	}{
+		{config.ServiceScope, map[string]interface{}{"state_file": "state.json", "body": "{}"}, false},
+		{config.EndpointScope, map[string]interface{}{"status": 410.0, "retry_after": "1h"}, false},
+		{config.EndpointScope, map[string]interface{}{"state_file": "state.json"}, true},
+		{config.ServiceScope, map[string]interface{}{"retry_after": "later"}, true},
+	} {
+		if err := validateExtraConfig(tc.scope, tc.v); (err != nil) != tc.err {
+			t.Errorf("#%d: unexpected error: %v", i, err)
+		}
+	}
+}
+
+func TestEndpointToggle(t *testing.T) {
+	defer SetDefault(Default())
+	s, _ := NewStore(Config{Response: Response{Status: 503, RetryAfter: "1m", Body: "down"}}, new(bytes.Buffer))
+	SetDefault(s)
+
+	endpoint := &config.EndpointConfig{
+		Method:      "GET",
+		Endpoint:    "/users/:id",
+		ExtraConfig: config.ExtraConfig{Namespace: map[string]interface{}{"body": "users are down"}},
+	}
+	et := NewEndpointToggle(endpoint)
+	if _, disabled := et.Disabled(); disabled {
+		t.Error("the endpoint should be enabled")
+	}
+
+	if _, err := s.Disable(Toggle{Method: "get", Endpoint: "/users/{id}", Response: Response{Status: 410}}, ""); err != nil {
+		t.Error(err)
+		return
+	}
+	resp, disabled := et.Disabled()
+	if !disabled {
+		t.Error("the endpoint should be disabled")
+	}
+	if resp.Status != 410 || resp.Body != "users are down" || resp.RetryAfter != "1m" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+
+	other := NewEndpointToggle(&config.EndpointConfig{Method: "POST", Endpoint: "/users/:id"})
+	if _, disabled := other.Disabled(); disabled {
+		t.Error("the endpoint should be enabled")
+	}
+}
@@ -0,0 +1,473 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/starvn/turbo/cache"
+	"github.com/starvn/turbo/config"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const httpCacheKey = "http_cache"
+
+// DefaultRevalidationTTL is the time the stale entries with validators are kept in the store, so they
+// can be revalidated with the backend
+const DefaultRevalidationTTL = time.Hour
+
+// CachedHTTPRequestExecutor wraps the executor with the HTTP cache configured for the backend. It
+// returns the error creating the store of the cache, so a misconfigured cache is never ignored
+func CachedHTTPRequestExecutor(remote *config.Backend, re HTTPRequestExecutor) (HTTPRequestExecutor, error) {
+	storeCfg, revalidationTTL, ok := getHTTPCacheCfg(remote)
+	if !ok {
+		return re, nil
+	}
+
+	maxEntrySize := cache.DefaultMaxEntrySize
+	if n, ok := storeCfg["max_entry_size"].(float64); ok && n > 0 {
+		maxEntrySize = int(n)
+	}
+	name := Namespace + cache.KeySeparator + strings.Join(remote.Host, ",") + remote.URLPattern
+	store, err := cache.NewStore(name, storeCfg)
+	if err != nil {
+		return nil, fmt.Errorf("%s: creating the store of the backend %s: %s", httpCacheKey, remote.URLPattern, err.Error())
+	}
+
+	return newHTTPCacheExecutor(store, maxEntrySize, revalidationTTL, re), nil
+}
+
+// HasHTTPCache tells if the backend enables the HTTP cache of CachedHTTPRequestExecutor
+func HasHTTPCache(remote *config.Backend) bool {
+	_, _, ok := getHTTPCacheCfg(remote)
+	return ok
+}
+
+func getHTTPCacheCfg(remote *config.Backend) (map[string]interface{}, time.Duration, bool) {
+	e, ok := remote.ExtraConfig[Namespace].(map[string]interface{})
+	if !ok {
+		return nil, 0, false
+	}
+
+	storeCfg := map[string]interface{}{}
+	revalidationTTL := DefaultRevalidationTTL
+	switch v := e[httpCacheKey].(type) {
+	case bool:
+		if !v {
+			return nil, 0, false
+		}
+	case map[string]interface{}:
+		if ttl, ok := v["revalidation_ttl"].(string); ok {
+			if d, err := time.ParseDuration(ttl); err == nil && d > 0 {
+				revalidationTTL = d
+			}
+		}
+		if store, ok := v["store"].(map[string]interface{}); ok {
+			storeCfg = store
+			break
+		}
+		for _, k := range []string{"max_items", "max_entry_size"} {
+			if n, ok := v[k]; ok {
+				storeCfg[k] = n
+			}
+		}
+	default:
+		return nil, 0, false
+	}
+	return storeCfg, revalidationTTL, true
+}
+
+func NewHTTPCacheExecutor(store cache.Store, maxEntrySize int, re HTTPRequestExecutor) HTTPRequestExecutor {
+	return newHTTPCacheExecutor(store, maxEntrySize, DefaultRevalidationTTL, re)
+}
+
+func newHTTPCacheExecutor(store cache.Store, maxEntrySize int, revalidationTTL time.Duration, re HTTPRequestExecutor) HTTPRequestExecutor {
+	c := httpCache{
+		store:           store,
+		maxEntrySize:    maxEntrySize,
+		revalidationTTL: revalidationTTL,
+		next:            re,
+		now:             time.Now,
+	}
+	return c.Do
+}
+
+type httpCache struct {
+	store           cache.Store
+	maxEntrySize    int
+	revalidationTTL time.Duration
+	next            HTTPRequestExecutor
+	now             func() time.Time
+}
+
+func (c httpCache) Do(ctx context.Context, req *http.Request) (*http.Response, error) {
+	key := req.Method + " " + req.URL.String()
+
+	if req.Method != http.MethodGet {
+		resp, err := c.next(ctx, req)
+		if err == nil && !isSafeMethod(req.Method) && resp.StatusCode < 400 {
+			getKey := http.MethodGet + " " + req.URL.String()
+			_ = c.store.Delete(ctx, getKey)
+			_, _ = c.store.PurgeTags(ctx, variantsTag(getKey))
+		}
+		return resp, err
+	}
+
+	reqCC := parseCacheControl(req.Header)
+	if _, ok := reqCC["no-store"]; ok {
+		return c.next(ctx, req)
+	}
+
+	entry, ok := c.load(ctx, key, req)
+	if !ok {
+		return c.fetch(ctx, key, req)
+	}
+
+	_, reqNoCache := reqCC["no-cache"]
+	if !reqNoCache && entry.isFresh(c.now()) {
+		return entry.response(req, c.now()), nil
+	}
+
+	if !entry.hasValidators() {
+		return c.fetch(ctx, key, req)
+	}
+
+	conditional := req.Clone(ctx)
+	if etag := entry.Header.Get("ETag"); etag != "" {
+		conditional.Header.Set("If-None-Match", etag)
+	}
+	if lastModified := entry.Header.Get("Last-Modified"); lastModified != "" {
+		conditional.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	requestTime := c.now()
+	resp, err := c.next(ctx, conditional)
+	if err != nil {
+		return resp, err
+	}
+	if resp.StatusCode != http.StatusNotModified {
+		return c.storeResponse(ctx, key, req, resp, requestTime)
+	}
+	_ = resp.Body.Close()
+
+	for k, vs := range resp.Header {
+		entry.Header[k] = vs
+	}
+	entry.RequestTime = requestTime
+	entry.ResponseTime = c.now()
+	entry.Header.Del("Age")
+	c.save(ctx, key, entry)
+
+	return entry.response(req, c.now()), nil
+}
+
+func (c httpCache) fetch(ctx context.Context, key string, req *http.Request) (*http.Response, error) {
+	requestTime := c.now()
+	resp, err := c.next(ctx, req)
+	if err != nil {
+		return resp, err
+	}
+	return c.storeResponse(ctx, key, req, resp, requestTime)
+}
+
+func (c httpCache) storeResponse(ctx context.Context, key string, req *http.Request, resp *http.Response, requestTime time.Time) (*http.Response, error) {
+	if !isStorable(req, resp) {
+		return resp, nil
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, int64(c.maxEntrySize)+1))
+	if err != nil {
+		_ = resp.Body.Close()
+		return nil, err
+	}
+	if len(body) > c.maxEntrySize {
+		resp.Body = readCloser{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return resp, nil
+	}
+	_ = resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	entry := &httpCacheEntry{
+		StatusCode:   resp.StatusCode,
+		Header:       resp.Header.Clone(),
+		Body:         body,
+		RequestTime:  requestTime,
+		ResponseTime: c.now(),
+		Vary:         map[string]string{},
+	}
+	for _, name := range varyHeaders(resp.Header) {
+		entry.Vary[name] = strings.Join(req.Header.Values(name), ",")
+	}
+	c.save(ctx, key, entry)
+
+	return resp, nil
+}
+
+func (c httpCache) load(ctx context.Context, key string, req *http.Request) (*httpCacheEntry, bool) {
+	entry, ok := c.get(ctx, key)
+	if !ok {
+		return nil, false
+	}
+	if len(entry.VaryHeaders) > 0 {
+		vary := make(map[string]string, len(entry.VaryHeaders))
+		for _, name := range entry.VaryHeaders {
+			vary[name] = strings.Join(req.Header.Values(name), ",")
+		}
+		if entry, ok = c.get(ctx, variantKey(key, vary)); !ok {
+			return nil, false
+		}
+	}
+	for name, value := range entry.Vary {
+		if strings.Join(req.Header.Values(name), ",") != value {
+			return nil, false
+		}
+	}
+	return entry, true
+}
+
+func (c httpCache) get(ctx context.Context, key string) (*httpCacheEntry, bool) {
+	b, err := c.store.Get(ctx, key)
+	if err != nil {
+		return nil, false
+	}
+	entry := &httpCacheEntry{}
+	if err := json.Unmarshal(b, entry); err != nil {
+		_ = c.store.Delete(ctx, key)
+		return nil, false
+	}
+	return entry, true
+}
+
+// save stores the entry. The responses with a Vary header are stored under a key of their variant,
+// and the entry of the URL only lists the headers selecting the variant
+func (c httpCache) save(ctx context.Context, key string, entry *httpCacheEntry) {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	ttl := entry.freshnessLifetime() - entry.currentAge(c.now())
+	if entry.hasValidators() {
+		// the entries with validators are still useful once stale, but only for a while
+		if ttl < 0 {
+			ttl = 0
+		}
+		ttl += c.revalidationTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+	if len(entry.Vary) == 0 {
+		_ = c.store.Set(ctx, key, b, ttl)
+		return
+	}
+
+	index := &httpCacheEntry{VaryHeaders: make([]string, 0, len(entry.Vary))}
+	for name := range entry.Vary {
+		index.VaryHeaders = append(index.VaryHeaders, name)
+	}
+	sort.Strings(index.VaryHeaders)
+	ib, err := json.Marshal(index)
+	if err != nil {
+		return
+	}
+	if err := c.store.Set(ctx, variantKey(key, entry.Vary), b, ttl, variantsTag(key)); err != nil {
+		return
+	}
+	_ = c.store.Set(ctx, key, ib, ttl)
+}
+
+func variantKey(key string, vary map[string]string) string {
+	v := url.Values{}
+	for name, value := range vary {
+		v.Set(name, value)
+	}
+	return key + " " + v.Encode()
+}
+
+func variantsTag(key string) string {
+	return httpCacheKey + ":" + key
+}
+
+type httpCacheEntry struct {
+	StatusCode   int               `json:"status_code"`
+	Header       http.Header       `json:"header"`
+	Body         []byte            `json:"body"`
+	RequestTime  time.Time         `json:"request_time"`
+	ResponseTime time.Time         `json:"response_time"`
+	Vary         map[string]string `json:"vary,omitempty"`
+	// VaryHeaders is only set in the entries of the URLs with variants
+	VaryHeaders []string `json:"vary_headers,omitempty"`
+}
+
+func (e *httpCacheEntry) hasValidators() bool {
+	return e.Header.Get("ETag") != "" || e.Header.Get("Last-Modified") != ""
+}
+
+func (e *httpCacheEntry) isFresh(now time.Time) bool {
+	cc := parseCacheControl(e.Header)
+	if _, ok := cc["no-cache"]; ok {
+		return false
+	}
+	return e.freshnessLifetime() > e.currentAge(now)
+}
+
+func (e *httpCacheEntry) freshnessLifetime() time.Duration {
+	cc := parseCacheControl(e.Header)
+	for _, directive := range []string{"s-maxage", "max-age"} {
+		if v, ok := cc[directive]; ok {
+			if seconds, err := strconv.Atoi(v); err == nil {
+				return time.Duration(seconds) * time.Second
+			}
+			return 0
+		}
+	}
+
+	expires, err := http.ParseTime(e.Header.Get("Expires"))
+	if err != nil {
+		return 0
+	}
+	date, err := http.ParseTime(e.Header.Get("Date"))
+	if err != nil {
+		date = e.ResponseTime
+	}
+	return expires.Sub(date)
+}
+
+func (e *httpCacheEntry) currentAge(now time.Time) time.Duration {
+	age := time.Duration(0)
+	if seconds, err := strconv.Atoi(e.Header.Get("Age")); err == nil && seconds > 0 {
+		age = time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(e.Header.Get("Date")); err == nil {
+		if apparent := e.ResponseTime.Sub(date); apparent > age {
+			age = apparent
+		}
+	}
+	return age + e.ResponseTime.Sub(e.RequestTime) + now.Sub(e.ResponseTime)
+}
+
+func (e *httpCacheEntry) response(req *http.Request, now time.Time) *http.Response {
+	header := e.Header.Clone()
+	header.Set("Age", strconv.Itoa(int(e.currentAge(now).Seconds())))
+	return &http.Response{
+		Status:        strconv.Itoa(e.StatusCode) + " " + http.StatusText(e.StatusCode),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+var cacheableStatusCodes = map[int]struct{}{
+	http.StatusOK:                   {},
+	http.StatusNonAuthoritativeInfo: {},
+	http.StatusNoContent:            {},
+	http.StatusMultipleChoices:      {},
+	http.StatusMovedPermanently:     {},
+	http.StatusNotFound:             {},
+	http.StatusMethodNotAllowed:     {},
+	http.StatusGone:                 {},
+	http.StatusRequestURITooLong:    {},
+	http.StatusNotImplemented:       {},
+}
+
+func isStorable(req *http.Request, resp *http.Response) bool {
+	if _, ok := cacheableStatusCodes[resp.StatusCode]; !ok {
+		return false
+	}
+	cc := parseCacheControl(resp.Header)
+	if _, ok := cc["no-store"]; ok {
+		return false
+	}
+	if _, ok := cc["private"]; ok {
+		return false
+	}
+	if req.Header.Get("Authorization") != "" {
+		_, public := cc["public"]
+		_, sMaxAge := cc["s-maxage"]
+		_, mustRevalidate := cc["must-revalidate"]
+		if !public && !sMaxAge && !mustRevalidate {
+			return false
+		}
+	}
+	for _, name := range varyHeaders(resp.Header) {
+		if name == "*" {
+			return false
+		}
+	}
+
+	if resp.Header.Get("ETag") != "" || resp.Header.Get("Last-Modified") != "" {
+		return true
+	}
+	_, maxAge := cc["max-age"]
+	_, sMaxAge := cc["s-maxage"]
+	return maxAge || sMaxAge || resp.Header.Get("Expires") != ""
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions || method == http.MethodTrace
+}
+
+func varyHeaders(h http.Header) []string {
+	var names []string
+	for _, v := range h.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	return names
+}
+
+func parseCacheControl(h http.Header) map[string]string {
+	cc := map[string]string{}
+	for _, v := range h.Values("Cache-Control") {
+		for _, directive := range strings.Split(v, ",") {
+			directive = strings.TrimSpace(directive)
+			if directive == "" {
+				continue
+			}
+			parts := strings.SplitN(directive, "=", 2)
+			name := strings.ToLower(strings.TrimSpace(parts[0]))
+			if len(parts) == 1 {
+				cc[name] = ""
+				continue
+			}
+			cc[name] = strings.Trim(strings.TrimSpace(parts[1]), `"`)
+		}
+	}
+	return cc
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,338 @@
+/*
+ * Copyright (c) 2021 Huy Duc Dao
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"github.com/starvn/turbo/cache"
+	"github.com/starvn/turbo/config"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newHTTPCacheTestExecutor(t *testing.T, extra interface{}) HTTPRequestExecutor {
+	re, err := CachedHTTPRequestExecutor(
+		&config.Backend{ExtraConfig: config.ExtraConfig{Namespace: map[string]interface{}{httpCacheKey: extra}}},
+		DefaultHTTPRequestExecutor(NewHTTPClient),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	return re
+}
+
+func doHTTPCacheTestRequest(t *testing.T, re HTTPRequestExecutor, method, url string, headers map[string]string) (int, string) {
+	req, _ := http.NewRequest(method, url, nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := re(context.Background(), req)
+	if err != nil {
+		t.Error("unexpected error:", err.Error())
+		return 0, ""
+	}
+	b, _ := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	return resp.StatusCode, string(b)
+}
+
+func TestCachedHTTPRequestExecutor_disabled(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = fmt.Fprint(w, atomic.AddInt32(&calls, 1))
+	}))
+	defer ts.Close()
+
+	re, err := CachedHTTPRequestExecutor(&config.Backend{}, DefaultHTTPRequestExecutor(NewHTTPClient))
+	if err != nil {
+		t.Error("unexpected error:", err.Error())
+		return
+	}
+	doHTTPCacheTestRequest(t, re, http.MethodGet, ts.URL, nil)
+	doHTTPCacheTestRequest(t, re, http.MethodGet, ts.URL, nil)
+
+	re = newHTTPCacheTestExecutor(t, false)
+	doHTTPCacheTestRequest(t, re, http.MethodGet, ts.URL, nil)
+
+	if calls != 3 {
+		t.Errorf("unexpected number of calls: %d", calls)
+	}
+}
+
+func TestCachedHTTPRequestExecutor_maxAge(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=60")
+		_, _ = fmt.Fprint(w, atomic.AddInt32(&calls, 1))
+	}))
+	defer ts.Close()
+
+	re := newHTTPCacheTestExecutor(t, true)
+	for i := 0; i < 3; i++ {
+		if status, body := doHTTPCacheTestRequest(t, re, http.MethodGet, ts.URL, nil); status != 200 || body != "1" {
+			t.Errorf("#%d: unexpected response: %d %s", i, status, body)
+		}
+	}
+
+	if _, body := doHTTPCacheTestRequest(t, re, http.MethodGet, ts.URL, map[string]string{"Cache-Control": "no-store"}); body != "2" {
+		t.Errorf("unexpected body: %s", body)
+	}
+
+	doHTTPCacheTestRequest(t, re, http.MethodPost, ts.URL, nil)
+	if _, body := doHTTPCacheTestRequest(t, re, http.MethodGet, ts.URL, nil); body != "4" {
+		t.Errorf("the unsafe request should have invalidated the entry. body: %s", body)
+	}
+}
+
+func TestCachedHTTPRequestExecutor_revalidation(t *testing.T) {
+	var calls, revalidations int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Cache-Control", "no-cache")
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			atomic.AddInt32(&revalidations, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		_, _ = fmt.Fprint(w, "content")
+	}))
+	defer ts.Close()
+
+	re := newHTTPCacheTestExecutor(t, map[string]interface{}{"max_items": 10.0})
+	for i := 0; i < 3; i++ {
+		if status, body := doHTTPCacheTestRequest(t, re, http.MethodGet, ts.URL, nil); status != 200 || body != "content" {
+			t.Errorf("#%d: unexpected response: %d %s", i, status, body)
+		}
+	}
+
+	if calls != 3 {
+		t.Errorf("unexpected number of calls: %d", calls)
+	}
+	if revalidations != 2 {
+		t.Errorf("unexpected number of revalidations: %d", revalidations)
+	}
+}
+
+func TestCachedHTTPRequestExecutor_lastModified(t *testing.T) {
+	var revalidations int32
+	lastModified := "Mon, 02 Jan 2006 15:04:05 GMT"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Last-Modified", lastModified)
+		if r.Header.Get("If-Modified-Since") == lastModified {
+			atomic.AddInt32(&revalidations, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		_, _ = fmt.Fprint(w, "content")
+	}))
+	defer ts.Close()
+
+	re := newHTTPCacheTestExecutor(t, true)
+	for i := 0; i < 2; i++ {
+		if status, body := doHTTPCacheTestRequest(t, re, http.MethodGet, ts.URL, nil); status != 200 || body != "content" {
+			t.Errorf("#%d: unexpected response: %d %s", i, status, body)
+		}
+	}
+	if revalidations != 1 {
+		t.Errorf("unexpected number of revalidations: %d", revalidations)
+	}
+}
+
+func TestCachedHTTPRequestExecutor_notStorable(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		headers map[string]string
+		req     map[string]string
+	}{
+		{name: "no-store", headers: map[string]string{"Cache-Control": "no-store, max-age=60"}},
+		{name: "private", headers: map[string]string{"Cache-Control": "private, max-age=60"}},
+		{name: "vary-star", headers: map[string]string{"Cache-Control": "max-age=60", "Vary": "*"}},
+		{name: "no-freshness", headers: map[string]string{}},
+		{name: "authorization", headers: map[string]string{"Cache-Control": "max-age=60"}, req: map[string]string{"Authorization": "Bearer x"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls int32
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for k, v := range tc.headers {
+					w.Header().Set(k, v)
+				}
+				_, _ = fmt.Fprint(w, atomic.AddInt32(&calls, 1))
+			}))
+			defer ts.Close()
+
+			re := newHTTPCacheTestExecutor(t, true)
+			doHTTPCacheTestRequest(t, re, http.MethodGet, ts.URL, tc.req)
+			doHTTPCacheTestRequest(t, re, http.MethodGet, ts.URL, tc.req)
+
+			if calls != 2 {
+				t.Errorf("unexpected number of calls: %d", calls)
+			}
+		})
+	}
+}
+
+func TestCachedHTTPRequestExecutor_vary(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Language")
+		_, _ = fmt.Fprint(w, r.Header.Get("Accept-Language"))
+	}))
+	defer ts.Close()
+
+	re := newHTTPCacheTestExecutor(t, true)
+	for i, lang := range []string{"en", "en", "vi", "vi", "en"} {
+		if _, body := doHTTPCacheTestRequest(t, re, http.MethodGet, ts.URL, map[string]string{"Accept-Language": lang}); body != lang {
+			t.Errorf("#%d: unexpected body: %s", i, body)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("unexpected number of calls: %d", calls)
+	}
+
+	doHTTPCacheTestRequest(t, re, http.MethodPut, ts.URL, nil)
+	for i, lang := range []string{"en", "vi"} {
+		if _, body := doHTTPCacheTestRequest(t, re, http.MethodGet, ts.URL, map[string]string{"Accept-Language": lang}); body != lang {
+			t.Errorf("#%d: unexpected body: %s", i, body)
+		}
+	}
+	if calls != 5 {
+		t.Errorf("the unsafe request should have invalidated every variant. calls: %d", calls)
+	}
+}
+
+func TestCachedHTTPRequestExecutor_invalidStore(t *testing.T) {
+	for i, store := range []map[string]interface{}{
+		{"driver": "unknown"},
+		{"driver": cache.RedisDriver},
+	} {
+		_, err := CachedHTTPRequestExecutor(
+			&config.Backend{ExtraConfig: config.ExtraConfig{Namespace: map[string]interface{}{httpCacheKey: map[string]interface{}{"store": store}}}},
+			DefaultHTTPRequestExecutor(NewHTTPClient),
+		)
+		if err == nil {
+			t.Errorf("#%d: expecting an error", i)
+		}
+	}
+}
+
+func TestCachedHTTPRequestExecutor_entryTooLarge(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = fmt.Fprint(w, "some content bigger than the limit")
+	}))
+	defer ts.Close()
+
+	re := newHTTPCacheTestExecutor(t, map[string]interface{}{"max_entry_size": 10.0})
+	for i := 0; i < 2; i++ {
+		if _, body := doHTTPCacheTestRequest(t, re, http.MethodGet, ts.URL, nil); body != "some content bigger than the limit" {
+			t.Errorf("#%d: unexpected body: %s", i, body)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("unexpected number of calls: %d", calls)
+	}
+}
+
+func TestCachedHTTPRequestExecutor_store(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = fmt.Fprint(w, atomic.AddInt32(&calls, 1))
+	}))
+	defer ts.Close()
+
+	store := cache.NewLRU(10, 0)
+	cache.RegisterStoreFactory("http-cache-test", func(_ map[string]interface{}) (cache.Store, error) {
+		return store, nil
+	})
+
+	re := newHTTPCacheTestExecutor(t, map[string]interface{}{"store": map[string]interface{}{"driver": "http-cache-test"}})
+	doHTTPCacheTestRequest(t, re, http.MethodGet, ts.URL, nil)
+	doHTTPCacheTestRequest(t, re, http.MethodGet, ts.URL, nil)
+	if store.Len() != 1 {
+		t.Errorf("unexpected store size: %d", store.Len())
+	}
+
+	_, _ = store.Purge(context.Background(), "*")
+	if _, body := doHTTPCacheTestRequest(t, re, http.MethodGet, ts.URL, nil); body != "2" {
+		t.Errorf("unexpected body: %s", body)
+	}
+}
+
+type ttlRecorderStore struct {
+	cache.Store
+	ttls []time.Duration
+}
+
+func (s *ttlRecorderStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration, tags ...string) error {
+	s.ttls = append(s.ttls, ttl)
+	return s.Store.Set(ctx, key, value, ttl, tags...)
+}
+
+func TestCachedHTTPRequestExecutor_revalidationTTL(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if r.URL.Path == "/fresh" {
+			w.Header().Set("Cache-Control", "max-age=60")
+		} else {
+			w.Header().Set("Cache-Control", "no-cache")
+		}
+		_, _ = fmt.Fprint(w, "content")
+	}))
+	defer ts.Close()
+
+	store := &ttlRecorderStore{Store: cache.NewLRU(10, 0)}
+	cache.RegisterStoreFactory("http-cache-ttl-test", func(_ map[string]interface{}) (cache.Store, error) {
+		return store, nil
+	})
+
+	re := newHTTPCacheTestExecutor(t, map[string]interface{}{
+		"revalidation_ttl": "10m",
+		"store":            map[string]interface{}{"driver": "http-cache-ttl-test"},
+	})
+	doHTTPCacheTestRequest(t, re, http.MethodGet, ts.URL+"/stale", nil)
+	doHTTPCacheTestRequest(t, re, http.MethodGet, ts.URL+"/fresh", nil)
+
+	if len(store.ttls) != 2 {
+		t.Errorf("unexpected number of entries: %d", len(store.ttls))
+		return
+	}
+	if store.ttls[0] != 10*time.Minute {
+		t.Errorf("unexpected ttl for the stale entry: %s", store.ttls[0])
+	}
+	if store.ttls[1] <= 10*time.Minute || store.ttls[1] > 11*time.Minute {
+		t.Errorf("unexpected ttl for the fresh entry: %s", store.ttls[1])
+	}
+
+	store.ttls = nil
+	re = NewHTTPCacheExecutor(store, cache.DefaultMaxEntrySize, DefaultHTTPRequestExecutor(NewHTTPClient))
+	doHTTPCacheTestRequest(t, re, http.MethodGet, ts.URL+"/default", nil)
+	if len(store.ttls) != 1 || store.ttls[0] != DefaultRevalidationTTL {
+		t.Errorf("unexpected ttls: %v", store.ttls)
+	}
+}
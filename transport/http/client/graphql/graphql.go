@@ -19,6 +19,7 @@ package graphql
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/starvn/turbo/config"
 	"io"
 	"io/ioutil"
@@ -56,6 +57,25 @@ type Options struct {
 
 var errNoConfigFound = errors.New("graphql: no configuration found")
 
+func init() {
+	config.RegisterExtraConfigType(Namespace, config.BackendScope, Options{})
+}
+
+// Validate checks the operation type and method of the options
+func (o Options) Validate() error {
+	switch OperationType(strings.ToLower(string(o.Type))) {
+	case "", OperationQuery, OperationMutation:
+	default:
+		return fmt.Errorf("type: unknown operation type %q", o.Type)
+	}
+	switch OperationMethod(strings.ToUpper(string(o.Method))) {
+	case "", MethodGet, MethodPost:
+	default:
+		return fmt.Errorf("method: unsupported method %q", o.Method)
+	}
+	return nil
+}
+
 func GetOptions(cfg config.ExtraConfig) (*Options, error) {
 	tmp, ok := cfg[Namespace]
 	if !ok {
@@ -18,6 +18,7 @@ package plugin
 
 import (
 	"context"
+	"errors"
 	"github.com/starvn/turbo/config"
 	"github.com/starvn/turbo/log"
 	"github.com/starvn/turbo/transport/http/client"
@@ -27,6 +28,22 @@ import (
 
 const Namespace = "github.com/starvn/turbo/transport/http/client/executor"
 
+func init() {
+	config.RegisterExtraConfigValidator(Namespace, config.BackendScope, validateExtraConfig)
+}
+
+// validateExtraConfig only checks the plugin name, the rest of the options belong to the plugin
+func validateExtraConfig(_ config.ExtraConfigScope, v interface{}) error {
+	extra, ok := v.(map[string]interface{})
+	if !ok {
+		return errors.New("expected an object")
+	}
+	if _, ok := extra["name"].(string); !ok {
+		return errors.New("name: expected a string")
+	}
+	return nil
+}
+
 func HTTPRequestExecutor(
 	logger log.Logger,
 	next func(*config.Backend) client.HTTPRequestExecutor,
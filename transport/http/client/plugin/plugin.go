@@ -36,6 +36,15 @@ func RegisterClient(
 	clientRegister.Register(Namespace, name, handler)
 }
 
+// ClientNames returns the names of the registered client plugins, sorted
+func ClientNames() []string {
+	r, ok := clientRegister.Get(Namespace)
+	if !ok {
+		return []string{}
+	}
+	return r.Keys()
+}
+
 type Registerer interface {
 	RegisterClients(func(
 		name string,
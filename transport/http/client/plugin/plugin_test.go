@@ -76,3 +76,16 @@ func TestLoadWithLogger(t *testing.T) {
 
 	fmt.Println(buff.String())
 }
+
+func TestClientNames(t *testing.T) {
+	RegisterClient("test-names-client", func(context.Context, map[string]interface{}) (http.Handler, error) {
+		return nil, nil
+	})
+	var found bool
+	for _, name := range ClientNames() {
+		found = found || name == "test-names-client"
+	}
+	if !found {
+		t.Errorf("the client was not listed: %v", ClientNames())
+	}
+}
@@ -20,15 +20,55 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"github.com/starvn/turbo/config"
 	"io/ioutil"
 	"net/http"
+	"time"
 )
 
 const Namespace = "github.com/starvn/turbo/transport/http/client"
 
 var ErrInvalidStatusCode = errors.New("Invalid status code")
 
+func init() {
+	config.RegisterExtraConfigValidator(Namespace, config.BackendScope, validateExtraConfig)
+}
+
+type extraConfig struct {
+	ReturnErrorDetails string      `json:"return_error_details"`
+	ReturnErrorCode    bool        `json:"return_error_code"`
+	HTTPCache          interface{} `json:"http_cache"`
+}
+
+type httpCacheExtraConfig struct {
+	Store           map[string]interface{} `json:"store"`
+	MaxItems        int                    `json:"max_items"`
+	MaxEntrySize    int                    `json:"max_entry_size"`
+	RevalidationTTL string                 `json:"revalidation_ttl"`
+}
+
+func validateExtraConfig(_ config.ExtraConfigScope, v interface{}) error {
+	cfg := extraConfig{}
+	if err := config.DecodeExtraConfig(v, &cfg); err != nil {
+		return err
+	}
+	switch cfg.HTTPCache.(type) {
+	case nil, bool:
+		return nil
+	}
+	cacheCfg := httpCacheExtraConfig{}
+	if err := config.DecodeExtraConfig(cfg.HTTPCache, &cacheCfg); err != nil {
+		return fmt.Errorf("%s: %s", httpCacheKey, err.Error())
+	}
+	if cacheCfg.RevalidationTTL != "" {
+		if d, err := time.ParseDuration(cacheCfg.RevalidationTTL); err != nil || d <= 0 {
+			return fmt.Errorf("%s: invalid revalidation_ttl %q", httpCacheKey, cacheCfg.RevalidationTTL)
+		}
+	}
+	return nil
+}
+
 type HTTPStatusHandler func(context.Context, *http.Response) (*http.Response, error)
 
 func GetHTTPStatusHandler(remote *config.Backend) HTTPStatusHandler {
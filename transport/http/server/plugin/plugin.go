@@ -36,6 +36,15 @@ func RegisterHandler(
 	serverRegister.Register(Namespace, name, handler)
 }
 
+// HandlerNames returns the names of the registered handler plugins, sorted
+func HandlerNames() []string {
+	r, ok := serverRegister.Get(Namespace)
+	if !ok {
+		return []string{}
+	}
+	return r.Keys()
+}
+
 type Registerer interface {
 	RegisterHandlers(func(
 		name string,
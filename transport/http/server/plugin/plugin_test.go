@@ -91,3 +91,16 @@ func TestLoadWithLogger(t *testing.T) {
 
 	fmt.Println(buff.String())
 }
+
+func TestHandlerNames(t *testing.T) {
+	RegisterHandler("test-names-handler", func(context.Context, map[string]interface{}, http.Handler) (http.Handler, error) {
+		return nil, nil
+	})
+	var found bool
+	for _, name := range HandlerNames() {
+		found = found || name == "test-names-handler"
+	}
+	if !found {
+		t.Errorf("the handler was not listed: %v", HandlerNames())
+	}
+}
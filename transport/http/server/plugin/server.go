@@ -18,6 +18,7 @@ package plugin
 
 import (
 	"context"
+	"errors"
 	"github.com/starvn/turbo/config"
 	"github.com/starvn/turbo/log"
 	"net/http"
@@ -28,6 +29,31 @@ const logPrefix = "[PLUGIN: Server]"
 
 type RunServer func(context.Context, config.ServiceConfig, http.Handler) error
 
+func init() {
+	config.RegisterExtraConfigValidator(Namespace, config.ServiceScope, validateExtraConfig)
+}
+
+// validateExtraConfig only checks the plugin names, the rest of the options belong to the plugins
+func validateExtraConfig(_ config.ExtraConfigScope, v interface{}) error {
+	extra, ok := v.(map[string]interface{})
+	if !ok {
+		return errors.New("expected an object")
+	}
+	if _, ok := extra["name"].(string); ok {
+		return nil
+	}
+	names, ok := extra["name"].([]interface{})
+	if !ok {
+		return errors.New("name: expected a string or an array of strings")
+	}
+	for _, name := range names {
+		if _, ok := name.(string); !ok {
+			return errors.New("name: expected a string or an array of strings")
+		}
+	}
+	return nil
+}
+
 func New(logger log.Logger, next RunServer) RunServer {
 	return func(ctx context.Context, cfg config.ServiceConfig, handler http.Handler) error {
 		v, ok := cfg.ExtraConfig[Namespace]